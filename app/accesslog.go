@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessEntry is one served request, attributed to a Tailscale identity
+// where there is one.
+type accessEntry struct {
+	Seq       uint64 // position in the log, from 1
+	Time      time.Time
+	ClientIP  string
+	Login     string
+	Node      string
+	Method    string
+	Path      string // request URI, including the query
+	Proto     string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	UserAgent string
+	Referer   string
+}
+
+// accessLog keeps the most recent requests in memory, oldest overwritten
+// first.
+type accessLog struct {
+	mu      sync.Mutex
+	entries []accessEntry
+	next    int
+	full    bool
+	seq     uint64
+}
+
+func newAccessLog(size int) *accessLog {
+	return &accessLog{entries: make([]accessEntry, size)}
+}
+
+func (l *accessLog) add(e accessEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// snapshot returns the recorded entries, oldest first.
+func (l *accessLog) snapshot() []accessEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]accessEntry{}, l.entries[:l.next]...)
+	}
+	return append(append([]accessEntry{}, l.entries[l.next:]...), l.entries[:l.next]...)
+}
+
+// since returns the entries recorded after seq that are still held, oldest
+// first.
+func (l *accessLog) since(seq uint64) []accessEntry {
+	entries := l.snapshot()
+	for i, e := range entries {
+		if e.Seq > seq {
+			return entries[i:]
+		}
+	}
+	return nil
+}
+
+// logAccess records every request next serves in the access log,
+// including those guestMode turns away, and logs it at LOG_LEVEL=debug.
+func (s *Server) logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := s.accessLog
+		debug := s.live().logLevel == "debug"
+		if l == nil && !debug {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		started := s.clock.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		e := accessEntry{
+			Time:      started,
+			ClientIP:  clientIP(r),
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Status:    rec.status(),
+			Bytes:     rec.bytes,
+			Duration:  s.clock.Now().Sub(started),
+			UserAgent: r.UserAgent(),
+			Referer:   r.Referer(),
+		}
+		if who, err := s.tailscaleWhois(r.Context(), r); err == nil {
+			e.Login, e.Node = who.LoginName, who.NodeName
+		}
+		if debug {
+			login := e.Login
+			if login == "" {
+				login = "-"
+			}
+			log.Printf("%s %s %d %dB %s %s", e.Method, e.Path, e.Status, e.Bytes, e.Duration.Round(time.Microsecond), login)
+		}
+		if l != nil {
+			l.add(e)
+		}
+	})
+}
+
+// accessLogFormats writes access entries in a log format that existing
+// analysis tools read.
+var accessLogFormats = map[string]func(w io.Writer, entries []accessEntry, now time.Time) error{
+	"w3c": writeW3CLog,
+	"clf": writeCommonLog,
+}
+
+// writeW3CLog writes entries in the W3C Extended Log File Format, with IIS
+// conventions for the values: "-" when empty and "+" for spaces.
+func writeW3CLog(w io.Writer, entries []accessEntry, now time.Time) error {
+	field := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return strings.ReplaceAll(v, " ", "+")
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#Version: 1.0\n#Software: tailscale-demo %s\n#Date: %s\n", version, now.UTC().Format("2006-01-02 15:04:05"))
+	fmt.Fprintln(bw, "#Fields: date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs-version cs(User-Agent) cs(Referer)")
+	for _, e := range entries {
+		stem, query, _ := strings.Cut(e.Path, "?")
+		fmt.Fprintf(bw, "%s %s %s %s %s %s %s %d %d %.3f %s %s %s\n",
+			e.Time.UTC().Format("2006-01-02"), e.Time.UTC().Format("15:04:05"),
+			field(e.ClientIP), field(e.Login), e.Method, field(stem), field(query),
+			e.Status, e.Bytes, e.Duration.Seconds(), field(e.Proto), field(e.UserAgent), field(e.Referer))
+	}
+	return bw.Flush()
+}
+
+// writeCommonLog writes entries in the NCSA Common Log Format, with the
+// Tailscale login as the authenticated user.
+func writeCommonLog(w io.Writer, entries []accessEntry, now time.Time) error {
+	orDash := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		size := "-"
+		if e.Bytes > 0 {
+			size = strconv.FormatInt(e.Bytes, 10)
+		}
+		fmt.Fprintf(bw, "%s - %s [%s] %q %d %s\n",
+			orDash(e.ClientIP), orDash(e.Login), e.Time.UTC().Format("02/Jan/2006:15:04:05 -0700"),
+			e.Method+" "+e.Path+" "+e.Proto, e.Status, size)
+	}
+	return bw.Flush()
+}
+
+// accessLogExportHandler downloads the in-memory access log for log
+// analysis tools such as GoAccess.
+func (s *Server) accessLogExportHandler(w http.ResponseWriter, r *http.Request) {
+	if s.accessLog == nil {
+		http.Error(w, `{"error": "Access log is disabled"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "w3c"
+	}
+	write, ok := accessLogFormats[format]
+	if !ok {
+		http.Error(w, `{"error": "format must be w3c or clf"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := s.clock.Now()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="access-%s.%s.log"`, now.UTC().Format("20060102T150405Z"), format))
+	write(w, s.accessLog.snapshot(), now)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAccessLogRing verifies the access log keeps only the newest entries
+func TestAccessLogRing(t *testing.T) {
+	l := newAccessLog(3)
+	for i := 1; i <= 4; i++ {
+		l.add(accessEntry{Status: i})
+	}
+	got := l.snapshot()
+	if len(got) != 3 || got[0].Status != 2 || got[2].Status != 4 {
+		t.Errorf("snapshot = %+v, want statuses 2, 3, 4", got)
+	}
+}
+
+// TestLogAccess verifies requests are recorded with their caller, status, size and duration
+func TestLogAccess(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	s := &Server{clock: clock, accessLog: newAccessLog(10)}
+	h := s.logAccess(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(250 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/orders?x=1", nil)
+	asServeUser(r, "alice@example.com")
+	r.Header.Set("User-Agent", "curl/8.0")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	entries := s.accessLog.snapshot()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.ClientIP != "127.0.0.1" || e.Login != "alice@example.com" || e.Path != "/api/orders?x=1" ||
+		e.Status != http.StatusCreated || e.Bytes != 5 || e.Duration != 250*time.Millisecond {
+		t.Errorf("entry = %+v", e)
+	}
+
+	// cs-username is never a login the client claimed for itself
+	h.ServeHTTP(httptest.NewRecorder(), asSpoofedUser(httptest.NewRequest(http.MethodGet, "/", nil), "alice@example.com"))
+	if e := s.accessLog.snapshot()[1]; e.ClientIP != "100.64.0.2" || e.Login != "" {
+		t.Errorf("spoofed entry = %+v, want no login", e)
+	}
+}
+
+// TestAccessLogFormats verifies entries are written in the combined and common log formats
+func TestAccessLogFormats(t *testing.T) {
+	entries := []accessEntry{{
+		Time:      time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC),
+		ClientIP:  "100.64.0.1",
+		Login:     "alice@example.com",
+		Method:    http.MethodGet,
+		Path:      "/api/products?category=AI/ML",
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		Bytes:     512,
+		Duration:  1500 * time.Millisecond,
+		UserAgent: "Mozilla/5.0 (X11)",
+	}, {
+		Time:     time.Date(2024, 3, 5, 14, 7, 10, 0, time.UTC),
+		ClientIP: "203.0.113.9",
+		Method:   http.MethodHead,
+		Path:     "/",
+		Proto:    "HTTP/2.0",
+		Status:   200,
+	}}
+
+	var w3c strings.Builder
+	writeW3CLog(&w3c, entries, entries[1].Time)
+	lines := strings.Split(strings.TrimSpace(w3c.String()), "\n")
+	if len(lines) != 6 || !strings.HasPrefix(lines[3], "#Fields: date time c-ip cs-username") {
+		t.Fatalf("w3c log:\n%s", w3c.String())
+	}
+	if want := "2024-03-05 14:07:09 100.64.0.1 alice@example.com GET /api/products category=AI/ML 200 512 1.500 HTTP/1.1 Mozilla/5.0+(X11) -"; lines[4] != want {
+		t.Errorf("w3c line = %q, want %q", lines[4], want)
+	}
+
+	var clf strings.Builder
+	writeCommonLog(&clf, entries, entries[1].Time)
+	want := `100.64.0.1 - alice@example.com [05/Mar/2024:14:07:09 +0000] "GET /api/products?category=AI/ML HTTP/1.1" 200 512
+203.0.113.9 - - [05/Mar/2024:14:07:10 +0000] "HEAD / HTTP/2.0" 200 -
+`
+	if clf.String() != want {
+		t.Errorf("clf log:\n%s\nwant:\n%s", clf.String(), want)
+	}
+}
+
+// TestAccessLogExportFormat verifies the export rejects unknown formats and
+// names the file by format and time
+func TestAccessLogExportFormat(t *testing.T) {
+	s := &Server{clock: newFakeClock(time.Unix(1700000000, 0)), accessLog: newAccessLog(1)}
+
+	w := httptest.NewRecorder()
+	s.accessLogExportHandler(w, httptest.NewRequest(http.MethodGet, "/api/admin/access-log/export?format=json", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	s.accessLogExportHandler(w, httptest.NewRequest(http.MethodGet, "/api/admin/access-log/export?format=clf", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Disposition") != `attachment; filename="access-20231114T221320Z.clf.log"` {
+		t.Errorf("clf export = %d %q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+}
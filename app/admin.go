@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// isAdminRoute reports whether path is restricted to admins.
+func isAdminRoute(path string) bool {
+	return strings.HasPrefix(path, "/api/admin/") || path == "/api/audit" || path == "/api/users" || path == "/api/diagnostics" || path == "/admin" || path == "/api/products/{id}/restore"
+}
+
+// adminRoute guards the admin routes with requireAdmin.
+func (s *Server) adminRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	if _, path, _ := strings.Cut(pattern, " "); !isAdminRoute(path) {
+		return next
+	}
+	return s.requireAdmin(next)
+}
+
+// requireAdmin only lets admins through: callers on a node tagged with one
+// of ADMIN_TAGS, the logins in ADMIN_LOGINS, and callers ROLES makes
+// admins. Without any of them nobody is an admin.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, reasons := s.isAdmin(r); !ok {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("Admin access requires %s (%s)", s.adminRequirement(), strings.Join(reasons, "; ")))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether the caller is an admin, and if not why not.
+func (s *Server) isAdmin(r *http.Request) (bool, []string) {
+	live := s.live()
+	var reasons []string
+	if live.roles != nil {
+		got, who := s.callerRole(r, live.roles)
+		if got >= roleAdmin {
+			return true, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s has the %s role", who, got))
+	} else if len(live.adminLogins) == 0 && len(live.adminTags) == 0 {
+		return false, []string{"no admins are configured"}
+	}
+
+	if len(live.adminTags) > 0 {
+		node, tags, err := s.callerNodeTags(r.Context(), r)
+		switch {
+		case err != nil:
+			reasons = append(reasons, "node tags unavailable: "+err.Error())
+		case live.hasAdminTag(tags):
+			return true, nil
+		case len(tags) == 0:
+			reasons = append(reasons, fmt.Sprintf("node %s is untagged", node))
+		default:
+			reasons = append(reasons, fmt.Sprintf("node %s is tagged %s", node, strings.Join(tags, ", ")))
+		}
+	}
+	if len(live.adminLogins) > 0 {
+		who, err := s.tailscaleWhois(r.Context(), r)
+		switch {
+		case err != nil:
+			reasons = append(reasons, "no Tailscale identity: "+err.Error())
+		case live.adminLogins[strings.ToLower(who.LoginName)]:
+			return true, nil
+		default:
+			reasons = append(reasons, who.LoginName+" is not an admin login")
+		}
+	}
+	return false, reasons
+}
+
+// adminRequirement describes who may use the admin routes.
+func (s *Server) adminRequirement() string {
+	live := s.live()
+	var who []string
+	if len(live.adminTags) > 0 {
+		who = append(who, "a node tagged "+strings.Join(live.adminTags, " or "))
+	}
+	if len(live.adminLogins) > 0 {
+		who = append(who, "a login in ADMIN_LOGINS")
+	}
+	if live.roles != nil {
+		who = append(who, "the admin role")
+	}
+	if len(who) == 0 {
+		return "ADMIN_TAGS, ADMIN_LOGINS or ROLES to be set"
+	}
+	return strings.Join(who, " or ")
+}
+
+// hasAdminTag reports whether tags include one of ADMIN_TAGS.
+func (c *liveConfig) hasAdminTag(tags []string) bool {
+	for _, tag := range tags {
+		if slices.Contains(c.adminTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// callerNodeTags returns the name and ACL tags of the caller's node. Tags
+// come from WhoIs, so they are only known in tsnet mode; Tailscale Serve
+// identity headers do not carry them.
+func (s *Server) callerNodeTags(ctx context.Context, r *http.Request) (string, []string, error) {
+	if isGuestRequest(r) {
+		return "", nil, errGuest
+	}
+	if s.client == nil {
+		return "", nil, errors.New("node tags are only known in tsnet mode")
+	}
+	whois, err := s.lookupWhoIs(ctx, r.RemoteAddr)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to identify node via tsnet: %w", err)
+	}
+	return whois.Node.ComputedName, whois.Node.Tags, nil
+}
+
+// callerLogin returns the caller's Tailscale login, as tailscaleWhois
+// identifies it, for keying their own data. If there is none it writes a
+// 403 saying that what (such as "Orders") requires an identity.
+func (s *Server) callerLogin(w http.ResponseWriter, r *http.Request, what string) (string, bool) {
+	who, err := s.tailscaleWhois(r.Context(), r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, what+" require a Tailscale identity: "+err.Error())
+		return "", false
+	}
+	return who.LoginName, true
+}
+
+// loginSet builds a case-insensitive set of logins.
+func loginSet(logins []string) map[string]bool {
+	set := map[string]bool{}
+	for _, l := range logins {
+		if l = strings.TrimSpace(l); l != "" {
+			set[strings.ToLower(l)] = true
+		}
+	}
+	return set
+}
+
+// tagList normalizes ACL tags, adding the tag: prefix where it is missing.
+func tagList(tags []string) []string {
+	var list []string
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !strings.HasPrefix(t, "tag:") {
+			t = "tag:" + t
+		}
+		list = append(list, t)
+	}
+	return list
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestRequireAdmin verifies only ADMIN_LOGINS may use the admin routes when it is set
+func TestRequireAdmin(t *testing.T) {
+	s := &Server{}
+	h := s.adminRoute("GET /api/audit", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	request := func(login string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+		if login != "" {
+			asServeUser(r, login)
+		}
+		return r
+	}
+
+	// Without ADMIN_LOGINS, ADMIN_TAGS or ROLES nobody is an admin
+	for _, login := range []string{"", "alice@example.com"} {
+		w := httptest.NewRecorder()
+		h(w, request(login))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("no admins configured, login %q: status %d", login, w.Code)
+		}
+		if body := w.Body.String(); !strings.Contains(body, "ADMIN_TAGS, ADMIN_LOGINS or ROLES") {
+			t.Errorf("no admins configured, login %q: body %s", login, body)
+		}
+	}
+
+	s.setLive(&liveConfig{adminLogins: loginSet([]string{" Alice@example.com ", ""})})
+	for login, want := range map[string]int{
+		"alice@example.com": http.StatusTeapot,
+		"bob@example.com":   http.StatusForbidden,
+		"":                  http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		h(w, request(login))
+		if w.Code != want {
+			t.Errorf("login %q: status %d, want %d", login, w.Code, want)
+		}
+	}
+
+	// Other routes are not guarded
+	h = s.adminRoute("GET /api/products", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	h(w, request(""))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("public route: status %d", w.Code)
+	}
+}
+
+// TestRequireAdminTags verifies callers on nodes with one of ADMIN_TAGS are admins
+func TestRequireAdminTags(t *testing.T) {
+	live := &liveConfig{adminTags: tagList([]string{"admin", " tag:ops ", ""})}
+	s := &Server{}
+	s.setLive(live)
+	if want := []string{"tag:admin", "tag:ops"}; !slices.Equal(live.adminTags, want) {
+		t.Fatalf("adminTags = %v, want %v", live.adminTags, want)
+	}
+	if !live.hasAdminTag([]string{"tag:web", "tag:ops"}) || live.hasAdminTag([]string{"tag:web"}) || live.hasAdminTag(nil) {
+		t.Error("hasAdminTag matched the wrong tags")
+	}
+
+	h := s.adminRoute("GET /admin", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	request := func(login string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		asServeUser(r, login)
+		return r
+	}
+
+	// Serve identity headers carry no tags, so only ADMIN_LOGINS can admit
+	// callers outside tsnet mode
+	w := httptest.NewRecorder()
+	h(w, request("alice@example.com"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("tags only: status %d, want 403", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "tag:admin or tag:ops") {
+		t.Errorf("tags only: error %s does not name the tags", body)
+	}
+
+	s.setLive(&liveConfig{adminTags: live.adminTags, adminLogins: loginSet([]string{"alice@example.com"})})
+	for login, want := range map[string]int{
+		"alice@example.com": http.StatusTeapot,
+		"bob@example.com":   http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		h(w, request(login))
+		if w.Code != want {
+			t.Errorf("tags and logins, login %q: status %d, want %d", login, w.Code, want)
+		}
+	}
+}
+
+// TestRequireAdminSpoofedHeader verifies a Tailscale-User-Login header only
+// counts when Tailscale Serve could have set it: not from a tailnet peer,
+// not in tsnet mode and not on the local listeners.
+func TestRequireAdminSpoofedHeader(t *testing.T) {
+	h := func(s *Server) http.HandlerFunc {
+		s.setLive(&liveConfig{adminLogins: loginSet([]string{"alice@example.com"})})
+		return s.adminRoute("GET /api/audit", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}
+	local := func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), localConnKey{}, true))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		s      *Server
+		remote string
+		local  bool
+		want   int
+	}{
+		{"serve on loopback", &Server{}, "127.0.0.1:41641", false, http.StatusTeapot},
+		{"serve on IPv6 loopback", &Server{}, "[::1]:41641", false, http.StatusTeapot},
+		{"tailnet peer", &Server{}, "100.64.0.2:41641", false, http.StatusForbidden},
+		{"tsnet mode", &Server{tsnetMode: true}, "127.0.0.1:41641", false, http.StatusForbidden},
+		{"local listener", &Server{}, "127.0.0.1:41641", true, http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+		r.Header.Set("Tailscale-User-Login", "alice@example.com")
+		r.RemoteAddr = tc.remote
+		if tc.local {
+			r = local(r)
+		}
+		w := httptest.NewRecorder()
+		h(tc.s)(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// advisorQuery is a query in the products workload the index advisor
+// explains, with the index that would best serve it.
+type advisorQuery struct {
+	Name string
+	SQL  string
+	Args []interface{}
+
+	IndexName string
+	CreateSQL string
+}
+
+// advisorWorkload lists the queries the app issues, plus the filter and
+// search queries a products catalogue typically grows.
+var advisorWorkload = []advisorQuery{
+	{
+		Name:      "list newest products",
+		SQL:       `SELECT * FROM products ORDER BY created_at DESC, id DESC LIMIT 100`,
+		IndexName: "idx_products_created_at_id",
+		CreateSQL: `CREATE INDEX CONCURRENTLY idx_products_created_at_id ON products (created_at DESC, id DESC);`,
+	},
+	{
+		Name:      "keyset page",
+		SQL:       `SELECT * FROM products WHERE (created_at, id) < ($1::timestamp, $2) ORDER BY created_at DESC, id DESC LIMIT 100`,
+		Args:      []interface{}{time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), int64(1 << 31)},
+		IndexName: "idx_products_created_at_id",
+		CreateSQL: `CREATE INDEX CONCURRENTLY idx_products_created_at_id ON products (created_at DESC, id DESC);`,
+	},
+	{
+		Name:      "get product by id",
+		SQL:       `SELECT * FROM products WHERE id = $1`,
+		Args:      []interface{}{int64(1)},
+		IndexName: "products_pkey",
+	},
+	{
+		Name:      "filter by category",
+		SQL:       `SELECT * FROM products WHERE category = $1 ORDER BY created_at DESC LIMIT 100`,
+		Args:      []interface{}{"Networking"},
+		IndexName: "idx_products_category",
+		CreateSQL: `CREATE INDEX CONCURRENTLY idx_products_category ON products (category);`,
+	},
+	{
+		Name:      "search by name",
+		SQL:       `SELECT * FROM products WHERE name ILIKE $1 ORDER BY name LIMIT 100`,
+		Args:      []interface{}{"%vpn%"},
+		IndexName: "idx_products_name_trgm",
+		CreateSQL: `CREATE EXTENSION IF NOT EXISTS pg_trgm; CREATE INDEX CONCURRENTLY idx_products_name_trgm ON products USING gin (name gin_trgm_ops);`,
+	},
+}
+
+// IndexReport is the index advisor's findings for the products table.
+type IndexReport struct {
+	Table         TableStats    `json:"table"`
+	Queries       []QueryAdvice `json:"queries"`
+	UnusedIndexes []string      `json:"unused_indexes"`
+	Suggestions   []string      `json:"suggestions"`
+}
+
+// TableStats are the activity counters from pg_stat_user_tables.
+type TableStats struct {
+	LiveRows   int64 `json:"live_rows"`
+	SeqScans   int64 `json:"seq_scans"`
+	SeqTupRead int64 `json:"seq_tuples_read"`
+	IndexScans int64 `json:"index_scans"`
+}
+
+// QueryAdvice describes how the planner executes one workload query.
+type QueryAdvice struct {
+	Name      string   `json:"name"`
+	SQL       string   `json:"sql"`
+	Plan      []string `json:"plan"`
+	TotalCost float64  `json:"total_cost"`
+	UsesIndex bool     `json:"uses_index"`
+	Advice    string   `json:"advice"`
+}
+
+// smallTableRows is the size below which sequential scans are expected and
+// not worth flagging on their own.
+const smallTableRows = 1000
+
+// planNode is the subset of EXPLAIN (FORMAT JSON) output the advisor reads.
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	IndexName    string     `json:"Index Name"`
+	TotalCost    float64    `json:"Total Cost"`
+	Plans        []planNode `json:"Plans"`
+}
+
+// planSummary flattens an EXPLAIN (FORMAT JSON) document into one line per
+// node and reports whether it scans products sequentially or sorts.
+func planSummary(doc []byte) (nodes []string, cost float64, seqScan, sorts bool, err error) {
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(doc, &plans); err != nil {
+		return nil, 0, false, false, err
+	}
+	if len(plans) == 0 {
+		return nil, 0, false, false, fmt.Errorf("empty plan")
+	}
+
+	var walk func(n planNode, depth int)
+	walk = func(n planNode, depth int) {
+		line := strings.Repeat("  ", depth) + n.NodeType
+		if n.IndexName != "" {
+			line += " using " + n.IndexName
+		}
+		if n.RelationName != "" {
+			line += " on " + n.RelationName
+		}
+		nodes = append(nodes, line)
+
+		switch {
+		case n.NodeType == "Seq Scan" && n.RelationName == "products":
+			seqScan = true
+		case n.NodeType == "Sort" || n.NodeType == "Incremental Sort":
+			sorts = true
+		}
+		for _, child := range n.Plans {
+			walk(child, depth+1)
+		}
+	}
+	walk(plans[0].Plan, 0)
+
+	return nodes, plans[0].Plan.TotalCost, seqScan, sorts, nil
+}
+
+// buildIndexReport explains each workload query and compares the plans with
+// the indexes that exist and how they are used.
+func (s *Server) buildIndexReport(ctx context.Context) (*IndexReport, error) {
+	report := &IndexReport{UnusedIndexes: []string{}, Suggestions: []string{}}
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT n_live_tup, seq_scan, seq_tup_read, COALESCE(idx_scan, 0)
+		FROM pg_stat_user_tables
+		WHERE relname = 'products'
+	`).Scan(&report.Table.LiveRows, &report.Table.SeqScans, &report.Table.SeqTupRead, &report.Table.IndexScans)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+
+	existing := map[string]bool{}
+	rows, err := s.db.QueryContext(ctx, `SELECT indexname FROM pg_indexes WHERE tablename = 'products'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT indexrelname
+		FROM pg_stat_user_indexes
+		WHERE relname = 'products' AND idx_scan = 0
+		ORDER BY indexrelname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index statistics: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.UnusedIndexes = append(report.UnusedIndexes, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	suggested := map[string]bool{}
+	for _, q := range advisorWorkload {
+		var doc []byte
+		if err := s.db.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+q.SQL, q.Args...).Scan(&doc); err != nil {
+			return nil, fmt.Errorf("failed to explain %q: %w", q.Name, err)
+		}
+
+		nodes, cost, seqScan, sorts, err := planSummary(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse plan for %q: %w", q.Name, err)
+		}
+
+		advice := QueryAdvice{
+			Name:      q.Name,
+			SQL:       q.SQL,
+			Plan:      nodes,
+			TotalCost: cost,
+			UsesIndex: !seqScan,
+		}
+
+		switch {
+		case !seqScan && !sorts:
+			advice.Advice = "Served by an index"
+		case !existing[q.IndexName] && q.CreateSQL != "":
+			advice.Advice = fmt.Sprintf("Missing index %s", q.IndexName)
+			if !suggested[q.IndexName] {
+				suggested[q.IndexName] = true
+				report.Suggestions = append(report.Suggestions, q.CreateSQL)
+			}
+		case !seqScan:
+			advice.Advice = "Uses an index but still sorts; an index matching the ORDER BY would avoid it"
+		case report.Table.LiveRows < smallTableRows:
+			advice.Advice = fmt.Sprintf("Index %s exists; with %d rows the planner prefers a sequential scan", q.IndexName, report.Table.LiveRows)
+		default:
+			advice.Advice = fmt.Sprintf("Index %s exists but is not used; run ANALYZE products and re-check", q.IndexName)
+		}
+
+		report.Queries = append(report.Queries, advice)
+	}
+
+	return report, nil
+}
+
+func (s *Server) indexReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	report, err := s.buildIndexReport(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
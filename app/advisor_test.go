@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestPlanSummary verifies EXPLAIN JSON is flattened and sequential scans and sorts are detected
+func TestPlanSummary(t *testing.T) {
+	doc := []byte(`[{"Plan": {
+		"Node Type": "Limit", "Total Cost": 12.5,
+		"Plans": [{
+			"Node Type": "Sort", "Total Cost": 12.4,
+			"Plans": [{"Node Type": "Seq Scan", "Relation Name": "products", "Total Cost": 11.0}]
+		}]
+	}}]`)
+
+	nodes, cost, seqScan, sorts, err := planSummary(doc)
+	if err != nil {
+		t.Fatalf("planSummary failed: %v", err)
+	}
+
+	want := []string{"Limit", "  Sort", "    Seq Scan on products"}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("Expected nodes %q, got %q", want, nodes)
+	}
+	if cost != 12.5 || !seqScan || !sorts {
+		t.Errorf("Unexpected summary: cost=%v seqScan=%v sorts=%v", cost, seqScan, sorts)
+	}
+}
+
+// TestPlanSummaryIndexScan verifies index scans are not reported as sequential
+func TestPlanSummaryIndexScan(t *testing.T) {
+	doc := []byte(`[{"Plan": {"Node Type": "Index Scan", "Index Name": "products_pkey", "Relation Name": "products", "Total Cost": 8.1}}]`)
+
+	nodes, _, seqScan, sorts, err := planSummary(doc)
+	if err != nil {
+		t.Fatalf("planSummary failed: %v", err)
+	}
+	if seqScan || sorts {
+		t.Errorf("Expected no seq scan or sort, got seqScan=%v sorts=%v", seqScan, sorts)
+	}
+	if nodes[0] != "Index Scan using products_pkey on products" {
+		t.Errorf("Unexpected node line %q", nodes[0])
+	}
+}
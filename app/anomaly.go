@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const (
+	// anomalyInterval is how often the access log is analyzed, and the
+	// window request spikes are measured over.
+	anomalyInterval = time.Minute
+
+	// A window is a spike if it has at least spikeMinRequests requests and
+	// spikeFactor times the baseline, an exponential moving average over
+	// the previous windows that is trusted after spikeWarmup of them.
+	spikeFactor      = 5
+	spikeMinRequests = 60
+	spikeWarmup      = 5
+	spikeSmoothing   = 0.2
+
+	alertsPageDefault = 50
+	alertsPageMax     = 500
+)
+
+// Alert kinds.
+const (
+	alertNewAdmin   = "new-admin-identity"
+	alertSpike      = "request-spike"
+	alertQuietHours = "unusual-hours"
+)
+
+// quietHours is the daily span, [start, end) in loc, when tailnet users are
+// not expected to be active. start > end spans midnight.
+type quietHours struct {
+	start, end int
+	loc        *time.Location
+}
+
+// parseQuietHours parses "START-END" in whole hours, such as "22-6". An
+// empty spec returns nil, disabling the check.
+func parseQuietHours(spec, tz string) (*quietHours, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	start, err1 := strconv.Atoi(strings.TrimSpace(from))
+	end, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil || start < 0 || start > 23 || end < 0 || end > 23 || start == end {
+		return nil, fmt.Errorf("quiet hours %q must be START-END with different hours from 0 to 23", spec)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("quiet hours time zone: %w", err)
+	}
+	return &quietHours{start: start, end: end, loc: loc}, nil
+}
+
+func (q *quietHours) contains(t time.Time) bool {
+	h := t.In(q.loc).Hour()
+	if q.start < q.end {
+		return h >= q.start && h < q.end
+	}
+	return h >= q.start || h < q.end
+}
+
+// anomalyDetector looks for unusual access in new access log entries: an
+// identity using the admin routes for the first time, a sudden spike in
+// requests, and tailnet users active during quiet hours. Each kind is
+// flagged once per identity (per day, for quiet hours) or window.
+type anomalyDetector struct {
+	quiet *quietHours // nil disables the quiet hours check
+
+	seq       uint64          // last access log entry analyzed
+	adminSeen map[string]bool // subjects that have used admin routes
+	quietSeen map[string]string
+	baseline  float64
+	windows   int
+}
+
+func newAnomalyDetector(quiet *quietHours) *anomalyDetector {
+	return &anomalyDetector{quiet: quiet, adminSeen: map[string]bool{}, quietSeen: map[string]string{}}
+}
+
+// accessSubject identifies who made a request: the login, or the client
+// address if there is none.
+func accessSubject(e accessEntry) string {
+	if e.Login != "" {
+		return e.Login
+	}
+	return e.ClientIP
+}
+
+// analyze returns the alerts raised by entries, the access log entries
+// recorded since the last call.
+func (d *anomalyDetector) analyze(entries []accessEntry, now time.Time) []store.Alert {
+	var alerts []store.Alert
+	alert := func(kind, subject, detail string) {
+		alerts = append(alerts, store.Alert{Time: now, Kind: kind, Subject: subject, Detail: detail})
+	}
+
+	perSubject := map[string]int{}
+	for _, e := range entries {
+		subject := accessSubject(e)
+		perSubject[subject]++
+
+		path, _, _ := strings.Cut(e.Path, "?")
+		if isAdminRoute(path) && !d.adminSeen[subject] {
+			d.adminSeen[subject] = true
+			alert(alertNewAdmin, subject, fmt.Sprintf("First admin request: %s %s (%d)", e.Method, path, e.Status))
+		}
+
+		if d.quiet != nil && e.Login != "" && d.quiet.contains(e.Time) {
+			day := e.Time.In(d.quiet.loc).Format("2006-01-02")
+			if d.quietSeen[e.Login] != day {
+				d.quietSeen[e.Login] = day
+				alert(alertQuietHours, e.Login, fmt.Sprintf("Active at %s during quiet hours %02d:00-%02d:00 %s",
+					e.Time.In(d.quiet.loc).Format("15:04"), d.quiet.start, d.quiet.end, d.quiet.loc))
+			}
+		}
+	}
+
+	// Count by sequence number, as the ring may have overwritten entries
+	// since the last window
+	count := 0
+	if len(entries) > 0 {
+		last := entries[len(entries)-1].Seq
+		count = int(last - d.seq)
+		d.seq = last
+	}
+	if d.windows >= spikeWarmup && count >= spikeMinRequests && float64(count) > spikeFactor*d.baseline {
+		top, topCount := "", 0
+		for subject, n := range perSubject {
+			if n > topCount || (n == topCount && subject < top) {
+				top, topCount = subject, n
+			}
+		}
+		alert(alertSpike, top, fmt.Sprintf("%d requests in %s against a baseline of %.1f; most from %s (%d)",
+			count, anomalyInterval, d.baseline, top, topCount))
+	}
+	if d.windows == 0 {
+		d.baseline = float64(count)
+	} else {
+		d.baseline += spikeSmoothing * (float64(count) - d.baseline)
+	}
+	d.windows++
+
+	return alerts
+}
+
+// runAnomalyDetector analyzes the access log every anomalyInterval until
+// ctx is done, storing the alerts raised.
+func (s *Server) runAnomalyDetector(ctx context.Context, d *anomalyDetector) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(anomalyInterval):
+		}
+
+		for _, a := range d.analyze(s.accessLog.since(d.seq), s.clock.Now()) {
+			log.Printf("Anomaly %s (%s): %s", a.Kind, a.Subject, a.Detail)
+			rctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := s.store.RecordAlert(rctx, a); err != nil {
+				log.Printf("Failed to store %s alert: %v", a.Kind, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// anomaliesHandler lists the stored alerts, newest first.
+func (s *Server) anomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.anomalies == nil {
+		http.Error(w, `{"error": "Anomaly detection is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := alertsPageDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > alertsPageMax {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", alertsPageMax))
+			return
+		}
+		limit = n
+	}
+
+	ctx := r.Context()
+
+	alerts, err := s.store.Alerts(ctx, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query alerts: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(alerts)
+}
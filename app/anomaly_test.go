@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestParseQuietHours verifies quiet hours may wrap past midnight in the given time zone
+func TestParseQuietHours(t *testing.T) {
+	q, err := parseQuietHours("22-6", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hour, want := range map[int]bool{21: false, 22: true, 3: true, 6: false, 12: false} {
+		if got := q.contains(time.Date(2024, 3, 5, hour, 30, 0, 0, time.UTC)); got != want {
+			t.Errorf("%02d:30 quiet = %v, want %v", hour, got, want)
+		}
+	}
+
+	if q, err := parseQuietHours("", "UTC"); q != nil || err != nil {
+		t.Errorf("empty spec = %v, %v; want disabled", q, err)
+	}
+	for _, spec := range []string{"22", "5-5", "25-6", "a-b"} {
+		if _, err := parseQuietHours(spec, "UTC"); err == nil {
+			t.Errorf("parseQuietHours(%q) succeeded", spec)
+		}
+	}
+}
+
+// TestAnomalyDetector verifies new admins, quiet-hour writes and request spikes raise alerts
+func TestAnomalyDetector(t *testing.T) {
+	quiet, _ := parseQuietHours("22-6", "UTC")
+	d := newAnomalyDetector(quiet)
+	day := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	var seq uint64
+	window := func(entries ...accessEntry) []store.Alert {
+		for i := range entries {
+			seq++
+			entries[i].Seq = seq
+			if entries[i].Time.IsZero() {
+				entries[i].Time = day
+			}
+		}
+		return d.analyze(entries, day)
+	}
+	requests := func(n int, login string) []accessEntry {
+		entries := make([]accessEntry, n)
+		for i := range entries {
+			entries[i] = accessEntry{Login: login, ClientIP: "100.64.0.1", Method: "GET", Path: "/api/products"}
+		}
+		return entries
+	}
+
+	// First admin use is flagged once per identity, guests by address
+	alerts := window(
+		accessEntry{Login: "alice@example.com", Method: "GET", Path: "/api/admin/features", Status: 200},
+		accessEntry{Login: "alice@example.com", Method: "GET", Path: "/api/audit?limit=5", Status: 200},
+		accessEntry{ClientIP: "203.0.113.9", Method: "GET", Path: "/api/admin/shaping", Status: 403},
+	)
+	if len(alerts) != 2 || alerts[0].Kind != alertNewAdmin || alerts[0].Subject != "alice@example.com" || alerts[1].Subject != "203.0.113.9" {
+		t.Fatalf("admin alerts = %+v", alerts)
+	}
+
+	// Quiet hours access is flagged once per login per day
+	night := time.Date(2024, 3, 5, 23, 15, 0, 0, time.UTC)
+	alerts = window(
+		accessEntry{Login: "bob@example.com", Time: night, Path: "/"},
+		accessEntry{Login: "bob@example.com", Time: night.Add(time.Minute), Path: "/"},
+		accessEntry{ClientIP: "203.0.113.9", Time: night, Path: "/"},
+	)
+	if len(alerts) != 1 || alerts[0].Kind != alertQuietHours || alerts[0].Subject != "bob@example.com" {
+		t.Fatalf("quiet hours alerts = %+v", alerts)
+	}
+
+	// A steady baseline, then a spike
+	for i := 0; i < spikeWarmup; i++ {
+		if alerts := window(requests(10, "carol@example.com")...); len(alerts) != 0 {
+			t.Fatalf("steady traffic raised %+v", alerts)
+		}
+	}
+	alerts = window(append(requests(100, "mallory@example.com"), requests(5, "carol@example.com")...)...)
+	if len(alerts) != 1 || alerts[0].Kind != alertSpike || alerts[0].Subject != "mallory@example.com" {
+		t.Fatalf("spike alerts = %+v", alerts)
+	}
+
+	// Entries overwritten in the ring still count towards the window
+	seq += 1000
+	if alerts := window(requests(1, "carol@example.com")...); len(alerts) != 1 || alerts[0].Kind != alertSpike {
+		t.Errorf("overwritten spike alerts = %+v", alerts)
+	}
+}
+
+// TestAccessLogSince verifies entries after a sequence number are returned,
+// as far as the log still holds them
+func TestAccessLogSince(t *testing.T) {
+	l := newAccessLog(3)
+	for i := 0; i < 5; i++ {
+		l.add(accessEntry{})
+	}
+	if got := l.since(3); len(got) != 2 || got[0].Seq != 4 {
+		t.Errorf("since(3) = %+v", got)
+	}
+	if got := l.since(0); len(got) != 3 || got[0].Seq != 3 {
+		t.Errorf("since(0) = %+v, want the 3 held entries", got)
+	}
+	if got := l.since(5); len(got) != 0 {
+		t.Errorf("since(5) = %+v", got)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const (
+	// auditQueueSize bounds how many entries may wait to be written. When
+	// the database falls behind, further entries are dropped and logged
+	// rather than slowing down requests.
+	auditQueueSize = 256
+
+	// auditBodyLimit is how much of a request body is inspected for the
+	// payload summary.
+	auditBodyLimit = 64 << 10
+
+	// auditPageDefault and auditPageMax bound /api/audit page sizes.
+	auditPageDefault = 50
+	auditPageMax     = 500
+)
+
+// auditLog writes audit entries to the database in the background.
+type auditLog struct {
+	store   *store.Store
+	reads   bool
+	entries chan store.AuditEntry
+	done    chan struct{}
+}
+
+func newAuditLog(st *store.Store, reads bool) *auditLog {
+	a := &auditLog{
+		store:   st,
+		reads:   reads,
+		entries: make(chan store.AuditEntry, auditQueueSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *auditLog) run() {
+	defer close(a.done)
+	for e := range a.entries {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := a.store.RecordAudit(ctx, e); err != nil {
+			log.Printf("Failed to write audit entry for %s %s: %v", e.Method, e.Path, err)
+		}
+		cancel()
+	}
+}
+
+// record queues e to be written.
+func (a *auditLog) record(e store.AuditEntry) {
+	select {
+	case a.entries <- e:
+	default:
+		log.Printf("Audit queue full, dropping entry for %s %s by %q", e.Method, e.Path, e.Login)
+	}
+}
+
+// Close writes any queued entries and stops the writer.
+func (a *auditLog) Close() {
+	close(a.entries)
+	<-a.done
+}
+
+// isMutating reports whether method changes state.
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// auditRoute records calls to the route pattern in the audit log: every
+// mutating call, and reads too if enabled.
+func (s *Server) auditRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	route := pattern
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		route = path
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := s.audit
+		if a == nil || (!isMutating(r.Method) && !a.reads) {
+			next(w, r)
+			return
+		}
+
+		started := s.clock.Now()
+		var body *capturingReader
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &capturingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		e := store.AuditEntry{
+			Time:   started,
+			Method: r.Method,
+			Route:  route,
+			Path:   r.URL.RequestURI(),
+			Status: rec.status(),
+		}
+		if who, err := s.tailscaleWhois(r.Context(), r); err == nil {
+			e.Login, e.Node = who.LoginName, who.NodeName
+		}
+		if body != nil && body.n > 0 {
+			e.Summary = summarizePayload(body.buf.Bytes(), body.n)
+		}
+		a.record(e)
+	}
+}
+
+// capturingReader keeps the first auditBodyLimit bytes read from a request
+// body and counts the rest.
+type capturingReader struct {
+	io.ReadCloser
+	buf bytes.Buffer
+	n   int64
+}
+
+func (c *capturingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if room := auditBodyLimit - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(n, room)])
+	}
+	c.n += int64(n)
+	return n, err
+}
+
+// statusRecorder remembers the status code written to a response and counts
+// the body bytes. It passes flushes and hijacks through so streaming routes
+// keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// status returns the status code sent, treating a response with no body
+// as 200 as net/http does.
+func (s *statusRecorder) status() int {
+	if s.code == 0 {
+		return http.StatusOK
+	}
+	return s.code
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.ResponseWriter does not implement http.Hijacker")
+	}
+	s.code = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// payloadSummary describes a request body without storing its values: the
+// field names of a JSON object, or the operations of a JSON Patch.
+type payloadSummary struct {
+	Bytes     int64    `json:"bytes"`
+	Fields    []string `json:"fields,omitempty"`
+	Ops       []string `json:"ops,omitempty"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// summarizePayload summarizes the captured start of a body of n bytes.
+func summarizePayload(captured []byte, n int64) json.RawMessage {
+	sum := payloadSummary{Bytes: n, Truncated: int64(len(captured)) < n}
+
+	var object map[string]json.RawMessage
+	var patch []patchOperation
+	if err := json.Unmarshal(captured, &object); err == nil {
+		for field := range object {
+			sum.Fields = append(sum.Fields, field)
+		}
+		sort.Strings(sum.Fields)
+	} else if err := json.Unmarshal(captured, &patch); err == nil {
+		for _, op := range patch {
+			sum.Ops = append(sum.Ops, strings.TrimSpace(op.Op+" "+op.Path))
+		}
+	}
+
+	b, _ := json.Marshal(sum)
+	return b
+}
+
+// AuditPage is a page of /api/audit results, newest first.
+type AuditPage struct {
+	Entries []store.AuditEntry `json:"entries"`
+
+	// NextBefore is passed as ?before= to fetch the next page
+	NextBefore *int64 `json:"next_before,omitempty"`
+}
+
+// auditHandler lists audit log entries, optionally for one login.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.audit == nil {
+		http.Error(w, `{"error": "Audit log is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	f := store.AuditFilter{Login: q.Get("login"), Limit: auditPageDefault}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > auditPageMax {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", auditPageMax))
+			return
+		}
+		f.Limit = limit
+	}
+	if v := q.Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || before < 1 {
+			http.Error(w, `{"error": "before must be a positive entry id"}`, http.StatusBadRequest)
+			return
+		}
+		f.Before = before
+	}
+
+	ctx := r.Context()
+
+	entries, err := s.store.AuditLog(ctx, f)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query audit log: %v", err))
+		return
+	}
+
+	page := AuditPage{Entries: entries}
+	if len(entries) == f.Limit {
+		next := entries[len(entries)-1].ID
+		page.NextBefore = &next
+	}
+	json.NewEncoder(w).Encode(page)
+}
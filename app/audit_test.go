@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestAuditRoute verifies writes are audited with the caller, route, status and payload summary
+func TestAuditRoute(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	s := &Server{clock: clock, audit: &auditLog{entries: make(chan store.AuditEntry, 1)}}
+	h := s.auditRoute("PATCH /api/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusConflict)
+	})
+
+	r := httptest.NewRequest(http.MethodPatch, "/api/products/3?dry=1", strings.NewReader(`[{"op":"replace","path":"/price","value":1}]`))
+	asServeUser(r, "alice@example.com")
+	h(httptest.NewRecorder(), r)
+
+	var e store.AuditEntry
+	select {
+	case e = <-s.audit.entries:
+	default:
+		t.Fatal("mutating call was not audited")
+	}
+	if e.Login != "alice@example.com" || e.Route != "/api/products/{id}" || e.Path != "/api/products/3?dry=1" ||
+		e.Status != http.StatusConflict || !e.Time.Equal(clock.Now()) {
+		t.Errorf("audit entry = %+v", e)
+	}
+
+	var sum payloadSummary
+	if err := json.Unmarshal(e.Summary, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Ops) != 1 || sum.Ops[0] != "replace /price" || sum.Bytes != 44 {
+		t.Errorf("summary = %+v", sum)
+	}
+
+	// Reads are only audited on request
+	get := s.auditRoute("GET /api/products", func(w http.ResponseWriter, r *http.Request) {})
+	get(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	if len(s.audit.entries) != 0 {
+		t.Error("read audited without AUDIT_READS")
+	}
+	s.audit.reads = true
+	get(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	if e := <-s.audit.entries; e.Status != http.StatusOK || e.Login != "" || e.Summary != nil {
+		t.Errorf("read audit entry = %+v", e)
+	}
+}
+
+// TestSummarizePayload verifies payloads are summarized by their fields,
+// and marked truncated when too large
+func TestSummarizePayload(t *testing.T) {
+	var sum payloadSummary
+	json.Unmarshal(summarizePayload([]byte(`{"price": 5, "name": "x"}`), 25), &sum)
+	if strings.Join(sum.Fields, ",") != "name,price" || sum.Truncated {
+		t.Errorf("object summary = %+v", sum)
+	}
+
+	json.Unmarshal(summarizePayload([]byte(`{"name": "x`), 1<<20), &sum)
+	if !sum.Truncated || sum.Bytes != 1<<20 {
+		t.Errorf("truncated summary = %+v", sum)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// role is what a caller may do. Each role includes the ones below it.
+type role int
+
+const (
+	roleNone role = iota
+	// roleViewer reads the catalog and manages the caller's own data:
+	// preferences, favorites, reviews, orders and files.
+	roleViewer
+	// roleEditor also changes the catalog.
+	roleEditor
+	// roleAdmin also uses the admin page and API.
+	roleAdmin
+)
+
+var roleNames = map[role]string{roleNone: "none", roleViewer: "viewer", roleEditor: "editor", roleAdmin: "admin"}
+
+func (r role) String() string { return roleNames[r] }
+
+func parseRole(s string) (role, error) {
+	for r, name := range roleNames {
+		if r != roleNone && strings.EqualFold(strings.TrimSpace(s), name) {
+			return r, nil
+		}
+	}
+	return roleNone, fmt.Errorf("unknown role %q (want viewer, editor or admin)", s)
+}
+
+// roleRule grants role to the callers match selects: a login, @domain for
+// every login in a domain, tag:name for nodes with an ACL tag, or * for
+// every tailnet user.
+type roleRule struct {
+	match string
+	role  role
+}
+
+func (rule roleRule) matches(login string, tags []string) bool {
+	switch {
+	case rule.match == "*":
+		return login != ""
+	case strings.HasPrefix(rule.match, "tag:"):
+		for _, t := range tags {
+			if strings.EqualFold(t, rule.match) {
+				return true
+			}
+		}
+		return false
+	case strings.HasPrefix(rule.match, "@"):
+		return login != "" && strings.HasSuffix(strings.ToLower(login), rule.match)
+	}
+	return strings.EqualFold(login, rule.match)
+}
+
+// roleMap assigns roles from ROLES and ROLES_FILE. A caller gets the
+// highest role of the rules that match them, and fallback if none do.
+type roleMap struct {
+	rules    []roleRule
+	fallback role
+	tags     bool // some rule matches tags, so callers' tags are looked up
+}
+
+// parseRoleRules parses MATCH=ROLE entries.
+func parseRoleRules(entries []string) ([]roleRule, error) {
+	var rules []roleRule
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		match, name, ok := strings.Cut(e, "=")
+		match = strings.ToLower(strings.TrimSpace(match))
+		if !ok || match == "" {
+			return nil, fmt.Errorf("role mapping %q must be MATCH=ROLE", e)
+		}
+		if strings.HasPrefix(match, "*@") {
+			match = match[1:]
+		}
+		r, err := parseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("role mapping %q: %w", e, err)
+		}
+		rules = append(rules, roleRule{match: match, role: r})
+	}
+	return rules, nil
+}
+
+// readRoleFile reads MATCH=ROLE lines from path, ignoring blank lines and
+// # comments.
+func readRoleFile(path string) ([]roleRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		entries = append(entries, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	rules, err := parseRoleRules(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// newRoleMap builds the role mapping, or returns nil if there are no rules,
+// leaving authorization to ADMIN_LOGINS and ADMIN_TAGS alone.
+func newRoleMap(entries []string, file, fallback string) (*roleMap, error) {
+	rules, err := parseRoleRules(entries)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		fileRules, err := readRoleFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading ROLES_FILE: %w", err)
+		}
+		rules = append(rules, fileRules...)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	m := &roleMap{rules: rules}
+	if m.fallback, err = parseRole(fallback); err != nil {
+		return nil, fmt.Errorf("ROLE_DEFAULT: %w", err)
+	}
+	for _, rule := range rules {
+		m.tags = m.tags || strings.HasPrefix(rule.match, "tag:")
+	}
+	return m, nil
+}
+
+// roleFor returns the role of a caller with login (empty if unidentified)
+// on a node with tags.
+func (m *roleMap) roleFor(login string, tags []string) role {
+	best := roleNone
+	for _, rule := range m.rules {
+		if rule.role > best && rule.matches(login, tags) {
+			best = rule.role
+		}
+	}
+	if best == roleNone {
+		return m.fallback
+	}
+	return best
+}
+
+// callerRole returns the caller's role in roles and a description of who
+// they are. The login is the one tailscaleWhois resolves, from WhoIs or a
+// trusted Tailscale Serve, so a caller cannot claim another's role.
+func (s *Server) callerRole(r *http.Request, roles *roleMap) (role, string) {
+	var login, who string
+	if whois, err := s.tailscaleWhois(r.Context(), r); err == nil {
+		login, who = whois.LoginName, whois.LoginName
+	} else {
+		who = "an unidentified caller"
+	}
+	var tags []string
+	if roles.tags {
+		if node, nodeTags, err := s.callerNodeTags(r.Context(), r); err == nil {
+			tags = nodeTags
+			if len(tags) > 0 {
+				who = fmt.Sprintf("%s (node %s, %s)", who, node, strings.Join(tags, ", "))
+			}
+		}
+	}
+	return roles.roleFor(login, tags), who
+}
+
+// routeRole returns the role rt requires: its own, editor for mutating
+// methods and viewer otherwise. The admin routes are left to requireAdmin,
+// which also admits ADMIN_LOGINS and ADMIN_TAGS.
+func routeRole(rt apiRoute) role {
+	switch {
+	case rt.Role != roleNone:
+		return rt.Role
+	case isMutating(rt.Method):
+		return roleEditor
+	}
+	return roleViewer
+}
+
+// checkRole returns an error if the caller's role is below need. Without a
+// role mapping every caller passes, as before roles existed.
+func (s *Server) checkRole(r *http.Request, need role) error {
+	roles := s.live().roles
+	if roles == nil {
+		return nil
+	}
+	if got, who := s.callerRole(r, roles); got < need {
+		return fmt.Errorf("this requires the %s role; %s has the %s role", need, who, got)
+	}
+	return nil
+}
+
+// authorize writes a 403 and returns false if the caller's role is below
+// need, or a 503 if roles are mapped but the node cannot identify callers.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, need role) bool {
+	if err := s.tsAuth.err(); err != nil && s.live().roles != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Cannot identify callers: "+err.Error())
+		return false
+	}
+	if err := s.checkRole(r, need); err != nil {
+		writeJSONError(w, http.StatusForbidden, "Forbidden: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// authorizeRoute enforces the role rt requires.
+func (s *Server) authorizeRoute(rt apiRoute, next http.HandlerFunc) http.HandlerFunc {
+	if isAdminRoute(rt.Path) {
+		return next
+	}
+	need := routeRole(rt)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authorize(w, r, need) {
+			next(w, r)
+		}
+	}
+}
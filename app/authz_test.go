@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRoleMap verifies the most specific rule decides a caller's role
+func TestRoleMap(t *testing.T) {
+	m, err := newRoleMap([]string{"*=viewer", "*@Example.com=editor", "root@example.com=admin", "tag:ops=admin", " "}, "", "viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.tags {
+		t.Error("a tag: rule should make the map look up tags")
+	}
+	for _, tc := range []struct {
+		login string
+		tags  []string
+		want  role
+	}{
+		{"ROOT@example.com", nil, roleAdmin},
+		{"alice@example.com", nil, roleEditor},
+		{"alice@example.com.evil", nil, roleViewer},
+		{"bob@other.com", []string{"tag:web", "tag:ops"}, roleAdmin},
+		{"bob@other.com", nil, roleViewer},
+		{"", nil, roleViewer},
+	} {
+		if got := m.roleFor(tc.login, tc.tags); got != tc.want {
+			t.Errorf("roleFor(%q, %v) = %s, want %s", tc.login, tc.tags, got, tc.want)
+		}
+	}
+
+	if m, err := newRoleMap(nil, "", "viewer"); m != nil || err != nil {
+		t.Errorf("no rules: got %v, %v; want nil, nil", m, err)
+	}
+	for _, bad := range []string{"alice", "=admin", "alice=owner"} {
+		if _, err := newRoleMap([]string{bad}, "", "viewer"); err == nil {
+			t.Errorf("rule %q: expected an error", bad)
+		}
+	}
+}
+
+// TestRoleFile verifies ROLES_FILE rules are read, with comments, after ROLES
+func TestRoleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roles")
+	os.WriteFile(path, []byte("# editors\n@example.com = editor\n\nroot@example.com=admin # on call\n"), 0o600)
+
+	m, err := newRoleMap([]string{"bob@other.com=editor"}, path, "viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.rules) != 3 || m.tags {
+		t.Fatalf("rules = %+v", m.rules)
+	}
+	if got := m.roleFor("root@example.com", nil); got != roleAdmin {
+		t.Errorf("root = %s, want admin", got)
+	}
+
+	os.WriteFile(path, []byte("root@example.com\n"), 0o600)
+	if _, err := newRoleMap(nil, path, "viewer"); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("bad file: err = %v, want one naming the file", err)
+	}
+}
+
+// TestAuthorizeRoute verifies each route needs the role its method calls for
+func TestAuthorizeRoute(t *testing.T) {
+	roles, err := newRoleMap([]string{"alice@example.com=editor", "root@example.com=admin"}, "", "viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{}
+	s.setLive(&liveConfig{roles: roles})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }
+
+	request := func(method, path, login string) *http.Request {
+		r := httptest.NewRequest(method, path, nil)
+		if login != "" {
+			asServeUser(r, login)
+		}
+		return r
+	}
+
+	for _, tc := range []struct {
+		rt    apiRoute
+		login string
+		want  int
+	}{
+		{apiRoute{Method: http.MethodGet, Path: "/api/products"}, "", http.StatusTeapot},
+		{apiRoute{Method: http.MethodPatch, Path: "/api/products/{id}"}, "bob@example.com", http.StatusForbidden},
+		{apiRoute{Method: http.MethodPatch, Path: "/api/products/{id}"}, "alice@example.com", http.StatusTeapot},
+		{apiRoute{Method: http.MethodPatch, Path: "/api/products/{id}"}, "root@example.com", http.StatusTeapot},
+		{apiRoute{Method: http.MethodPut, Path: "/api/preferences", Role: roleViewer}, "bob@example.com", http.StatusTeapot},
+	} {
+		w := httptest.NewRecorder()
+		s.authorizeRoute(tc.rt, ok)(w, request(tc.rt.Method, tc.rt.Path, tc.login))
+		if w.Code != tc.want {
+			t.Errorf("%s %s as %q: status %d, want %d", tc.rt.Method, tc.rt.Path, tc.login, w.Code, tc.want)
+		}
+		if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), "requires the editor role") {
+			t.Errorf("403 body = %s", w.Body)
+		}
+	}
+
+	// The admin role admits to the admin routes, alongside ADMIN_LOGINS
+	s.setLive(&liveConfig{roles: roles, adminLogins: loginSet([]string{"ops@example.com"})})
+	h := s.adminRoute("GET /api/audit", ok)
+	for login, want := range map[string]int{
+		"root@example.com":  http.StatusTeapot,
+		"ops@example.com":   http.StatusTeapot,
+		"alice@example.com": http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		h(w, request(http.MethodGet, "/api/audit", login))
+		if w.Code != want {
+			t.Errorf("admin route as %q: status %d, want %d", login, w.Code, want)
+		}
+	}
+
+	// A login header from a tailnet peer is its own claim, not an identity
+	spoofed := httptest.NewRequest(http.MethodPatch, "/api/products/1", nil)
+	spoofed.RemoteAddr = "100.64.0.2:41641"
+	spoofed.Header.Set("Tailscale-User-Login", "root@example.com")
+	w := httptest.NewRecorder()
+	s.authorizeRoute(apiRoute{Method: http.MethodPatch, Path: "/api/products/{id}"}, ok)(w, spoofed)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("spoofed login header: status %d, want 403", w.Code)
+	}
+
+	// Without a role mapping nothing changes
+	s = &Server{}
+	w = httptest.NewRecorder()
+	s.authorizeRoute(apiRoute{Method: http.MethodPatch, Path: "/api/products/{id}"}, ok)(w, request(http.MethodPatch, "/api/products/1", ""))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("no roles: status %d", w.Code)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+var (
+	awsSecretsOnce   sync.Once
+	awsSecretsShared *awsSecrets
+	awsSecretsErr    error
+)
+
+// sharedAWSSecrets returns the process's awsSecrets, so that every
+// DBConfig copy reading the same secret fetches it once.
+func sharedAWSSecrets(ctx context.Context) (*awsSecrets, error) {
+	awsSecretsOnce.Do(func() {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			awsSecretsErr = fmt.Errorf("loading AWS configuration: %w", err)
+			return
+		}
+		awsSecretsShared = newAWSSecrets(cfg)
+	})
+	return awsSecretsShared, awsSecretsErr
+}
+
+// awsSecrets reads secrets from Secrets Manager and SSM Parameter Store,
+// caching each value. Requests are signed directly, as for S3 snapshots:
+// each service needs only its one JSON call.
+type awsSecrets struct {
+	config aws.Config
+	signer *v4.Signer
+	client *http.Client
+
+	// endpoint returns the service URL; tests point it elsewhere
+	endpoint func(service, region string) string
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newAWSSecrets(cfg aws.Config) *awsSecrets {
+	return &awsSecrets{
+		config: cfg,
+		signer: v4.NewSigner(),
+		client: &http.Client{Timeout: 10 * time.Second},
+		endpoint: func(service, region string) string {
+			return fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+		},
+		cache: map[string]string{},
+	}
+}
+
+// get resolves ref: a Secrets Manager secret or SSM parameter ARN, or
+// secretsmanager:NAME or ssm:NAME in the configured region. A #KEY suffix
+// picks that field of a JSON secret, such as the password of an
+// RDS-managed secret.
+func (s *awsSecrets) get(ctx context.Context, ref string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.cache[ref]; ok {
+		return v, nil
+	}
+
+	id, key, _ := strings.Cut(ref, "#")
+	service, region := "", s.config.Region
+	switch {
+	case strings.HasPrefix(id, "arn:"):
+		parts := strings.SplitN(id, ":", 6)
+		if len(parts) < 6 || (parts[2] != "secretsmanager" && parts[2] != "ssm") {
+			return "", fmt.Errorf("%q is not a Secrets Manager secret or SSM parameter ARN", id)
+		}
+		service, region = parts[2], parts[3]
+	case strings.HasPrefix(id, "secretsmanager:"):
+		service, id = "secretsmanager", strings.TrimPrefix(id, "secretsmanager:")
+	case strings.HasPrefix(id, "ssm:"):
+		service, id = "ssm", strings.TrimPrefix(id, "ssm:")
+	default:
+		return "", fmt.Errorf("%q must be an ARN or start with secretsmanager: or ssm:", ref)
+	}
+	if region == "" {
+		return "", fmt.Errorf("%s needs AWS_REGION to be set", ref)
+	}
+
+	var v string
+	var err error
+	if service == "secretsmanager" {
+		var out struct {
+			SecretString *string
+		}
+		err = s.call(ctx, service, region, "secretsmanager.GetSecretValue", map[string]interface{}{"SecretId": id}, &out)
+		if err == nil && out.SecretString == nil {
+			err = fmt.Errorf("secret %s is binary; only string secrets are supported", id)
+		} else if err == nil {
+			v = *out.SecretString
+		}
+	} else {
+		var out struct {
+			Parameter struct{ Value string }
+		}
+		err = s.call(ctx, service, region, "AmazonSSM.GetParameter", map[string]interface{}{"Name": id, "WithDecryption": true}, &out)
+		v = out.Parameter.Value
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", id, err)
+	}
+
+	if key != "" {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(v), &fields); err != nil {
+			return "", fmt.Errorf("%s is not a JSON object, so #%s cannot be picked from it", id, key)
+		}
+		f, ok := fields[key]
+		if !ok {
+			return "", fmt.Errorf("%s has no %q field", id, key)
+		}
+		v = fmt.Sprint(f)
+	}
+	if v == "" {
+		return "", fmt.Errorf("%s is empty", ref)
+	}
+	s.cache[ref] = v
+	return v, nil
+}
+
+// iamActions are the permissions each service's call needs, for access
+// denied errors.
+var iamActions = map[string]string{
+	"secretsmanager": "secretsmanager:GetSecretValue (and kms:Decrypt if it uses a customer managed key)",
+	"ssm":            "ssm:GetParameter (and kms:Decrypt for a SecureString with a customer managed key)",
+}
+
+// call makes a signed JSON 1.1 request to the service and decodes the
+// response into out, explaining the errors misconfigured IAM causes.
+func (s *awsSecrets) call(ctx context.Context, service, region, target string, in, out interface{}) error {
+	body, _ := json.Marshal(in)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint(service, region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	creds, err := s.config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("no AWS credentials (set AWS_PROFILE or access keys, or run with an IAM role): %w", err)
+	}
+	sum := sha256.Sum256(body)
+	if err := s.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), service, region, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return json.Unmarshal(b, out)
+	}
+
+	var apiErr struct {
+		Type     string `json:"__type"`
+		Message  string `json:"message"`
+		MessageU string `json:"Message"`
+	}
+	json.Unmarshal(b, &apiErr)
+	code := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+	msg := apiErr.Message
+	if msg == "" {
+		msg = apiErr.MessageU
+	}
+	switch code {
+	case "AccessDeniedException":
+		return fmt.Errorf("access denied: the IAM role needs %s: %s", iamActions[service], msg)
+	case "ResourceNotFoundException", "ParameterNotFound":
+		return fmt.Errorf("not found in %s in %s", service, region)
+	case "UnrecognizedClientException", "InvalidSignatureException", "ExpiredTokenException":
+		return fmt.Errorf("AWS rejected the credentials (%s): %s", code, msg)
+	case "":
+		return fmt.Errorf("%s %s: %s", target, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return fmt.Errorf("%s: %s: %s", target, code, msg)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// TestAWSSecrets verifies secrets are read from Secrets Manager and
+// Parameter Store with signed requests
+func TestAWSSecrets(t *testing.T) {
+	var calls int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			t.Errorf("unsigned request: %q", r.Header.Get("Authorization"))
+		}
+		var in map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&in)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch target := r.Header.Get("X-Amz-Target"); {
+		case target == "secretsmanager.GetSecretValue" && in["SecretId"] == "prod/db":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"username":"app","password":"hunter2"}`})
+		case target == "secretsmanager.GetSecretValue" && in["SecretId"] == "arn:aws:secretsmanager:eu-west-1:123456789012:secret:ts-AbCdEf":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": "tskey-auth-sm"})
+		case target == "AmazonSSM.GetParameter" && in["Name"] == "/demo/authkey" && in["WithDecryption"] == true:
+			json.NewEncoder(w).Encode(map[string]interface{}{"Parameter": map[string]string{"Value": "tskey-auth-ssm"}})
+		case target == "AmazonSSM.GetParameter":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "ParameterNotFound"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "AccessDeniedException", "Message": "User: arn:aws:sts::123456789012:assumed-role/demo is not authorized"})
+		}
+	}))
+	defer api.Close()
+
+	var regions []string
+	s := newAWSSecrets(aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+		}),
+	})
+	s.endpoint = func(service, region string) string {
+		regions = append(regions, service+"/"+region)
+		return api.URL
+	}
+
+	ctx := context.Background()
+	for ref, want := range map[string]string{
+		"secretsmanager:prod/db#password":                                "hunter2",
+		"secretsmanager:prod/db#username":                                "app",
+		"ssm:/demo/authkey":                                              "tskey-auth-ssm",
+		"arn:aws:secretsmanager:eu-west-1:123456789012:secret:ts-AbCdEf": "tskey-auth-sm",
+	} {
+		if got, err := s.get(ctx, ref); err != nil || got != want {
+			t.Errorf("%s = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+	if got, _ := s.get(ctx, "secretsmanager:prod/db#password"); got != "hunter2" || calls != 4 {
+		t.Errorf("cached get = %q after %d calls", got, calls)
+	}
+	for _, want := range []string{"secretsmanager/eu-west-1", "ssm/us-east-1"} {
+		found := false
+		for _, r := range regions {
+			found = found || r == want
+		}
+		if !found {
+			t.Errorf("no call to %s in %v", want, regions)
+		}
+	}
+
+	for ref, want := range map[string]string{
+		"secretsmanager:other":         "other: access denied: the IAM role needs secretsmanager:GetSecretValue",
+		"ssm:/missing":                 "/missing: not found in ssm in us-east-1",
+		"secretsmanager:prod/db#token": `prod/db has no "token" field`,
+		"ssm:/demo/authkey#password":   "/demo/authkey is not a JSON object",
+		"prod/db":                      "must be an ARN or start with secretsmanager: or ssm:",
+		"arn:aws:s3:::bucket/key":      "is not a Secrets Manager secret or SSM parameter ARN",
+	} {
+		if _, err := s.get(ctx, ref); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", ref, err, want)
+		}
+	}
+
+	if _, err := (DBConfig{}).fetchSecret("DB_PASSWORD_SECRET", "ssm:/x"); err == nil || err.Error() != "DB_PASSWORD_SECRET needs SECRETS_PROVIDER to be aws or vault" {
+		t.Errorf("no provider: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// backoff computes exponentially growing retry delays with full jitter.
+type backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	rand    *lockedRand
+	attempt int
+}
+
+func newBackoff(initial, max time.Duration, rnd *lockedRand) *backoff {
+	return &backoff{Initial: initial, Max: max, rand: rnd}
+}
+
+// Next returns the delay before the next attempt: a random duration in
+// [0, min(Max, Initial*2^n)), so restarting replicas don't retry in lockstep.
+func (b *backoff) Next() time.Duration {
+	d := b.Initial << b.attempt
+	if d <= 0 || d > b.Max {
+		d = b.Max
+	} else {
+		b.attempt++
+	}
+	return time.Duration(b.rand.Int63n(int64(d))) + 1
+}
+
+// retry calls fn until it succeeds, ctx is done, or the deadline (measured
+// on clock) passes, sleeping b.Next() between attempts. onRetry, if set, is
+// called after each failure that will be retried. The last error is
+// returned.
+func retry(ctx context.Context, clock Clock, b *backoff, timeout time.Duration, fn func(context.Context) error, onRetry func(attempt int, err error, wait time.Duration)) error {
+	deadline := clock.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		wait := b.Next()
+		if remaining := deadline.Sub(clock.Now()); remaining <= 0 {
+			return err
+		} else if wait > remaining {
+			wait = remaining
+		}
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-clock.After(wait):
+		}
+	}
+}
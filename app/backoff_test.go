@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBackoffNext verifies delays stay within the doubling cap and Max
+func TestBackoffNext(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, time.Second, newLockedRand(1))
+
+	caps := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, c := range caps {
+		limit := c * time.Millisecond
+		if got := b.Next(); got <= 0 || got > limit {
+			t.Errorf("Attempt %d: delay %v outside (0, %v]", i+1, got, limit)
+		}
+	}
+}
+
+// TestRetrySucceeds verifies retry keeps calling fn until it succeeds
+func TestRetrySucceeds(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := newBackoff(100*time.Millisecond, time.Second, newLockedRand(1))
+
+	calls := 0
+	retries := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- retry(context.Background(), clock, b, time.Minute, func(context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		}, func(attempt int, err error, wait time.Duration) { retries++ })
+	}()
+
+	for i := 0; i < 2; i++ {
+		waitForWaiters(t, clock, 1)
+		clock.Advance(time.Second)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Expected success, got %v", err)
+	}
+	if calls != 3 || retries != 2 {
+		t.Errorf("Expected 3 calls and 2 retries, got %d and %d", calls, retries)
+	}
+}
+
+// TestRetryDeadline verifies retry gives up with the last error once the
+// timeout has elapsed
+func TestRetryDeadline(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := newBackoff(time.Second, time.Second, newLockedRand(1))
+
+	wantErr := errors.New("connection refused")
+	done := make(chan error, 1)
+	go func() {
+		done <- retry(context.Background(), clock, b, 3*time.Second, func(context.Context) error {
+			return wantErr
+		}, nil)
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if !errors.Is(err, wantErr) {
+				t.Fatalf("Expected %v, got %v", wantErr, err)
+			}
+			if elapsed := clock.Now().Sub(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); elapsed > 4*time.Second {
+				t.Errorf("Retried for %v, past the 3s timeout", elapsed)
+			}
+			return
+		default:
+		}
+		clock.mu.Lock()
+		pending := len(clock.waiters)
+		clock.mu.Unlock()
+		if pending > 0 {
+			clock.Advance(time.Second)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestRetryZeroTimeout verifies a zero timeout makes a single attempt
+func TestRetryZeroTimeout(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	calls := 0
+	err := retry(context.Background(), clock, newBackoff(time.Second, time.Second, newLockedRand(1)), 0, func(context.Context) error {
+		calls++
+		return errors.New("down")
+	}, nil)
+	if err == nil || calls != 1 {
+		t.Errorf("Expected one failed attempt, got %d calls and err %v", calls, err)
+	}
+}
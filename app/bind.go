@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// portSearchRange is how many ports above the configured one are probed when
+// suggesting or auto-picking an alternative.
+const portSearchRange = 20
+
+// listenFunc opens a listener, e.g. net.Listen or (*tsnet.Server).Listen.
+type listenFunc func(network, addr string) (net.Listener, error)
+
+// bindError explains why a listener could not be opened.
+type bindError struct {
+	Name        string
+	Addr        string
+	Err         error
+	Holder      string
+	Suggestions []int
+}
+
+func (e *bindError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s could not listen on %s: %v", e.Name, e.Addr, e.Err)
+	if e.Holder != "" {
+		fmt.Fprintf(&b, "; port is held by %s", e.Holder)
+	}
+	if len(e.Suggestions) > 0 {
+		ports := make([]string, len(e.Suggestions))
+		for i, p := range e.Suggestions {
+			ports[i] = strconv.Itoa(p)
+		}
+		fmt.Fprintf(&b, "; free ports nearby: %s (or set AUTO_PORT=true)", strings.Join(ports, ", "))
+	}
+	return b.String()
+}
+
+func (e *bindError) Unwrap() error { return e.Err }
+
+// bindListener listens on port using listen. If that fails it diagnoses the
+// conflict and, when autoPort is set, falls back to the nearest free port.
+// local reports whether listen binds a port on this host, in which case the
+// process holding the port can be looked up.
+func bindListener(name, port string, listen listenFunc, local, autoPort bool) (net.Listener, error) {
+	addr := ":" + port
+	ln, err := listen("tcp", addr)
+	if err == nil {
+		return ln, nil
+	}
+
+	bindErr := &bindError{Name: name, Addr: addr, Err: err}
+	n, convErr := strconv.Atoi(port)
+	if convErr != nil {
+		return nil, bindErr
+	}
+
+	if local && errors.Is(err, syscall.EADDRINUSE) {
+		bindErr.Holder = portHolder(n)
+	}
+
+	for candidate := n + 1; candidate <= n+portSearchRange && candidate <= 65535; candidate++ {
+		probe, err := listen("tcp", ":"+strconv.Itoa(candidate))
+		if err != nil {
+			continue
+		}
+		if autoPort {
+			log.Printf("⚠️  %s: port %d unavailable (%v), using port %d instead", name, n, bindErr.Err, candidate)
+			return probe, nil
+		}
+		probe.Close()
+		bindErr.Suggestions = append(bindErr.Suggestions, candidate)
+		if len(bindErr.Suggestions) == 3 {
+			break
+		}
+	}
+
+	return nil, bindErr
+}
+
+// announceListen reports the address a listener is bound to, so scripts can
+// find the server even when AUTO_PORT picked a different port.
+func announceListen(name string, ln net.Listener, announceFile string) {
+	log.Printf("%s bound to %s", name, ln.Addr())
+	if announceFile == "" {
+		return
+	}
+
+	f, err := os.OpenFile(announceFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("Warning: failed to write announce file: %v", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s=%s\n", name, ln.Addr())
+}
+
+// portHolder describes the local process listening on port, or returns ""
+// when it cannot be determined (non-Linux, or insufficient permissions).
+func portHolder(port int) string {
+	var inodes []string
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(table)
+		if err != nil {
+			continue
+		}
+		inodes = append(inodes, listeningInodes(f, port)...)
+		f.Close()
+	}
+	if len(inodes) == 0 {
+		return ""
+	}
+
+	want := map[string]bool{}
+	for _, inode := range inodes {
+		want["socket:["+inode+"]"] = true
+	}
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !want[link] {
+			continue
+		}
+		pid := strings.Split(fd, "/")[2]
+		comm, _ := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		return fmt.Sprintf("%s (pid %s)", strings.TrimSpace(string(comm)), pid)
+	}
+	return "another process (run as root or use `ss -ltnp` to see which)"
+}
+
+// listeningInodes returns the socket inodes in a /proc/net/tcp table that are
+// in the LISTEN state on port.
+func listeningInodes(r io.Reader, port int) []string {
+	const tcpListen = "0A"
+
+	var inodes []string
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseInt(hexPort, 16, 32); err == nil && int(p) == port {
+			inodes = append(inodes, fields[9])
+		}
+	}
+	return inodes
+}
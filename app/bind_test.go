@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestListeningInodes verifies LISTEN sockets are matched by port in a /proc/net/tcp table
+func TestListeningInodes(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4242 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 4343 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1111 1 0000000000000000 100 0 0 10 0
+`
+	got := listeningInodes(strings.NewReader(table), 8080)
+	if len(got) != 1 || got[0] != "4242" {
+		t.Errorf("Expected [4242], got %v", got)
+	}
+}
+
+// TestBindListenerReportsConflict verifies a taken port yields diagnostics or an automatic fallback
+func TestBindListenerReportsConflict(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer taken.Close()
+	port := strconv.Itoa(taken.Addr().(*net.TCPAddr).Port)
+
+	listen := func(network, addr string) (net.Listener, error) {
+		return net.Listen(network, "127.0.0.1"+addr)
+	}
+
+	_, err = bindListener("test", port, listen, true, false)
+	var bindErr *bindError
+	if !errors.As(err, &bindErr) {
+		t.Fatalf("Expected *bindError, got %v", err)
+	}
+	if len(bindErr.Suggestions) == 0 {
+		t.Errorf("Expected alternative port suggestions, got none: %v", err)
+	}
+
+	ln, err := bindListener("test", port, listen, true, true)
+	if err != nil {
+		t.Fatalf("Expected automatic fallback, got %v", err)
+	}
+	defer ln.Close()
+	if got := ln.Addr().(*net.TCPAddr).Port; strconv.Itoa(got) == port {
+		t.Errorf("Expected a different port than %s", port)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestDiskBlobStore verifies blobs are stored, read back and removed by key
+func TestDiskBlobStore(t *testing.T) {
+	ctx := context.Background()
+	d, err := newDiskBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := newBlobKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := d.Put(ctx, key, strings.NewReader("hello"))
+	if err != nil || n != 5 {
+		t.Fatalf("Put = %d, %v; want 5, nil", n, err)
+	}
+	r, err := d.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if string(got) != "hello" {
+		t.Errorf("Open read %q, want hello", got)
+	}
+
+	if err := d.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Open(ctx, key); !errors.Is(err, errBlobNotFound) {
+		t.Errorf("Open after Delete = %v, want errBlobNotFound", err)
+	}
+	if err := d.Delete(ctx, key); err != nil {
+		t.Errorf("second Delete = %v, want nil", err)
+	}
+}
+
+// TestDiskBlobStoreFailedPut verifies a failed upload leaves no partial blob behind
+func TestDiskBlobStoreFailedPut(t *testing.T) {
+	dir := t.TempDir()
+	d, err := newDiskBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := newBlobKey()
+
+	r := io.MultiReader(strings.NewReader("partial"), &errReader{errors.New("connection reset")})
+	if _, err := d.Put(context.Background(), key, r); err == nil {
+		t.Fatal("Put succeeded, want error")
+	}
+	entries, err := os.ReadDir(dir + "/" + key[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("failed Put left %d files behind", len(entries))
+	}
+}
+
+// TestDiskBlobStoreInvalidKey verifies keys that are not blob keys are rejected rather than opened
+func TestDiskBlobStoreInvalidKey(t *testing.T) {
+	d, err := newDiskBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "ab", "../etc/passwd", "ab/cd"} {
+		if _, err := d.Open(context.Background(), key); err == nil || errors.Is(err, errBlobNotFound) {
+			t.Errorf("Open(%q) = %v, want invalid key error", key, err)
+		}
+	}
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultMaxBodyBytes is the MAX_BODY_BYTES default.
+const defaultMaxBodyBytes = 1 << 20
+
+// errTrailingData reports a request body with more after its JSON value.
+var errTrailingData = errors.New("unexpected data after the JSON value")
+
+// bodyLimit returns the size limit for a request body: limit, if the
+// endpoint has one and it is below MAX_BODY_BYTES, or MAX_BODY_BYTES.
+func (s *Server) bodyLimit(limit int64) int64 {
+	max := s.maxBodyBytes
+	if max <= 0 {
+		max = defaultMaxBodyBytes
+	}
+	if limit > 0 && limit < max {
+		return limit
+	}
+	return max
+}
+
+// decodeJSONBody decodes the request body into v, allowing at most
+// bodyLimit(limit) bytes. Unknown fields and anything after the value are
+// errors; an empty body is io.EOF.
+func (s *Server) decodeJSONBody(w http.ResponseWriter, r *http.Request, limit int64, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(limit)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if err := dec.Decode(&json.RawMessage{}); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return errTrailingData
+	}
+	return nil
+}
+
+// readJSONBody decodes the request body into v as decodeJSONBody does,
+// writing a 413 or 400 and returning false if it cannot. what names the
+// expected body in the 400, e.g. "order". Write endpoints taking JSON
+// should read their bodies with it.
+func (s *Server) readJSONBody(w http.ResponseWriter, r *http.Request, limit int64, v interface{}, what string) bool {
+	if err := s.decodeJSONBody(w, r, limit, v); err != nil {
+		writeBodyError(w, err, what)
+		return false
+	}
+	return true
+}
+
+// writeBodyError answers a request whose body decodeJSONBody rejected.
+func writeBodyError(w http.ResponseWriter, err error, what string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Body may be at most %d bytes", tooLarge.Limit))
+	case errors.Is(err, io.EOF):
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Body must be a JSON %s", what))
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Body must be a JSON %s: %v", what, err))
+	}
+}
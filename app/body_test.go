@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBodyLimit verifies route limits are capped by MAX_BODY_BYTES
+func TestBodyLimit(t *testing.T) {
+	s := &Server{}
+	if got := s.bodyLimit(0); got != defaultMaxBodyBytes {
+		t.Errorf("default limit = %d", got)
+	}
+	s.maxBodyBytes = 1000
+	for limit, want := range map[int64]int64{0: 1000, 100: 100, 5000: 1000} {
+		if got := s.bodyLimit(limit); got != want {
+			t.Errorf("bodyLimit(%d) = %d, want %d", limit, got, want)
+		}
+	}
+}
+
+// TestReadJSONBody verifies oversized, malformed and unknown-field bodies get the matching errors
+func TestReadJSONBody(t *testing.T) {
+	s := &Server{maxBodyBytes: 64}
+	type rule struct {
+		Route string `json:"route"`
+	}
+
+	tests := []struct {
+		body   string
+		status int
+		error  string
+	}{
+		{`{"route": "GET /api/products"}`, http.StatusOK, ""},
+		{`  {"route": "x"}` + "\n", http.StatusOK, ""},
+		{"", http.StatusBadRequest, "Body must be a JSON rule"},
+		{`{"route": `, http.StatusBadRequest, "Body must be a JSON rule: unexpected EOF"},
+		{`{"rout": "x"}`, http.StatusBadRequest, `Body must be a JSON rule: json: unknown field "rout"`},
+		{`{"route": "x"} {"route": "y"}`, http.StatusBadRequest, "Body must be a JSON rule: unexpected data after the JSON value"},
+		{`{"route": "x"} garbage`, http.StatusBadRequest, "Body must be a JSON rule: unexpected data after the JSON value"},
+		{`{"route": "` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge, "Body may be at most 64 bytes"},
+		{`{"route": "x"}` + strings.Repeat(" ", 64), http.StatusRequestEntityTooLarge, "Body may be at most 64 bytes"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		var v rule
+		ok := s.readJSONBody(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(tt.body)), 0, &v, "rule")
+		if ok != (tt.status == http.StatusOK) || w.Code != tt.status {
+			t.Errorf("%.30q: ok %v, status %d, want %d", tt.body, ok, w.Code, tt.status)
+			continue
+		}
+		var e apiError
+		if !ok {
+			json.Unmarshal(w.Body.Bytes(), &e)
+		}
+		if e.Error != tt.error {
+			t.Errorf("%.30q: error %q, want %q", tt.body, e.Error, tt.error)
+		}
+	}
+
+	// A smaller endpoint limit wins
+	var v rule
+	err := s.decodeJSONBody(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"route": "GET /"}`)), 10, &v)
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 10 {
+		t.Errorf("endpoint limit: %v", err)
+	}
+	if err := s.decodeJSONBody(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/", http.NoBody), 0, &v); err != io.EOF {
+		t.Errorf("empty body: %v", err)
+	}
+}
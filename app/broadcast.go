@@ -0,0 +1,63 @@
+package main
+
+import "sync"
+
+// broadcaster fans values out to subscriber channels. Subscribers that fall
+// more than their buffer behind are dropped (their channel is closed) rather
+// than blocking everyone else.
+type broadcaster[T any] struct {
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[chan T]struct{}
+}
+
+func newBroadcaster[T any](buffer int) *broadcaster[T] {
+	return &broadcaster[T]{buffer: buffer, subscribers: map[chan T]struct{}{}}
+}
+
+func (b *broadcaster[T]) subscribe() chan T {
+	ch := make(chan T, b.buffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *broadcaster[T]) unsubscribe(ch chan T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *broadcaster[T]) publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- v:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeAll disconnects every subscriber.
+func (b *broadcaster[T]) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *broadcaster[T]) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
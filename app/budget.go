@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+)
+
+// budgetCheckInterval is how often the budget guard re-reads the instance
+// tags, so a TTL tag can be changed on a running instance.
+const budgetCheckInterval = 5 * time.Minute
+
+// BudgetConfig configures the budget guard, which shuts down demo
+// environments on EC2 that have been left running.
+type BudgetConfig struct {
+	TTL              time.Duration `env:"BUDGET_TTL" help:"Shut down once the EC2 instance has been running this long (0 disables the budget guard)"`
+	TTLTag           string        `env:"BUDGET_TTL_TAG" default:"demo-ttl" help:"Instance tag overriding BUDGET_TTL with a duration, or never (needs instance metadata tags)"`
+	ShutdownInstance bool          `env:"BUDGET_SHUTDOWN_INSTANCE" help:"Also power off the instance, which stops or terminates it per its shutdown behavior"`
+	Webhook          string        `env:"BUDGET_WEBHOOK_URL" help:"POST a JSON announcement (Slack-compatible text) here before shutting down"`
+	WebhookFile      string        `env:"BUDGET_WEBHOOK_URL_FILE" help:"Read BUDGET_WEBHOOK_URL from this file instead; POST /api/admin/rotate re-reads it"`
+}
+
+// budgetInstance is what the budget guard knows about the instance.
+type budgetInstance struct {
+	ID         string
+	Region     string
+	LaunchedAt time.Time
+	TagTTL     string // value of the TTL tag, if set
+}
+
+// budgetGuard shuts the app, and optionally the instance, down once the
+// instance has outlived its TTL.
+type budgetGuard struct {
+	config   BudgetConfig
+	webhook  *fileSecret // overrides config.Webhook if set
+	clock    Clock
+	instance func(ctx context.Context) (budgetInstance, error)
+	client   *http.Client
+	poweroff func() error
+	exit     func()
+}
+
+func newBudgetGuard(config BudgetConfig, clock Clock) *budgetGuard {
+	md := imds.New(imds.Options{})
+	return &budgetGuard{
+		config:   config,
+		clock:    clock,
+		instance: func(ctx context.Context) (budgetInstance, error) { return ec2Instance(ctx, md, config.TTLTag) },
+		client:   &http.Client{Timeout: 10 * time.Second},
+		poweroff: func() error { return runChild(exec.Command("shutdown", "-h", "now")) },
+		// SIGTERM takes the usual graceful shutdown path
+		exit: func() { syscall.Kill(os.Getpid(), syscall.SIGTERM) },
+	}
+}
+
+// ec2Instance reads the instance identity and TTL tag from the EC2 instance
+// metadata service.
+func ec2Instance(ctx context.Context, md *imds.Client, tag string) (budgetInstance, error) {
+	doc, err := md.GetInstanceIdentityDocument(ctx, &imds.GetInstanceIdentityDocumentInput{})
+	if err != nil {
+		return budgetInstance{}, fmt.Errorf("reading EC2 instance identity: %w", err)
+	}
+	inst := budgetInstance{ID: doc.InstanceID, Region: doc.Region, LaunchedAt: doc.PendingTime}
+
+	if tag != "" {
+		out, err := md.GetMetadata(ctx, &imds.GetMetadataInput{Path: "tags/instance/" + tag})
+		var status interface{ HTTPStatusCode() int }
+		switch {
+		case errors.As(err, &status) && status.HTTPStatusCode() == http.StatusNotFound:
+			// No such tag, or tags are not exposed in instance metadata
+		case err != nil:
+			return budgetInstance{}, fmt.Errorf("reading instance tag %s: %w", tag, err)
+		default:
+			defer out.Content.Close()
+			b, err := io.ReadAll(out.Content)
+			if err != nil {
+				return budgetInstance{}, fmt.Errorf("reading instance tag %s: %w", tag, err)
+			}
+			inst.TagTTL = strings.TrimSpace(string(b))
+		}
+	}
+	return inst, nil
+}
+
+// ttl returns the TTL for inst, or 0 if it should be left running.
+func (g *budgetGuard) ttl(inst budgetInstance) (time.Duration, error) {
+	switch strings.ToLower(inst.TagTTL) {
+	case "":
+		return g.config.TTL, nil
+	case "never", "off", "0":
+		return 0, nil
+	}
+	d, err := time.ParseDuration(inst.TagTTL)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("instance tag %s=%q is not a duration or never", g.config.TTLTag, inst.TagTTL)
+	}
+	return d, nil
+}
+
+// check reads the instance and returns how long is left before it expires,
+// or a negative duration once it has; ok is false if it has no TTL.
+func (g *budgetGuard) check(ctx context.Context) (inst budgetInstance, ttl, left time.Duration, ok bool, err error) {
+	inst, err = g.instance(ctx)
+	if err != nil {
+		return inst, 0, 0, false, err
+	}
+	if ttl, err = g.ttl(inst); err != nil || ttl == 0 {
+		return inst, 0, 0, false, err
+	}
+	return inst, ttl, inst.LaunchedAt.Add(ttl).Sub(g.clock.Now()), true, nil
+}
+
+// run checks the instance every budgetCheckInterval, or sooner if it
+// expires before then, until ctx is done or it has shut down.
+func (g *budgetGuard) run(ctx context.Context) {
+	for {
+		wait := budgetCheckInterval
+		inst, ttl, left, ok, err := g.check(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Warning: budget guard check failed: %v", err)
+		case ok && left <= 0:
+			g.shutdown(ctx, inst, ttl)
+			return
+		case ok && left < wait:
+			wait = left
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.clock.After(wait):
+		}
+	}
+}
+
+// budgetAnnouncement is the webhook payload. Text makes it usable as a
+// Slack incoming webhook message.
+type budgetAnnouncement struct {
+	Text       string    `json:"text"`
+	InstanceID string    `json:"instance_id"`
+	Region     string    `json:"region"`
+	LaunchedAt time.Time `json:"launched_at"`
+	TTL        string    `json:"ttl"`
+	Instance   bool      `json:"instance_shutdown"`
+}
+
+// shutdown announces the shutdown, powers the instance off if configured
+// and stops the app.
+func (g *budgetGuard) shutdown(ctx context.Context, inst budgetInstance, ttl time.Duration) {
+	uptime := g.clock.Now().Sub(inst.LaunchedAt).Round(time.Minute)
+	what := "the demo app"
+	if g.config.ShutdownInstance {
+		what = "the demo app and instance"
+	}
+	text := fmt.Sprintf("Budget guard: EC2 instance %s (%s) has been up %s, past its %s TTL; shutting down %s",
+		inst.ID, inst.Region, uptime, ttl, what)
+	log.Print(text)
+
+	if g.webhookURL() != "" {
+		if err := g.announce(ctx, budgetAnnouncement{
+			Text:       text,
+			InstanceID: inst.ID,
+			Region:     inst.Region,
+			LaunchedAt: inst.LaunchedAt,
+			TTL:        ttl.String(),
+			Instance:   g.config.ShutdownInstance,
+		}); err != nil {
+			log.Printf("Warning: budget guard webhook failed: %v", err)
+		}
+	}
+
+	if g.config.ShutdownInstance {
+		if err := g.poweroff(); err != nil {
+			log.Printf("Warning: failed to power off the instance: %v", err)
+		}
+	}
+	g.exit()
+}
+
+// webhookURL returns the current announcement webhook, if any.
+func (g *budgetGuard) webhookURL() string {
+	if g.webhook != nil {
+		return g.webhook.Get()
+	}
+	return g.config.Webhook
+}
+
+func (g *budgetGuard) announce(ctx context.Context, a budgetAnnouncement) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.webhookURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// startBudgetGuard starts the budget guard if BUDGET_TTL is set. It fails to
+// start off EC2, where there is no instance metadata.
+func (s *Server) startBudgetGuard(config BudgetConfig) {
+	s.features.start(context.Background(), feature{
+		Name:    "budget guard",
+		Enabled: config.TTL > 0,
+		Start: func(ctx context.Context) (func(), error) {
+			g := newBudgetGuard(config, s.clock)
+			if config.WebhookFile != "" {
+				webhook, err := newFileSecret("BUDGET_WEBHOOK_URL_FILE", config.WebhookFile)
+				if err != nil {
+					return nil, err
+				}
+				g.webhook = webhook
+				s.secrets.add(webhook)
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			inst, ttl, left, ok, err := g.check(checkCtx)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				log.Printf("Budget guard: instance %s shuts down in %s (TTL %s)", inst.ID, left.Round(time.Second), ttl)
+			} else {
+				log.Printf("Budget guard: instance %s is tagged %s=%s and will be left running", inst.ID, config.TTLTag, inst.TagTTL)
+			}
+
+			ctx, stop := context.WithCancel(ctx)
+			go g.run(ctx)
+			return stop, nil
+		},
+	})
+}
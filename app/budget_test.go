@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+)
+
+// TestBudgetGuardTTL verifies the instance tag overrides BUDGET_TTL and can turn it off
+func TestBudgetGuardTTL(t *testing.T) {
+	g := &budgetGuard{config: BudgetConfig{TTL: 4 * time.Hour, TTLTag: "demo-ttl"}}
+	for tag, want := range map[string]time.Duration{"": 4 * time.Hour, "90m": 90 * time.Minute, "never": 0, "Off": 0} {
+		if got, err := g.ttl(budgetInstance{TagTTL: tag}); err != nil || got != want {
+			t.Errorf("ttl with tag %q = %v, %v; want %v", tag, got, err, want)
+		}
+	}
+	if _, err := g.ttl(budgetInstance{TagTTL: "tomorrow"}); err == nil {
+		t.Error("invalid tag accepted")
+	}
+}
+
+// TestBudgetGuardShutdown verifies an expired instance announces its shutdown before powering off
+func TestBudgetGuardShutdown(t *testing.T) {
+	announced := make(chan budgetAnnouncement, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a budgetAnnouncement
+		json.NewDecoder(r.Body).Decode(&a)
+		announced <- a
+	}))
+	defer hook.Close()
+
+	launched := time.Unix(1700000000, 0)
+	clock := newFakeClock(launched.Add(time.Hour))
+	poweredOff, exited := false, make(chan struct{})
+	g := &budgetGuard{
+		config: BudgetConfig{TTL: 2 * time.Hour, ShutdownInstance: true, Webhook: hook.URL},
+		clock:  clock,
+		instance: func(context.Context) (budgetInstance, error) {
+			return budgetInstance{ID: "i-0abc", Region: "us-east-1", LaunchedAt: launched}, nil
+		},
+		client:   hook.Client(),
+		poweroff: func() error { poweredOff = true; return nil },
+		exit:     func() { close(exited) },
+	}
+
+	go g.run(context.Background())
+
+	// Checks every budgetCheckInterval until the TTL is close
+	waitForWaiters(t, clock, 1)
+	clock.Advance(55 * time.Minute)
+	waitForWaiters(t, clock, 1)
+	select {
+	case <-exited:
+		t.Fatal("shut down before the TTL")
+	default:
+	}
+	clock.Advance(5 * time.Minute)
+
+	<-exited
+	a := <-announced
+	if a.InstanceID != "i-0abc" || a.TTL != "2h0m0s" || !a.Instance || a.Text == "" {
+		t.Errorf("announcement = %+v", a)
+	}
+	if !poweredOff {
+		t.Error("instance was not powered off")
+	}
+}
+
+// TestEC2Instance verifies the instance identity and TTL tag are read from the metadata service
+func TestEC2Instance(t *testing.T) {
+	md := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			w.Write([]byte("token"))
+		case "/latest/dynamic/instance-identity/document":
+			w.Write([]byte(`{"instanceId": "i-0abc", "region": "eu-west-1", "pendingTime": "2024-03-05T10:00:00Z"}`))
+		case "/latest/meta-data/tags/instance/demo-ttl":
+			w.Write([]byte("8h\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer md.Close()
+	client := imds.New(imds.Options{Endpoint: md.URL})
+
+	inst, err := ec2Instance(context.Background(), client, "demo-ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.ID != "i-0abc" || inst.Region != "eu-west-1" || !inst.LaunchedAt.Equal(time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)) || inst.TagTTL != "8h" {
+		t.Errorf("instance = %+v", inst)
+	}
+
+	// A missing tag is not an error
+	if inst, err := ec2Instance(context.Background(), client, "other"); err != nil || inst.TagTTL != "" {
+		t.Errorf("untagged instance = %+v, %v", inst, err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// productCache keeps product listings in memory for a short TTL so page
+// loads do not each run the same SELECT *. Writes through the API drop it;
+// writes made elsewhere, such as by migrations, show once the TTL expires.
+type productCache struct {
+	clock Clock
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]productCacheEntry // by category, "" for all
+	// generation is bumped by invalidate, so a query that started before
+	// a write does not cache what it read
+	generation uint64
+
+	hits, misses atomic.Int64
+}
+
+type productCacheEntry struct {
+	products []map[string]interface{}
+	expires  time.Time
+}
+
+// CacheStats counts product cache lookups for /health.
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// newProductCache returns a cache holding listings for ttl, or nil (no
+// caching) if ttl is not positive.
+func newProductCache(clock Clock, ttl time.Duration) *productCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &productCache{clock: clock, ttl: ttl, entries: map[string]productCacheEntry{}}
+}
+
+// get returns the cached listing for category, or calls load and caches its
+// result. A nil cache always calls load.
+func (c *productCache) get(category string, load func() ([]map[string]interface{}, error)) ([]map[string]interface{}, error) {
+	if c == nil {
+		return load()
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[category]; ok && c.clock.Now().Before(e.expires) {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return e.products, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	products, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.entries[category] = productCacheEntry{products: products, expires: c.clock.Now().Add(c.ttl)}
+	}
+	return products, nil
+}
+
+// invalidate drops every cached listing.
+func (c *productCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	clear(c.entries)
+}
+
+// stats returns the lookup counters, or nil if caching is off.
+func (c *productCache) stats() *CacheStats {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	return &CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+// invalidateOnWrite drops the cached product listings, in memory and in
+// Redis, and statistics after any request that may have changed products.
+func (s *Server) invalidateOnWrite(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r)
+		if isMutating(r.Method) {
+			s.productCache.invalidate()
+			s.shared.invalidateProducts()
+			s.invalidateProductStats()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestProductCache verifies listings are cached per category until the TTL or an invalidation
+func TestProductCache(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	c := newProductCache(clock, 5*time.Second)
+
+	loads := 0
+	load := func() ([]map[string]interface{}, error) {
+		loads++
+		return []map[string]interface{}{{"id": loads}}, nil
+	}
+	get := func(category string) int {
+		t.Helper()
+		products, err := c.get(category, load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return products[0]["id"].(int)
+	}
+
+	if get("") != 1 || get("") != 1 {
+		t.Error("second lookup within the TTL should be a hit")
+	}
+	if get("IoT") != 2 {
+		t.Error("categories are cached separately")
+	}
+	clock.Advance(5 * time.Second)
+	if get("") != 3 {
+		t.Error("an expired listing should be reloaded")
+	}
+	c.invalidate()
+	if get("") != 4 {
+		t.Error("an invalidated listing should be reloaded")
+	}
+	if st := c.stats(); st.Hits != 1 || st.Misses != 4 || st.Entries != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	// A load that overlaps a write is returned but not cached
+	c.get("Personal", func() ([]map[string]interface{}, error) {
+		c.invalidate()
+		return load()
+	})
+	if get("Personal") != 6 {
+		t.Error("a listing read before a write should not be cached")
+	}
+
+	if _, err := c.get("AI/ML", func() ([]map[string]interface{}, error) { return nil, errors.New("down") }); err == nil {
+		t.Error("expected the load error")
+	}
+	if c.stats().Entries != 1 {
+		t.Error("a failed load should not be cached")
+	}
+
+	var off *productCache
+	if newProductCache(clock, 0) != nil || off.stats() != nil {
+		t.Error("a zero TTL should disable the cache")
+	}
+	before := loads
+	off.get("", load)
+	off.get("", load)
+	off.invalidate()
+	if loads != before+2 {
+		t.Error("a nil cache should always load")
+	}
+}
+
+// TestInvalidateOnWrite verifies writes drop the cached listings and reads keep them
+func TestInvalidateOnWrite(t *testing.T) {
+	s := &Server{clock: newFakeClock(time.Unix(1700000000, 0))}
+	s.productCache = newProductCache(s.clock, time.Minute)
+	h := s.invalidateOnWrite(func(w http.ResponseWriter, r *http.Request) {})
+
+	for method, wantEntries := range map[string]int{
+		http.MethodGet:    1,
+		http.MethodHead:   1,
+		http.MethodPost:   0,
+		http.MethodPatch:  0,
+		http.MethodDelete: 0,
+	} {
+		s.productCache.get("", func() ([]map[string]interface{}, error) { return nil, nil })
+		s.stats = &ProductStatsResponse{}
+		h(httptest.NewRecorder(), httptest.NewRequest(method, "/api/products/1", nil))
+		if got := s.productCache.stats().Entries; got != wantEntries {
+			t.Errorf("%s: %d cached listings, want %d", method, got, wantEntries)
+		}
+		if (s.stats == nil) != (wantEntries == 0) {
+			t.Errorf("%s: cached stats = %v", method, s.stats)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// categoriesHandler lists the product categories, for filtering products
+// with ?category=.
+func (s *Server) categoriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	categories, err := s.store.Categories(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query database: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(categories)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced Clock for tests.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward, firing any timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.at.After(c.now) {
+			w.ch <- c.now
+		} else {
+			pending = append(pending, w)
+		}
+	}
+	c.waiters = pending
+}
+
+// TestFakeClockAfter verifies timers only fire once the clock is advanced past them
+func TestFakeClockAfter(t *testing.T) {
+	c := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ch := c.After(time.Second)
+
+	c.Advance(500 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatalf("Timer fired early")
+	default:
+	}
+
+	c.Advance(500 * time.Millisecond)
+	select {
+	case got := <-ch:
+		if !got.Equal(c.Now()) {
+			t.Errorf("Expected fire time %v, got %v", c.Now(), got)
+		}
+	default:
+		t.Fatalf("Timer did not fire")
+	}
+}
+
+// TestLockedRandIsDeterministic verifies equal seeds give equal sequences
+func TestLockedRandIsDeterministic(t *testing.T) {
+	a, b := newLockedRand(42), newLockedRand(42)
+	for i := 0; i < 10; i++ {
+		if x, y := a.Int63n(1000), b.Int63n(1000); x != y {
+			t.Fatalf("Sequences diverged at %d: %d != %d", i, x, y)
+		}
+	}
+}
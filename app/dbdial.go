@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"tailscale.com/ipn/ipnstate"
+)
+
+// dbDialTraceCount is how many recent database dials are kept for
+// /api/diag/db-path.
+const dbDialTraceCount = 20
+
+// dialSpan is one timed step of a database dial.
+type dialSpan struct {
+	Name       string            `json:"name"` // dns, connect, path or tls
+	Start      time.Time         `json:"start"`
+	DurationMS float64           `json:"duration_ms"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// dialTrace is the spans of one connection to the database, from name
+// resolution to the end of the TLS handshake.
+type dialTrace struct {
+	Address    string     `json:"address"`
+	Start      time.Time  `json:"start"`
+	DurationMS float64    `json:"duration_ms"`
+	Spans      []dialSpan `json:"spans"`
+	Error      string     `json:"error,omitempty"`
+
+	ip netip.Addr // resolved address, for the path report
+}
+
+// DBPath is how traffic to a database host crosses the tailnet, per the
+// node's current view of the peer.
+type DBPath struct {
+	Address    string `json:"address"`
+	Peer       string `json:"peer,omitempty"`        // MagicDNS name of the database node
+	Path       string `json:"path"`                  // direct, relayed or unknown
+	Endpoint   string `json:"endpoint,omitempty"`    // peer's UDP endpoint when direct
+	DERPRegion string `json:"derp_region,omitempty"` // relay region when relayed
+	Error      string `json:"error,omitempty"`
+}
+
+// DBPathReport is the response of /api/diag/db-path.
+type DBPathReport struct {
+	Paths []DBPath    `json:"paths"`
+	Dials []dialTrace `json:"dials"` // recent dials, newest first
+}
+
+// dbDialer connects to the database over the tailnet and traces each
+// connection: resolving the host against the tailnet peers, dialing it
+// (which includes the WireGuard handshake), the path the peer is reached
+// by, and the TLS handshake. Traces are logged and kept for
+// /api/diag/db-path.
+type dbDialer struct {
+	clock  Clock
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+	status func(ctx context.Context) (*ipnstate.Status, error)
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	mu     sync.Mutex
+	traces []*dialTrace // oldest first
+}
+
+func newDBDialer(clock Clock, dial func(ctx context.Context, network, addr string) (net.Conn, error), status func(ctx context.Context) (*ipnstate.Status, error)) *dbDialer {
+	return &dbDialer{clock: clock, dial: dial, status: status, lookup: net.DefaultResolver.LookupHost}
+}
+
+// instrument makes cfg, a per-connection copy, dial through d and report
+// the TLS handshake to the same trace.
+func (d *dbDialer) instrument(cfg *pgconn.Config) {
+	var trace *dialTrace
+	cfg.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		trace = d.begin(addr)
+		conn, err := d.dialTraced(ctx, network, addr, trace)
+		if err != nil {
+			d.finish(trace, err)
+		} else if cfg.TLSConfig == nil {
+			d.finish(trace, nil)
+		}
+		return conn, err
+	}
+
+	traceTLS := func(tc *tls.Config) *tls.Config {
+		if tc == nil {
+			return nil
+		}
+		tc = tc.Clone()
+		verify := tc.VerifyConnection
+		tc.VerifyConnection = func(cs tls.ConnectionState) error {
+			var err error
+			if verify != nil {
+				err = verify(cs)
+			}
+			if trace != nil {
+				d.endTLS(trace, cs, err)
+			}
+			return err
+		}
+		return tc
+	}
+	cfg.TLSConfig = traceTLS(cfg.TLSConfig)
+	for _, fb := range cfg.Fallbacks {
+		fb.TLSConfig = traceTLS(fb.TLSConfig)
+	}
+}
+
+// begin records a new trace for a dial to addr.
+func (d *dbDialer) begin(addr string) *dialTrace {
+	t := &dialTrace{Address: addr, Start: d.clock.Now(), Spans: []dialSpan{}}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.traces = append(d.traces, t)
+	if len(d.traces) > dbDialTraceCount {
+		d.traces = d.traces[len(d.traces)-dbDialTraceCount:]
+	}
+	return t
+}
+
+// span runs fn as the step name of t.
+func (d *dbDialer) span(t *dialTrace, name string, fn func() (map[string]string, error)) error {
+	start := d.clock.Now()
+	attrs, err := fn()
+	s := dialSpan{Name: name, Start: start, DurationMS: msSince(d.clock, start), Attributes: attrs}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	d.mu.Lock()
+	t.Spans = append(t.Spans, s)
+	d.mu.Unlock()
+	return err
+}
+
+func (d *dbDialer) dialTraced(ctx context.Context, network, addr string, t *dialTrace) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ip netip.Addr
+	if err := d.span(t, "dns", func() (map[string]string, error) {
+		var resolver string
+		var err error
+		ip, resolver, err = d.resolve(ctx, host)
+		if err != nil {
+			return map[string]string{"host": host}, err
+		}
+		return map[string]string{"host": host, "resolver": resolver, "address": ip.String()}, nil
+	}); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	t.ip = ip
+	d.mu.Unlock()
+
+	var conn net.Conn
+	if err := d.span(t, "connect", func() (map[string]string, error) {
+		var err error
+		conn, err = d.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		return nil, err
+	}); err != nil {
+		return nil, err
+	}
+
+	// The path is informational; not knowing it does not fail the dial
+	d.span(t, "path", func() (map[string]string, error) {
+		p := d.path(ctx, ip, addr)
+		attrs := map[string]string{"path": p.Path}
+		for k, v := range map[string]string{"peer": p.Peer, "endpoint": p.Endpoint, "derp_region": p.DERPRegion} {
+			if v != "" {
+				attrs[k] = v
+			}
+		}
+		if p.Error != "" {
+			return attrs, errors.New(p.Error)
+		}
+		return attrs, nil
+	})
+	return conn, nil
+}
+
+// resolve finds host among the tailnet peers by MagicDNS or host name, as
+// tsnet would, and otherwise through the system resolver.
+func (d *dbDialer) resolve(ctx context.Context, host string) (netip.Addr, string, error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip, "literal", nil
+	}
+
+	if st, err := d.status(ctx); err == nil {
+		if ip, ok := findPeer(st, host); ok {
+			return ip, "magicdns", nil
+		}
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return netip.Addr{}, "", err
+	}
+	for _, a := range addrs {
+		if ip, err := netip.ParseAddr(a); err == nil {
+			return ip, "system", nil
+		}
+	}
+	return netip.Addr{}, "", fmt.Errorf("no addresses for %s", host)
+}
+
+// findPeer returns the Tailscale IP of the peer in st whose MagicDNS name,
+// short name or host name is host.
+func findPeer(st *ipnstate.Status, host string) (netip.Addr, bool) {
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range st.Peer {
+		dnsName := strings.ToLower(strings.TrimSuffix(p.DNSName, "."))
+		short, _, _ := strings.Cut(dnsName, ".")
+		if len(p.TailscaleIPs) > 0 && (name == dnsName || name == short || name == strings.ToLower(p.HostName)) {
+			return p.TailscaleIPs[0], true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// path reports how the peer with ip is currently reached.
+func (d *dbDialer) path(ctx context.Context, ip netip.Addr, addr string) DBPath {
+	p := DBPath{Address: addr, Path: "unknown"}
+	st, err := d.status(ctx)
+	if err != nil {
+		p.Error = "Tailscale status: " + err.Error()
+		return p
+	}
+	for _, peer := range st.Peer {
+		for _, pip := range peer.TailscaleIPs {
+			if pip != ip {
+				continue
+			}
+			p.Peer = strings.TrimSuffix(peer.DNSName, ".")
+			switch {
+			case peer.CurAddr != "":
+				p.Path, p.Endpoint = "direct", peer.CurAddr
+			case peer.Relay != "":
+				p.Path, p.DERPRegion = "relayed", peer.Relay
+			}
+			return p
+		}
+	}
+	p.Error = fmt.Sprintf("%s is not a tailnet peer", ip)
+	return p
+}
+
+// endTLS records the TLS handshake, measured from the end of the dial so
+// it includes the Postgres SSLRequest round trip.
+func (d *dbDialer) endTLS(t *dialTrace, cs tls.ConnectionState, err error) {
+	d.mu.Lock()
+	start := t.Start
+	if n := len(t.Spans); n > 0 {
+		last := t.Spans[n-1]
+		start = last.Start.Add(time.Duration(last.DurationMS * float64(time.Millisecond)))
+	}
+	s := dialSpan{
+		Name:       "tls",
+		Start:      start,
+		DurationMS: msSince(d.clock, start),
+		Attributes: map[string]string{"version": tls.VersionName(cs.Version), "cipher": tls.CipherSuiteName(cs.CipherSuite)},
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	t.Spans = append(t.Spans, s)
+	d.mu.Unlock()
+	d.finish(t, err)
+}
+
+// finish ends t and logs it.
+func (d *dbDialer) finish(t *dialTrace, err error) {
+	d.mu.Lock()
+	t.DurationMS = msSince(d.clock, t.Start)
+	if err != nil {
+		t.Error = err.Error()
+	}
+	steps := make([]string, len(t.Spans))
+	for i, s := range t.Spans {
+		steps[i] = fmt.Sprintf("%s %.1fms", s.Name, s.DurationMS)
+		if p := s.Attributes["path"]; p != "" {
+			steps[i] += " (" + p + ")"
+		}
+	}
+	d.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Database dial to %s failed after %.1fms [%s]: %v", t.Address, t.DurationMS, strings.Join(steps, ", "), err)
+	} else {
+		log.Printf("Database dial to %s took %.1fms [%s]", t.Address, t.DurationMS, strings.Join(steps, ", "))
+	}
+}
+
+// report returns the current path to each database host dialed, and the
+// recent dials.
+func (d *dbDialer) report(ctx context.Context) DBPathReport {
+	d.mu.Lock()
+	dials := make([]dialTrace, len(d.traces))
+	for i, t := range d.traces {
+		c := *t
+		c.Spans = append([]dialSpan{}, t.Spans...)
+		dials[len(d.traces)-1-i] = c
+	}
+	d.mu.Unlock()
+
+	r := DBPathReport{Paths: []DBPath{}, Dials: dials}
+	seen := map[string]bool{}
+	for _, t := range dials {
+		if seen[t.Address] || !t.ip.IsValid() {
+			continue
+		}
+		seen[t.Address] = true
+		r.Paths = append(r.Paths, d.path(ctx, t.ip, t.Address))
+	}
+	return r
+}
+
+func msSince(clock Clock, start time.Time) float64 {
+	return float64(clock.Now().Sub(start).Microseconds()) / 1000
+}
+
+// dbPathHandler reports whether database traffic crosses the tailnet
+// directly or through DERP, with traces of the recent dials.
+func (s *Server) dbPathHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.dbDialer == nil {
+		http.Error(w, `{"error": "The database is not dialed over the tailnet (set DB_TSNET=true in tsnet mode)"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	json.NewEncoder(w).Encode(s.dbDialer.report(r.Context()))
+}
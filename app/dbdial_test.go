@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/key"
+)
+
+// TestDBDialerTracesDial verifies database dials over the tailnet record the peer, path and timings
+func TestDBDialerTracesDial(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	dbIP := netip.MustParseAddr("100.64.0.7")
+	status := &ipnstate.Status{Peer: map[key.NodePublic]*ipnstate.PeerStatus{
+		key.NewNode().Public(): {HostName: "postgres", DNSName: "postgres.tail1234.ts.net.", TailscaleIPs: []netip.Addr{dbIP}, Relay: "nyc"},
+	}}
+	var dialed string
+	d := newDBDialer(newFakeClock(time.Unix(1700000000, 0)),
+		func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = addr
+			return net.Dial("tcp", srv.Listener.Addr().String())
+		},
+		func(ctx context.Context) (*ipnstate.Status, error) { return status, nil })
+
+	cfg := &pgconn.Config{TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+	d.instrument(cfg)
+	conn, err := cfg.DialFunc(context.Background(), "tcp", "postgres:5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if dialed != "100.64.0.7:5432" {
+		t.Errorf("dialed %q, want the MagicDNS address", dialed)
+	}
+	if err := tls.Client(conn, cfg.TLSConfig).Handshake(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := d.report(context.Background())
+	if len(r.Dials) != 1 {
+		t.Fatalf("got %d dials, want 1", len(r.Dials))
+	}
+	var names []string
+	for _, s := range r.Dials[0].Spans {
+		names = append(names, s.Name)
+	}
+	if got, _ := json.Marshal(names); string(got) != `["dns","connect","path","tls"]` {
+		t.Errorf("spans = %s", got)
+	}
+	if dns := r.Dials[0].Spans[0].Attributes; dns["resolver"] != "magicdns" || dns["address"] != "100.64.0.7" {
+		t.Errorf("dns span attributes = %v", dns)
+	}
+	want := DBPath{Address: "postgres:5432", Peer: "postgres.tail1234.ts.net", Path: "relayed", DERPRegion: "nyc"}
+	if len(r.Paths) != 1 || r.Paths[0] != want {
+		t.Errorf("paths = %+v, want %+v", r.Paths, want)
+	}
+
+	// Once the peers find a direct path the report follows it
+	for _, p := range status.Peer {
+		p.CurAddr = "203.0.113.5:41641"
+	}
+	if p := d.report(context.Background()).Paths[0]; p.Path != "direct" || p.Endpoint != "203.0.113.5:41641" {
+		t.Errorf("path after upgrade = %+v, want direct", p)
+	}
+}
+
+// TestDBDialerResolveFailure verifies a host that does not resolve fails without dialing
+func TestDBDialerResolveFailure(t *testing.T) {
+	d := newDBDialer(newFakeClock(time.Now()),
+		func(ctx context.Context, network, addr string) (net.Conn, error) {
+			t.Fatal("dialed unresolved host")
+			return nil, nil
+		},
+		func(ctx context.Context) (*ipnstate.Status, error) { return &ipnstate.Status{}, nil })
+	d.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+
+	cfg := &pgconn.Config{}
+	d.instrument(cfg)
+	if _, err := cfg.DialFunc(context.Background(), "tcp", "missing:5432"); err == nil {
+		t.Fatal("dial of an unknown host succeeded")
+	}
+	r := d.report(context.Background())
+	if len(r.Dials) != 1 || r.Dials[0].Error == "" || len(r.Paths) != 0 {
+		t.Errorf("report = %+v, want one failed dial and no paths", r)
+	}
+}
+
+// TestDBPathHandlerDisabled verifies /api/diag/db-path answers 503 without DB_TSNET
+func TestDBPathHandlerDisabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Server{}).dbPathHandler(w, httptest.NewRequest(http.MethodGet, "/api/diag/db-path", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", w.Code)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queryTracer is a pgx tracer that remembers when a query last succeeded,
+// for /health, and times every query by name for /metrics. Each connection
+// of the primary and replica pools is configured with it, so it sees all
+// the app's queries without the callers doing anything. Queries slower
+// than slow are logged. Pings bypass tracers, so it only sees real queries.
+type queryTracer struct {
+	clock Clock
+	slow  time.Duration // 0 disables the slow query log
+	logf  func(format string, args ...interface{})
+	last  atomic.Int64 // UnixNano of the last successful query; 0 if none
+
+	durations *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+}
+
+// queryStartKey holds the query's name and start time in its context.
+type queryStartKey struct{}
+
+type queryStart struct {
+	name string
+	sql  string
+	at   time.Time
+}
+
+// queryCallerKey holds a func naming who a request's queries are made
+// for, called only when one is slow.
+type queryCallerKey struct{}
+
+// slowQuerySQLLen is how much of a slow query's SQL is logged.
+const slowQuerySQLLen = 200
+
+// queryDurationBuckets span local queries to slow ones relayed across
+// regions.
+var queryDurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+func newQueryTracer(clock Clock, slow time.Duration) *queryTracer {
+	return &queryTracer{
+		clock: clock,
+		slow:  slow,
+		logf:  log.Printf,
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "demo_db_query_duration_seconds",
+			Help:    "Database query durations by query name, such as select_products.",
+			Buckets: queryDurationBuckets,
+		}, []string{"query"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "demo_db_query_errors_total",
+			Help: "Database queries that failed, by query name.",
+		}, []string{"query"}),
+	}
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{name: queryName(data.SQL), sql: data.SQL, at: t.clock.Now()})
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if data.Err == nil {
+		t.last.Store(t.clock.Now().UnixNano())
+	}
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	took := t.clock.Now().Sub(start.at)
+	t.durations.WithLabelValues(start.name).Observe(took.Seconds())
+	if data.Err != nil {
+		t.errors.WithLabelValues(start.name).Inc()
+	}
+	if t.slow > 0 && took >= t.slow {
+		t.logSlow(ctx, start, took, data.Err)
+	}
+}
+
+// logSlow logs a query that took at least the slow threshold, with the
+// caller of the request it was made for.
+func (t *queryTracer) logSlow(ctx context.Context, start queryStart, took time.Duration, err error) {
+	caller := "-"
+	if who, ok := ctx.Value(queryCallerKey{}).(func() string); ok {
+		caller = who()
+	}
+	sql := strings.Join(strings.Fields(start.sql), " ")
+	if len(sql) > slowQuerySQLLen {
+		sql = sql[:slowQuerySQLLen] + "..."
+	}
+	outcome := ""
+	if err != nil {
+		outcome = " and failed"
+	}
+	t.logf("Slow database query %s took %s (over %s)%s for %s: %s", start.name, took.Round(100*time.Microsecond), t.slow, outcome, caller, sql)
+}
+
+// queryCallerRoute lets the slow query log name who a request's queries
+// were made for. The identity is only looked up once a query is slow.
+func (s *Server) queryCallerRoute(next http.HandlerFunc) http.HandlerFunc {
+	if s.queries == nil || s.queries.slow <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		who := sync.OnceValue(func() string {
+			// the query's context may be done by the time it is logged
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 2*time.Second)
+			defer cancel()
+			u, err := s.tailscaleWhois(ctx, r)
+			switch {
+			case errors.Is(err, errGuest):
+				return "funnel guest"
+			case err != nil:
+				return "unidentified caller"
+			case u.NodeName != "":
+				return u.LoginName + " on " + u.NodeName
+			default:
+				return u.LoginName
+			}
+		})
+		next(w, r.WithContext(context.WithValue(r.Context(), queryCallerKey{}, who)))
+	}
+}
+
+// collectors exports the query durations and errors.
+func (t *queryTracer) collectors() []prometheus.Collector {
+	return []prometheus.Collector{t.durations, t.errors}
+}
+
+// lastSuccess returns when a query last succeeded, or nil if none has.
+func (t *queryTracer) lastSuccess() *time.Time {
+	n := t.last.Load()
+	if n == 0 {
+		return nil
+	}
+	at := time.Unix(0, n).UTC()
+	return &at
+}
+
+// queryTableKeyword is the keyword the table follows in each statement.
+var queryTableKeyword = map[string]string{"select": "from", "delete": "from", "insert": "into", "update": "update"}
+
+// queryName names sql by its statement and the table it works on, such as
+// select_products or insert_orders, so the metrics have one series per
+// kind of query rather than per SQL string. WITH queries are named by
+// their main statement and subqueries in FROM are looked through to the
+// table they read; statements without a table, such as BEGIN, are named
+// by their verb alone.
+func queryName(sql string) string {
+	fields := strings.Fields(stripSQLComments(sql))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	words := make([]string, len(fields))
+	depths := make([]int, len(fields)) // parentheses each word is within
+	depth := 0
+	for i, f := range fields {
+		word := strings.TrimLeft(f, "(")
+		depths[i] = depth + len(f) - len(word)
+		word, _, _ = strings.Cut(word, "(") // products(name, ...
+		words[i] = strings.ToLower(strings.Trim(word, `"),;`))
+		depth += strings.Count(f, "(") - strings.Count(f, ")")
+	}
+
+	main := 0
+	if words[0] == "with" {
+		for i := 1; i < len(words); i++ {
+			if depths[i] == 0 && (words[i] == "select" || words[i] == "insert" || words[i] == "update" || words[i] == "delete") {
+				main = i
+				break
+			}
+		}
+	}
+	verb := words[main]
+	tableAfter, ok := queryTableKeyword[verb]
+	if !ok {
+		return verb
+	}
+	for i := main; i < len(fields)-1; i++ {
+		if words[i] != tableAfter || strings.HasPrefix(fields[i+1], "(") {
+			continue
+		}
+		table := words[i+1]
+		if table == "only" && i+2 < len(words) {
+			table = words[i+2]
+		}
+		if table != "" {
+			return verb + "_" + table
+		}
+	}
+	return verb
+}
+
+// stripSQLComments removes -- line comments from sql.
+func stripSQLComments(sql string) string {
+	if !strings.Contains(sql, "--") {
+		return sql
+	}
+	lines := strings.Split(sql, "\n")
+	for i, line := range lines {
+		if j := strings.Index(line, "--"); j >= 0 {
+			lines[i] = line[:j]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
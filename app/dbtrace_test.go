@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestQueryTracer verifies the last successful query time ignores failed queries
+func TestQueryTracer(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0).UTC())
+	tr := newQueryTracer(clock, 0)
+	if at := tr.lastSuccess(); at != nil {
+		t.Fatalf("lastSuccess = %v before any query", at)
+	}
+
+	tr.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+	want := clock.Now()
+	clock.Advance(time.Minute)
+	tr.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	if at := tr.lastSuccess(); at == nil || !at.Equal(want) {
+		t.Errorf("lastSuccess = %v, want %v", at, want)
+	}
+}
+
+// TestQueryTracerMetrics verifies queries are counted and timed by name and outcome
+func TestQueryTracerMetrics(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0).UTC())
+	tr := newQueryTracer(clock, 0)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tr.collectors()...)
+
+	run := func(sql string, took time.Duration, err error) {
+		ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql})
+		clock.Advance(took)
+		tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: err})
+	}
+	run(`SELECT * FROM products ORDER BY created_at DESC LIMIT $1`, 3*time.Millisecond, nil)
+	run(`SELECT * FROM products WHERE id = $1`, 40*time.Millisecond, nil)
+	run(`INSERT INTO orders (login) VALUES ($1) RETURNING id`, time.Millisecond, errors.New("boom"))
+
+	w := httptest.NewRecorder()
+	(&Server{metrics: reg}).metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`demo_db_query_duration_seconds_bucket{query="select_products",le="0.005"} 1`,
+		`demo_db_query_duration_seconds_bucket{query="select_products",le="0.05"} 2`,
+		`demo_db_query_duration_seconds_sum{query="select_products"} 0.043`,
+		`demo_db_query_duration_seconds_count{query="insert_orders"} 1`,
+		`demo_db_query_errors_total{query="insert_orders"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	if strings.Contains(body, `demo_db_query_errors_total{query="select_products"}`) {
+		t.Errorf("errors counted for successful queries")
+	}
+}
+
+// TestQueryName verifies queries are named by their statement and main table
+func TestQueryName(t *testing.T) {
+	for sql, want := range map[string]string{
+		`SELECT * FROM products WHERE id = $1`:                                     "select_products",
+		"\n\tSELECT id, name\n\tFROM \"categories\"\n\tORDER BY name":              "select_categories",
+		`INSERT INTO products(name, price) VALUES ($1, $2)`:                        "insert_products",
+		`UPDATE products SET price = $1 WHERE id = $2`:                             "update_products",
+		`DELETE FROM reviews WHERE id = $1`:                                        "delete_reviews",
+		`SELECT agg.count FROM (SELECT count(*) AS count FROM products) agg`:       "select_products",
+		`WITH recent AS (SELECT * FROM orders) DELETE FROM order_items WHERE true`: "delete_order_items",
+		`-- name: version` + "\nSELECT version()":                                  "select",
+		`BEGIN READ ONLY`: "begin",
+		`   `:             "unknown",
+	} {
+		if got := queryName(sql); got != want {
+			t.Errorf("queryName(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+// TestQueryTracerSlowLog verifies queries over the threshold are logged with their duration
+func TestQueryTracerSlowLog(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0).UTC())
+	tr := newQueryTracer(clock, 200*time.Millisecond)
+	var logged []string
+	tr.logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+
+	run := func(ctx context.Context, sql string, took time.Duration, err error) {
+		ctx = tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql})
+		clock.Advance(took)
+		tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: err})
+	}
+	calls := 0
+	ctx := context.WithValue(context.Background(), queryCallerKey{}, func() string { calls++; return "alice@example.com on laptop" })
+	run(ctx, "SELECT * FROM products WHERE id = $1", 20*time.Millisecond, nil)
+	if len(logged) != 0 || calls != 0 {
+		t.Fatalf("fast query logged %q, caller looked up %d times", logged, calls)
+	}
+
+	run(ctx, "SELECT *\n\tFROM products\n\tWHERE id = $1", 412*time.Millisecond, nil)
+	run(context.Background(), "DELETE FROM sessions WHERE expires_at < now()", 250*time.Millisecond, errors.New("boom"))
+	want := []string{
+		"Slow database query select_products took 412ms (over 200ms) for alice@example.com on laptop: SELECT * FROM products WHERE id = $1",
+		"Slow database query delete_sessions took 250ms (over 200ms) and failed for -: DELETE FROM sessions WHERE expires_at < now()",
+	}
+	if strings.Join(logged, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logged:\n%s\nwant:\n%s", strings.Join(logged, "\n"), strings.Join(want, "\n"))
+	}
+
+	tr.slow = 0
+	run(ctx, "SELECT pg_sleep(1)", time.Second, nil)
+	if len(logged) != 2 {
+		t.Errorf("logged %q with the threshold disabled", logged[2:])
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+)
+
+const (
+	// derpNearbyRegions is how many of the lowest-latency regions are
+	// reported
+	derpNearbyRegions = 5
+
+	// derpReportTTL is how long a latency measurement is reused; a full
+	// netcheck takes a few seconds
+	derpReportTTL = 30 * time.Second
+)
+
+// DERPRegionInfo summarizes one DERP region.
+type DERPRegionInfo struct {
+	ID        int      `json:"id"`
+	Code      string   `json:"code"`
+	Name      string   `json:"name"`
+	Nodes     int      `json:"nodes"`
+	LatencyMS *float64 `json:"latency_ms,omitempty"`
+	Home      bool     `json:"home,omitempty"`
+}
+
+// DERPDiagnostics is the response of /api/diag/derp.
+type DERPDiagnostics struct {
+	HomeRegion      *DERPRegionInfo  `json:"home_region,omitempty"`
+	PreferredRegion int              `json:"preferred_region,omitempty"` // lowest latency per netcheck
+	Regions         []DERPRegionInfo `json:"regions"`
+	TotalRegions    int              `json:"total_regions"`
+	MeasuredAt      *time.Time       `json:"measured_at,omitempty"`
+	NetcheckError   string           `json:"netcheck_error,omitempty"`
+}
+
+// buildDERPDiagnostics combines the DERP map, the node's home region code
+// and a netcheck report (which may be nil) into the nearest limit regions,
+// plus the home region if it is not among them.
+func buildDERPDiagnostics(dm *tailcfg.DERPMap, homeCode string, report *netcheck.Report, limit int) DERPDiagnostics {
+	diag := DERPDiagnostics{Regions: []DERPRegionInfo{}}
+	if dm == nil {
+		return diag
+	}
+	diag.TotalRegions = len(dm.Regions)
+
+	var regions []DERPRegionInfo
+	for _, id := range dm.RegionIDs() {
+		r := dm.Regions[id]
+		info := DERPRegionInfo{ID: r.RegionID, Code: r.RegionCode, Name: r.RegionName, Nodes: len(r.Nodes), Home: r.RegionCode == homeCode && homeCode != ""}
+		if report != nil {
+			if d, ok := report.RegionLatency[id]; ok {
+				ms := float64(d.Microseconds()) / 1000
+				info.LatencyMS = &ms
+			}
+		}
+		if info.Home {
+			home := info
+			diag.HomeRegion = &home
+		}
+		regions = append(regions, info)
+	}
+
+	// Nearest first; unmeasured regions keep their ID order at the end
+	sort.SliceStable(regions, func(i, j int) bool {
+		a, b := regions[i].LatencyMS, regions[j].LatencyMS
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a < *b
+	})
+
+	homeListed := false
+	for _, r := range regions {
+		if len(diag.Regions) == limit || (report != nil && r.LatencyMS == nil) {
+			break
+		}
+		diag.Regions = append(diag.Regions, r)
+		homeListed = homeListed || r.Home
+	}
+	if diag.HomeRegion != nil && !homeListed {
+		diag.Regions = append(diag.Regions, *diag.HomeRegion)
+	}
+
+	if report != nil {
+		diag.PreferredRegion = report.PreferredDERP
+	}
+	return diag
+}
+
+// derpLatencyReport measures latency to the DERP regions in dm, reusing a
+// recent measurement.
+func (s *Server) derpLatencyReport(ctx context.Context, dm *tailcfg.DERPMap) (*netcheck.Report, time.Time, error) {
+	s.derpMu.Lock()
+	defer s.derpMu.Unlock()
+
+	if s.derpReport != nil && s.clock.Now().Sub(s.derpReportAt) < derpReportTTL {
+		return s.derpReport, s.derpReportAt, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	c := &netcheck.Client{Logf: logger.Discard}
+	if err := c.Standalone(ctx, ""); err != nil {
+		return nil, time.Time{}, err
+	}
+	report, err := c.GetReport(ctx, dm)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	s.derpReport, s.derpReportAt = report, s.clock.Now()
+	return report, s.derpReportAt, nil
+}
+
+// derpHandler reports the DERP map, this node's home region and measured
+// latencies to nearby regions.
+func (s *Server) derpHandler(w http.ResponseWriter, r *http.Request) {
+	if s.client == nil {
+		http.Error(w, `{"error": "DERP diagnostics require tsnet mode"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+
+	dm, err := s.client.CurrentDERPMap(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "Failed to get DERP map: "+err.Error())
+		return
+	}
+	st, err := s.client.StatusWithoutPeers(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "Failed to get Tailscale status: "+err.Error())
+		return
+	}
+	homeCode := ""
+	if st.Self != nil {
+		homeCode = st.Self.Relay
+	}
+
+	report, at, err := s.derpLatencyReport(r.Context(), dm)
+	diag := buildDERPDiagnostics(dm, homeCode, report, derpNearbyRegions)
+	if err != nil {
+		diag.NetcheckError = err.Error()
+	} else {
+		diag.MeasuredAt = &at
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diag)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+)
+
+func testDERPMap() *tailcfg.DERPMap {
+	dm := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{}}
+	for i, code := range []string{"nyc", "sfo", "fra", "lhr", "syd"} {
+		dm.Regions[i+1] = &tailcfg.DERPRegion{
+			RegionID:   i + 1,
+			RegionCode: code,
+			RegionName: code,
+			Nodes:      []*tailcfg.DERPNode{{Name: code + "1"}},
+		}
+	}
+	return dm
+}
+
+// TestBuildDERPDiagnostics verifies regions are ordered by latency, limited,
+// and that the home region is always included
+func TestBuildDERPDiagnostics(t *testing.T) {
+	report := &netcheck.Report{
+		PreferredDERP: 3,
+		RegionLatency: map[int]time.Duration{
+			1: 80 * time.Millisecond,
+			2: 150 * time.Millisecond,
+			3: 12 * time.Millisecond,
+			4: 20 * time.Millisecond,
+		},
+	}
+
+	diag := buildDERPDiagnostics(testDERPMap(), "sfo", report, 2)
+	if diag.TotalRegions != 5 || diag.PreferredRegion != 3 {
+		t.Errorf("Expected 5 regions and preferred 3, got %d and %d", diag.TotalRegions, diag.PreferredRegion)
+	}
+	if diag.HomeRegion == nil || diag.HomeRegion.Code != "sfo" || !diag.HomeRegion.Home {
+		t.Fatalf("Expected home region sfo, got %+v", diag.HomeRegion)
+	}
+
+	var codes []string
+	for _, r := range diag.Regions {
+		codes = append(codes, r.Code)
+	}
+	want := []string{"fra", "lhr", "sfo"}
+	if len(codes) != len(want) {
+		t.Fatalf("Expected regions %v, got %v", want, codes)
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("Expected regions %v, got %v", want, codes)
+		}
+	}
+	if got := *diag.Regions[0].LatencyMS; got != 12 {
+		t.Errorf("Expected fra latency 12ms, got %v", got)
+	}
+
+	// Without a measurement the regions are listed in ID order
+	diag = buildDERPDiagnostics(testDERPMap(), "", nil, 2)
+	if len(diag.Regions) != 2 || diag.Regions[0].Code != "nyc" || diag.Regions[0].LatencyMS != nil {
+		t.Errorf("Unexpected unmeasured regions %+v", diag.Regions)
+	}
+}
+
+// TestDERPHandlerRequiresTsnet verifies /api/diag/derp answers 503 outside tsnet mode
+func TestDERPHandlerRequiresTsnet(t *testing.T) {
+	s := newServer(nil, false)
+	rec := httptest.NewRecorder()
+	s.derpHandler(rec, httptest.NewRequest(http.MethodGet, "/api/diag/derp", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+}
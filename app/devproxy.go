@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// DevProxyCmd runs a local reverse proxy that adds the identity headers
+// Tailscale Serve would, so the header-based identity path can be exercised
+// without tailscale installed. It is for development only: anyone who can
+// reach it is treated as the configured user.
+type DevProxyCmd struct {
+	Listen      string `env:"DEV_PROXY_LISTEN" default:"127.0.0.1:8081" help:"Address to listen on (loopback only unless --allow-remote)"`
+	Target      string `env:"DEV_PROXY_TARGET" default:"http://127.0.0.1:8080" help:"URL of the app to proxy to"`
+	Login       string `env:"DEV_PROXY_LOGIN" default:"dev@example.com" help:"Login name sent as Tailscale-User-Login"`
+	Name        string `env:"DEV_PROXY_NAME" default:"Dev User" help:"Display name sent as Tailscale-User-Name"`
+	ProfilePic  string `env:"DEV_PROXY_PROFILE_PIC" help:"Profile picture URL sent as Tailscale-User-Profile-Pic"`
+	Funnel      bool   `help:"Emulate a Funnel visitor instead: mark requests as Funnel and send no identity"`
+	AllowRemote bool   `help:"Allow listening on a non-loopback address"`
+}
+
+// devIdentity is the synthetic identity the dev proxy injects.
+type devIdentity struct {
+	Login      string
+	Name       string
+	ProfilePic string
+	Funnel     bool
+}
+
+func (c *DevProxyCmd) Run() error {
+	target, err := url.Parse(c.Target)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return fmt.Errorf("invalid --target %q: want a URL such as http://127.0.0.1:8080", c.Target)
+	}
+	if !c.AllowRemote {
+		if err := requireLoopback(c.Listen); err != nil {
+			return err
+		}
+	}
+	if !c.Funnel && c.Login == "" {
+		return errors.New("--login is required unless --funnel is set")
+	}
+
+	id := devIdentity{Login: c.Login, Name: c.Name, ProfilePic: c.ProfilePic, Funnel: c.Funnel}
+	if id.Funnel {
+		log.Printf("Dev proxy on http://%s -> %s as a Funnel visitor", c.Listen, target)
+	} else {
+		log.Printf("Dev proxy on http://%s -> %s as %s (%s)", c.Listen, target, id.Login, id.Name)
+	}
+	log.Printf("Warning: every request through the dev proxy is trusted as this identity; do not expose it")
+
+	return http.ListenAndServe(c.Listen, devProxyHandler(target, id))
+}
+
+// requireLoopback rejects listen addresses that are reachable from other
+// machines.
+func requireLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --listen %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("dev-proxy only listens on loopback addresses (got %q); pass --allow-remote to override", addr)
+}
+
+// devProxyHandler proxies to target the way Tailscale Serve does: identity
+// headers sent by the client are dropped and replaced with id's, and
+// X-Forwarded-* headers are set.
+func devProxyHandler(target *url.URL, id devIdentity) http.Handler {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Host = pr.In.Host
+
+			for k := range pr.Out.Header {
+				if strings.HasPrefix(k, "Tailscale-") {
+					pr.Out.Header.Del(k)
+				}
+			}
+
+			if id.Funnel {
+				pr.Out.Header.Set("Tailscale-Funnel-Request", "?1")
+				return
+			}
+			pr.Out.Header.Set("Tailscale-User-Login", encodeServeHeader(id.Login))
+			pr.Out.Header.Set("Tailscale-User-Name", encodeServeHeader(id.Name))
+			if id.ProfilePic != "" {
+				pr.Out.Header.Set("Tailscale-User-Profile-Pic", id.ProfilePic)
+			}
+			pr.Out.Header.Set("Tailscale-Headers-Info", "https://tailscale.com/s/serve-headers")
+		},
+	}
+}
+
+// encodeServeHeader encodes non-ASCII header values as RFC 2047 encoded
+// words, as Tailscale Serve does for user names.
+func encodeServeHeader(v string) string {
+	return mime.QEncoding.Encode("utf-8", v)
+}
+
+// decodeServeHeader reverses encodeServeHeader, returning v unchanged if it
+// is not encoded.
+func decodeServeHeader(v string) string {
+	dec, err := new(mime.WordDecoder).DecodeHeader(v)
+	if err != nil {
+		return v
+	}
+	return dec
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// proxiedUser fetches /api/user through a dev proxy configured with id.
+func proxiedUser(t *testing.T, id devIdentity, header http.Header) (int, UserInfo) {
+	t.Helper()
+	s := newServer(nil, false)
+	app := httptest.NewServer(s.guestMode(s.handler()))
+	defer app.Close()
+
+	target, _ := url.Parse(app.URL)
+	proxy := httptest.NewServer(devProxyHandler(target, id))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/api/user", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var user UserInfo
+	json.NewDecoder(resp.Body).Decode(&user)
+	return resp.StatusCode, user
+}
+
+// TestDevProxyIdentity verifies the app sees the proxy's identity, not the
+// client's, and that non-ASCII names survive the header encoding
+func TestDevProxyIdentity(t *testing.T) {
+	spoofed := http.Header{"Tailscale-User-Login": {"mallory@example.com"}}
+	code, user := proxiedUser(t, devIdentity{Login: "dev@example.com", Name: "Zoë Dev"}, spoofed)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if !user.Connected || user.LoginName != "dev@example.com" || user.DisplayName != "Zoë Dev" {
+		t.Errorf("Unexpected user %+v", user)
+	}
+}
+
+// TestDevProxyFunnel verifies a Funnel identity makes the caller a guest whatever headers are sent
+func TestDevProxyFunnel(t *testing.T) {
+	_, user := proxiedUser(t, devIdentity{Funnel: true}, http.Header{"Tailscale-User-Login": {"mallory@example.com"}})
+	if !user.Guest || user.Connected {
+		t.Errorf("Expected a guest, got %+v", user)
+	}
+}
+
+// TestRequireLoopback verifies the dev proxy only listens on loopback addresses
+func TestRequireLoopback(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:8081", "[::1]:8081", "localhost:8081"} {
+		if err := requireLoopback(addr); err != nil {
+			t.Errorf("requireLoopback(%q) = %v", addr, err)
+		}
+	}
+	for _, addr := range []string{":8081", "0.0.0.0:8081", "192.168.1.10:8081"} {
+		if err := requireLoopback(addr); err == nil {
+			t.Errorf("requireLoopback(%q) succeeded", addr)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+// diagnosticsTimeout bounds each check, within the analysis route timeout.
+const diagnosticsTimeout = 8 * time.Second
+
+// DiagnosticCheck is the outcome of one /api/diagnostics check.
+type DiagnosticCheck struct {
+	Status     string  `json:"status"` // ok, failed or skipped
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"` // why it failed or was skipped
+}
+
+// DatabaseDiagnostic is a round trip to the database.
+type DatabaseDiagnostic struct {
+	DiagnosticCheck
+	Version string `json:"version,omitempty"`
+}
+
+// PingDiagnostic is a disco ping to a tailnet peer, which shows whether
+// it is reached directly or through DERP.
+type PingDiagnostic struct {
+	DiagnosticCheck
+	Peer       string   `json:"peer,omitempty"`
+	IP         string   `json:"ip,omitempty"`
+	Node       string   `json:"node,omitempty"`
+	LatencyMS  *float64 `json:"latency_ms,omitempty"`
+	Path       string   `json:"path,omitempty"`        // direct or relayed
+	Endpoint   string   `json:"endpoint,omitempty"`    // peer's UDP endpoint when direct
+	DERPRegion string   `json:"derp_region,omitempty"` // relay region when relayed
+}
+
+// DERPDiagnostic is the netcheck summary of /api/diag/derp.
+type DERPDiagnostic struct {
+	DiagnosticCheck
+	Report *DERPDiagnostics `json:"report,omitempty"`
+}
+
+// DiagnosticsReport is the response of /api/diagnostics.
+type DiagnosticsReport struct {
+	Status     string  `json:"status"` // ok, or degraded if a check failed
+	DurationMS float64 `json:"duration_ms"`
+
+	Database DatabaseDiagnostic `json:"database"`
+	Ping     PingDiagnostic     `json:"ping"`
+	DERP     DERPDiagnostic     `json:"derp"`
+}
+
+// timeCheck runs fn and fills in c from its duration and error.
+func (s *Server) timeCheck(c *DiagnosticCheck, fn func() error) {
+	start := s.clock.Now()
+	err := fn()
+	c.DurationMS = msSince(s.clock, start)
+	c.Status = "ok"
+	if err != nil {
+		c.Status, c.Error = "failed", err.Error()
+	}
+}
+
+func skippedCheck(reason string) DiagnosticCheck {
+	return DiagnosticCheck{Status: "skipped", Error: reason}
+}
+
+// diagnoseDatabase times a query to the primary database.
+func (s *Server) diagnoseDatabase(ctx context.Context) DatabaseDiagnostic {
+	var d DatabaseDiagnostic
+	s.timeCheck(&d.DiagnosticCheck, func() error {
+		return s.db.QueryRowContext(ctx, "SELECT version()").Scan(&d.Version)
+	})
+	return d
+}
+
+// diagnosePing pings peer, a MagicDNS name, host name or Tailscale IP.
+func (s *Server) diagnosePing(ctx context.Context, peer string) PingDiagnostic {
+	switch {
+	case s.client == nil:
+		return PingDiagnostic{DiagnosticCheck: skippedCheck("tailnet checks require tsnet mode")}
+	case peer == "":
+		return PingDiagnostic{DiagnosticCheck: skippedCheck("no peer to ping; set DIAG_PING_PEER or pass ?peer=")}
+	}
+
+	d := PingDiagnostic{Peer: peer}
+	s.timeCheck(&d.DiagnosticCheck, func() error {
+		ip, err := netip.ParseAddr(peer)
+		if err != nil {
+			st, err := s.client.Status(ctx)
+			if err != nil {
+				return fmt.Errorf("Tailscale status: %w", err)
+			}
+			var ok bool
+			if ip, ok = findPeer(st, peer); !ok {
+				return fmt.Errorf("%s is not a tailnet peer", peer)
+			}
+		}
+		d.IP = ip.String()
+		res, err := s.client.Ping(ctx, ip, tailcfg.PingDisco)
+		if err != nil {
+			return err
+		}
+		return d.fill(res)
+	})
+	return d
+}
+
+// fill copies a ping result into d, returning its error.
+func (d *PingDiagnostic) fill(res *ipnstate.PingResult) error {
+	d.Node = res.NodeName
+	if res.Err != "" {
+		return fmt.Errorf("%s", res.Err)
+	}
+	ms := res.LatencySeconds * 1000
+	d.LatencyMS = &ms
+	switch {
+	case res.Endpoint != "":
+		d.Path, d.Endpoint = "direct", res.Endpoint
+	case res.DERPRegionCode != "":
+		d.Path, d.DERPRegion = "relayed", res.DERPRegionCode
+	}
+	return nil
+}
+
+// diagnoseDERP summarizes the DERP map and a netcheck, as /api/diag/derp.
+func (s *Server) diagnoseDERP(ctx context.Context) DERPDiagnostic {
+	if s.client == nil {
+		return DERPDiagnostic{DiagnosticCheck: skippedCheck("tailnet checks require tsnet mode")}
+	}
+	var d DERPDiagnostic
+	s.timeCheck(&d.DiagnosticCheck, func() error {
+		dm, err := s.client.CurrentDERPMap(ctx)
+		if err != nil {
+			return fmt.Errorf("DERP map: %w", err)
+		}
+		homeCode := ""
+		if st, err := s.client.StatusWithoutPeers(ctx); err == nil && st.Self != nil {
+			homeCode = st.Self.Relay
+		}
+		report, at, err := s.derpLatencyReport(ctx, dm)
+		diag := buildDERPDiagnostics(dm, homeCode, report, derpNearbyRegions)
+		d.Report = &diag
+		if err != nil {
+			diag.NetcheckError = err.Error()
+			return fmt.Errorf("netcheck: %w", err)
+		}
+		diag.MeasuredAt = &at
+		return nil
+	})
+	return d
+}
+
+// diagnosticsHandler runs the database, ping and DERP checks at once and
+// reports each with its timing, for troubleshooting the demo environment.
+// A failed check makes the report degraded but is still a 200: the report
+// is the answer.
+func (s *Server) diagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	peer := strings.TrimSpace(r.URL.Query().Get("peer"))
+	if peer == "" {
+		peer = s.diagPingPeer
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), diagnosticsTimeout)
+	defer cancel()
+
+	start := s.clock.Now()
+	var report DiagnosticsReport
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); report.Database = s.diagnoseDatabase(ctx) }()
+	go func() { defer wg.Done(); report.Ping = s.diagnosePing(ctx, peer) }()
+	go func() { defer wg.Done(); report.DERP = s.diagnoseDERP(ctx) }()
+	wg.Wait()
+	report.DurationMS = msSince(s.clock, start)
+
+	report.Status = "ok"
+	for _, c := range []DiagnosticCheck{report.Database.DiagnosticCheck, report.Ping.DiagnosticCheck, report.DERP.DiagnosticCheck} {
+		if c.Status == "failed" {
+			report.Status = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/key"
+)
+
+// TestDiagnosticsHandler verifies each check is reported, with tailnet
+// checks skipped outside tsnet mode and an unreachable database degrading
+// the report
+func TestDiagnosticsHandler(t *testing.T) {
+	db, err := sql.Open(store.DriverName, "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &Server{db: db, clock: systemClock{}}
+
+	w := httptest.NewRecorder()
+	s.diagnosticsHandler(w, httptest.NewRequest(http.MethodGet, "/api/diagnostics?peer=db", nil))
+	var report DiagnosticsReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || report.Status != "degraded" {
+		t.Errorf("status %d, report %s", w.Code, report.Status)
+	}
+	if report.Database.Status != "failed" || report.Database.Error == "" {
+		t.Errorf("database = %+v", report.Database)
+	}
+	for name, c := range map[string]DiagnosticCheck{"ping": report.Ping.DiagnosticCheck, "derp": report.DERP.DiagnosticCheck} {
+		if c.Status != "skipped" || c.Error != "tailnet checks require tsnet mode" {
+			t.Errorf("%s = %+v", name, c)
+		}
+	}
+}
+
+// TestPingDiagnosticFill verifies pings report latency and whether the path is direct or relayed
+func TestPingDiagnosticFill(t *testing.T) {
+	var d PingDiagnostic
+	if err := d.fill(&ipnstate.PingResult{NodeName: "db", LatencySeconds: 0.0125, Endpoint: "203.0.113.7:41641"}); err != nil {
+		t.Fatal(err)
+	}
+	if d.Node != "db" || d.LatencyMS == nil || *d.LatencyMS != 12.5 || d.Path != "direct" || d.Endpoint != "203.0.113.7:41641" {
+		t.Errorf("direct = %+v", d)
+	}
+
+	d = PingDiagnostic{}
+	d.fill(&ipnstate.PingResult{NodeName: "db", LatencySeconds: 0.08, DERPRegionCode: "fra"})
+	if d.Path != "relayed" || d.DERPRegion != "fra" {
+		t.Errorf("relayed = %+v", d)
+	}
+
+	d = PingDiagnostic{}
+	if err := d.fill(&ipnstate.PingResult{Err: "timeout"}); err == nil || err.Error() != "timeout" || d.LatencyMS != nil {
+		t.Errorf("failed = %+v, %v", d, err)
+	}
+}
+
+// TestFindPeer verifies peers are found by short name, MagicDNS name or host name
+func TestFindPeer(t *testing.T) {
+	ip := netip.MustParseAddr("100.64.0.7")
+	st := &ipnstate.Status{Peer: map[key.NodePublic]*ipnstate.PeerStatus{
+		key.NewNode().Public(): {DNSName: "db.tailnet-1234.ts.net.", HostName: "postgres", TailscaleIPs: []netip.Addr{ip}},
+	}}
+	for _, name := range []string{"db", "DB.tailnet-1234.ts.net", "db.tailnet-1234.ts.net.", "postgres"} {
+		if got, ok := findPeer(st, name); !ok || got != ip {
+			t.Errorf("findPeer(%q) = %v, %v", name, got, ok)
+		}
+	}
+	if _, ok := findPeer(st, "web"); ok {
+		t.Errorf("found a peer that is not in the tailnet")
+	}
+}
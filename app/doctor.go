@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/paths"
+	"tailscale.com/types/logger"
+)
+
+// staticRequired are the UI files the pages and their assets need.
+var staticRequired = []string{"index.html", "admin.html", "app.js", "admin.js", "style.css"}
+
+// DoctorCmd checks the environment serve would run in, as most demo
+// failures are a missing setting, an unreachable database or a bad key
+// that otherwise surface as runtime errors. It reads the same settings as
+// serve, prints each check with what to do about a failure, and exits
+// non-zero if any failed.
+type DoctorCmd struct {
+	ServeCmd `embed:""`
+
+	Timeout time.Duration `default:"10s" help:"How long each check may take"`
+}
+
+// doctorResult is the outcome of one doctor check.
+type doctorResult struct {
+	name   string
+	status string // ok, warn, fail or skip
+	detail string
+	fix    string // what to do about a warn or fail
+}
+
+func (c *DoctorCmd) Run() error {
+	results := c.checkConfig()
+	for _, check := range []func(context.Context) doctorResult{
+		c.checkDatabase,
+		c.checkTailscaled,
+		c.checkAuthKey,
+		func(context.Context) doctorResult { return checkStatic(c.StaticDir) },
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		results = append(results, check(ctx))
+		cancel()
+	}
+	return printDoctor(os.Stdout, results)
+}
+
+// printDoctor writes results to w, and returns an error if any failed.
+func printDoctor(w io.Writer, results []doctorResult) error {
+	failed := 0
+	for _, r := range results {
+		label := r.status
+		if r.status == "warn" || r.status == "fail" {
+			label = strings.ToUpper(r.status)
+		}
+		fmt.Fprintf(w, "%-4s  %-16s %s\n", label, r.name, r.detail)
+		if r.fix != "" {
+			fmt.Fprintf(w, "      %-16s fix: %s\n", "", r.fix)
+		}
+		if r.status == "fail" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// checkConfig runs the validation serve does at startup, reporting every
+// problem rather than the first.
+func (c *DoctorCmd) checkConfig() []doctorResult {
+	const help = "See `tailscale-demo serve --help` for the setting"
+	checks := []struct {
+		validate func() error
+		fix      string
+	}{
+		{c.loadAuthKeyFile, "Set only one of TS_AUTHKEY, TS_AUTHKEY_FILE and TS_AUTHKEY_SECRET, and check the file or secret exists"},
+		{func() error { return c.OAuth.validate(c.UseTsnet, c.TailscaleAuthKey) }, "Set TS_OAUTH_CLIENT_ID, TS_OAUTH_CLIENT_SECRET and TS_OAUTH_TAGS together, with TSNET=true and without TS_AUTHKEY"},
+		{func() error { return c.TLS.validate(c.UseTsnet) }, help},
+		{func() error {
+			if len(c.PostureRules) > 0 && !c.UseTsnet {
+				return errors.New("POSTURE_RULES needs TSNET=true: device posture is checked via WhoIs")
+			}
+			return nil
+		}, "Set TSNET=true, or unset POSTURE_RULES"},
+		{func() error {
+			if c.DBOverTailnet && !c.UseTsnet {
+				return errors.New("DB_TSNET=true requires TSNET=true")
+			}
+			return nil
+		}, "Set TSNET=true, or unset DB_TSNET to dial the database directly"},
+		{func() error {
+			if c.ListenLocal == "" {
+				return nil
+			}
+			return checkListenLocal(c.ListenLocal)
+		}, "Use a loopback address such as 127.0.0.1:8080 for LISTEN_LOCAL"},
+		{func() error { _, err := parseSocketMode(c.ListenUnixMode); return err }, "Set LISTEN_UNIX_MODE to octal permissions such as 0660"},
+		{func() error { _, err := parseRouteTimeouts(c.RouteTimeouts); return err }, "Use GROUP=DURATION entries in ROUTE_TIMEOUTS, such as api=2s,files=5m"},
+		{func() error { _, err := parseWaitFor(c.WaitFor, c.WaitTimeout); return err }, "Use DEP[:TIMEOUT] entries of db, tailscale and redis in WAIT_FOR, such as tailscale:2m,db:30s"},
+		{func() error { _, err := newLiveConfig(&c.ServeCmd); return err }, help},
+		{func() error {
+			resolved, err := c.DBConfig.resolve()
+			if err != nil {
+				return err
+			}
+			return resolved.validateTLS()
+		}, "Check DATABASE_URL and the DB_SSL* settings"},
+	}
+
+	var results []doctorResult
+	for _, check := range checks {
+		if err := check.validate(); err != nil {
+			results = append(results, doctorResult{name: "configuration", status: "fail", detail: err.Error(), fix: check.fix})
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, doctorResult{name: "configuration", status: "ok", detail: "settings are valid"})
+	}
+	return results
+}
+
+// checkDatabase connects to the database as serve would and checks its
+// migrations are applied.
+func (c *DoctorCmd) checkDatabase(ctx context.Context) doctorResult {
+	r := doctorResult{name: "database"}
+	if c.DBOverTailnet {
+		r.status, r.detail = "skip", "DB_TSNET dials the database over the tailnet, which doctor does not join; GET /api/diagnostics checks it from the running server"
+		return r
+	}
+	resolved, err := c.DBConfig.resolve()
+	if err != nil {
+		r.status, r.detail = "skip", "the database settings are invalid"
+		return r
+	}
+
+	if err := c.DBConfig.loadVaultCreds(); err != nil {
+		r.status, r.detail, r.fix = "fail", err.Error(), "Check VAULT_ADDR, VAULT_TOKEN and that VAULT_DB_CREDS names a database secrets engine role"
+		return r
+	}
+	if c.vaultCreds != nil {
+		defer c.vaultCreds.close()
+	}
+	db, err := newDB(c.DBConfig)
+	if err != nil {
+		r.status, r.detail, r.fix = "fail", err.Error(), "Check DB_PASSWORD_FILE or DB_PASSWORD_SECRET and SECRETS_PROVIDER"
+		return r
+	}
+	defer db.Close()
+
+	addr := net.JoinHostPort(resolved.DBHost, resolved.DBPort)
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT version()").Scan(&version); err != nil {
+		r.status, r.detail, r.fix = "fail", fmt.Sprintf("cannot connect to %s on %s: %v", resolved.DBName, addr, err), databaseFix(err, addr)
+		return r
+	}
+	// "PostgreSQL 16.1 on x86_64-pc-linux-musl, ..."
+	if fields := strings.Fields(version); len(fields) >= 2 {
+		version = fields[0] + " " + fields[1]
+	}
+	r.detail = fmt.Sprintf("connected to %s on %s as %s (%s)", resolved.DBName, addr, resolved.DBUser, version)
+
+	if err := schemaCurrent(ctx, db); err != nil {
+		r.status, r.fix = "warn", "Run `tailscale-demo migrate`, or start serve with AUTO_MIGRATE=true"
+		r.detail += "; " + err.Error()
+		return r
+	}
+	r.status = "ok"
+	return r
+}
+
+// databaseFix suggests what to do about err, a failure to reach the
+// database at addr.
+func databaseFix(err error, addr string) string {
+	var pgErr *pgconn.PgError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &pgErr):
+		switch pgErr.Code {
+		case "28P01":
+			return "The server rejected the password: check DB_USER and DB_PASSWORD (or DB_PASSWORD_FILE, DB_PASSWORD_SECRET)"
+		case "3D000":
+			return "Create the database, or set DB_NAME to an existing one"
+		case "28000":
+			return "The server's pg_hba.conf does not admit this host, user or DB_SSLMODE; add an entry or change DB_SSLMODE"
+		}
+		return "Check DB_USER, DB_PASSWORD and DB_NAME"
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("%s does not resolve: fix DB_HOST (or the DATABASE_URL host); use the postgres service name under docker compose", dnsErr.Name)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Sprintf("Nothing is listening on %s: start Postgres (`docker compose up -d postgres`), or fix DB_HOST and DB_PORT", addr)
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded):
+		return fmt.Sprintf("%s did not answer in time: check it is reachable from here and no firewall drops the port, or set DB_TSNET=true if it is only on the tailnet", addr)
+	}
+	return "Check DATABASE_URL, or DB_HOST, DB_PORT, DB_USER, DB_PASSWORD and DB_NAME"
+}
+
+// checkTailscaled checks where the node's identity comes from: in tsnet
+// mode tailscaled is embedded and needs its state store, and otherwise
+// callers are identified by `tailscale serve` through the host's tailscaled.
+func (c *DoctorCmd) checkTailscaled(ctx context.Context) doctorResult {
+	if c.UseTsnet {
+		return checkTsnetState(c.ServeCmd)
+	}
+	var lc tailscale.LocalClient
+	return checkTailscaledSocket(ctx, paths.DefaultTailscaledSocket(), lc.StatusWithoutPeers)
+}
+
+// checkTsnetState checks the tsnet state store opens and, for the default
+// file store, that its directory is writable.
+func checkTsnetState(config ServeCmd) doctorResult {
+	r := doctorResult{name: "tailscale state"}
+	const fix = "Set TS_STATE to a writable path, or mount a volume for it in containers so the node keeps its identity across restarts"
+	if _, err := tsnetStateStore(config, logger.Discard); err != nil {
+		r.status, r.detail, r.fix = "fail", err.Error(), fix
+		return r
+	}
+	if config.TailscaleState != "" {
+		r.status, r.detail = "ok", "tsnet state is stored in "+config.TailscaleState
+		return r
+	}
+	dir, err := tsnetDefaultDir()
+	if err == nil {
+		var f *os.File
+		if f, err = os.CreateTemp(dir, ".doctor-*"); err == nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		r.status, r.detail, r.fix = "fail", "the tsnet state directory is not writable: "+err.Error(), fix
+		return r
+	}
+	r.status, r.detail = "ok", "tsnet state is stored in "+filepath.Join(dir, "tailscaled.state")
+	return r
+}
+
+// checkTailscaledSocket checks the host's tailscaled answers on socket and
+// is logged in. Without it the server still runs, but with no caller
+// identities, so problems are warnings.
+func checkTailscaledSocket(ctx context.Context, socket string, status func(context.Context) (*ipnstate.Status, error)) doctorResult {
+	r := doctorResult{name: "tailscaled"}
+	st, err := status(ctx)
+	switch {
+	case err != nil:
+		r.status = "warn"
+		r.detail = fmt.Sprintf("tailscaled is not reachable on %s: %v", socket, err)
+		r.fix = "Without TSNET=true, callers are identified by `tailscale serve` on this host: start tailscaled and run `tailscale serve` for PORT, or set TSNET=true"
+	case st.BackendState != "Running":
+		r.status = "warn"
+		r.detail = "tailscaled is " + st.BackendState
+		r.fix = "Run `tailscale up` to log this host in"
+	default:
+		r.status = "ok"
+		r.detail = "tailscaled is running"
+		if st.Self != nil {
+			r.detail += " as " + strings.TrimSuffix(st.Self.DNSName, ".")
+		}
+	}
+	return r
+}
+
+// checkAuthKey checks tsnet mode has a key to register with: that the
+// OAuth client can get a token, without minting a key, or that TS_AUTHKEY
+// is an auth key. Only the control server can tell whether a key is
+// expired or used up, which it does when the node logs in.
+func (c *DoctorCmd) checkAuthKey(ctx context.Context) doctorResult {
+	r := doctorResult{name: "auth key"}
+	if !c.UseTsnet {
+		r.status, r.detail = "skip", "tsnet mode is off (TSNET=false)"
+		return r
+	}
+	if c.OAuth.enabled() {
+		if _, err := c.OAuth.token(ctx, http.DefaultClient); err != nil {
+			r.status, r.detail, r.fix = "fail", err.Error(), "Check TS_OAUTH_CLIENT_ID and TS_OAUTH_CLIENT_SECRET; the client needs the auth_keys scope"
+			return r
+		}
+		r.status, r.detail = "ok", "the OAuth client gets an API token; serve mints a key with it at startup"
+		return r
+	}
+	r.status, r.detail, r.fix = authKeyFormat(c.TailscaleAuthKey)
+	return r
+}
+
+// authKeyFormat checks key is shaped like a Tailscale auth key.
+func authKeyFormat(key string) (status, detail, fix string) {
+	const keysPage = "Create an auth key at https://login.tailscale.com/admin/settings/keys and set TS_AUTHKEY"
+	switch {
+	case key == "":
+		return "fail", "TSNET=true but no auth key is set", keysPage + ", or set TS_OAUTH_CLIENT_ID to mint one"
+	case strings.HasPrefix(key, "tskey-api-"):
+		return "fail", "TS_AUTHKEY is an API access token, which cannot register a node", keysPage
+	case strings.HasPrefix(key, "tskey-client-"):
+		return "fail", "TS_AUTHKEY is an OAuth client secret", "Set it as TS_OAUTH_CLIENT_SECRET, with TS_OAUTH_CLIENT_ID and TS_OAUTH_TAGS, to mint auth keys"
+	case !strings.HasPrefix(key, "tskey-"):
+		return "fail", "TS_AUTHKEY does not look like an auth key (tskey-auth-...)", keysPage + ", copying the whole key"
+	}
+	return "ok", "TS_AUTHKEY is an auth key; the control server checks it is unexpired and unused when the node logs in", ""
+}
+
+// checkStatic checks the UI files are present in dir, or those embedded in
+// the binary, and that the index page parses.
+func checkStatic(dir string) doctorResult {
+	r := doctorResult{name: "static assets"}
+	where := "embedded in the binary"
+	fix := "Rebuild the binary from a checkout with app/static"
+	if dir != "" {
+		where = "in STATIC_DIR " + dir
+		fix = "Point STATIC_DIR at the app's static directory (app/static in the repository), or unset it to use the embedded copy"
+	}
+
+	fsys := staticFiles(dir)
+	var missing []string
+	for _, name := range staticRequired {
+		if _, err := fs.Stat(fsys, name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		r.status, r.detail, r.fix = "fail", fmt.Sprintf("%s missing %s", where, strings.Join(missing, ", ")), fix
+		return r
+	}
+	if _, err := newTemplateCache(fsys).get("index.html"); err != nil {
+		r.status, r.detail, r.fix = "fail", "index.html "+where+" does not parse: "+err.Error(), "Fix the template syntax in index.html"
+		return r
+	}
+	r.status, r.detail = "ok", fmt.Sprintf("%d files %s", len(staticRequired), where)
+	return r
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// dsnSSLModes are the accepted sslmode values.
+var dsnSSLModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// resolve applies DatabaseURL, if set, over the discrete settings. Every
+// component present in the URL takes precedence; anything it omits (such
+// as a password kept in a separate secret) falls back to the DB_* setting.
+// Query parameters other than the sslmode and certificate options are
+// passed through to the driver.
+func (c DBConfig) resolve() (DBConfig, error) {
+	if c.DatabaseURL == "" {
+		return c, nil
+	}
+
+	u, err := url.Parse(c.DatabaseURL)
+	if err != nil {
+		// The error would echo the URL, password included
+		return c, errors.New("invalid DATABASE_URL: not a valid URL")
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return c, fmt.Errorf("invalid DATABASE_URL: scheme must be postgres or postgresql, got %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return c, errors.New("invalid DATABASE_URL: missing host")
+	}
+
+	c.DBHost = u.Hostname()
+	if p := u.Port(); p != "" {
+		c.DBPort = p
+	} else if c.DBPort == "" {
+		c.DBPort = "5432"
+	}
+	if u.User != nil {
+		if name := u.User.Username(); name != "" {
+			c.DBUser = name
+		}
+		if pw, ok := u.User.Password(); ok {
+			c.DBPassword = pw
+		}
+	}
+	if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+		c.DBName = name
+	}
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	c.dsnParams = nil
+	for _, k := range keys {
+		v := query.Get(k)
+		switch k {
+		case "sslmode":
+			valid := false
+			for _, m := range dsnSSLModes {
+				valid = valid || m == v
+			}
+			if !valid {
+				return c, fmt.Errorf("invalid DATABASE_URL: unsupported sslmode %q (want one of %s)", v, strings.Join(dsnSSLModes, ", "))
+			}
+			c.DBSSLMode = v
+		case "sslrootcert":
+			c.DBSSLRootCert = v
+		case "sslcert":
+			c.DBSSLCert = v
+		case "sslkey":
+			c.DBSSLKey = v
+		default:
+			c.dsnParams = append(c.dsnParams, [2]string{k, v})
+		}
+	}
+
+	c.DatabaseURL = ""
+	return c, nil
+}
+
+// replicaConnectTimeout bounds connection attempts to the read replica, so
+// an unreachable one falls back to the primary well within a request.
+const replicaConnectTimeout = "2"
+
+// replica returns the settings for the read replica, which are the
+// primary's with the host (and port, if given) replaced. ok is false if no
+// replica is configured.
+func (c DBConfig) replica() (DBConfig, bool) {
+	if c.DBReplicaHost == "" {
+		return c, false
+	}
+	if r, err := c.resolve(); err == nil {
+		c = r
+	}
+
+	c.DBHost = c.DBReplicaHost
+	if host, port, err := net.SplitHostPort(c.DBReplicaHost); err == nil {
+		c.DBHost, c.DBPort = host, port
+	}
+	c.DBReplicaHost = ""
+
+	hasTimeout := false
+	for _, p := range c.dsnParams {
+		hasTimeout = hasTimeout || p[0] == "connect_timeout"
+	}
+	if !hasTimeout {
+		c.dsnParams = append(append([][2]string(nil), c.dsnParams...), [2]string{"connect_timeout", replicaConnectTimeout})
+	}
+	return c, true
+}
+
+// currentPassword returns the password from DBPasswordFile if it has been
+// loaded, and DBPassword otherwise.
+func (c DBConfig) currentPassword() string {
+	if c.password != nil {
+		return c.password.Get()
+	}
+	return c.DBPassword
+}
+
+// connString builds a libpq key/value connection string. Values are quoted
+// where needed so passwords and certificate paths may contain spaces,
+// quotes or backslashes.
+func (c DBConfig) connString() string {
+	// newDB has already rejected an invalid URL
+	if r, err := c.resolve(); err == nil {
+		c = r
+	}
+
+	params := [][2]string{
+		{"host", c.DBHost},
+		{"port", c.DBPort},
+		{"user", c.DBUser},
+		{"password", c.currentPassword()},
+		{"dbname", c.DBName},
+		{"sslmode", c.DBSSLMode},
+	}
+	for _, p := range [][2]string{
+		{"sslrootcert", c.DBSSLRootCert},
+		{"sslcert", c.DBSSLCert},
+		{"sslkey", c.DBSSLKey},
+	} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+	params = append(params, c.dsnParams...)
+
+	var b strings.Builder
+	for _, p := range params {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p[0])
+		b.WriteByte('=')
+		b.WriteString(dsnQuote(p[1]))
+	}
+	return b.String()
+}
+
+// dsnQuote quotes a connection string value if it is empty or contains
+// characters that are special to the key/value syntax.
+func dsnQuote(v string) string {
+	if v != "" && !strings.ContainsAny(v, " '\\\t\n") {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// validateTLS checks the client certificate options are used together.
+func (c DBConfig) validateTLS() error {
+	if (c.DBSSLCert == "") != (c.DBSSLKey == "") {
+		return errors.New("DB_SSLCERT and DB_SSLKEY must be set together")
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"tailscale.com/tsnet"
+	"tailscale.com/types/logger"
+)
+
+// E2ECmd runs several app nodes and a client node in-process on a tailnet
+// and drives a scripted scenario across them.
+type E2ECmd struct {
+	DBConfig `embed:""`
+
+	Nodes          int           `default:"3" help:"Number of app nodes to start"`
+	Requests       int           `default:"30" help:"Requests to spread across nodes in the load balancing step"`
+	AuthKey        string        `env:"TS_AUTHKEY" required:"" help:"Tailscale auth key for the test nodes (reusable; ephemeral recommended)"`
+	ControlURL     string        `env:"TS_CONTROL_URL" help:"Coordination server URL (default: Tailscale)"`
+	HostnamePrefix string        `default:"demo-e2e" help:"Prefix for the test node hostnames"`
+	Timeout        time.Duration `default:"5m" help:"Deadline for the whole scenario"`
+	Verbose        bool          `help:"Show tsnet logs"`
+}
+
+// e2eNode is one app instance under test.
+type e2eNode struct {
+	Name string
+	URL  string
+
+	stop    func()
+	stopped bool
+}
+
+// e2eResult is the outcome of one scenario step.
+type e2eResult struct {
+	Step     string
+	Passed   bool
+	Detail   string
+	Duration time.Duration
+}
+
+// e2eScenario deploys nodes and checks querying, failover and load
+// balancing through client. deploy is pluggable so the scenario can run
+// against plain HTTP servers in tests.
+type e2eScenario struct {
+	client   *http.Client
+	deploy   func(ctx context.Context) ([]*e2eNode, error)
+	requests int
+
+	nodes []*e2eNode
+}
+
+func (c *E2ECmd) Run() error {
+	if c.Nodes < 1 {
+		return errors.New("--nodes must be at least 1")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	logf := logger.Discard
+	if c.Verbose {
+		logf = log.Printf
+	}
+
+	db, err := openDB(c.DBConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := prepareSchema(db, true); err != nil {
+		return err
+	}
+
+	baseDir, err := os.MkdirTemp("", "tailscale-demo-e2e-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(baseDir)
+
+	newTS := func(hostname string) *tsnet.Server {
+		return &tsnet.Server{
+			Hostname:   hostname,
+			AuthKey:    c.AuthKey,
+			ControlURL: c.ControlURL,
+			Ephemeral:  true,
+			Dir:        filepath.Join(baseDir, hostname),
+			Logf:       logf,
+		}
+	}
+
+	log.Printf("Starting e2e client node...")
+	clientTS := newTS(c.HostnamePrefix + "-client")
+	defer clientTS.Close()
+	if _, err := clientTS.Up(ctx); err != nil {
+		return fmt.Errorf("failed to start client node: %w", err)
+	}
+
+	sc := &e2eScenario{
+		client:   clientTS.HTTPClient(),
+		requests: c.Requests,
+		deploy: func(ctx context.Context) ([]*e2eNode, error) {
+			var nodes []*e2eNode
+			for i := 1; i <= c.Nodes; i++ {
+				n, err := c.startNode(ctx, newTS(fmt.Sprintf("%s-%d", c.HostnamePrefix, i)), db)
+				if err != nil {
+					return nodes, err
+				}
+				nodes = append(nodes, n)
+			}
+			return nodes, nil
+		},
+	}
+	defer sc.stopAll()
+
+	results := sc.run(ctx)
+	printE2EReport(os.Stdout, results)
+
+	for _, r := range results {
+		if !r.Passed {
+			return errors.New("e2e scenario failed")
+		}
+	}
+	return nil
+}
+
+// startNode brings up an app instance on its own tsnet node.
+func (c *E2ECmd) startNode(ctx context.Context, ts *tsnet.Server, db *sql.DB) (*e2eNode, error) {
+	log.Printf("Starting e2e node %s...", ts.Hostname)
+	if _, err := ts.Up(ctx); err != nil {
+		ts.Close()
+		return nil, fmt.Errorf("failed to start %s: %w", ts.Hostname, err)
+	}
+
+	lc, err := ts.LocalClient()
+	if err != nil {
+		ts.Close()
+		return nil, err
+	}
+	ln, err := ts.Listen("tcp", ":80")
+	if err != nil {
+		ts.Close()
+		return nil, err
+	}
+
+	server := newServer(db, true)
+	server.client = lc
+	server.startFeatures(FeatureFlags{LiveFeed: true, Events: true, Metrics: true}, c.pgxConfig)
+
+	httpServer := &http.Server{Handler: server.guestMode(server.handler())}
+	go httpServer.Serve(ln)
+
+	ip4, _ := ts.TailscaleIPs()
+	return &e2eNode{
+		Name: ts.Hostname,
+		URL:  "http://" + ip4.String(),
+		stop: func() {
+			httpServer.Close()
+			server.features.stopAll()
+			ts.Close()
+		},
+	}, nil
+}
+
+// run executes each step in order. Steps after a failed deploy are skipped.
+func (sc *e2eScenario) run(ctx context.Context) []e2eResult {
+	steps := []struct {
+		name string
+		fn   func(context.Context) (string, error)
+	}{
+		{"deploy", sc.stepDeploy},
+		{"query", sc.stepQuery},
+		{"failover", sc.stepFailover},
+		{"load balance", sc.stepLoadBalance},
+	}
+
+	var results []e2eResult
+	for _, st := range steps {
+		start := time.Now()
+		detail, err := st.fn(ctx)
+		res := e2eResult{Step: st.name, Passed: err == nil, Detail: detail, Duration: time.Since(start)}
+		if err != nil {
+			res.Detail = err.Error()
+		}
+		results = append(results, res)
+
+		if st.name == "deploy" && err != nil {
+			break
+		}
+	}
+	return results
+}
+
+func (sc *e2eScenario) stepDeploy(ctx context.Context) (string, error) {
+	nodes, err := sc.deploy(ctx)
+	sc.nodes = nodes
+	if err != nil {
+		return "", err
+	}
+
+	for _, n := range sc.nodes {
+		if err := sc.waitHealthy(ctx, n); err != nil {
+			return "", fmt.Errorf("%s never became healthy: %w", n.Name, err)
+		}
+	}
+	return fmt.Sprintf("%d/%d nodes healthy", len(sc.nodes), len(sc.nodes)), nil
+}
+
+// waitHealthy polls a node's /health until it reports ok.
+func (sc *e2eScenario) waitHealthy(ctx context.Context, n *e2eNode) error {
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		_, err := checkHealth(reqCtx, sc.client, n.URL+"/health")
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// stepQuery checks every node serves the same products and identifies the
+// client.
+func (sc *e2eScenario) stepQuery(ctx context.Context) (string, error) {
+	count := -1
+	for _, n := range sc.nodes {
+		var products []map[string]interface{}
+		if err := sc.getJSON(ctx, n.URL+"/api/products", &products); err != nil {
+			return "", fmt.Errorf("%s: %w", n.Name, err)
+		}
+		if count >= 0 && len(products) != count {
+			return "", fmt.Errorf("%s returned %d products, others returned %d", n.Name, len(products), count)
+		}
+		count = len(products)
+	}
+
+	var user UserInfo
+	if err := sc.getJSON(ctx, sc.nodes[0].URL+"/api/user", &user); err != nil {
+		return "", fmt.Errorf("%s: %w", sc.nodes[0].Name, err)
+	}
+	identity := user.LoginName
+	if !user.Connected {
+		identity = "none (" + user.Error + ")"
+	}
+	return fmt.Sprintf("%d nodes returned %d products; client identity %s", len(sc.nodes), count, identity), nil
+}
+
+// stepFailover stops the first node and checks traffic moves to another.
+func (sc *e2eScenario) stepFailover(ctx context.Context) (string, error) {
+	if len(sc.nodes) < 2 {
+		return "skipped: needs at least 2 nodes", nil
+	}
+
+	victim := sc.nodes[0]
+	victim.stop()
+	victim.stopped = true
+
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	err := sc.getJSON(reqCtx, victim.URL+"/api/products", nil)
+	cancel()
+	if err == nil {
+		return "", fmt.Errorf("%s still serving after being stopped", victim.Name)
+	}
+
+	n, err := sc.pick(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s stopped; traffic served by %s", victim.Name, n.Name), nil
+}
+
+// stepLoadBalance spreads requests round-robin over the live nodes and
+// checks each one served its share.
+func (sc *e2eScenario) stepLoadBalance(ctx context.Context) (string, error) {
+	served := map[string]int{}
+	for i := 0; i < sc.requests; i++ {
+		n, err := sc.pick(ctx, i)
+		if err != nil {
+			return "", fmt.Errorf("request %d: %w", i+1, err)
+		}
+		served[n.Name]++
+	}
+
+	live := 0
+	for _, n := range sc.nodes {
+		if n.stopped {
+			continue
+		}
+		live++
+		if served[n.Name] == 0 {
+			return "", fmt.Errorf("%s served no requests", n.Name)
+		}
+	}
+	return fmt.Sprintf("%d requests across %d live nodes %v", sc.requests, live, served), nil
+}
+
+// pick sends a product query to the i'th live node (round-robin), moving on
+// to the next node if it fails, and returns the node that served it.
+func (sc *e2eScenario) pick(ctx context.Context, i int) (*e2eNode, error) {
+	var lastErr error
+	for attempt := 0; attempt < len(sc.nodes); attempt++ {
+		n := sc.nodes[(i+attempt)%len(sc.nodes)]
+		if n.stopped {
+			continue
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := sc.getJSON(reqCtx, n.URL+"/api/products", nil)
+		cancel()
+		if err == nil {
+			return n, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no live nodes")
+	}
+	return nil, lastErr
+}
+
+// getJSON fetches url and decodes the body into v (if non-nil).
+func (sc *e2eScenario) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", req.URL.Path, resp.Status)
+	}
+	if v == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (sc *e2eScenario) stopAll() {
+	for _, n := range sc.nodes {
+		if !n.stopped {
+			n.stop()
+			n.stopped = true
+		}
+	}
+}
+
+// printE2EReport writes a pass/fail table.
+func printE2EReport(w io.Writer, results []e2eResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tRESULT\tTIME\tDETAIL")
+
+	passed := 0
+	for _, r := range results {
+		result := "FAIL"
+		if r.Passed {
+			result = "PASS"
+			passed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Step, result, r.Duration.Round(time.Millisecond), r.Detail)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d/%d steps passed\n", passed, len(results))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeE2ENodes returns a deploy func serving a fixed product count per node.
+func fakeE2ENodes(t *testing.T, productCounts ...int) func(context.Context) ([]*e2eNode, error) {
+	return func(context.Context) ([]*e2eNode, error) {
+		var nodes []*e2eNode
+		for i, count := range productCounts {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(HealthResponse{Status: "ok", Database: "connected", Tailscale: "connected"})
+			})
+			mux.HandleFunc("GET /api/user", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(UserInfo{Connected: true, LoginName: "alice@example.com"})
+			})
+			mux.HandleFunc("GET /api/products", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(make([]map[string]interface{}, count))
+			})
+
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+			nodes = append(nodes, &e2eNode{
+				Name: fmt.Sprintf("node-%d", i+1),
+				URL:  srv.URL,
+				stop: srv.Close,
+			})
+		}
+		return nodes, nil
+	}
+}
+
+// TestE2EScenario verifies the scenario passes against nodes that agree
+func TestE2EScenario(t *testing.T) {
+	sc := &e2eScenario{client: http.DefaultClient, deploy: fakeE2ENodes(t, 5, 5, 5), requests: 10}
+	defer sc.stopAll()
+
+	results := sc.run(context.Background())
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+	for _, r := range results {
+		if !r.Passed {
+			t.Errorf("step %s failed: %s", r.Step, r.Detail)
+		}
+	}
+	if !strings.Contains(results[1].Detail, "alice@example.com") {
+		t.Errorf("query detail %q does not report the identity", results[1].Detail)
+	}
+	if !strings.Contains(results[2].Detail, "node-1 stopped; traffic served by node-2") {
+		t.Errorf("failover detail = %q", results[2].Detail)
+	}
+
+	var buf bytes.Buffer
+	printE2EReport(&buf, results)
+	if !strings.Contains(buf.String(), "4/4 steps passed") {
+		t.Errorf("report:\n%s", buf.String())
+	}
+}
+
+// TestE2EScenarioInconsistentNodes verifies the query step fails when nodes
+// return different products
+func TestE2EScenarioInconsistentNodes(t *testing.T) {
+	sc := &e2eScenario{client: http.DefaultClient, deploy: fakeE2ENodes(t, 5, 4), requests: 4}
+	defer sc.stopAll()
+
+	results := sc.run(context.Background())
+	if results[1].Step != "query" || results[1].Passed {
+		t.Errorf("query step = %+v, want failure", results[1])
+	}
+}
+
+// TestE2EScenarioSingleNode verifies the scenario passes with a single node
+func TestE2EScenarioSingleNode(t *testing.T) {
+	sc := &e2eScenario{client: http.DefaultClient, deploy: fakeE2ENodes(t, 1), requests: 3}
+	defer sc.stopAll()
+
+	for _, r := range sc.run(context.Background()) {
+		if !r.Passed {
+			t.Errorf("step %s failed: %s", r.Step, r.Detail)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envFileFromArgs returns the .env file requested with --env-file or
+// ENV_FILE, or "" if none was. It runs before kong so the file can supply
+// the environment kong reads defaults from.
+func envFileFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if v, ok := strings.CutPrefix(arg, "--env-file="); ok {
+			return v
+		}
+		if arg == "--env-file" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv("ENV_FILE")
+}
+
+// envFileVars are the variables loadEnvFile set, which reloadEnvFile may
+// change again.
+var envFileVars = map[string]bool{}
+
+// loadEnvFile sets the variables in the .env file at path and returns how
+// many were set. Variables already in the environment take precedence.
+func loadEnvFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	vars, err := parseEnvFile(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	set := 0
+	for _, kv := range vars {
+		if _, ok := os.LookupEnv(kv[0]); ok {
+			continue
+		}
+		if err := os.Setenv(kv[0], kv[1]); err != nil {
+			return set, err
+		}
+		envFileVars[kv[0]] = true
+		set++
+	}
+	return set, nil
+}
+
+// reloadEnvFile applies the current contents of the .env file at path, for
+// a configuration reload. Variables the file set before are updated, or
+// unset if it no longer has them; the rest of the environment still takes
+// precedence as in loadEnvFile.
+func reloadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	vars, err := parseEnvFile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, kv := range vars {
+		seen[kv[0]] = true
+		if _, ok := os.LookupEnv(kv[0]); ok && !envFileVars[kv[0]] {
+			continue
+		}
+		if err := os.Setenv(kv[0], kv[1]); err != nil {
+			return err
+		}
+		envFileVars[kv[0]] = true
+	}
+	for key := range envFileVars {
+		if !seen[key] {
+			os.Unsetenv(key)
+			delete(envFileVars, key)
+		}
+	}
+	return nil
+}
+
+// parseEnvFile parses KEY=VALUE lines in file order. Blank lines and #
+// comments are skipped, an "export " prefix is allowed, and values may be
+// double quoted (with Go escapes), single quoted (literal) or bare (with
+// trailing " #" comments removed).
+func parseEnvFile(r io.Reader) ([][2]string, error) {
+	var vars [][2]string
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid double-quoted value for %s", n, key)
+			}
+			value = unquoted
+		case strings.HasPrefix(value, "'"):
+			if len(value) < 2 || !strings.HasSuffix(value, "'") {
+				return nil, fmt.Errorf("line %d: unterminated single-quoted value for %s", n, key)
+			}
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+
+		vars = append(vars, [2]string{key, value})
+	}
+	return vars, sc.Err()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseEnvFile verifies comments, export prefixes, quoting and escapes in env files
+func TestParseEnvFile(t *testing.T) {
+	input := `
+# Database
+DB_HOST=localhost
+export DB_PORT = 5433
+DB_PASSWORD="p@ss \"word\"\n"
+TS_HOSTNAME='demo # not a comment'
+PORT=8081 # trailing comment
+EMPTY=
+`
+	got, err := parseEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{
+		{"DB_HOST", "localhost"},
+		{"DB_PORT", "5433"},
+		{"DB_PASSWORD", "p@ss \"word\"\n"},
+		{"TS_HOSTNAME", "demo # not a comment"},
+		{"PORT", "8081"},
+		{"EMPTY", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnvFile =\n%q\nwant\n%q", got, want)
+	}
+
+	for _, bad := range []string{"NOEQUALS", "=value", "BAD KEY=1", `Q="unterminated`, "S='unterminated"} {
+		if _, err := parseEnvFile(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseEnvFile(%q) succeeded", bad)
+		}
+	}
+}
+
+// TestLoadEnvFileKeepsExisting verifies variables set in the environment win over the env file
+func TestLoadEnvFileKeepsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("ENVFILE_TEST_A=from-file\nENVFILE_TEST_B=from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVFILE_TEST_A", "from-env")
+	t.Setenv("ENVFILE_TEST_B", "")
+	os.Unsetenv("ENVFILE_TEST_B")
+
+	n, err := loadEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("loadEnvFile set %d variables, want 1", n)
+	}
+	if got := os.Getenv("ENVFILE_TEST_A"); got != "from-env" {
+		t.Errorf("ENVFILE_TEST_A = %q, want the existing value", got)
+	}
+	if got := os.Getenv("ENVFILE_TEST_B"); got != "from-file" {
+		t.Errorf("ENVFILE_TEST_B = %q, want from-file", got)
+	}
+}
+
+// TestEnvFileFromArgs verifies --env-file is found anywhere before a --
+// argument, falling back to ENV_FILE
+func TestEnvFileFromArgs(t *testing.T) {
+	t.Setenv("ENV_FILE", "")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"serve"}, ""},
+		{[]string{"--env-file=dev.env", "migrate"}, "dev.env"},
+		{[]string{"seed", "--env-file", "dev.env"}, "dev.env"},
+		{[]string{"--", "--env-file=x"}, ""},
+	}
+	for _, tt := range tests {
+		if got := envFileFromArgs(tt.args); got != tt.want {
+			t.Errorf("envFileFromArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	t.Setenv("ENV_FILE", "from-env.env")
+	if got := envFileFromArgs(nil); got != "from-env.env" {
+		t.Errorf("envFileFromArgs with ENV_FILE = %q", got)
+	}
+}
+
+// TestReloadEnvFile verifies reloading picks up changed values but still
+// leaves the environment's own alone
+func TestReloadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("ENVFILE_RELOAD_A=one\nENVFILE_RELOAD_B=one\nENVFILE_RELOAD_C=one\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVFILE_RELOAD_A", "from-env")
+	for _, key := range []string{"ENVFILE_RELOAD_B", "ENVFILE_RELOAD_C"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	if _, err := loadEnvFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("ENVFILE_RELOAD_A=two\nENVFILE_RELOAD_B=two\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadEnvFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("ENVFILE_RELOAD_A"); got != "from-env" {
+		t.Errorf("ENVFILE_RELOAD_A = %q, want the environment to still win", got)
+	}
+	if got := os.Getenv("ENVFILE_RELOAD_B"); got != "two" {
+		t.Errorf("ENVFILE_RELOAD_B = %q, want the reloaded value", got)
+	}
+	if _, ok := os.LookupEnv("ENVFILE_RELOAD_C"); ok {
+		t.Error("ENVFILE_RELOAD_C is still set after being removed from the file")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestWriteJSONETag verifies JSON responses get a weak ETag and a 304 when If-None-Match lists it
+func TestWriteJSONETag(t *testing.T) {
+	product := map[string]interface{}{"id": 1, "name": "Homelab"}
+
+	w := httptest.NewRecorder()
+	writeJSONETag(w, httptest.NewRequest(http.MethodGet, "/api/products/1", nil), product)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || len(etag) < 4 || etag[:3] != `W/"` {
+		t.Fatalf("status %d, ETag %q", w.Code, etag)
+	}
+	if w.Body.String() != `{"id":1,"name":"Homelab"}`+"\n" {
+		t.Errorf("body = %q", w.Body)
+	}
+
+	for header, want := range map[string]int{
+		etag:                       http.StatusNotModified,
+		etag[2:]:                   http.StatusNotModified,
+		`"other", ` + etag:         http.StatusNotModified,
+		"*":                        http.StatusNotModified,
+		`W/"other"`:                http.StatusOK,
+		`W/"x` + etag[3:]:          http.StatusOK,
+		`"other-tag", W/"another"`: http.StatusOK,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/products/1", nil)
+		r.Header.Set("If-None-Match", header)
+		w := httptest.NewRecorder()
+		writeJSONETag(w, r, product)
+		if w.Code != want {
+			t.Errorf("If-None-Match %s: status %d, want %d", header, w.Code, want)
+		}
+		if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: 304 with a body", header)
+		}
+	}
+
+	// A change to the payload changes the tag
+	product["price"] = 0
+	w = httptest.NewRecorder()
+	writeJSONETag(w, httptest.NewRequest(http.MethodGet, "/api/products/1", nil), product)
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag did not change with the payload")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// sseHeartbeatInterval keeps idle connections (and proxies) alive.
+	sseHeartbeatInterval = 15 * time.Second
+
+	// dbMonitorInterval is how often the database is pinged for status changes.
+	dbMonitorInterval = 5 * time.Second
+)
+
+// DBStatusEvent reports the database connection status. It is sent when an
+// events stream opens and whenever the status changes.
+type DBStatusEvent struct {
+	Database string `json:"database"` // "connected" or "disconnected"
+	Error    string `json:"error,omitempty"`
+	Time     string `json:"time"`
+}
+
+// HeartbeatEvent is sent periodically on idle event streams.
+type HeartbeatEvent struct {
+	Time string `json:"time"`
+}
+
+// dbMonitor pings the database and broadcasts status transitions.
+type dbMonitor struct {
+	db    *sql.DB
+	clock Clock
+
+	mu      sync.Mutex
+	current DBStatusEvent
+
+	*broadcaster[DBStatusEvent]
+}
+
+func newDBMonitor(db *sql.DB, clock Clock) *dbMonitor {
+	return &dbMonitor{
+		db:          db,
+		clock:       clock,
+		current:     DBStatusEvent{Database: "disconnected", Time: clock.Now().UTC().Format(time.RFC3339)},
+		broadcaster: newBroadcaster[DBStatusEvent](feedSubscriberBuffer),
+	}
+}
+
+// run checks the database every interval until ctx is cancelled.
+func (m *dbMonitor) run(ctx context.Context, interval time.Duration) {
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			m.closeAll()
+			return
+		case <-m.clock.After(interval):
+		}
+	}
+}
+
+// check pings the database and publishes the result if it changed.
+func (m *dbMonitor) check(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	err := m.db.PingContext(pingCtx)
+	cancel()
+
+	status := DBStatusEvent{Database: "connected", Time: m.clock.Now().UTC().Format(time.RFC3339)}
+	if err != nil {
+		status.Database = "disconnected"
+		status.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	changed := status.Database != m.current.Database
+	m.current = status
+	m.mu.Unlock()
+
+	if changed {
+		m.publish(status)
+	}
+}
+
+// status returns the most recently observed status.
+func (m *dbMonitor) status() DBStatusEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+// eventsHandler streams Server-Sent Events: "db_status" on connect and on
+// change, "product" for each product mutation, and a periodic "heartbeat".
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error": "Streaming is not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Nil channels simply never fire in the select below
+	var statuses chan DBStatusEvent
+	if s.dbMonitor != nil {
+		statuses = s.dbMonitor.subscribe()
+		defer s.dbMonitor.unsubscribe(statuses)
+	}
+	var products chan productEvent
+	if s.feed != nil {
+		products = s.feed.subscribe()
+		defer s.feed.unsubscribe(products)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if s.dbMonitor != nil {
+		writeSSE(w, "db_status", s.dbMonitor.status())
+	}
+	flusher.Flush()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.clock.After(sseHeartbeatInterval):
+			err = writeSSE(w, "heartbeat", HeartbeatEvent{Time: s.clock.Now().UTC().Format(time.RFC3339)})
+		case status, ok := <-statuses:
+			if !ok {
+				return
+			}
+			err = writeSSE(w, "db_status", status)
+		case event, ok := <-products:
+			if !ok {
+				return
+			}
+			err = writeSSE(w, "product", event)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSE writes one event with a JSON data payload.
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
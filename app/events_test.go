@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEventsHandlerStreamsEvents verifies product events and heartbeats are written as SSE
+func TestEventsHandlerStreamsEvents(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &Server{clock: clock, feed: newTestFeed()}
+	srv := httptest.NewServer(http.HandlerFunc(s.eventsHandler))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	readEvent := func() (string, string) {
+		var event, data string
+		for lines.Scan() {
+			line := lines.Text()
+			if line == "" {
+				return event, data
+			}
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				event = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				data = v
+			}
+		}
+		t.Fatalf("Stream ended: %v", lines.Err())
+		return "", ""
+	}
+
+	waitForWaiters(t, clock, 1)
+	s.feed.publish(productEvent{Type: "insert", ID: 3})
+	if event, data := readEvent(); event != "product" || !strings.Contains(data, `"id":3`) {
+		t.Errorf("Expected product event, got %q %q", event, data)
+	}
+
+	// The timer from before the product event is still pending alongside
+	// the new one
+	waitForWaiters(t, clock, 2)
+	clock.Advance(sseHeartbeatInterval)
+	if event, _ := readEvent(); event != "heartbeat" {
+		t.Errorf("Expected heartbeat, got %q", event)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// exportFlushRows controls how many rows are written between flushes so
+// clients see data arriving while large tables are exported.
+const exportFlushRows = 100
+
+// queryExport starts the query of a products export, writing a 500 and
+// returning ok false if it fails. Only starting the query can fall back to
+// the primary; once rows are being streamed a replica failure aborts the
+// export.
+func (s *Server) queryExport(w http.ResponseWriter, r *http.Request) (rows *sql.Rows, columns []string, ok bool) {
+	err := s.store.Read(r.Context(), func(q store.Queryer) (err error) {
+		rows, err = q.QueryContext(r.Context(), `SELECT * FROM products WHERE `+store.NotDeleted+` ORDER BY id`)
+		return err
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to query database: %s"}`, err.Error()), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	columns, err = rows.Columns()
+	if err != nil {
+		rows.Close()
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to get columns: %s"}`, err.Error()), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return rows, columns, true
+}
+
+// exportCSVHandler streams the products table as CSV one row at a time.
+func (s *Server) exportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	rows, columns, ok := s.queryExport(w, r)
+	if !ok {
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("products-%s.csv", s.clock.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	cw := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+
+	cw.Write(columns)
+
+	record := make([]string, len(columns))
+	count := 0
+	for rows.Next() {
+		raw, err := store.ScanRow(rows, columns)
+		if err != nil {
+			log.Printf("CSV export aborted after %d rows: %v", count, err)
+			panic(http.ErrAbortHandler)
+		}
+
+		for i, col := range columns {
+			record[i] = csvValue(raw[col])
+		}
+		if err := cw.Write(record); err != nil {
+			// Client went away
+			return
+		}
+
+		count++
+		if count%exportFlushRows == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		// Headers are already sent, so abort the response rather than
+		// letting a truncated file look complete
+		log.Printf("CSV export aborted after %d rows: %v", count, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	cw.Flush()
+}
+
+// exportNDJSONHandler streams the products table as newline-delimited
+// JSON, one product object per line as it is scanned, so tables far larger
+// than memory can be exported.
+func (s *Server) exportNDJSONHandler(w http.ResponseWriter, r *http.Request) {
+	rows, columns, ok := s.queryExport(w, r)
+	if !ok {
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("products-%s.ndjson", s.clock.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	count := 0
+	for rows.Next() {
+		raw, err := store.ScanRow(rows, columns)
+		if err != nil {
+			log.Printf("NDJSON export aborted after %d rows: %v", count, err)
+			panic(http.ErrAbortHandler)
+		}
+		if err := enc.Encode(normalizeProduct(raw)); err != nil {
+			// Client went away
+			return
+		}
+
+		count++
+		if count%exportFlushRows == 0 && flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		// Headers are already sent, so abort the response rather than
+		// letting a truncated file look complete
+		log.Printf("NDJSON export aborted after %d rows: %v", count, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// csvValue formats a raw driver value as a CSV cell. Text values that a
+// spreadsheet would interpret as a formula are prefixed with a quote.
+func csvValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestCSVValue verifies driver values are rendered safely for spreadsheets
+func TestCSVValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, ""},
+		{[]byte("99.00"), "99.00"},
+		{int64(42), "42"},
+		{"Business VPN", "Business VPN"},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"-1+1", "'-1+1"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "2024-01-02T03:04:05Z"},
+	}
+
+	for _, tt := range tests {
+		if got := csvValue(tt.in); got != tt.want {
+			t.Errorf("csvValue(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestExportNDJSONUnavailable verifies a failing query is reported before
+// any of the stream is written
+func TestExportNDJSONUnavailable(t *testing.T) {
+	db, err := sql.Open(store.DriverName, "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := &Server{store: store.New(db), clock: systemClock{}}
+	w := httptest.NewRecorder()
+	s.exportNDJSONHandler(w, httptest.NewRequest(http.MethodGet, "/api/products/export.ndjson", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("status = %d, Content-Disposition %q; want a 500 without the file", w.Code, w.Header().Get("Content-Disposition"))
+	}
+}
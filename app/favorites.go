@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// FavoriteStatus is the response of starring or unstarring a product.
+type FavoriteStatus struct {
+	ProductID int64 `json:"product_id"`
+	Favorite  bool  `json:"favorite"`
+}
+
+// addFavoriteHandler stars a product for the caller. Starring it again is
+// not an error, so the UI can retry freely.
+func (s *Server) addFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	login, ok := s.callerLogin(w, r, "Favorites")
+	if !ok {
+		return
+	}
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	added, err := s.store.AddFavorite(ctx, login, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Product not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add favorite: %v", err))
+		return
+	}
+	if added {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(FavoriteStatus{ProductID: id, Favorite: true})
+}
+
+// removeFavoriteHandler unstars a product for the caller.
+func (s *Server) removeFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	login, ok := s.callerLogin(w, r, "Favorites")
+	if !ok {
+		return
+	}
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := s.store.RemoveFavorite(ctx, login, id); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove favorite: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(FavoriteStatus{ProductID: id, Favorite: false})
+}
+
+// favoritesHandler lists the caller's starred products.
+func (s *Server) favoritesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	login, ok := s.callerLogin(w, r, "Favorites")
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	rows, err := s.store.Favorites(ctx, login)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query favorites: %v", err))
+		return
+	}
+	products := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		products = append(products, normalizeProduct(row))
+	}
+	json.NewEncoder(w).Encode(products)
+}
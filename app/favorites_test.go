@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFavoritesRequireIdentity verifies favorites need a Tailscale identity and a valid product id
+func TestFavoritesRequireIdentity(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/products/{id}/favorite", s.addFavoriteHandler)
+	mux.HandleFunc("DELETE /api/products/{id}/favorite", s.removeFavoriteHandler)
+	mux.HandleFunc("GET /api/favorites", s.favoritesHandler)
+
+	for _, tt := range []struct {
+		method, path string
+		login        string
+		want         int
+	}{
+		{http.MethodPost, "/api/products/1/favorite", "", http.StatusForbidden},
+		{http.MethodDelete, "/api/products/1/favorite", "", http.StatusForbidden},
+		{http.MethodGet, "/api/favorites", "", http.StatusForbidden},
+		{http.MethodPost, "/api/products/0/favorite", "alice@example.com", http.StatusBadRequest},
+		{http.MethodDelete, "/api/products/abc/favorite", "alice@example.com", http.StatusBadRequest},
+		// A tailnet peer's own login header is not an identity
+		{http.MethodPost, "/api/products/1/favorite", "spoofed:alice@example.com", http.StatusForbidden},
+		{http.MethodGet, "/api/favorites", "spoofed:alice@example.com", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if login, ok := strings.CutPrefix(tt.login, "spoofed:"); ok {
+			asSpoofedUser(r, login)
+		} else if tt.login != "" {
+			asServeUser(r, tt.login)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// FeatureFlags enables or disables the optional subsystems. Disabled
+// subsystems are never initialized and their endpoints report 503.
+type FeatureFlags struct {
+	LiveFeed  bool `env:"FEATURE_LIVE_FEED" default:"true" negatable:"" help:"WebSocket product feed (LISTEN/NOTIFY)"`
+	Events    bool `env:"FEATURE_EVENTS" default:"true" negatable:"" help:"Server-Sent Events stream and database monitor"`
+	Metrics   bool `env:"FEATURE_METRICS" default:"true" negatable:"" help:"Prometheus metrics on /metrics"`
+	GRPC      bool `env:"FEATURE_GRPC" default:"true" negatable:"" help:"gRPC services on GRPC_PORT (tsnet mode only)"`
+	Audit     bool `env:"FEATURE_AUDIT" default:"true" negatable:"" help:"Audit log of API calls, listed on /api/audit"`
+	Anomalies bool `env:"FEATURE_ANOMALIES" default:"true" negatable:"" help:"Flag unusual access in the access log, listed on /api/admin/anomalies"`
+	Files     bool `env:"FEATURE_FILES" default:"true" negatable:"" help:"Identity-scoped file drop on /api/files"`
+	Users     bool `env:"FEATURE_USERS" default:"true" negatable:"" help:"Record each Tailscale login's first and last visit and request count, listed on /api/users"`
+
+	AuditReads   bool   `env:"AUDIT_READS" help:"Also audit read-only API calls"`
+	QuietHours   string `env:"ANOMALY_QUIET_HOURS" default:"22-6" help:"Hours (START-END) when tailnet access is flagged as unusual; empty to disable"`
+	QuietHoursTZ string `env:"ANOMALY_TZ" default:"UTC" help:"Time zone of ANOMALY_QUIET_HOURS"`
+	FilesDir     string `env:"FILES_DIR" default:"data/files" help:"Directory dropped files are stored in"`
+	FilesMaxMB   int64  `env:"FILES_MAX_MB" default:"25" help:"Largest file that may be dropped, in MiB"`
+}
+
+// feature is an optional subsystem. Start initializes it and returns a
+// function that shuts it down.
+type feature struct {
+	Name    string
+	Enabled bool
+	Start   func(ctx context.Context) (stop func(), err error)
+}
+
+// featureStatus reports the state of one subsystem.
+type featureStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	State   string `json:"state"` // "disabled", "running" or "failed"
+	Error   string `json:"error,omitempty"`
+}
+
+// featureRegistry starts subsystems as they are registered and tracks their
+// status. A subsystem that fails to start is logged and reported, but does
+// not stop the server.
+type featureRegistry struct {
+	mu       sync.Mutex
+	statuses []featureStatus
+	stops    []func()
+}
+
+func newFeatureRegistry() *featureRegistry {
+	return &featureRegistry{}
+}
+
+// start registers f and, if it is enabled, initializes it now.
+func (r *featureRegistry) start(ctx context.Context, f feature) {
+	st := featureStatus{Name: f.Name, Enabled: f.Enabled, State: "disabled"}
+
+	var stop func()
+	if f.Enabled {
+		var err error
+		stop, err = f.Start(ctx)
+		if err != nil {
+			log.Printf("Warning: %s disabled: %v", f.Name, err)
+			st.State = "failed"
+			st.Error = err.Error()
+		} else {
+			log.Printf("Started %s", f.Name)
+			st.State = "running"
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, st)
+	if stop != nil {
+		r.stops = append(r.stops, stop)
+	}
+}
+
+// stopAll shuts running subsystems down in reverse start order.
+func (r *featureRegistry) stopAll() {
+	r.mu.Lock()
+	stops := r.stops
+	r.stops = nil
+	r.mu.Unlock()
+
+	for i := len(stops) - 1; i >= 0; i-- {
+		stops[i]()
+	}
+}
+
+func (r *featureRegistry) status() []featureStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]featureStatus{}, r.statuses...)
+}
+
+// startFeatures starts the subsystems that only need the database.
+// connConfig configures the connections opened outside the pool.
+func (s *Server) startFeatures(flags FeatureFlags, connConfig func() (*pgx.ConnConfig, error)) {
+	ctx := context.Background()
+
+	s.features.start(ctx, feature{
+		Name:    "live feed",
+		Enabled: flags.LiveFeed,
+		Start: func(ctx context.Context) (func(), error) {
+			// Subscribe to product change notifications for the live feed
+			feed, err := newProductFeed(s.db, connConfig)
+			if err != nil {
+				return nil, err
+			}
+			s.feed = feed
+			go feed.run()
+			return func() { feed.Close() }, nil
+		},
+	})
+
+	s.features.start(ctx, feature{
+		Name:    "events",
+		Enabled: flags.Events,
+		Start: func(ctx context.Context) (func(), error) {
+			ctx, cancel := context.WithCancel(ctx)
+			s.dbMonitor = newDBMonitor(s.db, s.clock)
+			go s.dbMonitor.run(ctx, dbMonitorInterval)
+			return cancel, nil
+		},
+	})
+
+	s.features.start(ctx, feature{
+		Name:    "audit log",
+		Enabled: flags.Audit,
+		Start: func(ctx context.Context) (func(), error) {
+			s.audit = newAuditLog(s.store, flags.AuditReads)
+			return s.audit.Close, nil
+		},
+	})
+
+	s.features.start(ctx, feature{
+		Name:    "user tracking",
+		Enabled: flags.Users,
+		Start: func(ctx context.Context) (func(), error) {
+			s.users = newUserTracker(s.store, s.clock)
+			return s.users.Close, nil
+		},
+	})
+
+	s.features.start(ctx, feature{
+		Name:    "anomaly detection",
+		Enabled: flags.Anomalies,
+		Start: func(ctx context.Context) (func(), error) {
+			if s.accessLog == nil {
+				return nil, errors.New("the access log is disabled (ACCESS_LOG_SIZE=0)")
+			}
+			quiet, err := parseQuietHours(flags.QuietHours, flags.QuietHoursTZ)
+			if err != nil {
+				return nil, err
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			s.anomalies = newAnomalyDetector(quiet)
+			go s.runAnomalyDetector(ctx, s.anomalies)
+			return cancel, nil
+		},
+	})
+
+	s.features.start(ctx, feature{
+		Name:    "file drop",
+		Enabled: flags.Files,
+		Start: func(ctx context.Context) (func(), error) {
+			files, err := newDiskBlobStore(flags.FilesDir)
+			if err != nil {
+				return nil, err
+			}
+			s.files = files
+			s.maxFileBytes = flags.FilesMaxMB << 20
+			return nil, nil
+		},
+	})
+
+	s.features.start(ctx, feature{
+		Name:    "metrics",
+		Enabled: flags.Metrics,
+		Start: func(ctx context.Context) (func(), error) {
+			replica, _ := s.store.Replica()
+			s.metrics = newMetricsRegistry(s.db, replica)
+			if s.productCache != nil {
+				s.metrics.MustRegister(s.productCache.collectors()...)
+			}
+			if s.queries != nil {
+				s.metrics.MustRegister(s.queries.collectors()...)
+			}
+			return nil, nil
+		},
+	})
+}
+
+// featuresHandler lists the optional subsystems and their state.
+func (s *Server) featuresHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	statuses := []featureStatus{}
+	if s.features != nil {
+		statuses = s.features.status()
+	}
+	json.NewEncoder(w).Encode(statuses)
+}
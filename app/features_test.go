@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestFeatureRegistry verifies enabled features start, report their status
+// and stop in reverse order
+func TestFeatureRegistry(t *testing.T) {
+	r := newFeatureRegistry()
+	ctx := context.Background()
+
+	var stopped []string
+	started := false
+	r.start(ctx, feature{Name: "a", Enabled: true, Start: func(context.Context) (func(), error) {
+		return func() { stopped = append(stopped, "a") }, nil
+	}})
+	r.start(ctx, feature{Name: "off", Enabled: false, Start: func(context.Context) (func(), error) {
+		started = true
+		return nil, nil
+	}})
+	r.start(ctx, feature{Name: "broken", Enabled: true, Start: func(context.Context) (func(), error) {
+		return nil, errors.New("no listener")
+	}})
+	r.start(ctx, feature{Name: "b", Enabled: true, Start: func(context.Context) (func(), error) {
+		return func() { stopped = append(stopped, "b") }, nil
+	}})
+
+	if started {
+		t.Error("disabled feature was initialized")
+	}
+
+	want := []featureStatus{
+		{Name: "a", Enabled: true, State: "running"},
+		{Name: "off", Enabled: false, State: "disabled"},
+		{Name: "broken", Enabled: true, State: "failed", Error: "no listener"},
+		{Name: "b", Enabled: true, State: "running"},
+	}
+	if got := r.status(); !reflect.DeepEqual(got, want) {
+		t.Errorf("status =\n%+v\nwant\n%+v", got, want)
+	}
+
+	r.stopAll()
+	if !reflect.DeepEqual(stopped, []string{"b", "a"}) {
+		t.Errorf("stop order = %v, want [b a]", stopped)
+	}
+	r.stopAll()
+	if len(stopped) != 2 {
+		t.Error("stopAll stopped features twice")
+	}
+}
+
+// TestStartFeaturesDisabled verifies disabled subsystems are not
+// initialized and are reported as off
+func TestStartFeaturesDisabled(t *testing.T) {
+	s := &Server{features: newFeatureRegistry()}
+	s.startFeatures(FeatureFlags{}, nil)
+
+	if s.feed != nil || s.dbMonitor != nil || s.metrics != nil || s.audit != nil || s.anomalies != nil || s.files != nil || s.users != nil {
+		t.Error("disabled subsystems were initialized")
+	}
+
+	w := httptest.NewRecorder()
+	s.featuresHandler(w, httptest.NewRequest(http.MethodGet, "/api/admin/features", nil))
+	var got []featureStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 7 {
+		t.Fatalf("got %d statuses, want 7", len(got))
+	}
+	for _, st := range got {
+		if st.State != "disabled" {
+			t.Errorf("%s state = %q, want disabled", st.Name, st.State)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// productChangesChannel is the NOTIFY channel populated by the
+// notify_products_change trigger (migrations/features).
+const productChangesChannel = "product_changes"
+
+// feedSubscriberBuffer is how many events a WebSocket client may lag behind
+// before it is disconnected.
+const feedSubscriberBuffer = 32
+
+// productEvent is pushed to live feed subscribers. Product is omitted for
+// deletes.
+type productEvent struct {
+	Type    string                 `json:"type"` // "insert", "update" or "delete"
+	ID      int64                  `json:"id"`
+	Product map[string]interface{} `json:"product,omitempty"`
+}
+
+// productFeed fans product change notifications out to subscribers.
+type productFeed struct {
+	products *store.Store
+	listener *store.Listener
+
+	*broadcaster[productEvent]
+}
+
+// newProductFeed subscribes to product change notifications using a
+// dedicated connection opened with connConfig.
+func newProductFeed(db *sql.DB, connConfig func() (*pgx.ConnConfig, error)) (*productFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	listener, err := store.Listen(ctx, connConfig, productChangesChannel, func(format string, args ...interface{}) {
+		log.Printf("Product feed listener: "+format, args...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &productFeed{
+		products:    store.New(db),
+		listener:    listener,
+		broadcaster: newBroadcaster[productEvent](feedSubscriberBuffer),
+	}, nil
+}
+
+// run dispatches notifications until the listener is closed.
+func (f *productFeed) run() {
+	for n := range f.listener.Notify {
+		// A nil notification means the connection was re-established and
+		// events may have been missed; there is nothing to replay.
+		if n == nil {
+			continue
+		}
+
+		var msg struct {
+			Op string `json:"op"`
+			ID int64  `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			log.Printf("Product feed: ignoring malformed notification %q", n.Payload)
+			continue
+		}
+
+		event := productEvent{Type: msg.Op, ID: msg.ID}
+		if msg.Op != "delete" {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			raw, err := f.products.Product(ctx, msg.ID)
+			cancel()
+			if errors.Is(err, store.ErrNotFound) {
+				// Deleted again before we could load it; the delete follows
+				continue
+			} else if err != nil {
+				log.Printf("Product feed: failed to load product %d: %v", msg.ID, err)
+				continue
+			}
+			event.Product = normalizeProduct(raw)
+		}
+
+		f.publish(event)
+	}
+}
+
+// Close stops listening and disconnects all subscribers.
+func (f *productFeed) Close() error {
+	err := f.listener.Close()
+	f.closeAll()
+	return err
+}
+
+// productStreamHandler upgrades to a WebSocket and pushes product change
+// events as JSON messages until the client disconnects.
+func (s *Server) productStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if s.feed == nil {
+		http.Error(w, `{"error": "Live product feed is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		// Accept has already written an error response
+		return
+	}
+	defer conn.Close(websocket.StatusInternalError, "")
+
+	events := s.feed.subscribe()
+	defer s.feed.unsubscribe(events)
+
+	// The feed is one-way; CloseRead handles control frames and cancels ctx
+	// when the client goes away.
+	ctx := conn.CloseRead(r.Context())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				conn.Close(websocket.StatusTryAgainLater, "feed closed or client too slow")
+				return
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := wsjson.Write(writeCtx, conn, event)
+			cancel()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+func newTestFeed() *productFeed {
+	return &productFeed{broadcaster: newBroadcaster[productEvent](feedSubscriberBuffer)}
+}
+
+// TestProductFeedDropsSlowSubscribers verifies a full subscriber is disconnected without blocking others
+func TestProductFeedDropsSlowSubscribers(t *testing.T) {
+	f := newTestFeed()
+	slow := f.subscribe()
+	fast := f.subscribe()
+
+	for i := 0; i <= feedSubscriberBuffer; i++ {
+		f.publish(productEvent{Type: "update", ID: int64(i)})
+		<-fast
+	}
+
+	for range slow {
+		// drain buffered events until the channel is closed
+	}
+	if n := f.len(); n != 1 {
+		t.Errorf("Expected only the fast subscriber to remain, have %d subscribers", n)
+	}
+}
+
+// TestProductStreamHandlerPushesEvents verifies published events reach WebSocket clients
+func TestProductStreamHandlerPushesEvents(t *testing.T) {
+	s := &Server{feed: newTestFeed()}
+	srv := httptest.NewServer(http.HandlerFunc(s.productStreamHandler))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	// Wait for the handler to subscribe before publishing
+	deadline := time.Now().Add(time.Second)
+	for {
+		if s.feed.len() == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Handler did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	s.feed.publish(productEvent{Type: "delete", ID: 7})
+
+	var got productEvent
+	if err := wsjson.Read(ctx, conn, &got); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got.Type != "delete" || got.ID != 7 {
+		t.Errorf("Unexpected event: %+v", got)
+	}
+}
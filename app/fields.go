@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// productFields parses ?fields=id,name,price, checking each field is a
+// column of the products table. It returns nil if the parameter is absent,
+// meaning every field.
+func (s *Server) productFields(ctx context.Context, r *http.Request) ([]string, error) {
+	q := r.URL.Query()
+	if !q.Has("fields") {
+		return nil, nil
+	}
+
+	var fields []string
+	seen := map[string]bool{}
+	for _, f := range strings.Split(q.Get("fields"), ",") {
+		f = strings.TrimSpace(f)
+		if f != "" && !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: list at least one product field", errInvalidFields)
+	}
+
+	columns, err := s.tableColumns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		known[col] = true
+	}
+	for _, f := range fields {
+		if !known[f] {
+			return nil, fmt.Errorf("%w: %s is not a product field; fields may be %s", errInvalidFields, f, strings.Join(columns, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// productColumnsTTL is how long the products table's columns are reused.
+// It is short so a migration adding or dropping a column soon shows.
+const productColumnsTTL = 30 * time.Second
+
+// tableColumns returns the products table's columns, looking them up at
+// most every productColumnsTTL rather than on each ?fields= request.
+func (s *Server) tableColumns(ctx context.Context) ([]string, error) {
+	s.columnsMu.Lock()
+	defer s.columnsMu.Unlock()
+
+	if s.columns != nil && s.clock.Now().Sub(s.columnsAt) < productColumnsTTL {
+		return s.columns, nil
+	}
+
+	columns, err := s.store.ProductColumns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.columns, s.columnsAt = columns, s.clock.Now()
+	return columns, nil
+}
+
+// errInvalidFields is a ?fields= value that is not a list of product
+// columns, answered with a 400.
+var errInvalidFields = errors.New("invalid fields")
+
+// writeFieldsError writes the error productFields returned.
+func writeFieldsError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidFields) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query database: %v", err))
+}
+
+// selectFields returns copies of products with only fields, or products
+// itself if fields is nil. The products may be held by a listing cache, so
+// they are never modified.
+func selectFields(products []map[string]interface{}, fields []string) []map[string]interface{} {
+	if fields == nil {
+		return products
+	}
+	selected := make([]map[string]interface{}, len(products))
+	for i, p := range products {
+		selected[i] = selectProductFields(p, fields)
+	}
+	return selected
+}
+
+// selectProductFields returns a copy of product with only fields, or
+// product itself if fields is nil.
+func selectProductFields(product map[string]interface{}, fields []string) map[string]interface{} {
+	if fields == nil {
+		return product
+	}
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, ok := product[f]; ok {
+			m[f] = v
+		}
+	}
+	return m
+}
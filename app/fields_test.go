@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestSelectFields verifies only the requested fields are kept, without
+// modifying the cached products
+func TestSelectFields(t *testing.T) {
+	cached := []map[string]interface{}{
+		{"id": int64(1), "name": "Business VPN", "price": "99.00", "category": "Networking"},
+		{"id": int64(2), "name": "Homelab", "price": "0.00"},
+	}
+	if got := selectFields(cached, nil); !reflect.DeepEqual(got, cached) {
+		t.Errorf("selectFields without fields = %v", got)
+	}
+
+	got := selectFields(cached, []string{"id", "category"})
+	want := []map[string]interface{}{
+		{"id": int64(1), "category": "Networking"},
+		{"id": int64(2)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selectFields = %v, want %v", got, want)
+	}
+	if len(cached[0]) != 4 || len(cached[1]) != 3 {
+		t.Errorf("selectFields modified the cached products: %v", cached)
+	}
+}
+
+// TestProductFieldsWithoutLookup verifies an absent or empty ?fields= is
+// handled without looking up the columns
+func TestProductFieldsWithoutLookup(t *testing.T) {
+	// Neither case needs the table's columns, so no store is set
+	s := &Server{}
+	fields, err := s.productFields(context.Background(), httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	if fields != nil || err != nil {
+		t.Errorf("productFields without ?fields= = %v, %v", fields, err)
+	}
+	for _, v := range []string{"", ",%20,"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/products?fields="+v, nil)
+		if _, err := s.productFields(context.Background(), r); !errors.Is(err, errInvalidFields) {
+			t.Errorf("productFields(%q) error = %v, want errInvalidFields", v, err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.productsHandler(w, httptest.NewRequest(http.MethodGet, "/api/products?fields=", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("products with empty fields status = %d, want 400", w.Code)
+	}
+}
+
+// TestProductFieldsCachedColumns verifies ?fields= is checked against the
+// cached columns without looking them up again
+func TestProductFieldsCachedColumns(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	// No store is set, so a lookup would panic
+	s := &Server{clock: clock, columns: []string{"id", "name", "price"}, columnsAt: clock.Now()}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/products?fields=id,price", nil)
+	if fields, err := s.productFields(context.Background(), r); err != nil || !reflect.DeepEqual(fields, []string{"id", "price"}) {
+		t.Errorf("productFields = %v, %v", fields, err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/api/products?fields=id,secret", nil)
+	if _, err := s.productFields(context.Background(), r); !errors.Is(err, errInvalidFields) {
+		t.Errorf("productFields(id,secret) error = %v, want errInvalidFields", err)
+	}
+}
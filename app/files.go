@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// validFileName reports whether name is usable as a dropped file's name.
+func validFileName(name string) bool {
+	if name == "" || name == "." || name == ".." || len(name) > 255 {
+		return false
+	}
+	for _, r := range name {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileName returns the {name} path value, writing a 400 if it is invalid.
+func fileName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	if !validFileName(name) {
+		http.Error(w, `{"error": "File name must be 1-255 characters without slashes or control characters"}`, http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+// filesAvailable writes a 503 if file drop is disabled.
+func (s *Server) filesAvailable(w http.ResponseWriter) bool {
+	if s.files == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "File drop is not available"}`, http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// putFileHandler stores the request body as the caller's file, replacing one
+// of the same name.
+func (s *Server) putFileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !s.filesAvailable(w) {
+		return
+	}
+	login, ok := s.callerLogin(w, r, "Files")
+	if !ok {
+		return
+	}
+	name, ok := fileName(w, r)
+	if !ok {
+		return
+	}
+	if r.ContentLength > s.maxFileBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Files may be at most %d bytes", s.maxFileBytes))
+		return
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store file: %v", err))
+		return
+	}
+	hash := sha256.New()
+	body := io.TeeReader(http.MaxBytesReader(w, r.Body, s.maxFileBytes), hash)
+
+	ctx := r.Context()
+
+	size, err := s.files.Put(ctx, key, body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Files may be at most %d bytes", s.maxFileBytes))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store file: %v", err))
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		contentType = "application/octet-stream"
+	}
+
+	f, replaced, err := s.store.PutFile(ctx, store.File{
+		Login:       login,
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		StorageKey:  key,
+	})
+	if err != nil {
+		s.deleteBlob(key)
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to record file: %v", err))
+		return
+	}
+
+	status := http.StatusCreated
+	if replaced != "" {
+		s.deleteBlob(replaced)
+		status = http.StatusOK
+	}
+	w.Header().Set("Location", "/api/files/"+url.PathEscape(name))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(f)
+}
+
+// filesHandler lists the caller's files.
+func (s *Server) filesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !s.filesAvailable(w) {
+		return
+	}
+	login, ok := s.callerLogin(w, r, "Files")
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	files, err := s.store.Files(ctx, login)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query files: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(files)
+}
+
+// getFileHandler downloads one of the caller's files.
+func (s *Server) getFileHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.filesAvailable(w) {
+		return
+	}
+	login, ok := s.callerLogin(w, r, "Files")
+	if !ok {
+		return
+	}
+	name, ok := fileName(w, r)
+	if !ok {
+		return
+	}
+
+	f, err := s.store.File(r.Context(), login, name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "File not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query files: %v", err))
+		return
+	}
+
+	content, err := s.files.Open(r.Context(), f.StorageKey)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read file: %v", err))
+		return
+	}
+	defer content.Close()
+
+	// Uploads are served as downloads so they are never rendered as pages
+	// on the app's origin
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+f.SHA256+`"`)
+	if rs, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", f.CreatedAt, rs)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(f.Size))
+	io.Copy(w, content)
+}
+
+// deleteFileHandler removes one of the caller's files.
+func (s *Server) deleteFileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !s.filesAvailable(w) {
+		return
+	}
+	login, ok := s.callerLogin(w, r, "Files")
+	if !ok {
+		return
+	}
+	name, ok := fileName(w, r)
+	if !ok {
+		return
+	}
+
+	f, err := s.store.DeleteFile(r.Context(), login, name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "File not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete file: %v", err))
+		return
+	}
+	s.deleteBlob(f.StorageKey)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteBlob removes contents no longer referenced by a file. Failures only
+// leave an orphaned blob, so they are logged.
+func (s *Server) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.files.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete blob %s: %v", key, err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestValidFileName verifies file names may not be empty, dot names or
+// contain path separators or control characters
+func TestValidFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"report.pdf", true},
+		{"notes from standup.txt", true},
+		{"résumé.docx", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"line\nbreak", false},
+		{strings.Repeat("x", 256), false},
+	}
+	for _, tt := range tests {
+		if got := validFileName(tt.name); got != tt.want {
+			t.Errorf("validFileName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestFilesUnavailable verifies the file routes answer 503 without a blob store
+func TestFilesUnavailable(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/files", s.filesHandler)
+	mux.HandleFunc("PUT /api/files/{name}", s.putFileHandler)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/files", nil),
+		httptest.NewRequest(http.MethodPut, "/api/files/a.txt", strings.NewReader("hi")),
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s = %d, want 503", req.Method, req.URL.Path, w.Code)
+		}
+	}
+}
+
+// TestFilesRequireIdentity verifies the caller's own files are only reached
+// with a Tailscale identity, not by claiming a login in the header
+func TestFilesRequireIdentity(t *testing.T) {
+	blobs, err := newDiskBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{files: blobs}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/files", s.filesHandler)
+	mux.HandleFunc("PUT /api/files/{name}", s.putFileHandler)
+	mux.HandleFunc("GET /api/files/{name}", s.getFileHandler)
+	mux.HandleFunc("DELETE /api/files/{name}", s.deleteFileHandler)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/files", nil),
+		httptest.NewRequest(http.MethodPut, "/api/files/a.txt", strings.NewReader("hi")),
+		httptest.NewRequest(http.MethodGet, "/api/files/a.txt", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/files/a.txt", nil),
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, asSpoofedUser(req, "alice@example.com"))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s with a spoofed login = %d, want 403", req.Method, req.URL.Path, w.Code)
+		}
+	}
+}
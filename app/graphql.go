@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	# Products, newest first. Pass the previous page's nextCursor to continue.
+	products(limit: Int, cursor: String): ProductConnection!
+	product(id: ID!): Product
+	# The Tailscale identity of the caller.
+	viewer: Viewer!
+}
+
+type Mutation {
+	# version is the one the product was read at; the update fails if it
+	# has changed since, rather than overwrite another user's edit.
+	updateProduct(id: ID!, input: ProductInput!, version: Int!): Product!
+}
+
+type Product {
+	id: ID!
+	name: String!
+	description: String
+	price: Float!
+	stockQuantity: Int
+	category: String
+	createdAt: String!
+	updatedAt: String!
+	# Bumped by every write, for updateProduct's version argument.
+	version: Int
+}
+
+type ProductConnection {
+	nodes: [Product!]!
+	nextCursor: String
+}
+
+type Viewer {
+	connected: Boolean!
+	loginName: String
+	displayName: String
+}
+
+input ProductInput {
+	name: String
+	description: String
+	price: Float
+	stockQuantity: Int
+	category: String
+}
+`
+
+// graphqlRequestKey carries the *http.Request into resolvers so they can
+// resolve the caller's Tailscale identity.
+type graphqlRequestKey struct{}
+
+// errNoGraphQLCaller refuses mutations executed without graphqlRequestKey,
+// whose caller cannot be authorized.
+var errNoGraphQLCaller = errors.New("mutations need an identified caller")
+
+// graphqlResolver is the root resolver for queries and mutations.
+type graphqlResolver struct {
+	s *Server
+}
+
+func (g *graphqlResolver) Products(ctx context.Context, args struct {
+	Limit  *int32
+	Cursor *string
+}) (*productConnectionResolver, error) {
+	limit := defaultPageSize
+	if args.Limit != nil {
+		limit = int(*args.Limit)
+		if limit < 1 {
+			return nil, fmt.Errorf("limit must be a positive integer")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+
+	var after *productCursor
+	if args.Cursor != nil && *args.Cursor != "" {
+		cursor, err := decodeCursor(*args.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		after = &cursor
+	}
+
+	var products []map[string]interface{}
+	var next string
+	err := g.s.store.Read(ctx, func(q store.Queryer) (err error) {
+		products, next, err = listProductsAfter(ctx, q, limit, after, "", false)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %w", err)
+	}
+
+	conn := &productConnectionResolver{}
+	for _, p := range products {
+		conn.nodes = append(conn.nodes, &productResolver{p})
+	}
+	if next != "" {
+		conn.nextCursor = &next
+	}
+	return conn, nil
+}
+
+func (g *graphqlResolver) Product(ctx context.Context, args struct{ ID graphql.ID }) (*productResolver, error) {
+	id, err := strconv.ParseInt(string(args.ID), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("product id must be an integer")
+	}
+
+	raw, err := g.s.store.Product(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		// Unknown IDs resolve to null rather than an error
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query product: %w", err)
+	}
+	return &productResolver{normalizeProduct(raw)}, nil
+}
+
+func (g *graphqlResolver) Viewer(ctx context.Context) *viewerResolver {
+	r, ok := ctx.Value(graphqlRequestKey{}).(*http.Request)
+	if !ok {
+		return &viewerResolver{}
+	}
+
+	whois, err := g.s.tailscaleWhois(ctx, r)
+	if err != nil || whois == nil {
+		return &viewerResolver{}
+	}
+	return &viewerResolver{whois: whois}
+}
+
+func (g *graphqlResolver) UpdateProduct(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input struct {
+		Name          *string
+		Description   *string
+		Price         *float64
+		StockQuantity *int32
+		Category      *string
+	}
+	Version int32
+}) (*productResolver, error) {
+	if g.s.live().readOnly {
+		return nil, errReadOnly
+	}
+	// /graphql is open to viewers for queries; editing needs an editor, as
+	// PATCH /api/products/{id} does. Without the request there is no caller
+	// to check, so the edit is refused
+	r, ok := ctx.Value(graphqlRequestKey{}).(*http.Request)
+	if !ok {
+		return nil, errNoGraphQLCaller
+	}
+	if err := g.s.checkRole(r, roleEditor); err != nil {
+		return nil, err
+	}
+	ctx = g.s.withActor(ctx, r)
+
+	id, err := strconv.ParseInt(string(args.ID), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("product id must be an integer")
+	}
+
+	// Translate the input into a merge patch of the provided fields
+	patch := map[string]interface{}{}
+	if args.Input.Name != nil {
+		patch["name"] = *args.Input.Name
+	}
+	if args.Input.Description != nil {
+		patch["description"] = *args.Input.Description
+	}
+	if args.Input.Price != nil {
+		patch["price"] = *args.Input.Price
+	}
+	if args.Input.StockQuantity != nil {
+		patch["stock_quantity"] = float64(*args.Input.StockQuantity)
+	}
+	if args.Input.Category != nil {
+		patch["category"] = *args.Input.Category
+	}
+
+	precondition := func(raw map[string]interface{}) error {
+		if v, _ := raw["version"].(int64); v != int64(args.Version) {
+			return errProductChanged
+		}
+		return nil
+	}
+
+	updated, err := g.s.patchProduct(ctx, id, precondition, func(original interface{}) (interface{}, error) {
+		return applyMergePatch(original, patch), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &productResolver{normalizeProduct(updated)}, nil
+}
+
+type productConnectionResolver struct {
+	nodes      []*productResolver
+	nextCursor *string
+}
+
+func (c *productConnectionResolver) Nodes() []*productResolver {
+	if c.nodes == nil {
+		return []*productResolver{}
+	}
+	return c.nodes
+}
+
+func (c *productConnectionResolver) NextCursor() *string { return c.nextCursor }
+
+// productResolver exposes a normalized product row.
+type productResolver struct {
+	p map[string]interface{}
+}
+
+func (r *productResolver) ID() graphql.ID { return graphql.ID(fmt.Sprint(r.p["id"])) }
+
+func (r *productResolver) Name() string { return r.str("name") }
+
+func (r *productResolver) Description() *string { return r.optStr("description") }
+
+func (r *productResolver) Price() float64 {
+	switch v := r.p["price"].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+func (r *productResolver) StockQuantity() *int32 {
+	if v, ok := r.p["stock_quantity"].(int64); ok {
+		n := int32(v)
+		return &n
+	}
+	return nil
+}
+
+func (r *productResolver) Category() *string { return r.optStr("category") }
+
+func (r *productResolver) Version() *int32 {
+	if v, ok := r.p["version"].(int64); ok {
+		n := int32(v)
+		return &n
+	}
+	return nil
+}
+
+func (r *productResolver) CreatedAt() string { return r.str("created_at") }
+
+func (r *productResolver) UpdatedAt() string { return r.str("updated_at") }
+
+func (r *productResolver) str(col string) string {
+	s, _ := r.p[col].(string)
+	return s
+}
+
+func (r *productResolver) optStr(col string) *string {
+	if s, ok := r.p[col].(string); ok {
+		return &s
+	}
+	return nil
+}
+
+type viewerResolver struct {
+	whois *WhoIsData
+}
+
+func (v *viewerResolver) Connected() bool { return v.whois != nil }
+
+func (v *viewerResolver) LoginName() *string {
+	if v.whois == nil || v.whois.LoginName == "" {
+		return nil
+	}
+	return &v.whois.LoginName
+}
+
+func (v *viewerResolver) DisplayName() *string {
+	if v.whois == nil || v.whois.DisplayName == "" {
+		return nil
+	}
+	return &v.whois.DisplayName
+}
+
+// graphqlRequest is a GraphQL-over-HTTP request body.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+
+	// Extensions is part of GraphQL over HTTP; declared so that strict
+	// decoding accepts clients that send it, but unused
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// graphqlResponse is a GraphQL-over-HTTP response body.
+type graphqlResponse struct {
+	Data   interface{}   `json:"data,omitempty"`
+	Errors []interface{} `json:"errors,omitempty"`
+}
+
+// graphqlHandler executes a GraphQL request sent as a JSON POST body.
+func (s *Server) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	s.graphqlOnce.Do(func() {
+		s.graphqlSchema = graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: s})
+	})
+
+	var req graphqlRequest
+	if !s.readJSONBody(w, r, 0, &req, "GraphQL request") {
+		return
+	}
+
+	if req.Query == "" {
+		http.Error(w, `{"error": "query is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphqlRequestKey{}, r)
+	response := s.graphqlSchema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
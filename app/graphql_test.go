@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestGraphQLSchemaMatchesResolvers verifies every schema field has a resolver
+func TestGraphQLSchemaMatchesResolvers(t *testing.T) {
+	if _, err := graphql.ParseSchema(graphqlSchema, &graphqlResolver{s: &Server{}}); err != nil {
+		t.Fatalf("Schema does not match resolvers: %v", err)
+	}
+}
+
+// TestGraphQLProductQueryError verifies a failing product query is reported
+// as an error rather than as a product that does not exist
+func TestGraphQLProductQueryError(t *testing.T) {
+	db, err := sql.Open(store.DriverName, "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: &Server{store: store.New(db)}})
+
+	resp := schema.Exec(context.Background(), `{ product(id: "1") { id } }`, "", nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "failed to query product") {
+		t.Fatalf("errors = %v, want a query error", resp.Errors)
+	}
+}
+
+// TestGraphQLViewerFromIdentityHeaders verifies the viewer is derived from Tailscale Serve headers
+func TestGraphQLViewerFromIdentityHeaders(t *testing.T) {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: &Server{}})
+
+	r := httptest.NewRequest("POST", "/graphql", nil)
+	asServeUser(r, "alice@example.com")
+	r.Header.Set("Tailscale-User-Name", "Alice")
+	ctx := context.WithValue(context.Background(), graphqlRequestKey{}, r)
+
+	resp := schema.Exec(ctx, `{ viewer { connected loginName displayName } }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", resp.Errors)
+	}
+
+	var data struct {
+		Viewer struct {
+			Connected   bool
+			LoginName   string
+			DisplayName string
+		}
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !data.Viewer.Connected || data.Viewer.LoginName != "alice@example.com" || data.Viewer.DisplayName != "Alice" {
+		t.Errorf("Unexpected viewer: %+v", data.Viewer)
+	}
+}
+
+// TestGraphQLMutationRequiresEditor verifies mutations enforce ROLES even
+// though /graphql itself is open to viewers
+func TestGraphQLMutationRequiresEditor(t *testing.T) {
+	roles, err := newRoleMap([]string{"alice@example.com=editor"}, "", "viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{}
+	s.setLive(&liveConfig{roles: roles})
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: s})
+
+	r := httptest.NewRequest("POST", "/graphql", nil)
+	asServeUser(r, "bob@example.com")
+	ctx := context.WithValue(context.Background(), graphqlRequestKey{}, r)
+
+	resp := schema.Exec(ctx, `mutation { updateProduct(id: "1", input: {name: "x"}, version: 1) { id } }`, "", nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "requires the editor role") {
+		t.Fatalf("errors = %v, want a role error", resp.Errors)
+	}
+}
+
+// TestGraphQLMutationReadOnly verifies --read-only refuses mutations
+func TestGraphQLMutationReadOnly(t *testing.T) {
+	s := &Server{}
+	s.setLive(&liveConfig{readOnly: true})
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: s})
+
+	resp := schema.Exec(context.Background(), `mutation { updateProduct(id: "1", input: {name: "x"}, version: 1) { id } }`, "", nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "read-only") {
+		t.Fatalf("errors = %v, want a read-only error", resp.Errors)
+	}
+}
+
+// TestGraphQLMutationWithoutRequest verifies a mutation executed without the
+// HTTP request, so without a caller to authorize, is refused rather than
+// let through
+func TestGraphQLMutationWithoutRequest(t *testing.T) {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: &Server{}})
+
+	resp := schema.Exec(context.Background(), `mutation { updateProduct(id: "1", input: {name: "x"}, version: 1) { id } }`, "", nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, errNoGraphQLCaller.Error()) {
+		t.Fatalf("errors = %v, want %v", resp.Errors, errNoGraphQLCaller)
+	}
+}
+
+// TestGraphQLMutationRequiresVersion verifies updateProduct cannot be called
+// without the version the product was read at, as PATCH needs If-Match
+func TestGraphQLMutationRequiresVersion(t *testing.T) {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: &Server{}})
+
+	resp := schema.Exec(context.Background(), `mutation { updateProduct(id: "1", input: {name: "x"}) { id } }`, "", nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, `"version"`) {
+		t.Fatalf("errors = %v, want a missing version error", resp.Errors)
+	}
+}
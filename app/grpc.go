@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The gRPC services use protobuf well-known types for their messages so no
+// code generation step is needed. proto/demo.proto describes them for
+// clients such as grpcurl.
+const (
+	productsServiceName = "tailscale.demo.v1.ProductsService"
+	identityServiceName = "tailscale.demo.v1.IdentityService"
+)
+
+// grpcIdentityKey carries the caller's Tailscale identity, resolved by
+// grpcIdentityInterceptor, to service methods.
+type grpcIdentityKey struct{}
+
+// newGRPCServer returns a gRPC server with the products and identity
+// services registered. Serve it on an identifyListener so peers are
+// identified once per connection.
+func (s *Server) newGRPCServer() *grpc.Server {
+	gs := grpc.NewServer(
+		grpc.Creds(tailnetCredentials{insecure.NewCredentials()}),
+		grpc.UnaryInterceptor(s.grpcIdentityInterceptor),
+	)
+	gs.RegisterService(&productsServiceDesc, s)
+	gs.RegisterService(&identityServiceDesc, s)
+	return gs
+}
+
+// grpcIdentityInterceptor attaches the peer's Tailscale identity: the one
+// resolved when the connection was accepted, or else a WhoIs on the
+// connection's remote address. Calls from unidentified peers still proceed;
+// methods that need an identity check for it themselves.
+func (s *Server) grpcIdentityInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		var whois *WhoIsData
+		var err error
+		if auth, ok := p.AuthInfo.(tailnetAuthInfo); ok && !errors.Is(auth.IdentityErr, errNoConnIdentity) {
+			whois, err = auth.Identity, auth.IdentityErr
+		} else {
+			whoisCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			whois, err = s.whoisAddr(whoisCtx, p.Addr.String())
+			cancel()
+		}
+		if err == nil {
+			ctx = context.WithValue(ctx, grpcIdentityKey{}, whois)
+			log.Printf("gRPC %s from %s", info.FullMethod, whois.LoginName)
+		} else {
+			log.Printf("gRPC %s from unidentified peer %s: %v", info.FullMethod, p.Addr, err)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// serveGRPC serves gRPC on ln until the listener is closed.
+func serveGRPC(gs *grpc.Server, ln net.Listener) {
+	log.Printf("gRPC server listening on Tailscale network at %s", ln.Addr())
+	if err := gs.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		log.Printf("gRPC server error: %v", err)
+	}
+}
+
+// ListProducts returns products newest first. The request may set "limit"
+// and "cursor"; the response has "products" and, when there are more,
+// "next_cursor".
+func (s *Server) ListProducts(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	fields := req.GetFields()
+
+	limit := defaultPageSize
+	if v, ok := fields["limit"]; ok {
+		limit = int(v.GetNumberValue())
+		if limit < 1 {
+			return nil, status.Error(codes.InvalidArgument, "limit must be a positive integer")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+
+	var after *productCursor
+	if token := fields["cursor"].GetStringValue(); token != "" {
+		cursor, err := decodeCursor(token)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid cursor: %v", err)
+		}
+		after = &cursor
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var products []map[string]interface{}
+	var next string
+	err := s.store.Read(ctx, func(q store.Queryer) (err error) {
+		products, next, err = listProductsAfter(ctx, q, limit, after, "", false)
+		return err
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to query products: %v", err)
+	}
+
+	list := make([]interface{}, len(products))
+	for i, p := range products {
+		list[i] = p
+	}
+	resp := map[string]interface{}{"products": list}
+	if next != "" {
+		resp["next_cursor"] = next
+	}
+	return toStruct(resp)
+}
+
+// GetProduct returns the product whose "id" is given in the request.
+func (s *Server) GetProduct(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	id := int64(req.GetFields()["id"].GetNumberValue())
+	if id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id must be a positive integer")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	raw, err := s.store.Product(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "product not found")
+	} else if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to query product: %v", err)
+	}
+	return toStruct(normalizeProduct(raw))
+}
+
+// WhoAmI returns the caller's Tailscale identity.
+func (s *Server) WhoAmI(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	whois, ok := ctx.Value(grpcIdentityKey{}).(*WhoIsData)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "caller is not an identified Tailscale user")
+	}
+	return toStruct(map[string]interface{}{
+		"login_name":   whois.LoginName,
+		"display_name": whois.DisplayName,
+	})
+}
+
+func toStruct(m map[string]interface{}) (*structpb.Struct, error) {
+	st, err := structpb.NewStruct(m)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	return st, nil
+}
+
+// productsService and identityService are the method sets the service
+// descriptors dispatch to.
+type productsService interface {
+	ListProducts(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	GetProduct(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+type identityService interface {
+	WhoAmI(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+}
+
+var productsServiceDesc = grpc.ServiceDesc{
+	ServiceName: productsServiceName,
+	HandlerType: (*productsService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListProducts",
+			Handler: unaryHandler(productsServiceName+"/ListProducts", func(srv interface{}, ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				return srv.(productsService).ListProducts(ctx, req)
+			}),
+		},
+		{
+			MethodName: "GetProduct",
+			Handler: unaryHandler(productsServiceName+"/GetProduct", func(srv interface{}, ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				return srv.(productsService).GetProduct(ctx, req)
+			}),
+		},
+	},
+	Metadata: "proto/demo.proto",
+}
+
+var identityServiceDesc = grpc.ServiceDesc{
+	ServiceName: identityServiceName,
+	HandlerType: (*identityService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "WhoAmI",
+			Handler: unaryHandler(identityServiceName+"/WhoAmI", func(srv interface{}, ctx context.Context, req *emptypb.Empty) (*structpb.Struct, error) {
+				return srv.(identityService).WhoAmI(ctx, req)
+			}),
+		},
+	},
+	Metadata: "proto/demo.proto",
+}
+
+// unaryHandler adapts a typed method to grpc's method handler signature,
+// doing what protoc-gen-go-grpc generates for each unary method.
+func unaryHandler[Req any](fullMethod string, call func(srv interface{}, ctx context.Context, req *Req) (*structpb.Struct, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(Req)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv, ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + fullMethod}
+		return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv, ctx, req.(*Req))
+		})
+	}
+}
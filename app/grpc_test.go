@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func dialTestGRPC(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	gs := s.newGRPCServer()
+	go gs.Serve(ln)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestGRPCWhoAmIRequiresIdentity verifies unidentified peers are rejected
+func TestGRPCWhoAmIRequiresIdentity(t *testing.T) {
+	conn := dialTestGRPC(t, &Server{})
+
+	var out structpb.Struct
+	err := conn.Invoke(context.Background(), "/"+identityServiceName+"/WhoAmI", &emptypb.Empty{}, &out)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected Unauthenticated, got %v", err)
+	}
+}
+
+// TestGRPCWhoAmIReturnsIdentity verifies the identity attached to the context is returned
+func TestGRPCWhoAmIReturnsIdentity(t *testing.T) {
+	ctx := context.WithValue(context.Background(), grpcIdentityKey{}, &WhoIsData{LoginName: "alice@example.com", DisplayName: "Alice"})
+	out, err := (&Server{}).WhoAmI(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("WhoAmI failed: %v", err)
+	}
+	if got := out.GetFields()["login_name"].GetStringValue(); got != "alice@example.com" {
+		t.Errorf("Expected login_name alice@example.com, got %q", got)
+	}
+}
+
+// TestGRPCRejectsInvalidArguments verifies request validation happens before any query
+func TestGRPCRejectsInvalidArguments(t *testing.T) {
+	conn := dialTestGRPC(t, &Server{})
+
+	tests := []struct {
+		method string
+		req    map[string]interface{}
+	}{
+		{"ListProducts", map[string]interface{}{"limit": 0}},
+		{"ListProducts", map[string]interface{}{"cursor": "not-a-cursor"}},
+		{"GetProduct", map[string]interface{}{}},
+	}
+
+	for _, tt := range tests {
+		req, _ := structpb.NewStruct(tt.req)
+		var out structpb.Struct
+		err := conn.Invoke(context.Background(), "/"+productsServiceName+"/"+tt.method, req, &out)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s(%v): expected InvalidArgument, got %v", tt.method, tt.req, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"tailscale.com/ipn"
+)
+
+// funnelConnKey marks request contexts for connections that arrived over
+// Tailscale Funnel.
+type funnelConnKey struct{}
+
+// funnelSrcKey holds the public client address of a Funnel connection, as
+// its RemoteAddr is the relaying Funnel node.
+type funnelSrcKey struct{}
+
+// errGuest is returned by identity lookups for public Funnel visitors.
+var errGuest = errors.New("public visitor via Tailscale Funnel")
+
+// funnelConnContext is the http.Server ConnContext for the Funnel listener.
+// tsnet hands out TLS connections wrapping an *ipn.FunnelConn.
+func funnelConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if fc, ok := c.(*ipn.FunnelConn); ok {
+		ctx = context.WithValue(ctx, funnelSrcKey{}, fc.Src)
+		return context.WithValue(ctx, funnelConnKey{}, true)
+	}
+	return ctx
+}
+
+// isGuestRequest reports whether r comes from the public internet rather
+// than the tailnet. That is either a connection on our own Funnel listener,
+// where any identity headers were set by the visitor and must be ignored, or
+// a request relayed by `tailscale serve --funnel`, which marks it with
+// Tailscale-Funnel-Request and never adds identity headers.
+func isGuestRequest(r *http.Request) bool {
+	if funnel, _ := r.Context().Value(funnelConnKey{}).(bool); funnel {
+		return true
+	}
+	return r.Header.Get("Tailscale-Funnel-Request") != "" && r.Header.Get("Tailscale-User-Login") == ""
+}
+
+// guestAllowed reports whether guests may make the request: the page, its
+// assets, their (lack of) identity, the product list, its categories and
+// statistics, and the public status, read-only and including OPTIONS.
+// Everything else needs a tailnet identity.
+func guestAllowed(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+		return false
+	}
+	switch {
+	case r.URL.Path == "/", r.URL.Path == "/api/user", r.URL.Path == "/api/products",
+		r.URL.Path == "/api/products/stats", r.URL.Path == "/api/categories",
+		r.URL.Path == "/status.json":
+		return true
+	case strings.HasPrefix(r.URL.Path, "/static/"):
+		return true
+	}
+	return false
+}
+
+// guestMode restricts unauthenticated Funnel visitors to a read-only view.
+func (s *Server) guestMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGuestRequest(r) && !guestAllowed(r) {
+			http.Error(w, `{"error": "Guest access is read-only; connect via Tailscale for the full demo"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+// funnelRequest returns a request as it would arrive on the Funnel listener.
+func funnelRequest(t *testing.T, method, target string) *http.Request {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() { c1.Close(); c2.Close() })
+
+	conn := tls.Server(&ipn.FunnelConn{Conn: c1}, &tls.Config{})
+	ctx := funnelConnContext(context.Background(), conn)
+
+	return httptest.NewRequest(method, target, nil).WithContext(ctx)
+}
+
+// TestFunnelConnContext verifies only connections arriving over Funnel mark
+// their requests as guests
+func TestFunnelConnContext(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	ctx := funnelConnContext(context.Background(), tls.Server(c1, &tls.Config{}))
+	if ctx.Value(funnelConnKey{}) != nil {
+		t.Error("tailnet connection marked as Funnel")
+	}
+
+	r := funnelRequest(t, http.MethodGet, "/")
+	if !isGuestRequest(r) {
+		t.Error("Funnel connection not treated as guest")
+	}
+}
+
+// TestIsGuestRequestServeHeaders verifies requests relayed by tailscale
+// serve --funnel are guests even with identity headers
+func TestIsGuestRequestServeHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if isGuestRequest(r) {
+		t.Error("plain request treated as guest")
+	}
+
+	r.Header.Set("Tailscale-Funnel-Request", "?1")
+	if !isGuestRequest(r) {
+		t.Error("request relayed by serve --funnel not treated as guest")
+	}
+
+	r.Header.Set("Tailscale-User-Login", "alice@example.com")
+	if isGuestRequest(r) {
+		t.Error("request with serve identity headers treated as guest")
+	}
+}
+
+// TestGuestMode verifies guests may only use the public read-only routes
+func TestGuestMode(t *testing.T) {
+	s := &Server{}
+	h := s.guestMode(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/", http.StatusTeapot},
+		{http.MethodGet, "/static/app.js", http.StatusTeapot},
+		{http.MethodGet, "/api/user", http.StatusTeapot},
+		{http.MethodGet, "/api/products?limit=10", http.StatusTeapot},
+		{http.MethodGet, "/api/products/stats", http.StatusTeapot},
+		{http.MethodGet, "/api/categories", http.StatusTeapot},
+		{http.MethodGet, "/status.json", http.StatusTeapot},
+		{http.MethodGet, "/api/products/1", http.StatusForbidden},
+		{http.MethodPatch, "/api/products/1", http.StatusForbidden},
+		{http.MethodPost, "/graphql", http.StatusForbidden},
+		{http.MethodGet, "/api/events", http.StatusForbidden},
+		{http.MethodGet, "/api/products/export.csv", http.StatusForbidden},
+		{http.MethodGet, "/api/admin/shaping", http.StatusForbidden},
+		{http.MethodGet, "/health", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, funnelRequest(t, tt.method, tt.target))
+		if w.Code != tt.want {
+			t.Errorf("guest %s %s = %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+
+	// Tailnet requests are unrestricted
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("tailnet POST /graphql = %d, want %d", w.Code, http.StatusTeapot)
+	}
+}
+
+// TestUserHandlerGuest verifies guests are shown as such whatever identity headers they send
+func TestUserHandlerGuest(t *testing.T) {
+	s := &Server{}
+
+	// Identity headers sent by a public visitor must not be trusted
+	r := funnelRequest(t, http.MethodGet, "/api/user")
+	r.Header.Set("Tailscale-User-Login", "alice@example.com")
+
+	w := httptest.NewRecorder()
+	s.userHandler(w, r)
+
+	var got UserInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Guest || got.Connected || got.LoginName != "" {
+		t.Errorf("userHandler for guest = %+v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthcheckCmd probes a running server's /readyz, for container and
+// orchestrator health checks without curl or a shell in the image. In tsnet
+// mode the health server keeps /readyz on the host's localhost. It exits
+// non-zero unless the server is ready.
+type HealthcheckCmd struct {
+	Port    string        `env:"PORT" default:"8080" help:"Port of the server to check on localhost"`
+	URL     string        `name:"url" env:"HEALTHCHECK_URL" placeholder:"URL" help:"Check this URL instead of /readyz on localhost (e.g. http://127.0.0.1:8080/livez)"`
+	Timeout time.Duration `default:"5s" help:"How long to wait for a response"`
+}
+
+func (c *HealthcheckCmd) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	url := c.URL
+	if url == "" {
+		url = "http://127.0.0.1:" + c.Port + "/readyz"
+	}
+	health, err := checkHealth(ctx, http.DefaultClient, url)
+	if err != nil {
+		return err
+	}
+	if health.Database == "" {
+		// /livez only reports the status
+		fmt.Printf("status=%s\n", health.Status)
+		return nil
+	}
+	fmt.Printf("status=%s database=%s tailscale=%s\n", health.Status, health.Database, health.Tailscale)
+	return nil
+}
+
+// checkHealth calls the health endpoint at url and returns an error unless
+// it reports ok.
+func checkHealth(ctx context.Context, client *http.Client, url string) (*HealthResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// /readyz explains a 503 with the same body
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("health check failed: %s", resp.Status)
+	}
+
+	var health HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("health check failed: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("health check returned an invalid response: %w", err)
+	}
+	if health.Status != "ok" {
+		reason := fmt.Sprintf("database=%s tailscale=%s", health.Database, health.Tailscale)
+		if health.Migrations != "" && health.Migrations != "applied" {
+			reason += " migrations=" + health.Migrations
+		}
+		if health.Error != "" {
+			reason += ": " + health.Error
+		}
+		return &health, fmt.Errorf("server is %s (%s)", health.Status, reason)
+	}
+	return &health, nil
+}
+
+// LiveResponse is the body of /livez.
+type LiveResponse struct {
+	Status string `json:"status"`
+}
+
+// liveHandler reports that the process is up and serving. It checks
+// nothing else, so a liveness probe does not restart the server while the
+// database or tailnet is slow to come up; /readyz covers those.
+func (s *Server) liveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LiveResponse{Status: "ok"})
+}
+
+// readyHandler reports whether the server can serve requests: the database
+// answers with its migrations applied and, in tsnet mode, the node is up on
+// the tailnet. It answers 503 with the reason until then.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	ready := HealthResponse{Status: "ok", Database: "connected", Tailscale: "disabled", Migrations: "applied"}
+	if err := s.db.PingContext(ctx); err != nil {
+		ready.Status, ready.Database, ready.Migrations = "unavailable", "disconnected", "unknown"
+	} else if err := schemaCurrent(ctx, s.db); err != nil {
+		ready.Status, ready.Migrations = "unavailable", "pending"
+		ready.Error = err.Error()
+	}
+	if s.tsnetMode {
+		ready.Tailscale = "starting"
+		if s.client != nil {
+			if status, err := s.client.Status(ctx); err == nil && status.BackendState == "Running" {
+				ready.Tailscale = "connected"
+			} else if err == nil {
+				ready.Tailscale = status.BackendState
+			}
+		}
+		if ready.Tailscale != "connected" {
+			ready.Status = "unavailable"
+		}
+	}
+
+	if ready.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(ready)
+}
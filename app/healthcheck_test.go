@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheckHealth verifies checkHealth only succeeds for an ok health response
+func TestCheckHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		body    interface{}
+		wantErr bool
+	}{
+		{"ok", http.StatusOK, HealthResponse{Status: "ok", Database: "connected", Tailscale: "disabled"}, false},
+		{"not ok", http.StatusOK, HealthResponse{Status: "degraded"}, true},
+		{"server error", http.StatusInternalServerError, apiError{Error: "boom"}, true},
+		{"not json", http.StatusOK, "<html>", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.code)
+				if s, ok := tt.body.(string); ok {
+					w.Write([]byte(s))
+					return
+				}
+				json.NewEncoder(w).Encode(tt.body)
+			}))
+			defer srv.Close()
+
+			_, err := checkHealth(context.Background(), srv.Client(), srv.URL+"/health")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkHealth error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestCheckHealthNotReady verifies a 503 from /readyz fails with the reason
+// and still returns the body
+func TestCheckHealthNotReady(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(HealthResponse{Status: "unavailable", Database: "connected", Tailscale: "starting"})
+	}))
+	defer srv.Close()
+
+	health, err := checkHealth(context.Background(), srv.Client(), srv.URL+"/readyz")
+	if err == nil || !strings.Contains(err.Error(), "tailscale=starting") {
+		t.Errorf("checkHealth error = %v, want the reason it is not ready", err)
+	}
+	if health == nil || health.Tailscale != "starting" {
+		t.Errorf("checkHealth = %+v, want the decoded /readyz body", health)
+	}
+}
+
+// TestCheckHealthMigrationsPending verifies pending migrations are reported
+// as the reason the server is not ready
+func TestCheckHealthMigrationsPending(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(HealthResponse{Status: "unavailable", Database: "connected", Tailscale: "disabled", Migrations: "pending", Error: "feature migrations are at version 9, want 10"})
+	}))
+	defer srv.Close()
+
+	_, err := checkHealth(context.Background(), srv.Client(), srv.URL+"/readyz")
+	if err == nil || !strings.Contains(err.Error(), "migrations=pending: feature migrations are at version 9") {
+		t.Errorf("checkHealth error = %v, want the pending migrations", err)
+	}
+}
+
+// TestLiveHandler verifies /livez answers ok without checking any dependency
+func TestLiveHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Server{}).liveHandler(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	var live LiveResponse
+	if err := json.NewDecoder(w.Body).Decode(&live); err != nil || w.Code != http.StatusOK || live.Status != "ok" {
+		t.Errorf("/livez = %d %+v (%v), want 200 ok", w.Code, live, err)
+	}
+}
+
+// TestCriticalDown verifies HEALTH_STRICTNESS decides which dependencies
+// being down fail the health check
+func TestCriticalDown(t *testing.T) {
+	dbDown := HealthResponse{Database: "disconnected", Tailscale: "connected"}
+	replicaDown := HealthResponse{Database: "connected", Replica: "disconnected", Tailscale: "connected"}
+	tsDown := HealthResponse{Database: "connected", Tailscale: "Starting"}
+
+	for _, tc := range []struct {
+		strictness string
+		health     HealthResponse
+		want       string
+	}{
+		{"none", dbDown, ""},
+		{"database", dbDown, "database"},
+		{"", dbDown, "database"},
+		{"database", replicaDown, ""},
+		{"all", replicaDown, "replica"},
+		{"database", tsDown, ""},
+		{"all", tsDown, "tailscale"},
+		{"all", HealthResponse{Database: "disconnected", Tailscale: "Starting"}, "database,tailscale"},
+	} {
+		s := &Server{healthStrictness: tc.strictness, tsnetMode: true}
+		if got := strings.Join(s.criticalDown(tc.health), ","); got != tc.want {
+			t.Errorf("%q with %+v: down = %q, want %q", tc.strictness, tc.health, got, tc.want)
+		}
+	}
+}
+
+// TestHealthcheckCmdURL verifies the healthcheck command checks the URL it is given
+func TestHealthcheckCmdURL(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewEncoder(w).Encode(LiveResponse{Status: "ok"})
+	}))
+	defer srv.Close()
+
+	cmd := HealthcheckCmd{URL: srv.URL + "/livez", Timeout: time.Second}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	if path != "/livez" {
+		t.Errorf("checked %q, want /livez", path)
+	}
+
+	srv.Close()
+	if err := cmd.Run(); err == nil {
+		t.Error("Run succeeded against a stopped server")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 sets srv up to serve HTTP/2 alongside HTTP/1.1, or only
+// HTTP/1.1 if enabled is false. On a TLS listener, whose tlsConfig is
+// given, clients negotiate h2 with ALPN; without TLS they use h2c, either
+// with prior knowledge or by upgrading.
+//
+// Funnel listeners are not configured here: tsnet terminates their TLS
+// without offering h2.
+func configureHTTP2(srv *http.Server, tlsConfig *tls.Config, enabled bool) error {
+	if !enabled {
+		// A non-nil map stops net/http adding h2 itself
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		if tlsConfig != nil {
+			tlsConfig.NextProtos = slices.DeleteFunc(tlsConfig.NextProtos, func(p string) bool { return p == http2.NextProtoTLS })
+		}
+		return nil
+	}
+
+	// Registers h2 for TLS connections and lets Shutdown close HTTP/2
+	// connections, h2c ones included, gracefully
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	} else if !slices.Contains(tlsConfig.NextProtos, http2.NextProtoTLS) {
+		tlsConfig.NextProtos = append([]string{http2.NextProtoTLS}, tlsConfig.NextProtos...)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// serveHTTP2Test serves the request protocol on a listener set up as
+// startRegularServer does, with TLS if tlsConfig is set.
+func serveHTTP2Test(t *testing.T, tlsConfig *tls.Config, enabled bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	if err := configureHTTP2(srv, tlsConfig, enabled); err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func getProto(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	return resp.Proto
+}
+
+// TestConfigureHTTP2 verifies HTTP2 decides whether TLS clients may negotiate HTTP/2
+func TestConfigureHTTP2(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+	clientTLS := &tls.Config{InsecureSkipVerify: true}
+	tlsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS, ForceAttemptHTTP2: true}}
+
+	for _, enabled := range []bool{true, false} {
+		cfg, _, err := TLSConfig{TLSCert: certFile, TLSKey: keyFile}.serverConfig("8443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "HTTP/2.0"
+		if !enabled {
+			want = "HTTP/1.1"
+		}
+		if got := getProto(t, tlsClient, "https://"+serveHTTP2Test(t, cfg, enabled)); got != want {
+			t.Errorf("TLS, enabled %v: %s, want %s", enabled, got, want)
+		}
+	}
+
+	// Cleartext with prior knowledge, as gRPC and other h2c clients connect
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	if got := getProto(t, h2cClient, "http://"+serveHTTP2Test(t, nil, true)); got != "HTTP/2.0" {
+		t.Errorf("h2c: %s", got)
+	}
+	if _, err := h2cClient.Get("http://" + serveHTTP2Test(t, nil, false)); err == nil {
+		t.Error("h2c succeeded with HTTP/2 disabled")
+	}
+	if got := getProto(t, http.DefaultClient, "http://"+serveHTTP2Test(t, nil, true)); got != "HTTP/1.1" {
+		t.Errorf("HTTP/1.1 client: %s", got)
+	}
+}
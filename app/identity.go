@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn"
+	"tailscale.com/types/netmap"
+)
+
+// whoisCacheTTL bounds how long a peer's WhoIs result is reused. Netmap
+// updates invalidate changed peers sooner; the TTL covers the IPN bus watch
+// being down.
+const whoisCacheTTL = 30 * time.Second
+
+// peerIdentity is the part of a peer's identity that authorization depends
+// on. Name is informational and not compared.
+type peerIdentity struct {
+	Node  string   `json:"node,omitempty"`
+	Name  string   `json:"name,omitempty"`
+	Login string   `json:"login,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// identityOf extracts the identity from a WhoIs response. Tagged nodes have
+// no user identity, whoever tagged them.
+func identityOf(whois *apitype.WhoIsResponse) peerIdentity {
+	id := peerIdentity{
+		Node: string(whois.Node.StableID),
+		Name: whois.Node.ComputedName,
+		Tags: whois.Node.Tags,
+	}
+	if !whois.Node.IsTagged() && whois.UserProfile != nil {
+		id.Login = whois.UserProfile.LoginName
+	}
+	return id
+}
+
+func (p peerIdentity) equal(o peerIdentity) bool {
+	return p.Node == o.Node && p.Login == o.Login && slices.Equal(p.Tags, o.Tags)
+}
+
+func (p peerIdentity) String() string {
+	switch {
+	case p.Node == "":
+		return "(gone)"
+	case len(p.Tags) > 0:
+		return fmt.Sprintf("%s (node %s)", strings.Join(p.Tags, ","), p.Node)
+	default:
+		return fmt.Sprintf("%s (node %s)", p.Login, p.Node)
+	}
+}
+
+// identityCache caches WhoIs results by peer address and notices when a
+// peer's user or tags change, either when a stale entry is looked up again
+// or when a netmap update shows the peer differently.
+type identityCache struct {
+	clock Clock
+
+	// onChange is called, without the lock held, when a cached peer's
+	// identity changes or it leaves the netmap (new is then zero).
+	onChange func(addr netip.Addr, old, new peerIdentity)
+
+	mu      sync.Mutex
+	entries map[netip.Addr]*identityEntry
+}
+
+type identityEntry struct {
+	whois   *apitype.WhoIsResponse
+	id      peerIdentity
+	fetched time.Time
+}
+
+func newIdentityCache(clock Clock, onChange func(addr netip.Addr, old, new peerIdentity)) *identityCache {
+	return &identityCache{clock: clock, onChange: onChange, entries: map[netip.Addr]*identityEntry{}}
+}
+
+// get returns the cached WhoIs for addr if it is still fresh.
+func (c *identityCache) get(addr netip.Addr) (*apitype.WhoIsResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[addr]
+	if !ok || c.clock.Now().Sub(e.fetched) >= whoisCacheTTL {
+		return nil, false
+	}
+	return e.whois, true
+}
+
+// put caches a fresh WhoIs for addr, reporting a change from the previous
+// (possibly stale) entry.
+func (c *identityCache) put(addr netip.Addr, whois *apitype.WhoIsResponse) {
+	id := identityOf(whois)
+
+	c.mu.Lock()
+	prev, had := c.entries[addr]
+	c.entries[addr] = &identityEntry{whois: whois, id: id, fetched: c.clock.Now()}
+	c.mu.Unlock()
+
+	if had && !prev.id.equal(id) {
+		c.onChange(addr, prev.id, id)
+	}
+}
+
+// observe drops cached entries whose peer is missing from or different in
+// peers, the identities in the current netmap.
+func (c *identityCache) observe(peers map[netip.Addr]peerIdentity) {
+	type change struct {
+		addr     netip.Addr
+		old, new peerIdentity
+	}
+	var changes []change
+
+	c.mu.Lock()
+	for addr, e := range c.entries {
+		if id, ok := peers[addr]; !ok || !e.id.equal(id) {
+			delete(c.entries, addr)
+			changes = append(changes, change{addr, e.id, id})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, ch := range changes {
+		c.onChange(ch.addr, ch.old, ch.new)
+	}
+}
+
+// netmapIdentities returns the identity of every peer address in nm.
+func netmapIdentities(nm *netmap.NetworkMap) map[netip.Addr]peerIdentity {
+	peers := map[netip.Addr]peerIdentity{}
+	for _, p := range nm.Peers {
+		id := peerIdentity{Node: string(p.StableID()), Name: p.ComputedName(), Tags: p.Tags().AsSlice()}
+		if len(id.Tags) == 0 {
+			id.Login = nm.UserProfiles[p.User()].LoginName
+		}
+		for _, pfx := range p.Addresses().AsSlice() {
+			if pfx.IsSingleIP() {
+				peers[pfx.Addr()] = id
+			}
+		}
+	}
+	return peers
+}
+
+// lookupWhoIs returns the WhoIs for remoteAddr, from the cache if possible.
+func (s *Server) lookupWhoIs(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error) {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if s.identities == nil || err != nil {
+		return s.client.WhoIs(ctx, remoteAddr)
+	}
+	addr := addrPort.Addr().Unmap()
+
+	if whois, ok := s.identities.get(addr); ok {
+		return whois, nil
+	}
+
+	// Another replica may have looked the peer up already
+	var shared apitype.WhoIsResponse
+	if s.shared.getJSON(ctx, whoisKey(addr.String()), &shared) {
+		s.identities.put(addr, &shared)
+		return &shared, nil
+	}
+
+	whois, err := s.client.WhoIs(ctx, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	s.identities.put(addr, whois)
+	s.shared.setJSON(ctx, whoisKey(addr.String()), whois, whoisCacheTTL)
+	return whois, nil
+}
+
+// identityChanged logs and audits a peer whose identity changed while its
+// WhoIs was cached. The cache entry is already gone, and is dropped from
+// Redis too, so the next request is authorized as the new identity.
+func (s *Server) identityChanged(addr netip.Addr, old, new peerIdentity) {
+	log.Printf("Tailscale identity of %s changed from %s to %s; cached WhoIs dropped", addr, old, new)
+	s.shared.forget(whoisKey(addr.String()))
+	if s.audit == nil {
+		return
+	}
+	summary, _ := json.Marshal(map[string]peerIdentity{"old": old, "new": new})
+	s.audit.record(store.AuditEntry{
+		Time:    s.clock.Now(),
+		Login:   old.Login,
+		Node:    old.Name,
+		Method:  "EVENT",
+		Route:   "identity-change",
+		Path:    addr.String(),
+		Summary: summary,
+	})
+}
+
+// watchIdentities follows netmap updates on the IPN bus until ctx is done,
+// so identity changes take effect without waiting for whoisCacheTTL. State
+// changes go to tsAuth.
+func (s *Server) watchIdentities(ctx context.Context) {
+	b := newBackoff(time.Second, time.Minute, s.rand)
+	for {
+		err := s.watchNetmaps(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		wait := b.Next()
+		log.Printf("Warning: IPN bus watch failed: %v; retrying in %s", err, wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(wait):
+		}
+	}
+}
+
+func (s *Server) watchNetmaps(ctx context.Context) error {
+	w, err := s.client.WatchIPNBus(ctx, ipn.NotifyInitialState|ipn.NotifyInitialNetMap|ipn.NotifyNoPrivateKeys)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	for {
+		n, err := w.Next()
+		if err != nil {
+			return err
+		}
+		if n.NetMap != nil {
+			s.identities.observe(netmapIdentities(n.NetMap))
+		}
+		if s.tsAuth != nil {
+			s.tsAuth.observe(n)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func whoisFor(node, login string, tags ...string) *apitype.WhoIsResponse {
+	return &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{StableID: tailcfg.StableNodeID(node), ComputedName: "laptop", Tags: tags},
+		UserProfile: &tailcfg.UserProfile{LoginName: login},
+	}
+}
+
+// TestIdentityCache verifies identities are cached until they expire and changes are reported
+func TestIdentityCache(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	var changes [][2]peerIdentity
+	c := newIdentityCache(clock, func(addr netip.Addr, old, new peerIdentity) {
+		changes = append(changes, [2]peerIdentity{old, new})
+	})
+	addr := netip.MustParseAddr("100.64.0.1")
+
+	c.put(addr, whoisFor("n1", "alice@example.com"))
+	if _, ok := c.get(addr); !ok {
+		t.Fatal("fresh entry not cached")
+	}
+	clock.Advance(whoisCacheTTL)
+	if _, ok := c.get(addr); ok {
+		t.Fatal("stale entry returned")
+	}
+
+	// A looked-up-again peer that is the same is not a change
+	c.put(addr, whoisFor("n1", "alice@example.com"))
+	if len(changes) != 0 {
+		t.Fatalf("unchanged peer reported: %v", changes)
+	}
+
+	// On the next lookup after the node was tagged, the change is reported
+	clock.Advance(whoisCacheTTL)
+	c.put(addr, whoisFor("n1", "alice@example.com", "tag:ci"))
+	if len(changes) != 1 || changes[0][0].Login != "alice@example.com" || changes[0][1].Login != "" || changes[0][1].Tags[0] != "tag:ci" {
+		t.Fatalf("changes = %v", changes)
+	}
+}
+
+// TestIdentityCacheObserve verifies the netmap drops identities of peers that moved or left
+func TestIdentityCacheObserve(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	var changed []netip.Addr
+	c := newIdentityCache(clock, func(addr netip.Addr, old, new peerIdentity) {
+		changed = append(changed, addr)
+	})
+	same, moved, gone := netip.MustParseAddr("100.64.0.1"), netip.MustParseAddr("100.64.0.2"), netip.MustParseAddr("100.64.0.3")
+	c.put(same, whoisFor("n1", "alice@example.com"))
+	c.put(moved, whoisFor("n2", "bob@example.com"))
+	c.put(gone, whoisFor("n3", "carol@example.com"))
+
+	c.observe(map[netip.Addr]peerIdentity{
+		same:  {Node: "n1", Name: "renamed", Login: "alice@example.com"},
+		moved: {Node: "n2", Login: "mallory@example.com"},
+	})
+
+	if _, ok := c.get(same); !ok {
+		t.Error("unchanged peer evicted")
+	}
+	for _, addr := range []netip.Addr{moved, gone} {
+		if _, ok := c.get(addr); ok {
+			t.Errorf("%s still cached", addr)
+		}
+	}
+	if len(changed) != 2 {
+		t.Errorf("changed = %v, want %s and %s", changed, moved, gone)
+	}
+}
+
+// TestIdentityChangedAudited verifies a peer's identity changing is recorded in the audit log
+func TestIdentityChangedAudited(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	s := &Server{clock: clock, audit: &auditLog{entries: make(chan store.AuditEntry, 1)}}
+	s.identityChanged(netip.MustParseAddr("100.64.0.1"),
+		peerIdentity{Node: "n1", Name: "laptop", Login: "alice@example.com"},
+		peerIdentity{Node: "n1", Name: "laptop", Tags: []string{"tag:ci"}})
+
+	e := <-s.audit.entries
+	if e.Route != "identity-change" || e.Login != "alice@example.com" || e.Node != "laptop" || e.Path != "100.64.0.1" {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// defaultMaxImportBytes is the IMPORT_MAX_BYTES default.
+const defaultMaxImportBytes = 32 << 20
+
+// importBatchSize is how many products each INSERT of an import adds.
+const importBatchSize = 500
+
+// importMaxErrors caps the row errors an import reports; the rest are only
+// counted.
+const importMaxErrors = 100
+
+// importColumns are the product fields an import may set, name first.
+var importColumns = []string{"name", "description", "price", "stock_quantity", "category"}
+
+// errImportRolledBack ends an import's transaction without committing it.
+var errImportRolledBack = errors.New("import rolled back")
+
+// ImportResult reports on a product import. Nothing is committed unless
+// every row was imported.
+type ImportResult struct {
+	// Rows is the number of data rows read.
+	Rows int `json:"rows"`
+	// Imported is the number of products added, or that would have been
+	// with dry_run; 0 if any row failed.
+	Imported int `json:"imported"`
+	// Failed is the number of rows that could not be imported.
+	Failed int              `json:"failed"`
+	DryRun bool             `json:"dry_run"`
+	Errors []ImportRowError `json:"errors,omitempty"`
+}
+
+// ImportRowError is why one row could not be imported.
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+func (res *ImportResult) fail(line int, name, msg string) {
+	res.Failed++
+	if len(res.Errors) < importMaxErrors {
+		res.Errors = append(res.Errors, ImportRowError{Line: line, Name: name, Error: msg})
+	}
+}
+
+// importRows reads the rows of an import body. next returns the line a row
+// starts on and its fields, io.EOF after the last row, or an *rowParseError
+// for a row that cannot be parsed; any other error ends the import.
+type importRows interface {
+	next() (line int, fields map[string]interface{}, err error)
+}
+
+type rowParseError struct {
+	msg string
+}
+
+func (e *rowParseError) Error() string { return e.msg }
+
+// csvImport reads a CSV file whose header names the columns.
+type csvImport struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func newCSVImport(body io.Reader) (*csvImport, error) {
+	r := csv.NewReader(body)
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("CSV must start with a header row")
+	} else if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(header))
+	for _, col := range header {
+		if !isImportColumn(col) {
+			return nil, fmt.Errorf("CSV column %q is not an importable product field", col)
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("CSV column %q appears twice", col)
+		}
+		seen[col] = true
+	}
+	if !seen["name"] || !seen["price"] {
+		return nil, errors.New("CSV header must include name and price")
+	}
+	return &csvImport{r: r, columns: header}, nil
+}
+
+func (c *csvImport) next() (int, map[string]interface{}, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+		return parseErr.StartLine, nil, &rowParseError{fmt.Sprintf("has %d fields, want %d", len(record), len(c.columns))}
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	fields := make(map[string]interface{}, len(record))
+	for i, col := range c.columns {
+		fields[col] = csvImportValue(col, record[i])
+	}
+	return line, fields, nil
+}
+
+// csvImportValue converts a CSV cell into the JSON value the product field
+// validators expect: empty optional cells are null and numbers are parsed.
+func csvImportValue(col, cell string) interface{} {
+	switch col {
+	case "name", "price":
+		return cell
+	case "stock_quantity":
+		if cell == "" {
+			return nil
+		}
+		if f, err := strconv.ParseFloat(cell, 64); err == nil {
+			return f
+		}
+		return cell
+	}
+	if cell == "" {
+		return nil
+	}
+	return cell
+}
+
+// ndjsonImport reads one JSON product object per line. Blank lines are
+// skipped.
+type ndjsonImport struct {
+	r    *bufio.Reader
+	line int
+}
+
+func newNDJSONImport(body io.Reader) *ndjsonImport {
+	return &ndjsonImport{r: bufio.NewReader(body)}
+}
+
+func (n *ndjsonImport) next() (int, map[string]interface{}, error) {
+	for {
+		text, err := n.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, nil, err
+		}
+		if len(text) == 0 && err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		n.line++
+
+		text = bytes.TrimSpace(text)
+		if len(text) == 0 {
+			continue
+		}
+		var fields map[string]interface{}
+		if jsonErr := json.Unmarshal(text, &fields); jsonErr != nil || fields == nil {
+			return n.line, nil, &rowParseError{"is not a JSON object"}
+		}
+		return n.line, fields, nil
+	}
+}
+
+func isImportColumn(col string) bool {
+	for _, c := range importColumns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// importValues validates a row's fields as PATCH does and returns their
+// values in importColumns order. A missing stock_quantity is 0, as the
+// column defaults to.
+func importValues(fields map[string]interface{}) ([]interface{}, error) {
+	var unknown []string
+	for col := range fields {
+		if !isImportColumn(col) {
+			unknown = append(unknown, col)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("%s is not an importable product field", unknown[0])
+	}
+
+	values := make([]interface{}, len(importColumns))
+	for i, col := range importColumns {
+		v, err := writableProductColumns[col](fields[col])
+		if err != nil {
+			return nil, err
+		}
+		if col == "stock_quantity" && v == nil {
+			v = int64(0)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// importProducts inserts rows in batches in tx, recording the rows that
+// fail in res. Rows keep being inserted after a failure, so every name
+// conflict is reported, though the caller then rolls back.
+func importProducts(ctx context.Context, tx *store.Tx, rows importRows, res *ImportResult) error {
+	seen := make(map[string]int)
+	var (
+		batch [][]interface{}
+		lines []int
+	)
+	flush := func() error {
+		inserted, err := tx.InsertProducts(ctx, importColumns, batch)
+		if err != nil {
+			return err
+		}
+		for i, values := range batch {
+			name := values[0].(string)
+			if inserted[name] {
+				res.Imported++
+			} else {
+				res.fail(lines[i], name, errProductNameTaken.Error())
+			}
+		}
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	for {
+		line, fields, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowParseError
+		if errors.As(err, &rowErr) {
+			res.Rows++
+			res.fail(line, "", "Row "+rowErr.msg)
+			continue
+		} else if err != nil {
+			return &importBodyError{err}
+		}
+		res.Rows++
+
+		name, _ := fields["name"].(string)
+		values, err := importValues(fields)
+		if err != nil {
+			res.fail(line, name, err.Error())
+			continue
+		}
+		if first, ok := seen[name]; ok {
+			res.fail(line, name, fmt.Sprintf("name duplicates line %d", first))
+			continue
+		}
+		seen[name] = line
+
+		batch = append(batch, values)
+		lines = append(lines, line)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// importProductsHandler adds products from a CSV or NDJSON body in one
+// transaction, so an import is either applied whole or not at all. With
+// ?dry_run=true every row is inserted and checked but the transaction is
+// rolled back.
+func (s *Server) importProductsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, `{"error": "dry_run must be true or false"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := s.maxImportBytes
+	if limit <= 0 {
+		limit = defaultMaxImportBytes
+	}
+	body := http.MaxBytesReader(w, r.Body, limit)
+
+	var rows importRows
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		csvRows, err := newCSVImport(body)
+		if err != nil {
+			writeImportError(w, &importBodyError{err})
+			return
+		}
+		rows = csvRows
+	case "application/x-ndjson", "application/ndjson":
+		rows = newNDJSONImport(body)
+	default:
+		http.Error(w, `{"error": "Content-Type must be text/csv or application/x-ndjson"}`, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctx := s.withActor(r.Context(), r)
+
+	res := ImportResult{DryRun: dryRun}
+	err := s.store.InTx(ctx, func(tx *store.Tx) error {
+		if err := importProducts(ctx, tx, rows, &res); err != nil {
+			return err
+		}
+		if res.Failed > 0 || dryRun {
+			return errImportRolledBack
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusCreated)
+	case !errors.Is(err, errImportRolledBack):
+		writeImportError(w, err)
+		return
+	case res.Failed > 0:
+		res.Imported = 0
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// importBodyError is an import body that could not be read.
+type importBodyError struct {
+	err error
+}
+
+func (e *importBodyError) Error() string { return e.err.Error() }
+func (e *importBodyError) Unwrap() error { return e.err }
+
+// writeImportError reports an import that could not be read or written.
+func writeImportError(w http.ResponseWriter, err error) {
+	var (
+		tooLarge *http.MaxBytesError
+		bodyErr  *importBodyError
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Imports may be at most %d bytes", tooLarge.Limit))
+	case errors.As(err, &bodyErr):
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Malformed import: %v", err))
+	default:
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to import products: %v", err))
+	}
+}
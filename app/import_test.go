@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readImport returns the rows of an import as line: fields, or line: error.
+func readImport(t *testing.T, rows importRows) map[int]interface{} {
+	t.Helper()
+	got := make(map[int]interface{})
+	for {
+		line, fields, err := rows.next()
+		if err == io.EOF {
+			return got
+		}
+		var rowErr *rowParseError
+		if errors.As(err, &rowErr) {
+			got[line] = rowErr.msg
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got[line] = fields
+	}
+}
+
+// TestCSVImport verifies CSV rows are read by header, including quoted
+// multi-line values, and short rows are reported
+func TestCSVImport(t *testing.T) {
+	rows, err := newCSVImport(strings.NewReader("name,price,stock_quantity,category\n" +
+		"Widget,9.99,3,Tools\n" +
+		"\"Multi\nline\",1,,\n" +
+		"Short,2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]interface{}{
+		2: map[string]interface{}{"name": "Widget", "price": "9.99", "stock_quantity": 3.0, "category": "Tools"},
+		3: map[string]interface{}{"name": "Multi\nline", "price": "1", "stock_quantity": nil, "category": nil},
+		5: "has 2 fields, want 4",
+	}
+	if got := readImport(t, rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %#v, want %#v", got, want)
+	}
+}
+
+// TestCSVImportHeader verifies CSV headers without the required or with
+// unknown or repeated columns are rejected
+func TestCSVImportHeader(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                  "CSV must start with a header row",
+		"name,price,id\n":   `CSV column "id" is not an importable product field`,
+		"name,name,price\n": `CSV column "name" appears twice`,
+		"name,category\n":   "CSV header must include name and price",
+	} {
+		if _, err := newCSVImport(strings.NewReader(header)); err == nil || err.Error() != want {
+			t.Errorf("header %q: error %v, want %q", header, err, want)
+		}
+	}
+}
+
+// TestNDJSONImport verifies NDJSON rows are read by line, skipping blank
+// lines and reporting non-objects
+func TestNDJSONImport(t *testing.T) {
+	rows := newNDJSONImport(strings.NewReader(`{"name": "Widget", "price": 9.99}` + "\n\n" + `[1, 2]` + "\n" + `{"name": "Gadget", "price": "5"}`))
+	want := map[int]interface{}{
+		1: map[string]interface{}{"name": "Widget", "price": 9.99},
+		3: "is not a JSON object",
+		4: map[string]interface{}{"name": "Gadget", "price": "5"},
+	}
+	if got := readImport(t, rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %#v, want %#v", got, want)
+	}
+}
+
+// TestImportValues verifies import fields are converted to column values,
+// and invalid ones are reported
+func TestImportValues(t *testing.T) {
+	got, err := importValues(map[string]interface{}{"name": "Widget", "price": 9.5, "category": "Tools"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"Widget", nil, "9.50", int64(0), "Tools"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %#v, want %#v", got, want)
+	}
+
+	for _, tc := range []struct {
+		fields map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"price": 1.0}, "name must be a non-empty string"},
+		{map[string]interface{}{"name": "Widget"}, "price must be a number"},
+		{map[string]interface{}{"name": "Widget", "price": 1.0, "stock_quantity": 1.5}, "stock_quantity must be a non-negative integer or null"},
+		{map[string]interface{}{"name": "Widget", "price": 1.0, "id": 7.0, "created_at": "now"}, "created_at is not an importable product field"},
+	} {
+		if _, err := importValues(tc.fields); err == nil || err.Error() != tc.want {
+			t.Errorf("importValues(%v) error = %v, want %q", tc.fields, err, tc.want)
+		}
+	}
+}
+
+// TestImportProductsHandlerRejects verifies bad imports are rejected before the database is used
+func TestImportProductsHandlerRejects(t *testing.T) {
+	s := &Server{maxImportBytes: 64}
+	for _, tc := range []struct {
+		name, query, contentType, body string
+		status                         int
+	}{
+		{"bad dry run", "?dry_run=maybe", "text/csv", "name,price\n", http.StatusBadRequest},
+		{"json", "", "application/json", `[{"name": "Widget"}]`, http.StatusUnsupportedMediaType},
+		{"bad header", "", "text/csv", "sku,price\n", http.StatusBadRequest},
+		{"too large", "", "text/csv", strings.Repeat("name", 20) + "\n", http.StatusRequestEntityTooLarge},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/products/import"+tc.query, strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		s.importProductsHandler(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d: %s", tc.name, w.Code, tc.status, w.Body)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// listenerSet runs the HTTP servers of a serving mode, each on its own
+// listener, and shuts them down together. Servers start as they are added,
+// so the health and local listeners can answer while tsnet is still coming
+// up.
+type listenerSet struct {
+	servers []namedServer
+}
+
+type namedServer struct {
+	name string
+	srv  *http.Server
+}
+
+// start serves srv on ln in the background. If fatal, the process exits
+// when serving fails; otherwise the error is logged.
+func (ls *listenerSet) start(name string, srv *http.Server, ln net.Listener, fatal bool) {
+	ls.servers = append(ls.servers, namedServer{name: name, srv: srv})
+	go func() {
+		log.Printf("%s listening on %s", name, ln.Addr())
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			if fatal {
+				log.Fatalf("%s error: %v", name, err)
+			}
+			log.Printf("%s error: %v", name, err)
+		}
+	}()
+}
+
+// shutdown gracefully stops every server, most recently started first.
+func (ls *listenerSet) shutdown(ctx context.Context) {
+	for i := len(ls.servers) - 1; i >= 0; i-- {
+		s := ls.servers[i]
+		if err := s.srv.Shutdown(ctx); err != nil {
+			log.Printf("%s forced to shutdown: %v", s.name, err)
+		}
+	}
+}
+
+// serveUntilSignal reports readiness, then waits for SIGINT or SIGTERM,
+// calls stopFeatures and shuts the servers down. The features stop first so
+// they can still reach the database and the tailnet while they wind down.
+func (ls *listenerSet) serveUntilSignal(config ServeCmd, stopFeatures func()) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	config.systemd.ready()
+	<-quit
+	config.systemd.stopping()
+	stopFeatures()
+	log.Println("Shutting down servers...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ls.shutdown(shutdownCtx)
+
+	log.Println("Server exited")
+}
+
+// checkListenLocal checks that addr, the --listen-local address, is a
+// loopback host and port: the local listener skips the tailnet, so it must
+// only be reachable from the machine or pod itself.
+func checkListenLocal(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("LISTEN_LOCAL %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("LISTEN_LOCAL %q: host must be localhost or a loopback address such as 127.0.0.1", addr)
+	}
+	if port == "" {
+		return fmt.Errorf("LISTEN_LOCAL %q: missing port", addr)
+	}
+	return nil
+}
+
+// localConnKey marks request contexts for connections accepted by the
+// --listen-local or --listen-unix listener.
+type localConnKey struct{}
+
+// errLocalListener is returned by identity lookups for requests on the
+// local listeners, which bypass the tailnet and so have no peer to WhoIs.
+var errLocalListener = errors.New("request on a local listener has no tailnet identity")
+
+// localConnContext is the http.Server ConnContext for the local listeners.
+func localConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, localConnKey{}, true)
+}
+
+// isLocalRequest reports whether r arrived on --listen-local or
+// --listen-unix rather than the tailnet or PORT.
+func isLocalRequest(r *http.Request) bool {
+	local, _ := r.Context().Value(localConnKey{}).(bool)
+	return local
+}
+
+// startLocalListener serves handler on the --listen-local loopback address,
+// if set, for health probes and sidecars on the same host.
+func startLocalListener(config ServeCmd, handler http.Handler, listeners *listenerSet) {
+	if config.ListenLocal == "" {
+		return
+	}
+	ln, err := net.Listen("tcp", config.ListenLocal)
+	if err != nil {
+		log.Fatal(&bindError{Name: "Local server", Addr: config.ListenLocal, Err: err})
+	}
+	announceListen("local", ln, config.AnnounceFile)
+
+	srv := &http.Server{Handler: handler, ConnContext: localConnContext}
+	if err := configureHTTP2(srv, nil, config.HTTP2); err != nil {
+		log.Fatalf("Failed to configure HTTP/2: %v", err)
+	}
+	listeners.start("Local server", srv, ln, false)
+}
+
+// listenUnix listens on the Unix socket at path with the given permissions.
+// A socket left behind by a process that did not shut down cleanly is
+// replaced; one that still accepts connections is an error. Closing the
+// listener removes the socket.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// parseSocketMode parses the octal --listen-unix-mode permissions.
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("LISTEN_UNIX_MODE %q: want octal permissions such as 0660", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// startUnixListener serves handler on the --listen-unix socket, if set,
+// for reverse proxies on the same host.
+func startUnixListener(config ServeCmd, handler http.Handler, listeners *listenerSet) {
+	if config.ListenUnix == "" {
+		return
+	}
+	mode, err := parseSocketMode(config.ListenUnixMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ln, err := listenUnix(config.ListenUnix, mode)
+	if err != nil {
+		log.Fatal(&bindError{Name: "Unix socket server", Addr: config.ListenUnix, Err: err})
+	}
+	announceListen("unix", ln, config.AnnounceFile)
+
+	srv := &http.Server{Handler: handler, ConnContext: localConnContext}
+	if err := configureHTTP2(srv, nil, config.HTTP2); err != nil {
+		log.Fatalf("Failed to configure HTTP/2: %v", err)
+	}
+	listeners.start("Unix socket server", srv, ln, false)
+}
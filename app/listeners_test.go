@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckListenLocal verifies LISTEN_LOCAL only accepts a loopback host and port
+func TestCheckListenLocal(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:8080", "localhost:9000", "[::1]:8080", "127.0.0.2:0"} {
+		if err := checkListenLocal(addr); err != nil {
+			t.Errorf("%s: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"8080", ":8080", "0.0.0.0:8080", "10.0.0.1:8080", "example.com:80", "127.0.0.1:"} {
+		if err := checkListenLocal(addr); err == nil {
+			t.Errorf("%s: expected an error", addr)
+		}
+	}
+}
+
+// TestListenerSet verifies each server answers on its own listener until the set is shut down
+func TestListenerSet(t *testing.T) {
+	var ls listenerSet
+	var addrs []string
+	for _, name := range []string{"first", "second"} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name)
+		})}
+		ls.start(name, srv, ln, false)
+		addrs = append(addrs, ln.Addr().String())
+	}
+
+	// Both listeners serve at once
+	for i, want := range []string{"first", "second"} {
+		resp, err := http.Get("http://" + addrs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("%s answered %q", addrs[i], body)
+		}
+	}
+
+	ls.shutdown(context.Background())
+	for _, addr := range addrs {
+		if _, err := http.Get("http://" + addr); err == nil {
+			t.Errorf("%s still serving after shutdown", addr)
+		}
+	}
+}
+
+// TestListenUnix verifies the Unix socket replaces a stale one and gets the configured mode
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "demo.sock")
+
+	// A stale socket from a crashed process is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenUnix(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode %v, %v", fi.Mode(), err)
+	}
+	var ls listenerSet
+	ls.start("unix", &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})}, ln, false)
+
+	// A live socket is not taken over
+	if _, err := listenUnix(path, 0o600); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("live socket: %v", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("status %d", resp.StatusCode)
+	}
+
+	ls.shutdown(context.Background())
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after shutdown: %v", err)
+	}
+
+	// Anything else at the path is left alone
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0o644)
+	if _, err := listenUnix(file, 0o600); err == nil {
+		t.Error("listened over a regular file")
+	}
+}
+
+// TestParseSocketMode verifies socket modes are octal permission bits
+func TestParseSocketMode(t *testing.T) {
+	if mode, err := parseSocketMode("0660"); err != nil || mode != 0o660 {
+		t.Errorf("0660: %v, %v", mode, err)
+	}
+	for _, bad := range []string{"", "rw", "660x", "1777", "999"} {
+		if _, err := parseSocketMode(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
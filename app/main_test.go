@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
 )
 
 // TestConfig holds test configuration
@@ -44,6 +47,22 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// asServeUser makes r look proxied by `tailscale serve` for login: from
+// loopback, with its identity header.
+func asServeUser(r *http.Request, login string) *http.Request {
+	r.RemoteAddr = "127.0.0.1:41641"
+	r.Header.Set("Tailscale-User-Login", login)
+	return r
+}
+
+// asSpoofedUser gives r the identity header of login, as a tailnet peer
+// could send, which must not make it login.
+func asSpoofedUser(r *http.Request, login string) *http.Request {
+	r.RemoteAddr = "100.64.0.2:41641"
+	r.Header.Set("Tailscale-User-Login", login)
+	return r
+}
+
 // waitForServer waits for the API server to be ready
 func waitForServer(baseURL string, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -202,7 +221,7 @@ func TestProductsWithSeededData(t *testing.T) {
 		config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName, config.DBSSLMode)
 
 	t.Log("Connecting to database to verify seeded data...")
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open(store.DriverName, connStr)
 	if err != nil {
 		t.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -213,7 +232,7 @@ func TestProductsWithSeededData(t *testing.T) {
 
 	// Count products in database
 	var count int
-	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products").Scan(&count)
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products WHERE deleted_at IS NULL").Scan(&count)
 	if err != nil {
 		t.Fatalf("❌ Failed to count products in database after 2 seconds: %v\n"+
 			"Please verify database connectivity.", err)
@@ -257,7 +276,7 @@ func TestDatabaseConnection(t *testing.T) {
 		config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName, config.DBSSLMode)
 
 	t.Logf("Connecting to database at %s:%s...", config.DBHost, config.DBPort)
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open(store.DriverName, connStr)
 	if err != nil {
 		t.Fatalf("❌ Failed to open database connection: %v", err)
 	}
@@ -291,3 +310,188 @@ func TestDatabaseConnection(t *testing.T) {
 
 	t.Logf("✅ Successfully verified database and products table")
 }
+
+// TestProductsCursorPagination walks the products table page by page using cursors
+func TestProductsCursorPagination(t *testing.T) {
+	config := getTestConfig()
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
+	seen := make(map[interface{}]bool)
+	url := config.APIBaseURL + "/api/products?limit=2&cursor="
+
+	for page := 0; page < 100; page++ {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("❌ Failed to call paginated products endpoint: %v", err)
+		}
+
+		var result ProductPage
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode paginated products response: %v", err)
+		}
+
+		if len(result.Products) > 2 {
+			t.Fatalf("Expected at most 2 products per page, got %d", len(result.Products))
+		}
+
+		for _, p := range result.Products {
+			if seen[p["id"]] {
+				t.Errorf("Product %v returned on more than one page", p["id"])
+			}
+			seen[p["id"]] = true
+		}
+
+		if result.NextCursor == "" {
+			t.Logf("✅ Walked %d products across %d pages", len(seen), page+1)
+			return
+		}
+		url = config.APIBaseURL + "/api/products?limit=2&cursor=" + result.NextCursor
+	}
+
+	t.Errorf("Pagination did not terminate after 100 pages")
+}
+
+// TestProductsCategoryFilter lists categories and filters products by each
+func TestProductsCategoryFilter(t *testing.T) {
+	config := getTestConfig()
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
+	resp, err := client.Get(config.APIBaseURL + "/api/categories")
+	if err != nil {
+		t.Fatalf("❌ Failed to call categories endpoint: %v", err)
+	}
+	var categories []store.Category
+	err = json.NewDecoder(resp.Body).Decode(&categories)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode categories response: %v", err)
+	}
+
+	for _, c := range categories {
+		resp, err := client.Get(config.APIBaseURL + "/api/products?category=" + url.QueryEscape(c.Name))
+		if err != nil {
+			t.Fatalf("❌ Failed to call products endpoint: %v", err)
+		}
+		var products []map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&products)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode products response: %v", err)
+		}
+
+		if c.ProductCount <= 100 && int64(len(products)) != c.ProductCount {
+			t.Errorf("Category %q has %d products, filter returned %d", c.Name, c.ProductCount, len(products))
+		}
+		for _, p := range products {
+			if p["category"] != c.Name {
+				t.Errorf("Product %v in category %v returned for %q", p["id"], p["category"], c.Name)
+			}
+		}
+	}
+	t.Logf("✅ Filtered products by %d categories", len(categories))
+}
+
+// TestProductsCSVExport tests the CSV export endpoint
+func TestProductsCSVExport(t *testing.T) {
+	config := getTestConfig()
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
+	resp, err := client.Get(config.APIBaseURL + "/api/products/export.csv")
+	if err != nil {
+		t.Fatalf("❌ Failed to call CSV export endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Expected text/csv content type, got '%s'", ct)
+	}
+
+	if cd := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Expected attachment content disposition, got '%s'", cd)
+	}
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV export: %v", err)
+	}
+
+	if len(records) == 0 || !strings.Contains(strings.Join(records[0], ","), "name") {
+		t.Fatalf("Expected a header row containing 'name', got %v", records)
+	}
+
+	t.Logf("✅ Exported %d products as CSV", len(records)-1)
+}
+
+// TestProductsStats checks the aggregate statistics against the database
+func TestProductsStats(t *testing.T) {
+	config := getTestConfig()
+
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s connect_timeout=2",
+		config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName, config.DBSSLMode)
+
+	db, err := sql.Open(store.DriverName, connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var count int64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products WHERE deleted_at IS NULL").Scan(&count); err != nil {
+		t.Fatalf("❌ Failed to count products in database: %v", err)
+	}
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
+	resp, err := client.Get(config.APIBaseURL + "/api/products/stats")
+	if err != nil {
+		t.Fatalf("❌ Failed to call stats endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var stats ProductStatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats response: %v", err)
+	}
+
+	if stats.Count != count {
+		t.Errorf("Expected a count of %d, got %d", count, stats.Count)
+	}
+
+	var categorized int64
+	for _, c := range stats.Categories {
+		categorized += c.Count
+	}
+	if categorized != count {
+		t.Errorf("Expected category counts to sum to %d, got %d", count, categorized)
+	}
+
+	if count > 0 && (stats.Newest == nil || stats.MinPrice == nil || *stats.MinPrice > *stats.MaxPrice) {
+		t.Errorf("Unexpected stats for a non-empty table: %+v", stats)
+	}
+
+	t.Logf("✅ %d products in %d categories", stats.Count, len(stats.Categories))
+}
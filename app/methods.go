@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response.
+const corsMaxAge = 600
+
+// probeMethods are the methods OPTIONS checks the mux for, in Allow order.
+var probeMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// allowedMethods returns the methods mux serves for r's path, or nil if the
+// path is not routed at all.
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	var allow []string
+	for _, m := range probeMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = m
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			allow = append(allow, m)
+		}
+	}
+	if allow != nil {
+		allow = append(allow, http.MethodOptions)
+	}
+	return allow
+}
+
+// methodSupport answers OPTIONS for every route, including CORS preflights,
+// from the methods registered on mux, and makes HEAD safe on streaming
+// routes. The mux itself serves HEAD for GET routes and 405 with an Allow
+// header for other methods.
+func (s *Server) methodSupport(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		corsAllowed := origin != "" && s.corsAllowed(origin)
+		if corsAllowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+
+		switch r.Method {
+		case http.MethodOptions:
+			allow := allowedMethods(mux, r)
+			if allow == nil {
+				mux.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			if corsAllowed && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(allow, ", "))
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodHead:
+			// net/http discards HEAD bodies, but streaming handlers would
+			// otherwise keep the request open; end it once headers are sent
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			mux.ServeHTTP(&headWriter{ResponseWriter: w, cancel: cancel}, r.WithContext(ctx))
+		default:
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// corsAllowed reports whether browsers on origin may call the API.
+func (s *Server) corsAllowed(origin string) bool {
+	for _, o := range s.corsOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// headWriter cancels a HEAD request once its headers have been flushed.
+type headWriter struct {
+	http.ResponseWriter
+	cancel context.CancelFunc
+}
+
+func (h *headWriter) Flush() {
+	if f, ok := h.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	h.cancel()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (h *headWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
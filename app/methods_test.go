@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestMethodSupportOptions verifies OPTIONS lists the methods each route allows
+func TestMethodSupportOptions(t *testing.T) {
+	s := newServer(nil, false)
+	s.corsOrigins = []string{"https://app.example.com"}
+	h := s.handler()
+
+	tests := []struct {
+		path, allow string
+	}{
+		{"/api/products/1", "GET, HEAD, PATCH, OPTIONS"},
+		{"/api/admin/shaping", "GET, HEAD, PUT, DELETE, OPTIONS"},
+		{"/", "GET, HEAD, OPTIONS"},
+		{"/static/app.js", "GET, HEAD, OPTIONS"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, tt.path, nil))
+		if w.Code != http.StatusNoContent || w.Header().Get("Allow") != tt.allow {
+			t.Errorf("OPTIONS %s = %d, Allow %q; want 204, %q", tt.path, w.Code, w.Header().Get("Allow"), tt.allow)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("OPTIONS on an unknown path = %d, want 404", w.Code)
+	}
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/api/products/1", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+		r.Header.Set("Access-Control-Request-Headers", "content-type")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	w = preflight("https://app.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, HEAD, PATCH, OPTIONS" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "content-type" {
+		t.Errorf("allowed preflight headers = %v", w.Header())
+	}
+	if w = preflight("https://evil.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight from a disallowed origin got CORS headers %v", w.Header())
+	}
+}
+
+// TestMethodSupportHeadStream verifies HEAD on a streaming route returns
+// once the headers are sent.
+func TestMethodSupportHeadStream(t *testing.T) {
+	srv := httptest.NewServer(newServer(nil, false).handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, srv.URL+"/api/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("HEAD /api/events: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("HEAD /api/events = %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
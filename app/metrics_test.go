@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestMetricsHandlerPoolStats verifies /metrics exposes the connection pool statistics
+func TestMetricsHandlerPoolStats(t *testing.T) {
+	// sql.Open does not connect, so pool stats are available without a server
+	db, err := sql.Open(store.DriverName, "host=127.0.0.1 port=1 sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+
+	s := &Server{db: db, metrics: newMetricsRegistry(db, nil)}
+
+	w := httptest.NewRecorder()
+	s.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`go_sql_max_open_connections{db_name="demo"} 7`, "go_goroutines"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+
+	if got := poolStats(db); got.MaxOpen != 7 || got.Open != 0 {
+		t.Errorf("poolStats = %+v", got)
+	}
+}
+
+// TestMetricsHandlerUnavailable verifies /metrics answers 503 without a metrics registry
+func TestMetricsHandlerUnavailable(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Server{}).metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("metrics status without registry = %d, want 503", w.Code)
+	}
+}
+
+// TestMetricsHandlerReplicaPool verifies /metrics exposes the replica's
+// pool statistics alongside the primary's
+func TestMetricsHandlerReplicaPool(t *testing.T) {
+	db, err := sql.Open(store.DriverName, "host=127.0.0.1 port=1 sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	replica, err := sql.Open(store.DriverName, "host=127.0.0.1 port=2 sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	replica.SetMaxOpenConns(3)
+
+	s := &Server{db: db, metrics: newMetricsRegistry(db, replica)}
+	w := httptest.NewRecorder()
+	s.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{`go_sql_max_open_connections{db_name="demo"} 0`, `go_sql_max_open_connections{db_name="demo_replica"} 3`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+// TestPoolStatsSaturated verifies a pool is only saturated when every
+// connection is in use and callers wait
+func TestPoolStatsSaturated(t *testing.T) {
+	db, err := sql.Open(store.DriverName, "host=127.0.0.1 port=1 sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if poolStats(db).Saturated {
+		t.Error("an unlimited pool is saturated")
+	}
+	db.SetMaxOpenConns(1)
+	if poolStats(db).Saturated {
+		t.Error("an idle pool is saturated")
+	}
+}
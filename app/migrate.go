@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratepgx "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/*.sql migrations/features/*.sql
+var migrationFS embed.FS
+
+// productMigrationVersion is the product migration the app runs at. Later
+// versions are applied and rolled back by the demo workflows.
+const productMigrationVersion = 1
+
+// MigrateCmd applies the embedded migrations without starting the server,
+// for deployments that migrate as a separate step (AUTO_MIGRATE=false).
+type MigrateCmd struct {
+	DBConfig `embed:""`
+
+	Status bool `help:"Print the migration versions and exit without applying anything"`
+}
+
+func (c *MigrateCmd) Run() error {
+	db, err := openDB(c.DBConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if c.Status {
+		return printMigrationStatus(db)
+	}
+
+	if err := runMigrations(db); err != nil {
+		return err
+	}
+	return runFeatureMigrations(db)
+}
+
+// newMigrator returns a migrate instance for the embedded migrations in dir,
+// versioned in table. The caller must close it. It runs on a pool of its
+// own, as the migrator holds a connection until closed and closing it also
+// closes its pool.
+func newMigrator(db *sql.DB, dir, table string) (*migrate.Migrate, error) {
+	mdb, err := migrationDB(db)
+	if err != nil {
+		return nil, fmt.Errorf("could not open migration connection: %w", err)
+	}
+	driver, err := migratepgx.WithInstance(mdb, &migratepgx.Config{MigrationsTable: table})
+	if err != nil {
+		mdb.Close()
+		return nil, fmt.Errorf("could not create pgx driver: %w", err)
+	}
+
+	// Create source from embedded filesystem
+	d, err := iofs.New(migrationFS, dir)
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("could not create migration source: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", d, "pgx5", driver)
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("could not create migrate instance: %w", err)
+	}
+	return m, nil
+}
+
+// migrationDB opens a pool with the settings of db's connections, which
+// include the current password and the tailnet dialer.
+func migrationDB(db *sql.DB) (*sql.DB, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var cfg *pgx.ConnConfig
+	err = conn.Raw(func(dc any) error {
+		pc, ok := dc.(interface{ Conn() *pgx.Conn })
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", dc)
+		}
+		cfg = pc.Conn().Config()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stdlib.OpenDB(*cfg), nil
+}
+
+func runMigrations(db *sql.DB) error {
+	m, err := newMigrator(db, "migrations", migratepgx.DefaultMigrationsTable)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	// Run initial migrations only (version 1 - base products without CI/CD)
+	log.Println("Running database migrations...")
+	if err := m.Migrate(productMigrationVersion); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return fmt.Errorf("could not get migration version: %w", err)
+	}
+
+	if dirty {
+		log.Printf("⚠️  Warning: Migration is in dirty state at version %d", version)
+	} else if err == migrate.ErrNilVersion {
+		log.Println("No migrations applied yet")
+	} else {
+		log.Printf("✅ Database is at migration version %d", version)
+	}
+
+	return nil
+}
+
+// runFeatureMigrations applies the schema the application's own features
+// depend on (triggers, supporting tables). They are versioned separately, in
+// the feature_migrations table, so the product migrations above can be moved
+// up and down by the demo workflows without touching them.
+func runFeatureMigrations(db *sql.DB) error {
+	m, err := newMigrator(db, "migrations/features", "feature_migrations")
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	log.Println("Running feature migrations...")
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("feature migration failed: %w", err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return fmt.Errorf("could not get feature migration version: %w", err)
+	}
+
+	if dirty {
+		log.Printf("⚠️  Warning: Feature migration is in dirty state at version %d", version)
+	} else if err == nil {
+		log.Printf("✅ Feature schema is at version %d", version)
+	}
+
+	return nil
+}
+
+// latestMigration returns the highest version in an embedded migration dir.
+func latestMigration(dir string) (uint, error) {
+	d, err := iofs.New(migrationFS, dir)
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+
+	v, err := d.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := d.Next(v)
+		if errors.Is(err, fs.ErrNotExist) {
+			return v, nil
+		} else if err != nil {
+			return 0, err
+		}
+		v = next
+	}
+}
+
+// checkMigrations verifies the schema is ready when migrations are not run
+// at startup, so a fresh database fails fast with a clear message instead of
+// on the first query.
+func checkMigrations(db *sql.DB) error {
+	version, dirty, err := migrationVersion(db, "migrations", migratepgx.DefaultMigrationsTable)
+	switch {
+	case err == migrate.ErrNilVersion:
+		return errors.New("no product migrations have been applied")
+	case err != nil:
+		return fmt.Errorf("could not get migration version: %w", err)
+	case dirty:
+		return fmt.Errorf("product migration %d is dirty", version)
+	}
+
+	latest, err := latestMigration("migrations/features")
+	if err != nil {
+		return err
+	}
+	version, dirty, err = migrationVersion(db, "migrations/features", "feature_migrations")
+	switch {
+	case err == migrate.ErrNilVersion:
+		return errors.New("no feature migrations have been applied")
+	case err != nil:
+		return fmt.Errorf("could not get feature migration version: %w", err)
+	case dirty:
+		return fmt.Errorf("feature migration %d is dirty", version)
+	case version < latest:
+		return fmt.Errorf("feature migrations are at version %d, want %d", version, latest)
+	}
+	return nil
+}
+
+// migrationVersion returns the applied version of the migrations in dir,
+// versioned in table, and whether it is dirty.
+func migrationVersion(db *sql.DB, dir, table string) (uint, bool, error) {
+	m, err := newMigrator(db, dir, table)
+	if err != nil {
+		return 0, false, err
+	}
+	defer m.Close()
+	return m.Version()
+}
+
+// schemaCurrent is checkMigrations for readiness probes. It reads the
+// version tables directly rather than open a pool for each migrator.
+func schemaCurrent(ctx context.Context, db *sql.DB) error {
+	latest, err := latestMigration("migrations/features")
+	if err != nil {
+		return err
+	}
+	streams := []struct {
+		name, table string
+		want        uint
+	}{
+		{"product", migratepgx.DefaultMigrationsTable, 1},
+		{"feature", "feature_migrations", latest},
+	}
+
+	for _, st := range streams {
+		var version uint
+		var dirty bool
+		err := db.QueryRowContext(ctx, "SELECT version, dirty FROM "+st.table+" LIMIT 1").Scan(&version, &dirty)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("no %s migrations have been applied", st.name)
+		case err != nil:
+			return fmt.Errorf("could not get %s migration version: %w", st.name, err)
+		case dirty:
+			return fmt.Errorf("%s migration %d is dirty", st.name, version)
+		case version < st.want:
+			return fmt.Errorf("%s migrations are at version %d, want %d", st.name, version, st.want)
+		}
+	}
+	return nil
+}
+
+// printMigrationStatus reports the applied and available version of each
+// migration stream.
+func printMigrationStatus(db *sql.DB) error {
+	streams := []struct {
+		name, dir, table string
+	}{
+		{"products", "migrations", migratepgx.DefaultMigrationsTable},
+		{"features", "migrations/features", "feature_migrations"},
+	}
+
+	for _, st := range streams {
+		latest, err := latestMigration(st.dir)
+		if err != nil {
+			return err
+		}
+
+		version, dirty, err := migrationVersion(db, st.dir, st.table)
+		switch {
+		case err == migrate.ErrNilVersion:
+			fmt.Fprintf(os.Stdout, "%-9s none applied (latest %d)\n", st.name, latest)
+		case err != nil:
+			return fmt.Errorf("could not get %s migration version: %w", st.name, err)
+		case dirty:
+			fmt.Fprintf(os.Stdout, "%-9s version %d DIRTY (latest %d)\n", st.name, version, latest)
+		default:
+			fmt.Fprintf(os.Stdout, "%-9s version %d (latest %d)\n", st.name, version, latest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+// TestLatestMigration verifies both embedded migration streams are readable
+func TestLatestMigration(t *testing.T) {
+	for _, dir := range []string{"migrations", "migrations/features"} {
+		v, err := latestMigration(dir)
+		if err != nil {
+			t.Fatalf("latestMigration(%q) failed: %v", dir, err)
+		}
+		if v < 1 {
+			t.Errorf("latestMigration(%q) = %d, want at least 1", dir, v)
+		}
+	}
+
+	if v, _ := latestMigration("migrations"); v < productMigrationVersion {
+		t.Errorf("Product migrations end at %d, before the pinned version %d", v, productMigrationVersion)
+	}
+}
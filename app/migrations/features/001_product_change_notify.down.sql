@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS notify_products_change ON products;
+DROP FUNCTION IF EXISTS notify_product_change();
@@ -0,0 +1,19 @@
+-- Publish product changes on the product_changes channel for the live feed.
+-- Only the operation and id are sent; listeners load the row themselves so
+-- payloads stay well under the 8000 byte NOTIFY limit.
+CREATE OR REPLACE FUNCTION notify_product_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('product_changes', json_build_object(
+        'op', lower(TG_OP),
+        'id', COALESCE(NEW.id, OLD.id)
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_products_change ON products;
+CREATE TRIGGER notify_products_change
+    AFTER INSERT OR UPDATE OR DELETE ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_product_change();
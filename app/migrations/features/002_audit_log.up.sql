@@ -0,0 +1,16 @@
+-- Audit trail of API calls, attributed to the calling Tailscale identity.
+-- summary holds a short description of the request payload, never the
+-- payload itself.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    login TEXT,
+    node TEXT,
+    method TEXT NOT NULL,
+    route TEXT NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    summary JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_login ON audit_log(login, id DESC);
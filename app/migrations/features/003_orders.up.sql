@@ -0,0 +1,24 @@
+-- Orders placed by Tailscale users. Items copy the product name and price at
+-- the time of ordering, and product_id deliberately has no foreign key: the
+-- demo workflows delete and recreate products, which must not be blocked by
+-- (or erase) order history.
+CREATE TABLE IF NOT EXISTS orders (
+    id BIGSERIAL PRIMARY KEY,
+    login TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'placed',
+    total DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_login ON orders(login, id DESC);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL,
+    product_name VARCHAR(255) NOT NULL,
+    unit_price DECIMAL(10, 2) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
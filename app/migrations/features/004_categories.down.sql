@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS sync_products_category ON products;
+DROP FUNCTION IF EXISTS sync_product_category();
+ALTER TABLE products DROP COLUMN IF EXISTS category_id;
+DROP TABLE IF EXISTS categories;
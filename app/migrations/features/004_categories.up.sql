@@ -0,0 +1,37 @@
+-- Categories as their own table, referenced from products. The product
+-- migrations and seed data still write the category name, so a trigger
+-- creates the category on first use and keeps category_id in step with it.
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO categories (name)
+SELECT DISTINCT category FROM products WHERE category IS NOT NULL
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
+
+UPDATE products p SET category_id = c.id FROM categories c WHERE c.name = p.category;
+
+CREATE INDEX IF NOT EXISTS idx_products_category_id ON products(category_id);
+
+CREATE OR REPLACE FUNCTION sync_product_category()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.category IS NULL THEN
+        NEW.category_id = NULL;
+    ELSE
+        INSERT INTO categories (name) VALUES (NEW.category) ON CONFLICT (name) DO NOTHING;
+        SELECT id INTO NEW.category_id FROM categories WHERE name = NEW.category;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS sync_products_category ON products;
+CREATE TRIGGER sync_products_category
+    BEFORE INSERT OR UPDATE OF category ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION sync_product_category();
@@ -0,0 +1,11 @@
+-- Anomalies the access log analyzer flagged. subject is the login, or the
+-- client address of an unidentified caller.
+CREATE TABLE IF NOT EXISTS alerts (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    kind TEXT NOT NULL,
+    subject TEXT,
+    detail TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_created_at ON alerts(created_at DESC);
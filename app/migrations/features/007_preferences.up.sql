@@ -0,0 +1,6 @@
+-- UI preferences per Tailscale login, as a JSON document the app validates.
+CREATE TABLE IF NOT EXISTS preferences (
+    login TEXT PRIMARY KEY,
+    data JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
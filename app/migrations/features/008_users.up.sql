@@ -0,0 +1,10 @@
+-- Tailscale logins seen by the app, with when and how often.
+CREATE TABLE IF NOT EXISTS users (
+    login TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL DEFAULT '',
+    first_seen TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS users_last_seen_idx ON users (last_seen DESC);
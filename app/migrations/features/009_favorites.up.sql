@@ -0,0 +1,10 @@
+-- Products starred by Tailscale users. Unlike order items, favorites go
+-- with the product: there is nothing to keep once it is deleted.
+CREATE TABLE IF NOT EXISTS favorites (
+    login TEXT NOT NULL,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (login, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_favorites_product ON favorites(product_id);
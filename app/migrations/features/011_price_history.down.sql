@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS record_products_price ON products;
+DROP FUNCTION IF EXISTS record_price_change();
+DROP TABLE IF EXISTS price_history;
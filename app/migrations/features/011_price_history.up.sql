@@ -0,0 +1,39 @@
+-- Product price changes, recorded by a trigger so every writer is covered,
+-- including SQL run outside the app. The app names the caller's Tailscale
+-- login in the transaction's app.changed_by setting; other writers leave
+-- changed_by empty.
+CREATE TABLE IF NOT EXISTS price_history (
+    id BIGSERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    old_price DECIMAL(10, 2),
+    new_price DECIMAL(10, 2) NOT NULL,
+    changed_by TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_history_product ON price_history(product_id, changed_at DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION record_price_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO price_history (product_id, new_price, changed_by)
+        VALUES (NEW.id, NEW.price, coalesce(current_setting('app.changed_by', true), ''));
+    ELSIF NEW.price IS DISTINCT FROM OLD.price THEN
+        INSERT INTO price_history (product_id, old_price, new_price, changed_by)
+        VALUES (NEW.id, OLD.price, NEW.price, coalesce(current_setting('app.changed_by', true), ''));
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS record_products_price ON products;
+CREATE TRIGGER record_products_price
+    AFTER INSERT OR UPDATE OF price ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION record_price_change();
+
+-- Existing products start their history at their current price
+INSERT INTO price_history (product_id, new_price, changed_at)
+SELECT p.id, p.price, p.created_at FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM price_history h WHERE h.product_id = p.id);
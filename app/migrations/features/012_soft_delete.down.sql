@@ -0,0 +1,17 @@
+CREATE OR REPLACE FUNCTION notify_product_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('product_changes', json_build_object(
+        'op', lower(TG_OP),
+        'id', COALESCE(NEW.id, OLD.id)
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- Without deleted_at, soft-deleted products would come back; delete them
+-- for good first, with their favorites, reviews and price history
+DELETE FROM products WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_products_live_created_at;
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,23 @@
+-- Soft delete: deleting a product sets deleted_at, and the app leaves such
+-- products out unless an admin asks for them, so they can be restored.
+-- Deleted products keep their name, so a new product cannot take it.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_products_live_created_at ON products(created_at DESC, id DESC) WHERE deleted_at IS NULL;
+
+-- The live feed reports soft deletes as deletes and restores as inserts
+CREATE OR REPLACE FUNCTION notify_product_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    op TEXT := lower(TG_OP);
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.deleted_at IS DISTINCT FROM OLD.deleted_at THEN
+        op := CASE WHEN NEW.deleted_at IS NULL THEN 'insert' ELSE 'delete' END;
+    END IF;
+    PERFORM pg_notify('product_changes', json_build_object(
+        'op', op,
+        'id', COALESCE(NEW.id, OLD.id)
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
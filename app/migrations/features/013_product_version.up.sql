@@ -0,0 +1,18 @@
+-- Row versions for optimistic concurrency. Every update bumps version, so
+-- a product's ETag changes with each write, even one that puts back
+-- earlier values within the same second of updated_at.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_product_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS bump_products_version ON products;
+CREATE TRIGGER bump_products_version
+    BEFORE UPDATE ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_product_version();
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// productEncoder writes a product listing in one format.
+type productEncoder struct {
+	// mediaTypes are matched against Accept; the first is sent
+	mediaTypes  []string
+	contentType string
+	encode      func(w io.Writer, products []map[string]interface{}) error
+}
+
+// productEncoders are the formats /api/products can be served in, most
+// preferred first: JSON is the default when Accept allows several. Add a
+// format by appending an encoder.
+var productEncoders = []productEncoder{
+	{
+		mediaTypes:  []string{"application/json"},
+		contentType: "application/json",
+		encode: func(w io.Writer, products []map[string]interface{}) error {
+			return json.NewEncoder(w).Encode(products)
+		},
+	},
+	{
+		mediaTypes:  []string{"text/csv"},
+		contentType: "text/csv; charset=utf-8",
+		encode:      encodeProductsCSV,
+	},
+	{
+		mediaTypes:  []string{"application/xml", "text/xml"},
+		contentType: "application/xml; charset=utf-8",
+		encode:      encodeProductsXML,
+	},
+}
+
+// isJSON reports whether e is the default JSON encoder.
+func (e *productEncoder) isJSON() bool {
+	return e == &productEncoders[0]
+}
+
+// negotiateProductEncoder picks the encoder the Accept header rates
+// highest, or nil if it accepts none of them. A missing header accepts
+// anything.
+func negotiateProductEncoder(accept string) *productEncoder {
+	if strings.TrimSpace(accept) == "" {
+		return &productEncoders[0]
+	}
+	ranges := parseAccept(accept)
+
+	// Browsers opening the API list application/xml, but below text/html:
+	// they get the default, as before content negotiation
+	if html := acceptQuality(ranges, "text/html"); html > 0 && !outranked(ranges, html, "text/html") {
+		if acceptQuality(ranges, productEncoders[0].mediaTypes[0]) > 0 {
+			return &productEncoders[0]
+		}
+	}
+
+	var best *productEncoder
+	bestQ := 0.0
+	for i := range productEncoders {
+		enc := &productEncoders[i]
+		for _, mt := range enc.mediaTypes {
+			if q := acceptQuality(ranges, mt); q > bestQ {
+				best, bestQ = enc, q
+			}
+		}
+	}
+	return best
+}
+
+// acceptRange is one media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mt, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality the most specific matching range gives
+// mediaType, per RFC 9110 section 12.5.1, or 0 if none matches.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mediaType == mediaType:
+			s = 2
+		case r.mediaType == typ+"/*":
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// outranked reports whether a range other than mediaType has a higher quality
+// than q.
+func outranked(ranges []acceptRange, q float64, mediaType string) bool {
+	for _, r := range ranges {
+		if r.mediaType != mediaType && r.q > q {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedProductTypes lists the media types for a 406 response.
+func supportedProductTypes() string {
+	var types []string
+	for _, enc := range productEncoders {
+		types = append(types, enc.mediaTypes...)
+	}
+	return strings.Join(types, ", ")
+}
+
+// productEncoderFor negotiates the response format, writing a 406 if
+// there is none the client accepts.
+func productEncoderFor(w http.ResponseWriter, r *http.Request) (*productEncoder, bool) {
+	w.Header().Add("Vary", "Accept")
+	enc := negotiateProductEncoder(r.Header.Get("Accept"))
+	if enc == nil {
+		writeJSONError(w, http.StatusNotAcceptable, "Accept must allow one of "+supportedProductTypes())
+		return nil, false
+	}
+	return enc, true
+}
+
+// writeProducts encodes products with enc, with an ETag like the JSON
+// responses.
+func writeProducts(w http.ResponseWriter, r *http.Request, enc *productEncoder, products []map[string]interface{}) {
+	var buf bytes.Buffer
+	if err := enc.encode(&buf, products); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to encode products: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", enc.contentType)
+	writeETagged(w, r, buf.Bytes())
+}
+
+// productColumns returns every column in products, id and name first and
+// the rest sorted, since listings are column maps.
+func productColumns(products []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var rest []string
+	for _, p := range products {
+		for col := range p {
+			if !seen[col] {
+				seen[col] = true
+				if col != "id" && col != "name" {
+					rest = append(rest, col)
+				}
+			}
+		}
+	}
+	sort.Strings(rest)
+
+	var columns []string
+	for _, col := range []string{"id", "name"} {
+		if seen[col] {
+			columns = append(columns, col)
+		}
+	}
+	return append(columns, rest...)
+}
+
+// encodeProductsCSV writes a header row of the columns, then a row per
+// product, formatted like the CSV export.
+func encodeProductsCSV(w io.Writer, products []map[string]interface{}) error {
+	columns := productColumns(products)
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	record := make([]string, len(columns))
+	for _, p := range products {
+		for i, col := range columns {
+			record[i] = csvValue(p[col])
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// xmlName matches column names that are usable as XML element names.
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// encodeProductsXML writes <products> with a <product> per product and an
+// element per non-null column. Columns whose names are not XML names are
+// written as <field name="...">.
+func encodeProductsXML(w io.Writer, products []map[string]interface{}) error {
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	root := xml.StartElement{Name: xml.Name{Local: "products"}}
+	enc.EncodeToken(root)
+	columns := productColumns(products)
+	for _, p := range products {
+		product := xml.StartElement{Name: xml.Name{Local: "product"}}
+		enc.EncodeToken(product)
+		for _, col := range columns {
+			v, ok := p[col]
+			if !ok || v == nil {
+				continue
+			}
+			field := xml.StartElement{Name: xml.Name{Local: col}}
+			if !xmlName.MatchString(col) {
+				field = xml.StartElement{Name: xml.Name{Local: "field"}, Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: col}}}
+			}
+			if err := enc.EncodeElement(fmt.Sprint(v), field); err != nil {
+				return err
+			}
+		}
+		enc.EncodeToken(product.End())
+	}
+	enc.EncodeToken(root.End())
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestNegotiateProductEncoder verifies the format is picked by Accept
+// quality, JSON first among equals
+func TestNegotiateProductEncoder(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                "application/json",
+		"*/*":                             "application/json",
+		"application/json":                "application/json",
+		"text/csv":                        "text/csv; charset=utf-8",
+		"text/csv;q=0.5, application/xml": "application/xml; charset=utf-8",
+		"text/xml":                        "application/xml; charset=utf-8",
+		"text/*":                          "text/csv; charset=utf-8",
+		"text/html, */*;q=0.1":            "application/json",
+		"*/*, application/json;q=0":       "text/csv; charset=utf-8",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": "application/json",
+		"text/html;q=0.1, text/csv":                                       "text/csv; charset=utf-8",
+	} {
+		enc := negotiateProductEncoder(accept)
+		if enc == nil || enc.contentType != want {
+			t.Errorf("Accept %q: got %v, want %s", accept, enc, want)
+		}
+	}
+
+	for _, accept := range []string{"text/html", "application/json;q=0", "image/*"} {
+		if enc := negotiateProductEncoder(accept); enc != nil {
+			t.Errorf("Accept %q: got %s, want none", accept, enc.contentType)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	if _, ok := productEncoderFor(w, r); ok || w.Code != http.StatusNotAcceptable || w.Header().Get("Vary") != "Accept" {
+		t.Errorf("status %d, Vary %q", w.Code, w.Header().Get("Vary"))
+	}
+}
+
+// TestEncodeProducts verifies products are written as CSV with formula escaping and as XML
+func TestEncodeProducts(t *testing.T) {
+	products := []map[string]interface{}{
+		{"id": 1, "name": "Homelab", "price": "0.00", "category": nil, "sku code": "H-1"},
+		{"id": 2, "name": "=cmd()", "price": "99.00", "category": "Networking"},
+	}
+
+	var buf bytes.Buffer
+	if err := encodeProductsCSV(&buf, products); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "id,name,category,price,sku code\n1,Homelab,,0.00,H-1\n2,'=cmd(),Networking,99.00,\n"
+	if buf.String() != wantCSV {
+		t.Errorf("CSV:\n%s\nwant:\n%s", buf.String(), wantCSV)
+	}
+
+	buf.Reset()
+	if err := encodeProductsXML(&buf, products); err != nil {
+		t.Fatal(err)
+	}
+	wantXML := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<products><product><id>1</id><name>Homelab</name><price>0.00</price><field name="sku code">H-1</field></product>` +
+		`<product><id>2</id><name>=cmd()</name><category>Networking</category><price>99.00</price></product></products>` + "\n"
+	if buf.String() != wantXML {
+		t.Errorf("XML:\n%s\nwant:\n%s", buf.String(), wantXML)
+	}
+
+	// Other formats get ETags too
+	r := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	w := httptest.NewRecorder()
+	writeProducts(w, r, negotiateProductEncoder("text/csv"), products)
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" || w.Header().Get("ETag") == "" || w.Body.String() != wantCSV {
+		t.Errorf("headers %v, body %q", w.Header(), w.Body)
+	}
+}
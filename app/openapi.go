@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buildOpenAPISpec generates an OpenAPI 3 document from the route table.
+// Schemas are derived from the Go types encoded by each handler.
+func buildOpenAPISpec(routes []apiRoute) map[string]interface{} {
+	g := &schemaGenerator{components: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+
+	for _, rt := range routes {
+		item, ok := paths[rt.Path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[rt.Path] = item
+		}
+
+		op := map[string]interface{}{
+			"summary":     rt.Summary,
+			"operationId": operationID(rt),
+		}
+
+		if len(rt.Params) > 0 {
+			var params []interface{}
+			for _, p := range rt.Params {
+				params = append(params, map[string]interface{}{
+					"name":        p.Name,
+					"in":          p.In,
+					"required":    p.In == "path",
+					"description": p.Description,
+					"schema":      map[string]interface{}{"type": p.Type},
+				})
+			}
+			op["parameters"] = params
+		}
+
+		if len(rt.Request) > 0 {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  g.content(rt.Request),
+			}
+		}
+
+		responses := map[string]interface{}{}
+		for _, resp := range rt.Responses {
+			r := map[string]interface{}{"description": resp.Description}
+			if len(resp.Bodies) > 0 {
+				r["content"] = g.content(resp.Bodies)
+			}
+			responses[strconv.Itoa(resp.Status)] = r
+		}
+		op["responses"] = responses
+
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Tailscale Demo API",
+			"description": "Tailscale demo application with PostgreSQL integration",
+			"version":     "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+		},
+	}
+}
+
+// operationID derives a stable operation ID such as "patchApiProductsId".
+func operationID(rt apiRoute) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.Method))
+	for _, part := range strings.FieldsFunc(rt.Path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '.' || r == '_' || r == '-'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+// content renders a media type map, combining bodies that share a content type with oneOf.
+func (g *schemaGenerator) content(bodies []apiBody) map[string]interface{} {
+	byType := map[string][]interface{}{}
+	var order []string
+	for _, b := range bodies {
+		if _, ok := byType[b.ContentType]; !ok {
+			order = append(order, b.ContentType)
+		}
+		byType[b.ContentType] = append(byType[b.ContentType], g.schema(reflect.TypeOf(b.Body)))
+	}
+
+	content := map[string]interface{}{}
+	for _, ct := range order {
+		schemas := byType[ct]
+		if len(schemas) == 1 {
+			content[ct] = map[string]interface{}{"schema": schemas[0]}
+		} else {
+			content[ct] = map[string]interface{}{"schema": map[string]interface{}{"oneOf": schemas}}
+		}
+	}
+	return content
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// schema returns the JSON schema for t, registering named structs as components.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			g.components[name] = map[string]interface{}{}
+			g.components[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag, tagged := f.Tag.Lookup("json")
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			// encoding/json promotes the fields of embedded structs
+			embedded := g.structSchema(f.Type)
+			for name, prop := range embedded["properties"].(map[string]interface{}) {
+				properties[name] = prop
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+
+		name := f.Name
+		omitempty := false
+		if tagged {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					omitempty = true
+				}
+			}
+		}
+
+		properties[name] = g.schema(f.Type)
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// componentName maps Go type names to schema names, dropping the "Schema"
+// suffix used by documentation-only types.
+func componentName(t reflect.Type) string {
+	name := strings.TrimSuffix(t.Name(), "Schema")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// OpenAPICmd writes the OpenAPI spec without starting a server, for
+// generating API clients.
+type OpenAPICmd struct {
+	Output string `short:"o" type:"path" help:"Write the spec to this file instead of stdout"`
+}
+
+func (c *OpenAPICmd) Run() error {
+	spec, err := json.MarshalIndent(buildOpenAPISpec((&Server{}).routes()), "", "  ")
+	if err != nil {
+		return err
+	}
+	spec = append(spec, '\n')
+	if c.Output == "" {
+		_, err = os.Stdout.Write(spec)
+		return err
+	}
+	return os.WriteFile(c.Output, spec, 0o644)
+}
+
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	s.openAPIOnce.Do(func() {
+		s.openAPISpec, _ = json.MarshalIndent(buildOpenAPISpec(s.routes()), "", "  ")
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.openAPISpec)
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>Tailscale Demo API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+    <script>
+        window.ui = SwaggerUIBundle({ url: '/openapi.json', dom_id: '#swagger-ui' });
+    </script>
+</body>
+</html>
+`
+
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
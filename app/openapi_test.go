@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPISpecCoversRoutes verifies every route in the table is documented
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	s := &Server{}
+	routes := s.routes()
+	spec := buildOpenAPISpec(routes)
+
+	if _, err := json.Marshal(spec); err != nil {
+		t.Fatalf("Spec is not serializable: %v", err)
+	}
+
+	paths := spec["paths"].(map[string]interface{})
+	for _, rt := range routes {
+		item, ok := paths[rt.Path].(map[string]interface{})
+		if !ok {
+			t.Errorf("Path %s missing from spec", rt.Path)
+			continue
+		}
+		if _, ok := item[strings.ToLower(rt.Method)]; !ok {
+			t.Errorf("Operation %s %s missing from spec", rt.Method, rt.Path)
+		}
+	}
+}
+
+// TestOpenAPISchemasFromTypes verifies schemas follow the Go struct definitions
+func TestOpenAPISchemasFromTypes(t *testing.T) {
+	spec := buildOpenAPISpec((&Server{}).routes())
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	health, ok := schemas["HealthResponse"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("HealthResponse schema missing, have %v", schemas)
+	}
+	props := health["properties"].(map[string]interface{})
+	for _, field := range []string{"status", "database", "tailscale"} {
+		if _, ok := props[field]; !ok {
+			t.Errorf("HealthResponse schema missing property %s", field)
+		}
+	}
+
+	user := schemas["UserInfo"].(map[string]interface{})
+	if required := user["required"].([]string); len(required) != 1 || required[0] != "connected" {
+		t.Errorf("Expected only 'connected' to be required on UserInfo, got %v", required)
+	}
+
+	if _, ok := schemas["Product"]; !ok {
+		t.Errorf("Product schema missing")
+	}
+
+	// Embedded fields are promoted and times are date-time strings
+	stats := schemas["ProductStatsResponse"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := stats["count"]; !ok {
+		t.Errorf("ProductStatsResponse schema missing promoted property count, have %v", stats)
+	}
+	if computed := stats["computed_at"].(map[string]interface{}); computed["format"] != "date-time" {
+		t.Errorf("computed_at schema = %v, want a date-time string", computed)
+	}
+}
+
+// TestOpenAPICmd verifies the openapi command writes a spec listing the routes
+func TestOpenAPICmd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	if err := (&OpenAPICmd{Output: path}).Run(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatalf("written spec is not JSON: %v", err)
+	}
+	if spec.OpenAPI == "" || spec.Paths["/api/products"] == nil {
+		t.Errorf("written spec is missing /api/products: %.200s", b)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const (
+	maxOrderBodyBytes = 64 << 10
+	maxOrderLines     = 100
+	maxOrderQuantity  = 1000
+	ordersPageDefault = 50
+	ordersPageMax     = 500
+)
+
+// OrderRequest is the POST /api/orders body.
+type OrderRequest struct {
+	Items []store.OrderLine `json:"items"`
+}
+
+// validate checks the order has between 1 and maxOrderLines lines, each for
+// a valid product and a sensible quantity.
+func (o OrderRequest) validate() error {
+	if len(o.Items) == 0 {
+		return errors.New("an order needs at least one item")
+	}
+	if len(o.Items) > maxOrderLines {
+		return fmt.Errorf("an order may have at most %d items", maxOrderLines)
+	}
+	for i, item := range o.Items {
+		if item.ProductID < 1 {
+			return fmt.Errorf("item %d: product_id must be a positive integer", i)
+		}
+		if item.Quantity < 1 || item.Quantity > maxOrderQuantity {
+			return fmt.Errorf("item %d: quantity must be between 1 and %d", i, maxOrderQuantity)
+		}
+	}
+	return nil
+}
+
+// createOrderHandler places an order for the caller at current prices.
+func (s *Server) createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	login, ok := s.callerLogin(w, r, "Orders")
+	if !ok {
+		return
+	}
+
+	var req OrderRequest
+	if !s.readJSONBody(w, r, maxOrderBodyBytes, &req, "order") {
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+
+	order, err := s.store.CreateOrder(ctx, login, req.Items)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "One or more products do not exist"}`, http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create order: %v", err))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/orders/%d", order.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// ordersHandler lists the caller's orders, newest first.
+func (s *Server) ordersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	login, ok := s.callerLogin(w, r, "Orders")
+	if !ok {
+		return
+	}
+
+	limit := ordersPageDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > ordersPageMax {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", ordersPageMax))
+			return
+		}
+		limit = n
+	}
+
+	ctx := r.Context()
+
+	orders, err := s.store.Orders(ctx, login, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query orders: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(orders)
+}
+
+// orderHandler returns one of the caller's orders. Other users' orders are
+// reported as not found.
+func (s *Server) orderHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	login, ok := s.callerLogin(w, r, "Orders")
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, `{"error": "Order id must be a positive integer"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	order, err := s.store.Order(ctx, login, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Order not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query orders: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(order)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestOrderRequestValidate verifies orders need between one and
+// maxOrderLines lines of valid products
+func TestOrderRequestValidate(t *testing.T) {
+	many := make([]store.OrderLine, maxOrderLines+1)
+	for i := range many {
+		many[i] = store.OrderLine{ProductID: 1, Quantity: 1}
+	}
+
+	tests := []struct {
+		name  string
+		items []store.OrderLine
+		ok    bool
+	}{
+		{"one item", []store.OrderLine{{ProductID: 1, Quantity: 2}}, true},
+		{"repeated product", []store.OrderLine{{ProductID: 1, Quantity: 1}, {ProductID: 1, Quantity: 3}}, true},
+		{"empty", nil, false},
+		{"too many items", many, false},
+		{"bad product", []store.OrderLine{{ProductID: 0, Quantity: 1}}, false},
+		{"zero quantity", []store.OrderLine{{ProductID: 1}}, false},
+		{"huge quantity", []store.OrderLine{{ProductID: 1, Quantity: maxOrderQuantity + 1}}, false},
+	}
+	for _, tt := range tests {
+		if err := (OrderRequest{Items: tt.items}).validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: validate() = %v", tt.name, err)
+		}
+	}
+}
+
+// TestOrdersRequireIdentity verifies orders are refused to callers without
+// a Tailscale identity, including ones claiming another user's login
+func TestOrdersRequireIdentity(t *testing.T) {
+	s := &Server{}
+	for _, spoof := range []string{"", "alice@example.com"} {
+		for _, tc := range []struct {
+			h http.HandlerFunc
+			r *http.Request
+		}{
+			{s.createOrderHandler, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(`{"items":[{"product_id":1,"quantity":1}]}`))},
+			{s.ordersHandler, httptest.NewRequest(http.MethodGet, "/api/orders", nil)},
+			{s.orderHandler, httptest.NewRequest(http.MethodGet, "/api/orders/1", nil)},
+		} {
+			if spoof != "" {
+				asSpoofedUser(tc.r, spoof)
+			}
+			w := httptest.NewRecorder()
+			tc.h(w, tc.r)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s %s without identity (header %q) = %d, want 403", tc.r.Method, tc.r.URL.Path, spoof, w.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+// ProductPage is the response envelope returned when pagination is requested.
+type ProductPage struct {
+	Products   []map[string]interface{} `json:"products"`
+	Limit      int                      `json:"limit"`
+	Offset     *int                     `json:"offset,omitempty"`
+	NextOffset *int                     `json:"next_offset,omitempty"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// productCursor identifies a position in the (created_at DESC, id DESC)
+// ordering used for keyset pagination.
+type productCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// encodeCursor returns an opaque, URL-safe token for the cursor.
+func encodeCursor(c productCursor) string {
+	token := fmt.Sprintf("%s,%d", c.CreatedAt.UTC().Format(time.RFC3339Nano), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+// decodeCursor parses a token produced by encodeCursor.
+func decodeCursor(token string) (productCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return productCursor{}, errors.New("cursor is not valid base64")
+	}
+
+	createdAt, id, ok := strings.Cut(string(b), ",")
+	if !ok {
+		return productCursor{}, errors.New("cursor is malformed")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return productCursor{}, errors.New("cursor has an invalid timestamp")
+	}
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return productCursor{}, errors.New("cursor has an invalid id")
+	}
+
+	return productCursor{CreatedAt: t, ID: n}, nil
+}
+
+// cursorFromRow builds the cursor pointing at a scanned product row.
+func cursorFromRow(raw map[string]interface{}) (productCursor, bool) {
+	t, ok := raw["created_at"].(time.Time)
+	if !ok {
+		return productCursor{}, false
+	}
+	id, ok := raw["id"].(int64)
+	if !ok {
+		return productCursor{}, false
+	}
+	return productCursor{CreatedAt: t, ID: id}, true
+}
+
+// isPaginatedRequest reports whether the client asked for a paginated envelope.
+func isPaginatedRequest(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("cursor") || q.Has("offset") || q.Has("limit")
+}
+
+// parseLimit reads the limit query parameter, clamped to maxPageSize.
+func parseLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultPageSize, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, nil
+}
+
+// paginatedProductsHandler serves offset (?offset=) or keyset (?cursor=)
+// pagination. An empty cursor starts keyset iteration from the newest product.
+// JSON responses are a page envelope; in other formats the page's products
+// are listed and the Link header is the only way to the next page. Only
+// fields are returned of each product, if set, and deleted products are
+// only listed withDeleted.
+func (s *Server) paginatedProductsHandler(w http.ResponseWriter, r *http.Request, enc *productEncoder, fields []string, withDeleted bool) {
+	q := r.URL.Query()
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	page := ProductPage{Limit: limit}
+	category := q.Get("category")
+
+	if q.Has("cursor") {
+		var after *productCursor
+		if token := q.Get("cursor"); token != "" {
+			cursor, err := decodeCursor(token)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"error": "Invalid cursor: %s"}`, err.Error()), http.StatusBadRequest)
+				return
+			}
+			after = &cursor
+		}
+
+		err = s.store.Read(ctx, func(q store.Queryer) (err error) {
+			page.Products, page.NextCursor, err = listProductsAfter(ctx, q, limit, after, category, withDeleted)
+			return err
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "Failed to query database: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		offset := 0
+		if v := q.Get("offset"); v != "" {
+			offset, err = strconv.Atoi(v)
+			if err != nil || offset < 0 {
+				http.Error(w, `{"error": "offset must be a non-negative integer"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		page.Offset = &offset
+
+		var where []string
+		args := []interface{}{limit + 1, offset}
+		if category != "" {
+			args = append(args, category)
+			where = append(where, store.CategoryFilter(len(args)))
+		}
+		if !withDeleted {
+			where = append(where, store.NotDeleted)
+		}
+		query := `SELECT * FROM products`
+		if len(where) > 0 {
+			query += ` WHERE ` + strings.Join(where, " AND ")
+		}
+		query += ` ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2`
+
+		var hasMore bool
+		err = s.store.Read(ctx, func(q store.Queryer) (err error) {
+			page.Products, _, hasMore, err = queryProductPage(ctx, q, limit, query, args...)
+			return err
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "Failed to query database: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if hasMore {
+			next := offset + limit
+			page.NextOffset = &next
+		}
+	}
+
+	page.Products = selectFields(page.Products, fields)
+	setLinkHeader(w, productPageLinks(r.URL, page))
+	if !enc.isJSON() {
+		writeProducts(w, r, enc, page.Products)
+		return
+	}
+	writeJSONETag(w, r, page)
+}
+
+// pageLink is one entry of a Link header.
+type pageLink struct {
+	Rel string
+	URL string
+}
+
+// productPageLinks returns the next, prev and first links for page, which
+// was served for the request URL u. Keyset pagination only moves forward, so
+// it has no prev link.
+func productPageLinks(u *url.URL, page ProductPage) []pageLink {
+	with := func(key, value string) string {
+		q := u.Query()
+		q.Set(key, value)
+		return (&url.URL{Path: u.Path, RawQuery: q.Encode()}).String()
+	}
+
+	var links []pageLink
+	if page.Offset == nil {
+		if page.NextCursor != "" {
+			links = append(links, pageLink{"next", with("cursor", page.NextCursor)})
+		}
+		if u.Query().Get("cursor") != "" {
+			links = append(links, pageLink{"first", with("cursor", "")})
+		}
+		return links
+	}
+
+	if page.NextOffset != nil {
+		links = append(links, pageLink{"next", with("offset", strconv.Itoa(*page.NextOffset))})
+	}
+	if *page.Offset > 0 {
+		prev := max(*page.Offset-page.Limit, 0)
+		links = append(links,
+			pageLink{"prev", with("offset", strconv.Itoa(prev))},
+			pageLink{"first", with("offset", "0")},
+		)
+	}
+	return links
+}
+
+// setLinkHeader writes links as an RFC 8288 Link header, with URLs relative
+// to the request.
+func setLinkHeader(w http.ResponseWriter, links []pageLink) {
+	if len(links) == 0 {
+		return
+	}
+	parts := make([]string, len(links))
+	for i, l := range links {
+		parts[i] = fmt.Sprintf(`<%s>; rel="%s"`, l.URL, l.Rel)
+	}
+	w.Header().Set("Link", strings.Join(parts, ", "))
+}
+
+// listProductsAfter returns up to limit products, newest first, starting
+// after the given cursor (nil for the first page), plus the cursor for the
+// following page or "" when there is none. If category is set, only
+// products in that category are listed. Deleted products are left out
+// unless withDeleted is set.
+func listProductsAfter(ctx context.Context, q store.Queryer, limit int, after *productCursor, category string, withDeleted bool) ([]map[string]interface{}, string, error) {
+	var where []string
+	args := []interface{}{limit + 1}
+	if category != "" {
+		args = append(args, category)
+		where = append(where, store.CategoryFilter(len(args)))
+	}
+	if !withDeleted {
+		where = append(where, store.NotDeleted)
+	}
+	if after != nil {
+		args = append(args, after.CreatedAt, after.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d::timestamp, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `SELECT * FROM products`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT $1`
+
+	products, last, hasMore, err := queryProductPage(ctx, q, limit, query, args...)
+	if err != nil || !hasMore {
+		return products, "", err
+	}
+
+	cursor, ok := cursorFromRow(last)
+	if !ok {
+		return products, "", nil
+	}
+	return products, encodeCursor(cursor), nil
+}
+
+// queryProductPage runs a query that fetches one row more than limit, to
+// learn whether another page exists without a separate COUNT. It returns the
+// normalized products and the raw last row on the page.
+func queryProductPage(ctx context.Context, q store.Queryer, limit int, query string, args ...interface{}) ([]map[string]interface{}, map[string]interface{}, bool, error) {
+	rows, err := store.QueryAll(ctx, q, query, args...)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	products := make([]map[string]interface{}, len(rows))
+	for i, raw := range rows {
+		products[i] = normalizeProduct(raw)
+	}
+
+	var last map[string]interface{}
+	if len(rows) > 0 {
+		last = rows[len(rows)-1]
+	}
+	return products, last, hasMore, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCursorRoundTrip verifies cursors survive encoding with full precision
+func TestCursorRoundTrip(t *testing.T) {
+	want := productCursor{
+		CreatedAt: time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC),
+		ID:        42,
+	}
+
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("Expected cursor %+v, got %+v", want, got)
+	}
+}
+
+// TestDecodeCursorRejectsGarbage verifies malformed cursors are rejected
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, token := range []string{"!!!", "bm9jb21tYQ", "Zm9vLDE", "MjAyNC0wMS0wMVQwMDowMDowMFosYWJj"} {
+		if _, err := decodeCursor(token); err == nil {
+			t.Errorf("Expected error decoding cursor %q", token)
+		}
+	}
+}
+
+// TestProductPageLinks verifies the Link header relations for both
+// pagination styles
+func TestProductPageLinks(t *testing.T) {
+	intp := func(n int) *int { return &n }
+
+	tests := []struct {
+		name   string
+		target string
+		page   ProductPage
+		want   string
+	}{
+		{
+			name:   "first offset page",
+			target: "/api/products?limit=10",
+			page:   ProductPage{Limit: 10, Offset: intp(0), NextOffset: intp(10)},
+			want:   `</api/products?limit=10&offset=10>; rel="next"`,
+		},
+		{
+			name:   "middle offset page",
+			target: "/api/products?limit=10&offset=5",
+			page:   ProductPage{Limit: 10, Offset: intp(5), NextOffset: intp(15)},
+			want: `</api/products?limit=10&offset=15>; rel="next", ` +
+				`</api/products?limit=10&offset=0>; rel="prev", ` +
+				`</api/products?limit=10&offset=0>; rel="first"`,
+		},
+		{
+			name:   "last offset page",
+			target: "/api/products?limit=10&offset=20",
+			page:   ProductPage{Limit: 10, Offset: intp(20)},
+			want: `</api/products?limit=10&offset=10>; rel="prev", ` +
+				`</api/products?limit=10&offset=0>; rel="first"`,
+		},
+		{
+			name:   "first cursor page",
+			target: "/api/products?cursor=",
+			page:   ProductPage{Limit: 100, NextCursor: "abc"},
+			want:   `</api/products?cursor=abc>; rel="next"`,
+		},
+		{
+			name:   "later cursor page",
+			target: "/api/products?cursor=abc&limit=2",
+			page:   ProductPage{Limit: 2, NextCursor: "def"},
+			want: `</api/products?cursor=def&limit=2>; rel="next", ` +
+				`</api/products?cursor=&limit=2>; rel="first"`,
+		},
+		{
+			name:   "only page",
+			target: "/api/products?cursor=",
+			page:   ProductPage{Limit: 100},
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			setLinkHeader(w, productPageLinks(httptest.NewRequest("GET", tt.target, nil).URL, tt.page))
+			if got := w.Header().Get("Link"); got != tt.want {
+				t.Errorf("Link = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonPatchContentType  = "application/json-patch+json"
+	mergePatchContentType = "application/merge-patch+json"
+)
+
+// patchOperation is a single RFC 6902 operation.
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from,omitempty"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// errPatchTestFailed is returned when a "test" operation does not match.
+var errPatchTestFailed = errors.New("test operation failed")
+
+// applyJSONPatch applies RFC 6902 operations to doc. Operations are applied
+// to a copy so a failing operation leaves doc untouched.
+func applyJSONPatch(doc interface{}, ops []patchOperation) (interface{}, error) {
+	result, err := deepCopyJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d (%s) is missing value", i, op.Op)
+			}
+			var value interface{}
+			if err := json.Unmarshal(*op.Value, &value); err != nil {
+				return nil, fmt.Errorf("operation %d has an invalid value: %w", i, err)
+			}
+
+			switch op.Op {
+			case "add":
+				result, err = pointerAdd(result, op.Path, value)
+			case "replace":
+				result, err = pointerReplace(result, op.Path, value)
+			case "test":
+				var current interface{}
+				current, err = pointerGet(result, op.Path)
+				if err == nil && !reflect.DeepEqual(current, value) {
+					return nil, fmt.Errorf("operation %d: %w at %s", i, errPatchTestFailed, op.Path)
+				}
+			}
+		case "remove":
+			result, _, err = pointerRemove(result, op.Path)
+		case "move":
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("operation %d cannot move %s into itself", i, op.From)
+			}
+			var value interface{}
+			result, value, err = pointerRemove(result, op.From)
+			if err == nil {
+				result, err = pointerAdd(result, op.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			value, err = pointerGet(result, op.From)
+			if err == nil {
+				value, err = deepCopyJSON(value)
+			}
+			if err == nil {
+				result, err = pointerAdd(result, op.Path, value)
+			}
+		default:
+			return nil, fmt.Errorf("operation %d has unsupported op %q", i, op.Op)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return result, nil
+}
+
+// applyMergePatch applies an RFC 7396 merge patch to target.
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	result := make(map[string]interface{}, len(targetObj))
+	for k, v := range targetObj {
+		result[k] = v
+	}
+
+	for k, v := range patchObj {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = applyMergePatch(result[k], v)
+		}
+	}
+
+	return result
+}
+
+func deepCopyJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if idx > max {
+		return 0, fmt.Errorf("array index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+func pointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	current := doc
+	for _, t := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			current = v
+		case []interface{}:
+			idx, err := arrayIndex(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+	}
+	return current, nil
+}
+
+// pointerUpdate walks to the parent of pointer and lets fn mutate the last
+// segment, rebuilding any arrays along the way.
+func pointerUpdate(doc interface{}, pointer string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return fn(nil, "")
+	}
+
+	var walk func(node interface{}, tokens []string) (interface{}, error)
+	walk = func(node interface{}, tokens []string) (interface{}, error) {
+		if len(tokens) == 1 {
+			return fn(node, tokens[0])
+		}
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[tokens[0]]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			updated, err := walk(child, tokens[1:])
+			if err != nil {
+				return nil, err
+			}
+			n[tokens[0]] = updated
+			return n, nil
+		case []interface{}:
+			idx, err := arrayIndex(tokens[0], len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			updated, err := walk(n[idx], tokens[1:])
+			if err != nil {
+				return nil, err
+			}
+			n[idx] = updated
+			return n, nil
+		default:
+			return nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+	}
+
+	return walk(doc, tokens)
+}
+
+func pointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	return pointerUpdate(doc, pointer, func(parent interface{}, key string) (interface{}, error) {
+		switch p := parent.(type) {
+		case nil:
+			return value, nil
+		case map[string]interface{}:
+			p[key] = value
+			return p, nil
+		case []interface{}:
+			idx, err := arrayIndex(key, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[idx+1:], p[idx:])
+			p[idx] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("cannot add to non-container at %s", pointer)
+		}
+	})
+}
+
+func pointerReplace(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	if _, err := pointerGet(doc, pointer); err != nil {
+		return nil, err
+	}
+	return pointerUpdate(doc, pointer, func(parent interface{}, key string) (interface{}, error) {
+		switch p := parent.(type) {
+		case nil:
+			return value, nil
+		case map[string]interface{}:
+			p[key] = value
+			return p, nil
+		case []interface{}:
+			idx, err := arrayIndex(key, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			p[idx] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("cannot replace non-container at %s", pointer)
+		}
+	})
+}
+
+func pointerRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	removed, err := pointerGet(doc, pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := pointerUpdate(doc, pointer, func(parent interface{}, key string) (interface{}, error) {
+		switch p := parent.(type) {
+		case nil:
+			return nil, errors.New("cannot remove the whole document")
+		case map[string]interface{}:
+			delete(p, key)
+			return p, nil
+		case []interface{}:
+			idx, err := arrayIndex(key, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(p[:idx], p[idx+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove from non-container at %s", pointer)
+		}
+	})
+	return result, removed, err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mustJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("Invalid test JSON %q: %v", s, err)
+	}
+	return v
+}
+
+// TestApplyJSONPatch covers the RFC 6902 operations on product-shaped documents
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace", `{"name":"a","price":"1.00"}`, `[{"op":"replace","path":"/price","value":2}]`, `{"name":"a","price":2}`},
+		{"add member", `{"name":"a"}`, `[{"op":"add","path":"/category","value":"IoT"}]`, `{"name":"a","category":"IoT"}`},
+		{"remove", `{"name":"a","category":"IoT"}`, `[{"op":"remove","path":"/category"}]`, `{"name":"a"}`},
+		{"move", `{"a":1}`, `[{"op":"move","from":"/a","path":"/b"}]`, `{"b":1}`},
+		{"copy", `{"a":[1]}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":[1],"b":[1]}`},
+		{"array insert", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"array append", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`},
+		{"escaped pointer", `{"a/b":1,"c~d":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/c~0d","value":3}]`, `{"c~d":3}`},
+		{"test then replace", `{"name":"a"}`, `[{"op":"test","path":"/name","value":"a"},{"op":"replace","path":"/name","value":"b"}]`, `{"name":"b"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []patchOperation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatalf("Invalid patch: %v", err)
+			}
+
+			got, err := applyJSONPatch(mustJSON(t, tt.doc), ops)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if want := mustJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+// TestApplyJSONPatchIsAtomic verifies a failing operation leaves the document untouched
+func TestApplyJSONPatchIsAtomic(t *testing.T) {
+	doc := mustJSON(t, `{"name":"a"}`)
+	var ops []patchOperation
+	json.Unmarshal([]byte(`[{"op":"replace","path":"/name","value":"b"},{"op":"test","path":"/name","value":"a"}]`), &ops)
+
+	if _, err := applyJSONPatch(doc, ops); !errors.Is(err, errPatchTestFailed) {
+		t.Fatalf("Expected test failure, got %v", err)
+	}
+	if want := mustJSON(t, `{"name":"a"}`); !reflect.DeepEqual(doc, want) {
+		t.Errorf("Document was modified: %v", doc)
+	}
+
+	json.Unmarshal([]byte(`[{"op":"remove","path":"/missing"}]`), &ops)
+	if _, err := applyJSONPatch(doc, ops); err == nil {
+		t.Errorf("Expected error removing a missing path")
+	}
+}
+
+// TestApplyMergePatch covers RFC 7396 semantics including null removal
+func TestApplyMergePatch(t *testing.T) {
+	got := applyMergePatch(
+		mustJSON(t, `{"name":"a","category":"IoT","meta":{"x":1,"y":2}}`),
+		mustJSON(t, `{"category":null,"price":3,"meta":{"y":null,"z":3}}`),
+	)
+	want := mustJSON(t, `{"name":"a","price":3,"meta":{"x":1,"z":3}}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// TestProductChanges verifies patched documents are validated against writable columns
+func TestProductChanges(t *testing.T) {
+	original := mustJSON(t, `{"id":1,"name":"a","price":"1.00","stock_quantity":5,"category":"IoT"}`).(map[string]interface{})
+
+	changes, err := productChanges(original, mustJSON(t, `{"id":1,"name":"a","price":"2.5","stock_quantity":5}`).(map[string]interface{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]interface{}{"price": "2.50", "category": nil}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expected changes %v, got %v", want, changes)
+	}
+
+	for _, patched := range []string{
+		`{"id":2,"name":"a","price":"1.00","stock_quantity":5,"category":"IoT"}`,
+		`{"id":1,"name":"","price":"1.00","stock_quantity":5,"category":"IoT"}`,
+		`{"id":1,"name":"a","price":-1,"stock_quantity":5,"category":"IoT"}`,
+		`{"id":1,"name":"a","price":"1.00","stock_quantity":1.5,"category":"IoT"}`,
+		`{"id":1,"name":"a","price":"1.00","stock_quantity":5,"category":"IoT","color":"red"}`,
+	} {
+		if _, err := productChanges(original, mustJSON(t, patched).(map[string]interface{})); err == nil {
+			t.Errorf("Expected validation error for %s", patched)
+		}
+	}
+}
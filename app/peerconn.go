@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// errNoConnIdentity is returned for connections that were not accepted by
+// an identifying listener.
+var errNoConnIdentity = errors.New("connection has no tailnet identity")
+
+// whoisFunc resolves the tailnet identity of a remote address.
+type whoisFunc func(ctx context.Context, remoteAddr string) (*WhoIsData, error)
+
+// peerConn is a connection whose peer identity is resolved once, the first
+// time it is asked for, so protocols other than HTTP can be identity-aware
+// without a WhoIs per request.
+type peerConn struct {
+	net.Conn
+	identity func() (*WhoIsData, error)
+}
+
+// identifyingListener resolves each accepted connection's peer via WhoIs.
+type identifyingListener struct {
+	net.Listener
+	name  string
+	whois whoisFunc
+}
+
+// identifyListener wraps ln so every accepted connection is a *peerConn.
+// name labels the connection log lines.
+func identifyListener(name string, ln net.Listener, whois whoisFunc) net.Listener {
+	return &identifyingListener{Listener: ln, name: name, whois: whois}
+}
+
+// Accept returns the next connection without waiting for its WhoIs. The
+// lookup is left to whoever first asks for the identity, on that
+// connection's goroutine, so a slow one does not hold up the connections
+// behind it.
+func (l *identifyingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	identity := sync.OnceValues(func() (*WhoIsData, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		whois, err := l.whois(ctx, c.RemoteAddr().String())
+		if err == nil {
+			log.Printf("%s connection from %s (%s)", l.name, whois.LoginName, c.RemoteAddr())
+		} else {
+			log.Printf("%s connection from unidentified peer %s: %v", l.name, c.RemoteAddr(), err)
+		}
+		return whois, err
+	})
+	return &peerConn{Conn: c, identity: identity}, nil
+}
+
+// connIdentity returns the identity of c's peer if an identifying listener
+// accepted it, looking through TLS.
+func connIdentity(c net.Conn) (*WhoIsData, error) {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	pc, ok := c.(*peerConn)
+	if !ok {
+		return nil, errNoConnIdentity
+	}
+	return pc.identity()
+}
+
+// tailnetCredentials are gRPC transport credentials that add the connection
+// identity from identifyListener to the peer's AuthInfo. Encryption is left
+// to the wrapped credentials (insecure on the tailnet, where WireGuard
+// already encrypts).
+type tailnetCredentials struct {
+	credentials.TransportCredentials
+}
+
+// tailnetAuthInfo is the gRPC AuthInfo for connections accepted with
+// tailnetCredentials.
+type tailnetAuthInfo struct {
+	credentials.CommonAuthInfo
+	Identity    *WhoIsData
+	IdentityErr error
+}
+
+func (tailnetAuthInfo) AuthType() string { return "tailnet" }
+
+func (c tailnetCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auth := tailnetAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}
+	if ci, ok := info.(interface {
+		GetCommonAuthInfo() credentials.CommonAuthInfo
+	}); ok {
+		auth.CommonAuthInfo = ci.GetCommonAuthInfo()
+	}
+	auth.Identity, auth.IdentityErr = connIdentity(rawConn)
+	return conn, auth, nil
+}
+
+func (c tailnetCredentials) Clone() credentials.TransportCredentials {
+	return tailnetCredentials{c.TransportCredentials.Clone()}
+}
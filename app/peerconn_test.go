@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// TestIdentifyListener verifies connections are identified once, on first use rather than in Accept
+func TestIdentifyListener(t *testing.T) {
+	ln := bufconn.Listen(1 << 10)
+	defer ln.Close()
+
+	calls := 0
+	il := identifyListener("test", ln, func(ctx context.Context, addr string) (*WhoIsData, error) {
+		calls++
+		return &WhoIsData{LoginName: "alice@example.com"}, nil
+	})
+
+	go func() {
+		c, err := ln.Dial()
+		if err == nil {
+			defer c.Close()
+		}
+	}()
+
+	c, err := il.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if calls != 0 {
+		t.Errorf("Accept called whois %d times, want it left to connIdentity", calls)
+	}
+
+	for range 2 {
+		whois, err := connIdentity(c)
+		if err != nil || whois.LoginName != "alice@example.com" {
+			t.Errorf("connIdentity = %+v, %v", whois, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("whois called %d times, want 1", calls)
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	if _, err := connIdentity(c1); !errors.Is(err, errNoConnIdentity) {
+		t.Errorf("connIdentity of plain conn error = %v, want errNoConnIdentity", err)
+	}
+}
+
+// dialIdentifiedGRPC serves gRPC behind an identifying listener using whois.
+func dialIdentifiedGRPC(t *testing.T, whois whoisFunc) *grpc.ClientConn {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	gs := (&Server{}).newGRPCServer()
+	go gs.Serve(identifyListener("gRPC", ln, whois))
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestGRPCConnectionIdentity verifies the identity resolved at accept time
+// reaches service methods
+func TestGRPCConnectionIdentity(t *testing.T) {
+	conn := dialIdentifiedGRPC(t, func(ctx context.Context, addr string) (*WhoIsData, error) {
+		return &WhoIsData{LoginName: "alice@example.com", DisplayName: "Alice"}, nil
+	})
+
+	var out structpb.Struct
+	if err := conn.Invoke(context.Background(), "/"+identityServiceName+"/WhoAmI", &emptypb.Empty{}, &out); err != nil {
+		t.Fatalf("WhoAmI failed: %v", err)
+	}
+	if got := out.GetFields()["login_name"].GetStringValue(); got != "alice@example.com" {
+		t.Errorf("Expected login_name alice@example.com, got %q", got)
+	}
+}
+
+// TestGRPCConnectionIdentityFailure verifies a failed accept-time lookup
+// leaves the caller unidentified
+func TestGRPCConnectionIdentityFailure(t *testing.T) {
+	conn := dialIdentifiedGRPC(t, func(ctx context.Context, addr string) (*WhoIsData, error) {
+		return nil, errors.New("tagged nodes do not have a user identity")
+	})
+
+	var out structpb.Struct
+	err := conn.Invoke(context.Background(), "/"+identityServiceName+"/WhoAmI", &emptypb.Empty{}, &out)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected Unauthenticated, got %v", err)
+	}
+}
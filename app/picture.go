@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// pictureTTL is how long a fetched profile picture is served from
+	// memory, and pictureFailureTTL how long a failed fetch is remembered.
+	pictureTTL        = time.Hour
+	pictureFailureTTL = 5 * time.Minute
+
+	maxPictureBytes   = 1 << 20
+	maxPictureEntries = 256
+)
+
+// picture is a cached profile picture; data is nil if fetching it failed.
+type picture struct {
+	data        []byte
+	contentType string
+	expires     time.Time
+}
+
+// pictureCache fetches profile pictures from the identity provider and
+// keeps them in memory, so browsers never load them from a third party.
+type pictureCache struct {
+	clock  Clock
+	client *http.Client
+
+	mu      sync.Mutex
+	entries map[string]picture
+}
+
+func newPictureCache(clock Clock) *pictureCache {
+	return &pictureCache{
+		clock: clock,
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			// A redirect could lead the fetch anywhere the node can reach
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return errPictureRedirect
+			},
+		},
+		entries: map[string]picture{},
+	}
+}
+
+// errPictureRedirect refuses to follow a profile picture URL's redirects.
+var errPictureRedirect = errors.New("profile picture redirects are not followed")
+
+// get returns the picture at picURL, or nil if it cannot be fetched.
+func (c *pictureCache) get(ctx context.Context, picURL string) *picture {
+	now := c.clock.Now()
+	c.mu.Lock()
+	p, ok := c.entries[picURL]
+	c.mu.Unlock()
+	if ok && now.Before(p.expires) {
+		if p.data == nil {
+			return nil
+		}
+		return &p
+	}
+
+	p = picture{expires: now.Add(pictureFailureTTL)}
+	if data, contentType, err := c.fetch(ctx, picURL); err == nil {
+		p = picture{data: data, contentType: contentType, expires: now.Add(pictureTTL)}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxPictureEntries {
+		c.evict(now)
+	}
+	c.entries[picURL] = p
+	if p.data == nil {
+		return nil
+	}
+	return &p
+}
+
+// evict drops expired entries, or the one expiring soonest if none have.
+// c.mu must be held.
+func (c *pictureCache) evict(now time.Time) {
+	var oldest string
+	for u, p := range c.entries {
+		if !now.Before(p.expires) {
+			delete(c.entries, u)
+		} else if oldest == "" || p.expires.Before(c.entries[oldest].expires) {
+			oldest = u
+		}
+	}
+	if len(c.entries) >= maxPictureEntries {
+		delete(c.entries, oldest)
+	}
+}
+
+// fetch downloads an image over HTTPS, refusing anything else.
+func (c *pictureCache) fetch(ctx context.Context, picURL string) ([]byte, string, error) {
+	u, err := url.Parse(picURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, "", fmt.Errorf("profile picture URL %q is not https", picURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("profile picture returned %s", resp.Status)
+	}
+
+	// SVG can carry script, and is served from the app's origin
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") || mediaType == "image/svg+xml" {
+		return nil, "", fmt.Errorf("profile picture has content type %q", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPictureBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxPictureBytes {
+		return nil, "", fmt.Errorf("profile picture is over %d bytes", maxPictureBytes)
+	}
+	return data, mediaType, nil
+}
+
+// identicon draws a symmetric 5x5 pattern in a color derived from seed, for
+// users without a profile picture.
+func identicon(seed string) []byte {
+	sum := sha256.Sum256([]byte(seed))
+	hue := int(sum[0]) * 360 / 256
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 5 5" shape-rendering="crispEdges">`)
+	fmt.Fprintf(&b, `<rect width="5" height="5" fill="hsl(%d,40%%,92%%)"/>`, hue)
+	for row := 0; row < 5; row++ {
+		for col := 0; col < 3; col++ {
+			if sum[1+row*3+col]&1 == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="1" height="1" fill="hsl(%d,55%%,50%%)"/>`, col, row, hue)
+			if col < 2 {
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="1" height="1" fill="hsl(%d,55%%,50%%)"/>`, 4-col, row, hue)
+			}
+		}
+	}
+	b.WriteString(`</svg>`)
+	return []byte(b.String())
+}
+
+// userPictureHandler serves the caller's profile picture through the
+// cache, or an identicon if they have none or it cannot be fetched.
+func (s *Server) userPictureHandler(w http.ResponseWriter, r *http.Request) {
+	who, err := s.tailscaleWhois(r.Context(), r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "Profile pictures require a Tailscale identity: "+err.Error())
+		return
+	}
+
+	h := w.Header()
+	h.Set("Cache-Control", "private, max-age=3600")
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	// Only the URL WhoIs reports is fetched, as the fetch is made from
+	// inside the node's network; in regular mode who came from headers,
+	// which are as good as whatever proxy set them
+	if s.tsnetMode && who.ProfilePicURL != "" && s.pictures != nil {
+		if p := s.pictures.get(r.Context(), who.ProfilePicURL); p != nil {
+			h.Set("Content-Type", p.contentType)
+			w.Write(p.data)
+			return
+		}
+	}
+	h.Set("Content-Type", "image/svg+xml")
+	w.Write(identicon(who.LoginName))
+}
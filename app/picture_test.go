@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPictureCache verifies pictures are fetched once, only as images and
+// without following redirects
+func TestPictureCache(t *testing.T) {
+	fetches := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		switch r.URL.Path {
+		case "/alice.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		case "/redirect.png":
+			http.Redirect(w, r, "/alice.png", http.StatusFound)
+		case "/evil.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte("<svg onload=alert(1)>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	c := newPictureCache(clock)
+	checkRedirect := c.client.CheckRedirect
+	c.client = srv.Client()
+	c.client.CheckRedirect = checkRedirect
+	ctx := context.Background()
+
+	p := c.get(ctx, srv.URL+"/alice.png")
+	if p == nil || string(p.data) != "png" || p.contentType != "image/png" {
+		t.Fatalf("get = %+v, want the png", p)
+	}
+	c.get(ctx, srv.URL+"/alice.png")
+	if fetches != 1 {
+		t.Errorf("cached picture fetched %d times, want 1", fetches)
+	}
+	clock.Advance(pictureTTL)
+	c.get(ctx, srv.URL+"/alice.png")
+	if fetches != 2 {
+		t.Errorf("expired picture not refetched: %d fetches", fetches)
+	}
+
+	for _, u := range []string{srv.URL + "/missing.png", srv.URL + "/redirect.png", srv.URL + "/evil.svg", "http://example.com/a.png", "file:///etc/passwd"} {
+		if p := c.get(ctx, u); p != nil {
+			t.Errorf("get(%q) = %+v, want nil", u, p)
+		}
+	}
+	before := fetches
+	c.get(ctx, srv.URL+"/missing.png")
+	if fetches != before {
+		t.Error("failed fetch was retried before pictureFailureTTL")
+	}
+}
+
+// TestIdenticon verifies identicons are plain SVGs, the same for a login
+// and different between logins
+func TestIdenticon(t *testing.T) {
+	a, b := identicon("alice@example.com"), identicon("bob@example.com")
+	if !bytes.Equal(a, identicon("alice@example.com")) {
+		t.Error("identicon is not deterministic")
+	}
+	if bytes.Equal(a, b) {
+		t.Error("different logins have the same identicon")
+	}
+	if !strings.HasPrefix(string(a), "<svg") || strings.Contains(string(a), "script") {
+		t.Errorf("identicon is not a plain SVG: %s", a)
+	}
+}
+
+// TestUserPictureHandlerFallsBack verifies callers without a fetchable picture get an identicon
+func TestUserPictureHandlerFallsBack(t *testing.T) {
+	s := &Server{pictures: newPictureCache(newFakeClock(time.Now()))}
+
+	w := httptest.NewRecorder()
+	s.userPictureHandler(w, httptest.NewRequest(http.MethodGet, "/api/user/picture", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("no identity: status %d, want 403", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/picture", nil)
+	asServeUser(r, "alice@example.com")
+	r.Header.Set("Tailscale-User-Profile-Pic", "http://insecure.example.com/a.png")
+	w = httptest.NewRecorder()
+	s.userPictureHandler(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("unfetchable picture: %d %s, want an identicon", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// Picture URLs from Serve headers are never fetched, however plausible
+	fetched := false
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+	}))
+	defer srv.Close()
+	s.pictures.client = srv.Client()
+	r.Header.Set("Tailscale-User-Profile-Pic", srv.URL+"/a.png")
+	w = httptest.NewRecorder()
+	s.userPictureHandler(w, r)
+	if fetched || w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("header picture: fetched %v, %s, want an identicon", fetched, w.Header().Get("Content-Type"))
+	}
+}
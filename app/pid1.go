@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// When the app is PID 1, as in a container started without an init, the
+// kernel drops signals PID 1 has no handler for and orphaned processes are
+// reparented to it. The serve path already handles SIGINT and SIGTERM;
+// reapChildren takes on init's other duty so orphans do not pile up as
+// zombies.
+
+// ownChildren are the PIDs of the children the app started with runChild
+// and waits on itself, which the reaper leaves alone. mu is held from
+// starting such a child until it is recorded, so the reaper cannot take it.
+var ownChildren = struct {
+	mu   sync.Mutex
+	pids map[int]bool
+}{pids: map[int]bool{}}
+
+// runChild runs cmd like cmd.Run, keeping reapChildren from reaping it
+// before cmd.Wait does.
+func runChild(cmd *exec.Cmd) error {
+	ownChildren.mu.Lock()
+	if err := cmd.Start(); err != nil {
+		ownChildren.mu.Unlock()
+		return err
+	}
+	pid := cmd.Process.Pid
+	ownChildren.pids[pid] = true
+	ownChildren.mu.Unlock()
+
+	err := cmd.Wait()
+
+	ownChildren.mu.Lock()
+	delete(ownChildren.pids, pid)
+	ownChildren.mu.Unlock()
+	return err
+}
+
+// reapChildren reaps exited children whenever SIGCHLD arrives if the app is
+// PID 1, except those started with runChild.
+func reapChildren() {
+	if os.Getpid() != 1 {
+		return
+	}
+	log.Printf("Running as PID 1; reaping orphaned child processes")
+
+	sigchld := make(chan os.Signal, 1)
+	signal.Notify(sigchld, syscall.SIGCHLD)
+	go func() {
+		for range sigchld {
+			reapZombies()
+		}
+	}()
+}
+
+// reapZombies reaps the exited children of the process that are not its
+// own. They are found in /proc, as Wait4(-1) could take an own child from
+// its cmd.Wait.
+func reapZombies() {
+	ownChildren.mu.Lock()
+	defer ownChildren.mu.Unlock()
+
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range stats {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			// The process has gone since the glob
+			continue
+		}
+		pid, state, ppid, ok := parseProcStat(b)
+		if !ok || state != 'Z' || ppid != os.Getpid() || ownChildren.pids[pid] {
+			continue
+		}
+		var status syscall.WaitStatus
+		syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+	}
+}
+
+// parseProcStat returns the PID, state and parent PID in the contents of a
+// /proc/<pid>/stat file. The command name in parentheses may itself contain
+// spaces and parentheses, so the fields after it are found from the last
+// closing parenthesis.
+func parseProcStat(b []byte) (pid int, state byte, ppid int, ok bool) {
+	open, end := bytes.IndexByte(b, '('), bytes.LastIndexByte(b, ')')
+	if open < 0 || end < open {
+		return 0, 0, 0, false
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(b[:open])))
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	fields := bytes.Fields(b[end+1:])
+	if len(fields) < 2 || len(fields[0]) != 1 {
+		return 0, 0, 0, false
+	}
+	ppid, err = strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return pid, fields[0][0], ppid, true
+}
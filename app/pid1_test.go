@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestParseProcStat verifies the state and parent PID are read after the
+// command name, whatever it contains
+func TestParseProcStat(t *testing.T) {
+	for _, tt := range []struct {
+		stat  string
+		pid   int
+		state byte
+		ppid  int
+		ok    bool
+	}{
+		{"42 (sleep) S 1 42 42 0 -1", 42, 'S', 1, true},
+		{"7 (a) b (c)) Z 1 7 7 0 -1", 7, 'Z', 1, true},
+		{"7 (sleep", 0, 0, 0, false},
+		{"x (sleep) S 1", 0, 0, 0, false},
+		{"7 (sleep) S", 0, 0, 0, false},
+	} {
+		pid, state, ppid, ok := parseProcStat([]byte(tt.stat))
+		if pid != tt.pid || state != tt.state || ppid != tt.ppid || ok != tt.ok {
+			t.Errorf("parseProcStat(%q) = %d, %q, %d, %v", tt.stat, pid, state, ppid, ok)
+		}
+	}
+}
+
+// TestReapZombies verifies exited children are reaped unless runChild is
+// waiting on them
+func TestReapZombies(t *testing.T) {
+	path, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("no true command")
+	}
+	p, err := os.StartProcess(path, []string{"true"}, &os.ProcAttr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for it to exit without reaping it
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		b, err := os.ReadFile("/proc/" + strconv.Itoa(p.Pid) + "/stat")
+		if err != nil {
+			t.Skip("no /proc")
+		}
+		if _, state, _, _ := parseProcStat(b); state == 'Z' {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("child did not exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ownChildren.mu.Lock()
+	ownChildren.pids[p.Pid] = true
+	ownChildren.mu.Unlock()
+	reapZombies()
+	if _, err := os.Stat("/proc/" + strconv.Itoa(p.Pid)); err != nil {
+		t.Errorf("own child was reaped")
+	}
+
+	ownChildren.mu.Lock()
+	delete(ownChildren.pids, p.Pid)
+	ownChildren.mu.Unlock()
+	reapZombies()
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(p.Pid, &status, syscall.WNOHANG, nil); !errors.Is(err, syscall.ECHILD) {
+		t.Errorf("Wait4 after reapZombies = %v, want ECHILD", err)
+	}
+}
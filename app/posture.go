@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+)
+
+// postureRule is one POSTURE_RULES entry, such as version>=1.56 or
+// os=linux,macos, checked against the caller's node.
+type postureRule struct {
+	attr  string // "os", "version" or "key_expiry"
+	op    string
+	value string
+
+	list   []string      // os values
+	expiry time.Duration // key_expiry duration
+}
+
+// postureOps are the comparisons, longest first so ">=" is not read as ">".
+var postureOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// parsePostureRules parses rules, which are ATTR OP VALUE:
+//
+//	os=linux,macos      the node's OS is one of these (os!= for none of them)
+//	version>=1.56       the Tailscale client version compares so
+//	key_expiry>=72h     the node key is valid for at least this long
+func parsePostureRules(rules []string) ([]postureRule, error) {
+	var parsed []postureRule
+	for _, s := range rules {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var rule postureRule
+		for _, op := range postureOps {
+			if i := strings.Index(s, op); i > 0 {
+				rule = postureRule{attr: strings.ToLower(strings.TrimSpace(s[:i])), op: op, value: strings.TrimSpace(s[i+len(op):])}
+				break
+			}
+		}
+		if rule.op == "" || rule.value == "" {
+			return nil, fmt.Errorf("POSTURE_RULES %q: want ATTR OP VALUE, such as version>=1.56", s)
+		}
+
+		switch rule.attr {
+		case "os":
+			if rule.op != "=" && rule.op != "!=" {
+				return nil, fmt.Errorf("POSTURE_RULES %q: os takes = or !=", s)
+			}
+			for _, v := range strings.Split(rule.value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					rule.list = append(rule.list, v)
+				}
+			}
+		case "version":
+			if _, ok := parseClientVersion(rule.value); !ok {
+				return nil, fmt.Errorf("POSTURE_RULES %q: %q is not a version such as 1.56.1", s, rule.value)
+			}
+		case "key_expiry":
+			if rule.op != ">=" && rule.op != ">" {
+				return nil, fmt.Errorf("POSTURE_RULES %q: key_expiry takes >= or >", s)
+			}
+			d, err := time.ParseDuration(rule.value)
+			if err != nil {
+				return nil, fmt.Errorf("POSTURE_RULES %q: %w", s, err)
+			}
+			rule.expiry = d
+		default:
+			return nil, fmt.Errorf("POSTURE_RULES %q: unknown attribute %q; use os, version or key_expiry", s, rule.attr)
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// parseClientVersion parses a Tailscale version such as
+// 1.56.1-t5e5f3926c-g1b8f563ba into its numeric parts.
+func parseClientVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v, _, _ = strings.Cut(v, "-")
+	fields := strings.Split(v, ".")
+	if len(fields) > 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// check returns why the node in whois fails the rule, or "" if it passes.
+func (rule postureRule) check(whois *apitype.WhoIsResponse, now time.Time) string {
+	node := whois.Node
+	switch rule.attr {
+	case "os":
+		nodeOS := node.Hostinfo.OS()
+		in := false
+		for _, v := range rule.list {
+			in = in || strings.EqualFold(v, nodeOS)
+		}
+		if in != (rule.op == "=") {
+			if nodeOS == "" {
+				nodeOS = "unknown"
+			}
+			if rule.op == "=" {
+				return fmt.Sprintf("OS %s is not one of %s", nodeOS, strings.Join(rule.list, ", "))
+			}
+			return fmt.Sprintf("OS %s is not allowed", nodeOS)
+		}
+
+	case "version":
+		raw := node.Hostinfo.IPNVersion()
+		have, ok := parseClientVersion(raw)
+		if !ok {
+			return fmt.Sprintf("Tailscale client version %q is unknown, but must be %s %s", raw, rule.op, rule.value)
+		}
+		want, _ := parseClientVersion(rule.value)
+		c := compareVersions(have, want)
+		var pass bool
+		switch rule.op {
+		case ">=":
+			pass = c >= 0
+		case "<=":
+			pass = c <= 0
+		case ">":
+			pass = c > 0
+		case "<":
+			pass = c < 0
+		case "=":
+			pass = c == 0
+		case "!=":
+			pass = c != 0
+		}
+		if !pass {
+			short, _, _ := strings.Cut(raw, "-")
+			return fmt.Sprintf("Tailscale client version %s must be %s %s", short, rule.op, rule.value)
+		}
+
+	case "key_expiry":
+		if node.KeyExpiry.IsZero() {
+			// Key expiry is disabled for the node
+			return ""
+		}
+		left := node.KeyExpiry.Sub(now)
+		if left <= 0 {
+			return "the node key has expired"
+		}
+		if left < rule.expiry || (rule.op == ">" && left == rule.expiry) {
+			return fmt.Sprintf("the node key expires in %s, sooner than %s; re-authenticate the device", left.Round(time.Minute), rule.value)
+		}
+	}
+	return ""
+}
+
+// postureViolations returns why the node in whois fails rules.
+func postureViolations(rules []postureRule, whois *apitype.WhoIsResponse, now time.Time) []string {
+	var violations []string
+	for _, rule := range rules {
+		if v := rule.check(whois, now); v != "" {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// checkPosture turns away tailnet callers whose device fails the
+// POSTURE_RULES, checked against the node WhoIs reports. Funnel visitors
+// have no node, so are left to guestMode; nor do callers on the local
+// listeners, which are on the same host. The health endpoints stay open to
+// probes.
+func (s *Server) checkPosture(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules := s.live().posture
+		if len(rules) == 0 || s.client == nil || isGuestRequest(r) || isLocalRequest(r) || isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := s.tsAuth.err(); err != nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "Cannot check device posture: "+err.Error())
+			return
+		}
+		whois, err := s.lookupWhoIs(r.Context(), r.RemoteAddr)
+		if err != nil {
+			writeJSONError(w, http.StatusForbidden, "Cannot check device posture: failed to identify node via tsnet: "+err.Error())
+			return
+		}
+		if violations := postureViolations(rules, whois, s.clock.Now()); len(violations) > 0 {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("Device %s does not meet the posture policy: %s", whois.Node.ComputedName, strings.Join(violations, "; ")))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isHealthPath reports whether path is a health or readiness probe.
+func isHealthPath(path string) bool {
+	return path == "/health" || path == "/livez" || path == "/readyz"
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func postureNode(os, version string, keyExpiry time.Time) *apitype.WhoIsResponse {
+	return &apitype.WhoIsResponse{
+		Node: &tailcfg.Node{
+			ComputedName: "laptop",
+			KeyExpiry:    keyExpiry,
+			Hostinfo:     (&tailcfg.Hostinfo{OS: os, IPNVersion: version}).View(),
+		},
+		UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+	}
+}
+
+// TestParsePostureRules verifies posture rules are parsed and malformed ones are rejected
+func TestParsePostureRules(t *testing.T) {
+	rules, err := parsePostureRules([]string{" version >= 1.56 ", "os=linux, macOS", "key_expiry>72h", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 || rules[0].attr != "version" || rules[0].op != ">=" || rules[1].list[1] != "macOS" || rules[2].expiry != 72*time.Hour {
+		t.Errorf("parsed %+v", rules)
+	}
+
+	for rule, want := range map[string]string{
+		"version":          "want ATTR OP VALUE",
+		"version>=":        "want ATTR OP VALUE",
+		"version>=1.x":     `"1.x" is not a version`,
+		"os>=linux":        "os takes = or !=",
+		"key_expiry<=1h":   "key_expiry takes >= or >",
+		"key_expiry>=soon": `invalid duration "soon"`,
+		"hostname=laptop":  `unknown attribute "hostname"`,
+	} {
+		if _, err := parsePostureRules([]string{rule}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", rule, err, want)
+		}
+	}
+}
+
+// TestPostureRulesFlag verifies POSTURE_RULES and --posture-rules split on
+// semicolons, so an os rule's list of systems stays one rule
+func TestPostureRulesFlag(t *testing.T) {
+	parse := func(args ...string) []string {
+		t.Helper()
+		var cli CLI
+		parser, err := kong.New(&cli, kong.Name("tailscale-demo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parser.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return cli.Serve.PostureRules
+	}
+
+	want := []string{"os=linux,macos", "version>=1.56"}
+	if got := parse("serve", "--posture-rules", "os=linux,macos;version>=1.56"); !slices.Equal(got, want) {
+		t.Errorf("--posture-rules = %q, want %q", got, want)
+	}
+	t.Setenv("POSTURE_RULES", "os=linux,macos;version>=1.56")
+	got := parse("serve")
+	if !slices.Equal(got, want) {
+		t.Errorf("POSTURE_RULES = %q, want %q", got, want)
+	}
+	if _, err := parsePostureRules(got); err != nil {
+		t.Errorf("parsing %q: %v", got, err)
+	}
+}
+
+// TestPostureViolations verifies each rule a node fails is reported
+func TestPostureViolations(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rules, err := parsePostureRules([]string{"version>=1.56", "os=linux,macOS", "key_expiry>=72h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		whois *apitype.WhoIsResponse
+		want  []string
+	}{
+		{"compliant", postureNode("macOS", "1.56.1-t5e5f3926c-g1b8f563ba", now.Add(30*24*time.Hour)), nil},
+		{"key expiry disabled", postureNode("linux", "1.60.0", time.Time{}), nil},
+		{"old client", postureNode("linux", "1.50.1-tabc", now.Add(30*24*time.Hour)), []string{"Tailscale client version 1.50.1 must be >= 1.56"}},
+		{"unknown version", postureNode("linux", "", time.Time{}), []string{`Tailscale client version "" is unknown, but must be >= 1.56`}},
+		{"everything", postureNode("windows", "1.48.0", now.Add(2*time.Hour)), []string{
+			"Tailscale client version 1.48.0 must be >= 1.56",
+			"OS windows is not one of linux, macOS",
+			"the node key expires in 2h0m0s, sooner than 72h; re-authenticate the device",
+		}},
+		{"expired", postureNode("linux", "1.56.0", now.Add(-time.Minute)), []string{"the node key has expired"}},
+	} {
+		got := postureViolations(rules, tc.whois, now)
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s: violations %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	deny, _ := parsePostureRules([]string{"os!=windows,android"})
+	if got := postureViolations(deny, postureNode("Windows", "1.56.0", time.Time{}), now); len(got) != 1 || got[0] != "OS Windows is not allowed" {
+		t.Errorf("os!=: %q", got)
+	}
+}
+
+// TestCheckPosture verifies requests from nodes failing POSTURE_RULES are refused
+func TestCheckPosture(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rules, _ := parsePostureRules([]string{"version>=1.56"})
+	s := &Server{client: &tailscale.LocalClient{}, clock: clock, identities: newIdentityCache(clock, nil)}
+	s.setLive(&liveConfig{posture: rules})
+	s.identities.put(netip.MustParseAddr("100.64.0.1"), postureNode("linux", "1.58.2", time.Time{}))
+	s.identities.put(netip.MustParseAddr("100.64.0.2"), postureNode("linux", "1.44.0", time.Time{}))
+
+	h := s.checkPosture(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	for _, tc := range []struct {
+		remote, path string
+		want         int
+		body         string
+	}{
+		{"100.64.0.1:1234", "/api/products", http.StatusTeapot, ""},
+		{"100.64.0.2:1234", "/api/products", http.StatusForbidden, "Device laptop does not meet the posture policy: Tailscale client version 1.44.0 must be"},
+		{"100.64.0.2:1234", "/health", http.StatusTeapot, ""},
+		{"local", "/api/products", http.StatusTeapot, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		r.RemoteAddr = tc.remote
+		if tc.remote == "local" {
+			// The local listeners are on the host, where WhoIs knows no one
+			r.RemoteAddr = "127.0.0.1:1234"
+			r = r.WithContext(context.WithValue(r.Context(), localConnKey{}, true))
+		}
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want || !strings.Contains(w.Body.String(), tc.body) {
+			t.Errorf("%s %s: status %d %s, want %d", tc.remote, tc.path, w.Code, w.Body, tc.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const maxPreferencesBodyBytes = 16 << 10
+
+var (
+	themes        = []string{"system", "light", "dark"}
+	favoriteViews = []string{"grid", "list"}
+)
+
+// Preferences personalize the UI for a Tailscale login. The tailnet
+// identity is the account, so there is nothing to sign up for.
+type Preferences struct {
+	Theme        string `json:"theme"`
+	PageSize     int    `json:"page_size"`
+	FavoriteView string `json:"favorite_view"`
+}
+
+// defaultPreferences are stored on first use, and fill in fields missing
+// from a stored or submitted document.
+func defaultPreferences() Preferences {
+	return Preferences{Theme: "system", PageSize: 20, FavoriteView: "grid"}
+}
+
+func (p Preferences) validate() error {
+	if !slices.Contains(themes, p.Theme) {
+		return fmt.Errorf("theme must be one of %s", strings.Join(themes, ", "))
+	}
+	if p.PageSize < 1 || p.PageSize > maxPageSize {
+		return fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+	}
+	if !slices.Contains(favoriteViews, p.FavoriteView) {
+		return fmt.Errorf("favorite_view must be one of %s", strings.Join(favoriteViews, ", "))
+	}
+	return nil
+}
+
+// preferencesHandler returns the caller's preferences, creating them with
+// the defaults on first use.
+func (s *Server) preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	login, ok := s.callerLogin(w, r, "Preferences")
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	defaults, _ := json.Marshal(defaultPreferences())
+	data, err := s.store.Preferences(ctx, login, defaults)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load preferences: %v", err))
+		return
+	}
+
+	prefs := defaultPreferences()
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Stored preferences are invalid: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// putPreferencesHandler replaces the caller's preferences. Fields left out
+// take their defaults.
+func (s *Server) putPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	login, ok := s.callerLogin(w, r, "Preferences")
+	if !ok {
+		return
+	}
+
+	prefs := defaultPreferences()
+	if !s.readJSONBody(w, r, maxPreferencesBodyBytes, &prefs, "preferences object") {
+		return
+	}
+	if err := prefs.validate(); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+
+	data, _ := json.Marshal(prefs)
+	if err := s.store.SetPreferences(ctx, login, data); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save preferences: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(prefs)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPreferencesValidate verifies only known themes, views and page sizes in range are accepted
+func TestPreferencesValidate(t *testing.T) {
+	if err := defaultPreferences().validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+	for _, p := range []Preferences{
+		{Theme: "neon", PageSize: 20, FavoriteView: "grid"},
+		{Theme: "dark", PageSize: 0, FavoriteView: "grid"},
+		{Theme: "dark", PageSize: maxPageSize + 1, FavoriteView: "grid"},
+		{Theme: "dark", PageSize: 20, FavoriteView: "carousel"},
+	} {
+		if err := p.validate(); err == nil {
+			t.Errorf("%+v passed validation", p)
+		}
+	}
+}
+
+// TestPutPreferencesValidation verifies bad preference updates are rejected
+// before the database is used
+func TestPutPreferencesValidation(t *testing.T) {
+	s := &Server{}
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"", http.StatusForbidden},
+		{`{"theme": "dark"`, http.StatusBadRequest},
+		{`{"colour": "red"}`, http.StatusBadRequest},
+		{`{"theme": "neon"}`, http.StatusUnprocessableEntity},
+		{`{"page_size": -1}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/preferences", strings.NewReader(tt.body))
+		if tt.want != http.StatusForbidden {
+			asServeUser(r, "alice@example.com")
+		}
+		w := httptest.NewRecorder()
+		s.putPreferencesHandler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("PUT %q = %d, want %d", tt.body, w.Code, tt.want)
+		}
+	}
+
+	// A login header from a tailnet peer does not make it that user
+	for _, h := range []http.HandlerFunc{s.preferencesHandler, s.putPreferencesHandler} {
+		r := asSpoofedUser(httptest.NewRequest(http.MethodPut, "/api/preferences", strings.NewReader(`{"theme": "dark"}`)), "alice@example.com")
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("spoofed login = %d, want 403", w.Code)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const (
+	priceHistoryPageDefault = 50
+	priceHistoryPageMax     = 500
+)
+
+// withActor attributes the product writes made with ctx to the caller, for
+// the price history. The login is tailscaleWhois's, so the trail cannot be
+// forged with identity headers; callers without a Tailscale identity are
+// recorded without one.
+func (s *Server) withActor(ctx context.Context, r *http.Request) context.Context {
+	who, err := s.tailscaleWhois(ctx, r)
+	if err != nil {
+		return ctx
+	}
+	return store.WithActor(ctx, who.LoginName)
+}
+
+// priceHistoryHandler lists a product's price changes, newest first, with
+// the Tailscale login that made each.
+func (s *Server) priceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	limit := priceHistoryPageDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > priceHistoryPageMax {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", priceHistoryPageMax))
+			return
+		}
+		limit = n
+	}
+
+	ctx := r.Context()
+
+	history, err := s.store.PriceHistory(ctx, id, limit)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Product not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query price history: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestPriceHistoryHandlerRejects verifies bad product ids and limits are
+// rejected before the database is used
+func TestPriceHistoryHandlerRejects(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/products/{id}/history", s.priceHistoryHandler)
+
+	for _, path := range []string{
+		"/api/products/0/history",
+		"/api/products/abc/history",
+		"/api/products/1/history?limit=0",
+		"/api/products/1/history?limit=501",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+// TestWithActor verifies price changes are attributed to the caller Tailscale
+// identifies, never to a login a tailnet peer puts in the header
+func TestWithActor(t *testing.T) {
+	s := &Server{}
+	for _, tc := range []struct {
+		name  string
+		r     *http.Request
+		actor string
+	}{
+		{"serve", asServeUser(httptest.NewRequest(http.MethodPatch, "/api/products/1", nil), "alice@example.com"), "alice@example.com"},
+		{"spoofed", asSpoofedUser(httptest.NewRequest(http.MethodPatch, "/api/products/1", nil), "alice@example.com"), ""},
+		{"anonymous", httptest.NewRequest(http.MethodPatch, "/api/products/1", nil), ""},
+	} {
+		actor, ok := store.Actor(s.withActor(context.Background(), tc.r))
+		if actor != tc.actor || ok != (tc.actor != "") {
+			t.Errorf("%s: actor %q, %v; want %q", tc.name, actor, ok, tc.actor)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// productIDFromPath parses the {id} path value, writing a 400 on failure.
+func productIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, `{"error": "Product id must be a positive integer"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) productHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Accept-Patch", jsonPatchContentType+", "+mergePatchContentType)
+
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	raw, err := s.store.Product(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Product not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to query database: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	writeProduct(w, r, raw)
+}
+
+// productETag returns a product's strong ETag, "<id>-<version>". Every write
+// bumps the version, so the tag names the revision a client read.
+func productETag(raw map[string]interface{}) string {
+	return fmt.Sprintf(`"%v-%v"`, raw["id"], raw["version"])
+}
+
+// writeProduct writes a raw product row with its ETag, or 304 if
+// If-None-Match matches it.
+func writeProduct(w http.ResponseWriter, r *http.Request, raw map[string]interface{}) {
+	body, err := json.Marshal(normalizeProduct(raw))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeWithETag(w, r, append(body, '\n'), productETag(raw))
+}
+
+// deleteProductHandler soft-deletes a single product, which
+// restoreProductHandler undoes. Orders keep their snapshot of its name and
+// price.
+func (s *Server) deleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	err := s.store.DeleteProduct(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Product not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete product: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// patchProductHandler applies a JSON Patch or JSON Merge Patch document to a
+// single product. If-Match must hold the ETag the client last read the
+// product with, so that of two users editing it at once the second gets a
+// 412 rather than overwriting the first's changes unseen.
+func (s *Server) patchProductHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, `{"error": "If-Match must hold the product's ETag from GET /api/products/{id}, or * to update it regardless"}`, http.StatusPreconditionRequired)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != jsonPatchContentType && mediaType != mergePatchContentType {
+		w.Header().Set("Accept-Patch", jsonPatchContentType+", "+mergePatchContentType)
+		http.Error(w, fmt.Sprintf(`{"error": "Content-Type must be %s or %s"}`, jsonPatchContentType, mergePatchContentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.bodyLimit(0)))
+	if err != nil {
+		writeBodyError(w, err, "patch")
+		return
+	}
+
+	ctx := s.withActor(r.Context(), r)
+
+	updated, err := s.patchProduct(ctx, id, ifMatchETag(ifMatch), func(original interface{}) (interface{}, error) {
+		if mediaType == jsonPatchContentType {
+			var ops []patchOperation
+			if err := json.Unmarshal(body, &ops); err != nil {
+				return nil, errMalformedPatch
+			}
+			patched, err := applyJSONPatch(original, ops)
+			if err != nil && !errors.Is(err, errPatchTestFailed) {
+				return nil, fmt.Errorf("%w: %v", errInvalidProduct, err)
+			}
+			return patched, err
+		}
+
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, errMalformedPatch
+		}
+		return applyMergePatch(original, patch), nil
+	})
+
+	switch {
+	case err == nil:
+		// The new ETag lets the client make its next edit
+		writeProduct(w, r, updated)
+	case errors.Is(err, errProductChanged):
+		writeJSONError(w, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, errMalformedPatch):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errProductNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errPatchTestFailed), errors.Is(err, errProductNameTaken):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, errInvalidProduct):
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update product: %v", err))
+	}
+}
+
+var (
+	errProductNotFound  = errors.New("product not found")
+	errProductNameTaken = errors.New("a product with that name already exists")
+	errInvalidProduct   = errors.New("invalid product")
+	errMalformedPatch   = errors.New("patch document is not valid JSON of the expected shape")
+	errProductChanged   = errors.New("the product has changed since it was read; read it again and reapply the change")
+)
+
+// ifMatchETag returns a patchProduct precondition that the product still
+// has one of the ETags in an If-Match header, as GET /api/products/{id}
+// sent them, so any write since the client read it fails the check.
+func ifMatchETag(ifMatch string) func(raw map[string]interface{}) error {
+	return func(raw map[string]interface{}) error {
+		if !ifMatchLists(ifMatch, productETag(raw)) {
+			return errProductChanged
+		}
+		return nil
+	}
+}
+
+// patchProduct locks a product row, checks it with precondition (if not
+// nil), passes its JSON document to fn, validates the document fn returns and
+// writes the changed columns, all in a single transaction so concurrent
+// patches are applied one after another. It returns the raw updated row.
+func (s *Server) patchProduct(ctx context.Context, id int64, precondition func(raw map[string]interface{}) error, fn func(original interface{}) (interface{}, error)) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := s.store.InTx(ctx, func(tx *store.Tx) error {
+		raw, err := tx.LockProduct(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			return errProductNotFound
+		} else if err != nil {
+			return err
+		}
+		if precondition != nil {
+			if err := precondition(raw); err != nil {
+				return err
+			}
+		}
+
+		original, err := deepCopyJSON(normalizeProduct(raw))
+		if err != nil {
+			return err
+		}
+
+		patched, err := fn(original)
+		if err != nil {
+			return err
+		}
+
+		patchedObj, ok := patched.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: patched product must remain a JSON object", errInvalidProduct)
+		}
+
+		changes, err := productChanges(original.(map[string]interface{}), patchedObj)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidProduct, err)
+		}
+
+		if len(changes) == 0 {
+			result = raw
+			return nil
+		}
+
+		result, err = tx.UpdateProduct(ctx, id, changes)
+		if errors.Is(err, store.ErrConflict) {
+			return errProductNameTaken
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateProductStats()
+	return result, nil
+}
+
+// writableProductColumns maps each column clients may change to a validator
+// that converts the JSON value into a driver value.
+var writableProductColumns = map[string]func(interface{}) (interface{}, error){
+	"name": func(v interface{}) (interface{}, error) {
+		s, ok := v.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, errors.New("name must be a non-empty string")
+		}
+		if len(s) > 255 {
+			return nil, errors.New("name must be at most 255 characters")
+		}
+		return s, nil
+	},
+	"description": func(v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("description must be a string or null")
+		}
+		return s, nil
+	},
+	"price": func(v interface{}) (interface{}, error) {
+		var price float64
+		switch p := v.(type) {
+		case float64:
+			price = p
+		case string:
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return nil, errors.New("price must be a number")
+			}
+			price = f
+		default:
+			return nil, errors.New("price must be a number")
+		}
+		if price < 0 || price >= 1e8 {
+			return nil, errors.New("price must be between 0 and 99999999.99")
+		}
+		return strconv.FormatFloat(price, 'f', 2, 64), nil
+	},
+	"stock_quantity": func(v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		f, ok := v.(float64)
+		if !ok || f != float64(int64(f)) || f < 0 {
+			return nil, errors.New("stock_quantity must be a non-negative integer or null")
+		}
+		return int64(f), nil
+	},
+	"category": func(v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("category must be a string or null")
+		}
+		if len(s) > 100 {
+			return nil, errors.New("category must be at most 100 characters")
+		}
+		return s, nil
+	},
+}
+
+// productChanges compares a product document before and after patching and
+// returns validated values for the columns that changed. Removing a field is
+// treated as setting it to null.
+func productChanges(original, patched map[string]interface{}) (map[string]interface{}, error) {
+	for col := range patched {
+		if _, ok := original[col]; !ok {
+			return nil, fmt.Errorf("%s is not a product field", col)
+		}
+	}
+
+	changes := make(map[string]interface{})
+	for col, before := range original {
+		after := patched[col]
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		validate, ok := writableProductColumns[col]
+		if !ok {
+			return nil, fmt.Errorf("%s is read-only", col)
+		}
+
+		value, err := validate(after)
+		if err != nil {
+			return nil, err
+		}
+		changes[col] = value
+	}
+
+	return changes, nil
+}
+
+// writeJSONError writes an {"error": msg} body, escaping msg properly.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
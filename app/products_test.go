@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPatchProductRequiresIfMatch verifies PATCH needs If-Match, answering 428 without it
+func TestPatchProductRequiresIfMatch(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("PATCH /api/products/{id}", s.patchProductHandler)
+
+	r := httptest.NewRequest(http.MethodPatch, "/api/products/1", strings.NewReader(`{"price": 5}`))
+	r.Header.Set("Content-Type", mergePatchContentType)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Errorf("PATCH without If-Match = %d, want 428", w.Code)
+	}
+}
+
+// TestIfMatchETag verifies If-Match is compared strongly with the product's id-version ETag
+func TestIfMatchETag(t *testing.T) {
+	raw := map[string]interface{}{"id": int64(1), "name": "Homelab", "price": []byte("0.00"), "version": int64(3)}
+
+	// The tag a client holds is the one GET /api/products/{id} sent
+	w := httptest.NewRecorder()
+	writeProduct(w, httptest.NewRequest(http.MethodGet, "/api/products/1", nil), raw)
+	etag := w.Header().Get("ETag")
+	if etag != `"1-3"` {
+		t.Fatalf("ETag = %s, want \"1-3\"", etag)
+	}
+
+	for header, want := range map[string]error{
+		etag:               nil,
+		`"other", ` + etag: nil,
+		"*":                nil,
+		`W/"other"`:        errProductChanged,
+		// Weak tags never match strongly
+		"W/" + etag: errProductChanged,
+		`"1-2"`:     errProductChanged,
+	} {
+		if err := ifMatchETag(header)(raw); !errors.Is(err, want) {
+			t.Errorf("If-Match %s: %v, want %v", header, err, want)
+		}
+	}
+
+	// Any write bumps the version, so the tag no longer matches
+	raw["version"] = int64(4)
+	if err := ifMatchETag(etag)(raw); !errors.Is(err, errProductChanged) {
+		t.Errorf("If-Match of the previous version: %v, want errProductChanged", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// PurchaseRequest is the POST /api/products/{id}/purchase body. An empty
+// body buys one.
+type PurchaseRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+var errOutOfStock = errors.New("not enough stock")
+
+// purchase takes quantity units of product id out of stock. The row is
+// locked for the check and the decrement, so concurrent purchases of the
+// last units cannot both succeed. It returns the raw updated row.
+func (s *Server) purchase(ctx context.Context, id int64, quantity int) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := s.store.InTx(ctx, func(tx *store.Tx) error {
+		raw, err := tx.LockProduct(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			return errProductNotFound
+		} else if err != nil {
+			return err
+		}
+
+		stock, _ := raw["stock_quantity"].(int64)
+		if stock < int64(quantity) {
+			return fmt.Errorf("%w: %d left", errOutOfStock, stock)
+		}
+
+		result, err = tx.UpdateProduct(ctx, id, map[string]interface{}{"stock_quantity": stock - int64(quantity)})
+		return err
+	})
+	return result, err
+}
+
+// purchaseHandler buys units of a product, answering 409 when there are not
+// enough in stock.
+func (s *Server) purchaseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	req := PurchaseRequest{Quantity: 1}
+	// An empty body buys one
+	if err := s.decodeJSONBody(w, r, maxOrderBodyBytes, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, err, "purchase")
+		return
+	}
+	if req.Quantity < 1 || req.Quantity > maxOrderQuantity {
+		writeJSONError(w, http.StatusUnprocessableEntity, fmt.Sprintf("quantity must be between 1 and %d", maxOrderQuantity))
+		return
+	}
+
+	ctx := r.Context()
+
+	updated, err := s.purchase(ctx, id, req.Quantity)
+	switch {
+	case err == nil:
+		json.NewEncoder(w).Encode(normalizeProduct(updated))
+	case errors.Is(err, errProductNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errOutOfStock):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	default:
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to purchase product: %v", err))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPurchaseHandlerValidation verifies malformed purchases are rejected
+// before the database is used
+func TestPurchaseHandlerValidation(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/products/{id}/purchase", s.purchaseHandler)
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/products/abc/purchase", "", http.StatusBadRequest},
+		{"/api/products/1/purchase", "{", http.StatusBadRequest},
+		{"/api/products/1/purchase", `{"qty": 2}`, http.StatusBadRequest},
+		{"/api/products/1/purchase", `{"quantity": 2} {"quantity": 3}`, http.StatusBadRequest},
+		{"/api/products/1/purchase", `{"quantity": 2, "note": "` + strings.Repeat("x", maxOrderBodyBytes) + `"}`, http.StatusRequestEntityTooLarge},
+		{"/api/products/1/purchase", `{"quantity": 0}`, http.StatusUnprocessableEntity},
+		{"/api/products/1/purchase", `{"quantity": -2}`, http.StatusUnprocessableEntity},
+		{"/api/products/1/purchase", `{"quantity": 1000000}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("POST %s %.40q = %d, want %d", tt.path, tt.body, w.Code, tt.want)
+		}
+	}
+}
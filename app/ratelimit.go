@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiterIdleTTL is how long an idle client's bucket is kept.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// rateLimiter is a per-key token bucket: each key may make burst requests
+// at once, refilled at rate per second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int, clock Clock) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), clock: clock, buckets: map[string]*tokenBucket{}}
+}
+
+// setLimits changes the rate and burst. Buckets keep their tokens, capped
+// at the new burst.
+func (l *rateLimiter) setLimits(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst = rate, float64(burst)
+	for _, b := range l.buckets {
+		b.tokens = math.Min(b.tokens, l.burst)
+	}
+}
+
+// allow takes a token for key. If none is left it returns false and how long
+// until one is.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// prune drops buckets that have been idle long enough to be full again.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < rateLimiterIdleTTL {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= rateLimiterIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limit rejects requests over the limit, keyed by client IP, with 429.
+func (l *rateLimiter) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(clientIP(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, `{"error": "Too many requests"}`, http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// clientIP returns the host part of the request's remote address, or the
+// original client's address for connections relayed by Funnel.
+func clientIP(r *http.Request) string {
+	if src, ok := r.Context().Value(funnelSrcKey{}).(netip.AddrPort); ok && src.IsValid() {
+		return src.Addr().String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimiterRefill verifies each key has its own burst, refilled at the rate
+func TestRateLimiterRefill(t *testing.T) {
+	clock := newFakeClock(time.Unix(0, 0))
+	l := newRateLimiter(1, 3, clock)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait != time.Second {
+		t.Fatalf("allow after burst = %v, %s; want false, 1s", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("other clients share the exhausted bucket")
+	}
+
+	clock.Advance(time.Second)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("bucket did not refill")
+	}
+	if ok, _ := l.allow("a"); ok {
+		t.Error("bucket refilled more than one token per second")
+	}
+
+	clock.Advance(rateLimiterIdleTTL)
+	l.allow("c")
+	if _, ok := l.buckets["b"]; ok {
+		t.Error("idle bucket was not pruned")
+	}
+}
+
+// TestRateLimiterLimit verifies limited requests get a 429 with Retry-After
+func TestRateLimiterLimit(t *testing.T) {
+	l := newRateLimiter(0.5, 1, newFakeClock(time.Unix(0, 0)))
+	h := l.limit(func(w http.ResponseWriter, r *http.Request) {})
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+		if w.Code != want {
+			t.Fatalf("request %d = %d, want %d", i+1, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "2" {
+			t.Errorf("Retry-After = %q, want 2", w.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// errReadOnly is returned for changes attempted in read-only mode.
+var errReadOnly = errors.New("the demo is in read-only mode")
+
+// readOnlyMode turns away every mutating request when the server runs with
+// --read-only, for exposing the demo publicly. POST /graphql still serves
+// queries; its mutations refuse themselves.
+func (s *Server) readOnlyMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.live().readOnly && isMutating(r.Method) && r.URL.Path != "/graphql" {
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			http.Error(w, `{"error": "The demo is in read-only mode; changes are disabled"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestReadOnlyMode verifies READ_ONLY refuses writes and lets reads through
+func TestReadOnlyMode(t *testing.T) {
+	s := &Server{}
+	s.setLive(&liveConfig{readOnly: true})
+	h := s.readOnlyMode(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/products", http.StatusTeapot},
+		{http.MethodHead, "/api/products", http.StatusTeapot},
+		{http.MethodOptions, "/api/products", http.StatusTeapot},
+		{http.MethodPatch, "/api/products/1", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/orders", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/admin/products/1", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/graphql", http.StatusTeapot},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+		if w.Code == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("%s %s: Allow = %q", tc.method, tc.path, w.Header().Get("Allow"))
+		}
+	}
+
+	s.setLive(&liveConfig{})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/api/products/1", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("read-write PATCH: status %d", w.Code)
+	}
+}
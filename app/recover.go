@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+)
+
+// requestIDHeader carries the ID that ties a failed request to its log
+// lines.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs a proxy in front may have assigned.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestID returns the request's X-Request-ID if it has a usable one, or a
+// new random ID.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); validRequestID.MatchString(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recoverPanics turns a panic in next into a 500 problem+json response,
+// logging the stack with a request ID that the response repeats, so that
+// one bad request doesn't drop the connection. If the handler had already
+// started its response, the connection is aborted as net/http would.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			id := requestID(r)
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.RequestURI(), id, v, debug.Stack())
+			if rec.code != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set(requestIDHeader, id)
+			sendProblem(w, problem{
+				Status:    http.StatusInternalServerError,
+				Detail:    "The server failed to handle the request",
+				RequestID: id,
+			})
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
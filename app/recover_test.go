@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRecoverPanics verifies a panic is logged with the request and
+// answered with a 500 problem carrying the request ID
+func TestRecoverPanics(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	s := &Server{}
+	h := s.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/wrote" {
+			w.Write([]byte("["))
+		}
+		var m map[string]int
+		m["boom"]++
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/products?x=1", nil)
+	r.Header.Set(requestIDHeader, "edge-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/problem+json" || w.Header().Get(requestIDHeader) != "edge-42" {
+		t.Fatalf("status %d, headers %v", w.Code, w.Header())
+	}
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != http.StatusInternalServerError || p.RequestID != "edge-42" {
+		t.Errorf("problem = %+v", p)
+	}
+	if out := logs.String(); !strings.Contains(out, "panic serving GET /api/products?x=1 (request edge-42): assignment to entry in nil map") || !strings.Contains(out, "recover_test.go") {
+		t.Errorf("log:\n%s", out)
+	}
+
+	// Unusable IDs are replaced
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(requestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if id := w.Header().Get(requestIDHeader); len(id) != 16 {
+		t.Errorf("request ID %q", id)
+	}
+
+	// A response already under way cannot be replaced
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/wrote", nil))
+	}()
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errCacheMiss is returned by kvStore.Get for a key that is not set.
+var errCacheMiss = errors.New("cache miss")
+
+// kvStore is the part of Redis the shared cache uses.
+type kvStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Incr(ctx context.Context, key string) (int64, error)
+	Del(ctx context.Context, key string) error
+	Ping(ctx context.Context) error
+}
+
+// redisOpTimeout bounds every cache operation, so a slow Redis costs a
+// request little more than going straight to the database.
+const redisOpTimeout = 250 * time.Millisecond
+
+// redisRetryAfter is how long the cache is bypassed after Redis fails.
+const redisRetryAfter = 10 * time.Second
+
+// redisStore is a kvStore backed by a Redis server.
+type redisStore struct {
+	client *redis.Client
+}
+
+// newRedisStore connects to the Redis server at url
+// (redis://[user:password@]host:port/db, or rediss:// for TLS).
+func newRedisStore(url string) (*redisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	opts.DialTimeout = redisOpTimeout
+	opts.ReadTimeout = redisOpTimeout
+	opts.WriteTimeout = redisOpTimeout
+	opts.MaxRetries = -1
+	return &redisStore{client: redis.NewClient(opts)}, nil
+}
+
+func (r *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, errCacheMiss
+	}
+	return b, err
+}
+
+func (r *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *redisStore) Incr(ctx context.Context, key string) (int64, error) {
+	return r.client.Incr(ctx, key).Result()
+}
+
+func (r *redisStore) Del(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *redisStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// addr returns the host:port of the server.
+func (r *redisStore) addr() string {
+	return r.client.Options().Addr
+}
+
+func (r *redisStore) Close() error {
+	return r.client.Close()
+}
+
+// sharedCache caches product listings and WhoIs results in Redis, so
+// replicas share them. It is best effort: when Redis fails, callers fall
+// back to the database or LocalAPI and the cache is skipped for
+// redisRetryAfter. A nil sharedCache caches nothing.
+type sharedCache struct {
+	kv    kvStore
+	clock Clock
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func newSharedCache(kv kvStore, clock Clock, ttl time.Duration) *sharedCache {
+	return &sharedCache{kv: kv, clock: clock, ttl: ttl}
+}
+
+// Keys are prefixed so the demo can share a Redis with other apps.
+const (
+	redisKeyPrefix      = "tailscale-demo:"
+	redisProductsGenKey = redisKeyPrefix + "products:generation"
+)
+
+// available reports whether Redis should be tried.
+func (c *sharedCache) available() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.clock.Now().Before(c.downUntil)
+}
+
+// failed notes a Redis error, logging it when Redis was thought up.
+func (c *sharedCache) failed(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.clock.Now().Before(c.downUntil) {
+		log.Printf("Redis unavailable, bypassing the shared cache for %s: %v", redisRetryAfter, err)
+	}
+	c.downUntil = c.clock.Now().Add(redisRetryAfter)
+}
+
+// getJSON decodes the value of key into v, reporting whether it was there.
+func (c *sharedCache) getJSON(ctx context.Context, key string, v interface{}) bool {
+	if !c.available() {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisOpTimeout)
+	defer cancel()
+
+	b, err := c.kv.Get(ctx, key)
+	if errors.Is(err, errCacheMiss) {
+		return false
+	} else if err != nil {
+		c.failed(err)
+		return false
+	}
+	// Numbers stay json.Number so large IDs survive the round trip
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v) == nil
+}
+
+// setJSON stores v under key for ttl.
+func (c *sharedCache) setJSON(ctx context.Context, key string, v interface{}, ttl time.Duration) {
+	if !c.available() {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisOpTimeout)
+	defer cancel()
+	if err := c.kv.Set(ctx, key, b, ttl); err != nil {
+		c.failed(err)
+	}
+}
+
+// productsKey returns the key of the listing for category. Listings are
+// keyed by a generation that writes bump, so one INCR invalidates them on
+// every replica.
+func (c *sharedCache) productsKey(ctx context.Context, category string) (string, bool) {
+	if !c.available() {
+		return "", false
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisOpTimeout)
+	defer cancel()
+
+	generation := "0"
+	if b, err := c.kv.Get(ctx, redisProductsGenKey); err == nil {
+		generation = string(b)
+	} else if !errors.Is(err, errCacheMiss) {
+		c.failed(err)
+		return "", false
+	}
+	return redisKeyPrefix + "products:" + generation + ":" + category, true
+}
+
+// products returns the listing for category from Redis, or calls load and
+// stores its result.
+func (c *sharedCache) products(ctx context.Context, category string, load func() ([]map[string]interface{}, error)) ([]map[string]interface{}, error) {
+	key, ok := c.productsKey(ctx, category)
+	if !ok {
+		return load()
+	}
+	var products []map[string]interface{}
+	if c.getJSON(ctx, key, &products) {
+		return products, nil
+	}
+	products, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.setJSON(ctx, key, products, c.ttl)
+	return products, nil
+}
+
+// invalidateProducts drops the listings cached by every replica. It is
+// tried even while Redis is thought down, so a recovered Redis does not
+// serve listings from before the write.
+func (c *sharedCache) invalidateProducts() {
+	if c == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if _, err := c.kv.Incr(ctx, redisProductsGenKey); err != nil {
+		c.failed(err)
+	}
+}
+
+// forget deletes key. Like invalidateProducts, it is tried even while Redis
+// is thought down.
+func (c *sharedCache) forget(key string) {
+	if c == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := c.kv.Del(ctx, key); err != nil {
+		c.failed(err)
+	}
+}
+
+// whoisKey returns the key of the WhoIs result for a tailnet address, which
+// is the same peer whichever replica it connects to.
+func whoisKey(addr string) string {
+	return redisKeyPrefix + "whois:" + addr
+}
+
+// status reports "connected" or "disconnected" for /health, or "" if
+// there is no shared cache.
+func (c *sharedCache) status(ctx context.Context) string {
+	if c == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisOpTimeout)
+	defer cancel()
+	if err := c.kv.Ping(ctx); err != nil {
+		return "disconnected"
+	}
+	return "connected"
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKV is an in-memory kvStore that can be made to fail.
+type fakeKV struct {
+	mu    sync.Mutex
+	data  map[string][]byte
+	down  bool
+	calls int
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{data: map[string][]byte{}}
+}
+
+var errKVDown = errors.New("connection refused")
+
+func (f *fakeKV) op() error {
+	f.calls++
+	if f.down {
+		return errKVDown
+	}
+	return nil
+}
+
+func (f *fakeKV) Get(ctx context.Context, key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.op(); err != nil {
+		return nil, err
+	}
+	b, ok := f.data[key]
+	if !ok {
+		return nil, errCacheMiss
+	}
+	return b, nil
+}
+
+func (f *fakeKV) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.op(); err != nil {
+		return err
+	}
+	f.data[key] = value
+	return nil
+}
+
+func (f *fakeKV) Incr(ctx context.Context, key string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.op(); err != nil {
+		return 0, err
+	}
+	n, _ := strconv.ParseInt(string(f.data[key]), 10, 64)
+	n++
+	f.data[key] = []byte(strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (f *fakeKV) Del(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.op(); err != nil {
+		return err
+	}
+	delete(f.data, key)
+	return nil
+}
+
+func (f *fakeKV) Ping(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.op()
+}
+
+// TestSharedCacheProducts verifies replicas share product listings until
+// one of them invalidates them
+func TestSharedCacheProducts(t *testing.T) {
+	kv := newFakeKV()
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	replicaA := newSharedCache(kv, clock, time.Minute)
+	replicaB := newSharedCache(kv, clock, time.Minute)
+	ctx := context.Background()
+
+	loads := 0
+	load := func() ([]map[string]interface{}, error) {
+		loads++
+		return []map[string]interface{}{{"id": 9007199254740993, "name": "Homelab"}}, nil
+	}
+
+	if _, err := replicaA.products(ctx, "", load); err != nil {
+		t.Fatal(err)
+	}
+	products, err := replicaB.products(ctx, "", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loads != 1 {
+		t.Errorf("%d database loads, want the second replica to use Redis", loads)
+	}
+	if id := products[0]["id"]; id == nil || id.(interface{ String() string }).String() != "9007199254740993" {
+		t.Errorf("id = %v, want it exact", id)
+	}
+
+	// A write on one replica invalidates the listing for both
+	replicaA.invalidateProducts()
+	replicaB.products(ctx, "", load)
+	if loads != 2 {
+		t.Errorf("%d database loads after a write, want 2", loads)
+	}
+	if replicaB.status(ctx) != "connected" {
+		t.Error("status should be connected")
+	}
+}
+
+// TestSharedCacheOutage verifies listings are loaded directly while Redis is unreachable
+func TestSharedCacheOutage(t *testing.T) {
+	kv := newFakeKV()
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	c := newSharedCache(kv, clock, time.Minute)
+	ctx := context.Background()
+
+	loads := 0
+	load := func() ([]map[string]interface{}, error) {
+		loads++
+		return []map[string]interface{}{}, nil
+	}
+
+	kv.down = true
+	for i := 0; i < 3; i++ {
+		if _, err := c.products(ctx, "", load); err != nil {
+			t.Fatalf("an outage should fall back to the database: %v", err)
+		}
+	}
+	if loads != 3 || kv.calls != 1 {
+		t.Errorf("%d loads and %d Redis calls, want 3 and 1: Redis should be skipped after failing", loads, kv.calls)
+	}
+	if c.status(ctx) != "disconnected" {
+		t.Error("status should be disconnected")
+	}
+
+	kv.down = false
+	clock.Advance(redisRetryAfter)
+	c.products(ctx, "", load)
+	c.products(ctx, "", load)
+	if loads != 4 {
+		t.Errorf("%d loads, want Redis used again once it is back", loads)
+	}
+
+	var off *sharedCache
+	off.invalidateProducts()
+	off.forget(whoisKey("100.64.0.1"))
+	if _, err := off.products(ctx, "", load); err != nil || loads != 5 || off.status(ctx) != "" {
+		t.Error("a nil shared cache should always load")
+	}
+}
+
+// TestSharedCacheForget verifies a forgotten WhoIs is dropped for every replica
+func TestSharedCacheForget(t *testing.T) {
+	kv := newFakeKV()
+	c := newSharedCache(kv, newFakeClock(time.Unix(1700000000, 0)), time.Minute)
+	ctx := context.Background()
+
+	key := whoisKey("100.64.0.1")
+	c.setJSON(ctx, key, peerIdentity{Login: "alice@example.com"}, time.Minute)
+	var id peerIdentity
+	if !c.getJSON(ctx, key, &id) || id.Login != "alice@example.com" {
+		t.Fatalf("got %+v", id)
+	}
+	c.forget(key)
+	if c.getJSON(ctx, key, &id) {
+		t.Error("forgotten key still cached")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/alecthomas/kong"
+)
+
+// liveConfig is the configuration SIGHUP reloads without a restart, so
+// without re-registering the tsnet node. It is swapped as a whole, so a
+// request sees either the old settings or the new ones, never a mix.
+type liveConfig struct {
+	readOnly    bool
+	adminLogins map[string]bool
+	adminTags   []string
+	roles       *roleMap
+
+	// posture are the POSTURE_RULES callers' devices must pass
+	posture []postureRule
+
+	// logLevel is "info", or "debug" to also log every request
+	logLevel string
+
+	statusRate  float64
+	statusBurst int
+}
+
+// newLiveConfig builds the reloadable settings from config.
+func newLiveConfig(config *ServeCmd) (*liveConfig, error) {
+	roles, err := newRoleMap(config.Roles, config.RolesFile, config.RoleDefault)
+	if err != nil {
+		return nil, err
+	}
+	posture, err := parsePostureRules(config.PostureRules)
+	if err != nil {
+		return nil, err
+	}
+	if config.StatusRate <= 0 || config.StatusBurst < 1 {
+		return nil, fmt.Errorf("STATUS_RATE must be positive and STATUS_BURST at least 1")
+	}
+	return &liveConfig{
+		readOnly:    config.ReadOnly,
+		adminLogins: loginSet(config.AdminLogins),
+		adminTags:   tagList(config.AdminTags),
+		roles:       roles,
+		posture:     posture,
+		logLevel:    config.LogLevel,
+		statusRate:  config.StatusRate,
+		statusBurst: config.StatusBurst,
+	}, nil
+}
+
+// live returns the current reloadable settings.
+func (s *Server) live() *liveConfig {
+	if c := s.reloadable.Load(); c != nil {
+		return c
+	}
+	return &liveConfig{}
+}
+
+// setLive swaps in c.
+func (s *Server) setLive(c *liveConfig) {
+	s.reloadable.Store(c)
+	if s.statusLimiter != nil && c.statusRate > 0 {
+		s.statusLimiter.setLimits(c.statusRate, c.statusBurst)
+	}
+}
+
+// loadServeConfig parses the serve configuration again from the command
+// line, the environment and the .env file, as at startup.
+func loadServeConfig() (*ServeCmd, error) {
+	if path := envFileFromArgs(os.Args[1:]); path != "" {
+		if err := reloadEnvFile(path); err != nil {
+			return nil, fmt.Errorf("reloading env file: %w", err)
+		}
+	}
+
+	var cli CLI
+	parser, err := kong.New(&cli, kong.Name("tailscale-demo"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parser.Parse(os.Args[1:]); err != nil {
+		return nil, err
+	}
+	return &cli.Serve, nil
+}
+
+// reloadConfig applies the reloadable part of the configuration load
+// returns, and logs what changed. Other settings need a restart.
+func (s *Server) reloadConfig(load func() (*ServeCmd, error)) error {
+	config, err := load()
+	if err != nil {
+		return err
+	}
+	next, err := newLiveConfig(config)
+	if err != nil {
+		return err
+	}
+	old := s.live()
+	s.setLive(next)
+
+	var changed []string
+	for _, f := range []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"READ_ONLY", old.readOnly, next.readOnly},
+		{"ADMIN_LOGINS", old.adminLogins, next.adminLogins},
+		{"ADMIN_TAGS", old.adminTags, next.adminTags},
+		{"ROLES", old.roles, next.roles},
+		{"POSTURE_RULES", old.posture, next.posture},
+		{"LOG_LEVEL", old.logLevel, next.logLevel},
+		{"STATUS_RATE", old.statusRate, next.statusRate},
+		{"STATUS_BURST", old.statusBurst, next.statusBurst},
+	} {
+		if !reflect.DeepEqual(f.old, f.new) {
+			changed = append(changed, f.name)
+		}
+	}
+	if len(changed) == 0 {
+		log.Printf("Reloaded configuration: nothing changed")
+	} else {
+		log.Printf("Reloaded configuration: %s changed", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// handleReloads reloads the configuration on SIGHUP until ctx is done. A
+// configuration that fails to load leaves the current one in place.
+func (s *Server) handleReloads(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := s.reloadConfig(loadServeConfig); err != nil {
+				log.Printf("Configuration reload failed, keeping the current settings: %v", err)
+			}
+		}
+	}
+}
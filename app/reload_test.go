@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestReloadConfig verifies reloading applies new settings and keeps the
+// old ones if the new ones are invalid
+func TestReloadConfig(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	s := &Server{clock: clock, statusLimiter: newRateLimiter(statusRate, statusBurst, clock)}
+	config := ServeCmd{RoleDefault: "viewer", LogLevel: "info", StatusRate: 1, StatusBurst: 10}
+	live, err := newLiveConfig(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setLive(live)
+
+	patch := func() int {
+		w := httptest.NewRecorder()
+		s.readOnlyMode(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})).ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/api/products/1", nil))
+		return w.Code
+	}
+	if code := patch(); code != http.StatusTeapot {
+		t.Fatalf("before reload: status %d", code)
+	}
+
+	next := config
+	next.ReadOnly = true
+	next.AdminTags = []string{"ops"}
+	next.StatusBurst = 1
+	if err := s.reloadConfig(func() (*ServeCmd, error) { return &next, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if code := patch(); code != http.StatusMethodNotAllowed {
+		t.Errorf("after reload: status %d, want read-only 405", code)
+	}
+	if tags := s.live().adminTags; len(tags) != 1 || tags[0] != "tag:ops" {
+		t.Errorf("adminTags = %v", tags)
+	}
+	if ok, _ := s.statusLimiter.allow("client"); !ok {
+		t.Error("first request refused")
+	}
+	if ok, _ := s.statusLimiter.allow("client"); ok {
+		t.Error("STATUS_BURST=1 was not applied")
+	}
+
+	// A bad configuration keeps the current one
+	bad := next
+	bad.ReadOnly = false
+	bad.Roles = []string{"alice"}
+	if err := s.reloadConfig(func() (*ServeCmd, error) { return &bad, nil }); err == nil {
+		t.Error("reload accepted a bad role mapping")
+	}
+	if !s.live().readOnly {
+		t.Error("failed reload changed the settings")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const (
+	maxReviewBodyBytes = 16 << 10
+	maxReviewLength    = 4000
+
+	reviewsPageDefault = 50
+	reviewsPageMax     = 500
+)
+
+// ReviewRequest is the body of posting or editing a review.
+type ReviewRequest struct {
+	Rating int    `json:"rating"`
+	Body   string `json:"body"`
+}
+
+func (req *ReviewRequest) validate() error {
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Rating < 1 || req.Rating > 5 {
+		return fmt.Errorf("rating must be from 1 to 5, got %d", req.Rating)
+	}
+	if n := utf8.RuneCountInString(req.Body); n > maxReviewLength {
+		return fmt.Errorf("body must be at most %d characters, got %d", maxReviewLength, n)
+	}
+	return nil
+}
+
+// decodeReview reads and validates a ReviewRequest, writing a 400 or 422 if
+// it is not one.
+func (s *Server) decodeReview(w http.ResponseWriter, r *http.Request) (ReviewRequest, bool) {
+	var req ReviewRequest
+	if !s.readJSONBody(w, r, maxReviewBodyBytes, &req, "review") {
+		return req, false
+	}
+	if err := req.validate(); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+// reviewIDFromPath parses the {id} path value of a review route, writing a
+// 400 if it is invalid.
+func reviewIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, `{"error": "Review id must be a positive integer"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// reviewsHandler lists a product's reviews, newest first.
+func (s *Server) reviewsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	limit := reviewsPageDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > reviewsPageMax {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", reviewsPageMax))
+			return
+		}
+		limit = n
+	}
+
+	ctx := r.Context()
+
+	reviews, err := s.store.Reviews(ctx, id, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query reviews: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// reviewHandler returns one review, as linked by createReviewHandler.
+func (s *Server) reviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := reviewIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	review, err := s.store.Review(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Review not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query reviews: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(review)
+}
+
+// createReviewHandler posts the caller's review of a product. The author is
+// whoever WhoIs says is calling.
+func (s *Server) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	who, err := s.tailscaleWhois(r.Context(), r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "Reviews require a Tailscale identity: "+err.Error())
+		return
+	}
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	req, ok := s.decodeReview(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	review, err := s.store.CreateReview(ctx, store.Review{
+		ProductID:   id,
+		Login:       who.LoginName,
+		DisplayName: who.DisplayName,
+		Rating:      req.Rating,
+		Body:        req.Body,
+	})
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, `{"error": "Product not found"}`, http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, `{"error": "You have already reviewed this product; edit that review instead"}`, http.StatusConflict)
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create review: %v", err))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/reviews/%d", review.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+// authorizeReview loads review id and checks that the caller wrote it or is
+// an admin, writing the error response if not.
+func (s *Server) authorizeReview(ctx context.Context, w http.ResponseWriter, r *http.Request) (*store.Review, bool) {
+	who, err := s.tailscaleWhois(r.Context(), r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "Reviews require a Tailscale identity: "+err.Error())
+		return nil, false
+	}
+	id, ok := reviewIDFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	review, err := s.store.Review(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Review not found"}`, http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query reviews: %v", err))
+		return nil, false
+	}
+
+	if !strings.EqualFold(review.Login, who.LoginName) {
+		if admin, _ := s.isAdmin(r); !admin {
+			http.Error(w, `{"error": "Only the author or an admin may change a review"}`, http.StatusForbidden)
+			return nil, false
+		}
+	}
+	return review, true
+}
+
+// updateReviewHandler replaces the rating and body of a review.
+func (s *Server) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	review, ok := s.authorizeReview(ctx, w, r)
+	if !ok {
+		return
+	}
+	req, ok := s.decodeReview(w, r)
+	if !ok {
+		return
+	}
+
+	review, err := s.store.UpdateReview(ctx, review.ID, req.Rating, req.Body)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Review not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update review: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(review)
+}
+
+// deleteReviewHandler deletes a review.
+func (s *Server) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	review, ok := s.authorizeReview(ctx, w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteReview(ctx, review.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete review: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
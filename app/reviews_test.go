@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestReviewRequestValidate verifies ratings must be 1 to 5 and bodies are trimmed and bounded
+func TestReviewRequestValidate(t *testing.T) {
+	req := ReviewRequest{Rating: 5, Body: "  Great  "}
+	if err := req.validate(); err != nil || req.Body != "Great" {
+		t.Errorf("validate = %v, body %q", err, req.Body)
+	}
+	for _, req := range []ReviewRequest{
+		{Rating: 0},
+		{Rating: 6},
+		{Rating: 3, Body: strings.Repeat("é", maxReviewLength+1)},
+	} {
+		if err := req.validate(); err == nil {
+			t.Errorf("rating %d with %d-byte body passed validation", req.Rating, len(req.Body))
+		}
+	}
+}
+
+// TestReviewHandlersReject verifies malformed review requests are rejected
+// before the database is used
+func TestReviewHandlersReject(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/products/{id}/reviews", s.createReviewHandler)
+	mux.HandleFunc("PUT /api/reviews/{id}", s.updateReviewHandler)
+	mux.HandleFunc("DELETE /api/reviews/{id}", s.deleteReviewHandler)
+	mux.HandleFunc("GET /api/products/{id}/reviews", s.reviewsHandler)
+	mux.HandleFunc("GET /api/reviews/{id}", s.reviewHandler)
+
+	for _, tt := range []struct {
+		method, path, body string
+		identified         bool
+		want               int
+	}{
+		{http.MethodPost, "/api/products/1/reviews", `{"rating": 5}`, false, http.StatusForbidden},
+		{http.MethodPut, "/api/reviews/1", `{"rating": 5}`, false, http.StatusForbidden},
+		{http.MethodDelete, "/api/reviews/1", "", false, http.StatusForbidden},
+		{http.MethodPost, "/api/products/x/reviews", `{"rating": 5}`, true, http.StatusBadRequest},
+		{http.MethodPost, "/api/products/1/reviews", `{"rating": 5, "login": "mallory@example.com"}`, true, http.StatusBadRequest},
+		{http.MethodPost, "/api/products/1/reviews", `{"rating": 9}`, true, http.StatusUnprocessableEntity},
+		{http.MethodPut, "/api/reviews/0", `{"rating": 5}`, true, http.StatusBadRequest},
+		{http.MethodGet, "/api/products/1/reviews?limit=501", "", false, http.StatusBadRequest},
+		{http.MethodGet, "/api/reviews/x", "", false, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.identified {
+			asServeUser(r, "alice@example.com")
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s %s = %d, want %d: %s", tt.method, tt.path, tt.body, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+// TestReviewHandlersSpoofedLogin verifies a tailnet peer cannot post, edit
+// or delete reviews as someone else by sending their login in the header
+func TestReviewHandlersSpoofedLogin(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/products/{id}/reviews", s.createReviewHandler)
+	mux.HandleFunc("PUT /api/reviews/{id}", s.updateReviewHandler)
+	mux.HandleFunc("DELETE /api/reviews/{id}", s.deleteReviewHandler)
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/api/products/1/reviews", strings.NewReader(`{"rating": 1}`)),
+		httptest.NewRequest(http.MethodPut, "/api/reviews/1", strings.NewReader(`{"rating": 1}`)),
+		httptest.NewRequest(http.MethodDelete, "/api/reviews/1", nil),
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, asSpoofedUser(r, "alice@example.com"))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s with a spoofed login = %d, want 403", r.Method, r.URL.Path, w.Code)
+		}
+	}
+}
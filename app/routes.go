@@ -0,0 +1,797 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// apiRoute describes one API endpoint. The route table drives both mux
+// registration and the generated OpenAPI document, so adding a handler here
+// is all it takes to have it documented.
+type apiRoute struct {
+	Method    string
+	Path      string
+	Summary   string
+	Handler   http.HandlerFunc
+	Params    []apiParam
+	Request   []apiBody
+	Responses []apiResponse
+
+	// Role is the role the route requires, if not the one routeRole
+	// derives from the method and path.
+	Role role
+
+	// TimeoutGroup is the group whose timeout bounds requests, if not
+	// timeoutAPI.
+	TimeoutGroup string
+}
+
+// apiParam documents a path or query parameter.
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string // JSON schema type
+	Description string
+}
+
+// apiBody documents a request or response payload. Body is a zero value of
+// the Go type that is encoded on the wire.
+type apiBody struct {
+	ContentType string
+	Body        interface{}
+}
+
+// apiResponse documents one response status.
+type apiResponse struct {
+	Status      int
+	Description string
+	Bodies      []apiBody
+}
+
+// jsonBody is shorthand for an application/json payload.
+func jsonBody(v interface{}) []apiBody {
+	return []apiBody{{ContentType: "application/json", Body: v}}
+}
+
+// errorResponse documents a JSON error response.
+func errorResponse(status int, description string) apiResponse {
+	return apiResponse{Status: status, Description: description, Bodies: jsonBody(apiError{})}
+}
+
+// apiError is the body of JSON error responses.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// productSchema documents the baseline product columns. Products are read
+// with SELECT * so additional columns are passed through as-is.
+type productSchema struct {
+	ID            int64   `json:"id"`
+	Name          string  `json:"name"`
+	Description   *string `json:"description"`
+	Price         string  `json:"price"`
+	StockQuantity *int64  `json:"stock_quantity"`
+	Category      *string `json:"category"`
+	CategoryID    *int64  `json:"category_id"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
+	DeletedAt     *string `json:"deleted_at"`
+	Version       int64   `json:"version"`
+}
+
+// routes returns the API route table.
+func (s *Server) routes() []apiRoute {
+	productID := apiParam{Name: "id", In: "path", Type: "integer", Description: "Product ID"}
+	ifNoneMatch := apiParam{Name: "If-None-Match", In: "header", Type: "string", Description: "ETag of a previous response, answered with 304 if nothing changed"}
+	notModified := apiResponse{Status: http.StatusNotModified, Description: "Unchanged since the If-None-Match ETag"}
+	fileNameParam := apiParam{Name: "name", In: "path", Type: "string", Description: "File name"}
+	reviewID := apiParam{Name: "id", In: "path", Type: "integer", Description: "Review ID"}
+	bodyTooLarge := errorResponse(http.StatusRequestEntityTooLarge, "Body exceeds MAX_BODY_BYTES or the endpoint's own limit")
+
+	return []apiRoute{
+		{
+			Method:  http.MethodGet,
+			Path:    "/health",
+			Summary: "Report database and Tailscale health, with latencies and uptime",
+			Handler: s.healthHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Health status", Bodies: jsonBody(HealthResponse{})},
+				{Status: http.StatusServiceUnavailable, Description: "A dependency HEALTH_STRICTNESS counts as critical is down", Bodies: jsonBody(HealthResponse{})},
+			},
+
+			TimeoutGroup: timeoutHealth,
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/version",
+			Summary:   "Report the running build: version, git commit, build time, Go and tailscale.com versions",
+			Handler:   s.versionHandler,
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "Build info", Bodies: jsonBody(BuildInfo{})}},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/livez",
+			Summary:   "Report that the process is up, for liveness probes; checks nothing else",
+			Handler:   s.liveHandler,
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "Alive", Bodies: jsonBody(LiveResponse{})}},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/readyz",
+			Summary: "Report whether the server is ready: the database answers with its migrations applied and, in tsnet mode, the node is up",
+			Handler: s.readyHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Ready", Bodies: jsonBody(HealthResponse{})},
+				{Status: http.StatusServiceUnavailable, Description: "Not ready, with the reason", Bodies: jsonBody(HealthResponse{})},
+			},
+
+			TimeoutGroup: timeoutHealth,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/status.json",
+			Summary: "Public, cacheable service status for uptime monitors, served from the last health check",
+			Handler: s.statusLimiter.limit(s.statusHandler),
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Service is up, or has not been checked yet", Bodies: jsonBody(PublicStatus{})},
+				{Status: http.StatusServiceUnavailable, Description: "Service is degraded", Bodies: jsonBody(PublicStatus{})},
+				errorResponse(http.StatusTooManyRequests, "Rate limit exceeded; see Retry-After"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/metrics",
+			Summary: "Prometheus metrics, including connection pool statistics and query durations",
+			Handler: s.metricsHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Metrics in the Prometheus text format", Bodies: []apiBody{{ContentType: "text/plain", Body: ""}}},
+			},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/api/user",
+			Summary:   "Identify the calling Tailscale user",
+			Handler:   s.userHandler,
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "Caller identity", Bodies: jsonBody(UserInfo{})}},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/user/picture",
+			Summary: "Get the caller's profile picture through a cache, or a generated identicon if there is none",
+			Handler: s.userPictureHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Profile picture or identicon", Bodies: []apiBody{{ContentType: "image/*", Body: ""}}},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products",
+			Summary: "List the newest products, optionally paginated; export.ndjson streams them all",
+			Handler: s.productsHandler,
+			Params: []apiParam{
+				{Name: "category", In: "query", Type: "string", Description: "Only products in the category with this name"},
+				{Name: "cursor", In: "query", Type: "string", Description: "Keyset pagination cursor; pass an empty value to start"},
+				{Name: "offset", In: "query", Type: "integer", Description: "Offset pagination start"},
+				{Name: "limit", In: "query", Type: "integer", Description: "Page size (max 500)"},
+				{Name: "fields", In: "query", Type: "string", Description: "Comma-separated product columns to return, e.g. id,name,price"},
+				{Name: "include_deleted", In: "query", Type: "boolean", Description: "List soft-deleted products too (admins only)"},
+				{Name: "Accept", In: "header", Type: "string", Description: "application/json (default), text/csv or application/xml"},
+				ifNoneMatch,
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Products, or a page envelope when pagination parameters are present (with next/prev/first in the Link header); CSV and XML list the products only", Bodies: []apiBody{
+					{ContentType: "application/json", Body: []productSchema{}},
+					{ContentType: "application/json", Body: ProductPage{}},
+					{ContentType: "text/csv", Body: ""},
+					{ContentType: "application/xml", Body: ""},
+				}},
+				notModified,
+				errorResponse(http.StatusBadRequest, "Invalid pagination parameters, fields or include_deleted"),
+				errorResponse(http.StatusForbidden, "include_deleted by a caller who is not an admin"),
+				errorResponse(http.StatusNotAcceptable, "Accept allows none of the supported formats"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products/stats",
+			Summary: "Product count, price range, newest product and per-category counts",
+			Handler: s.productStatsHandler,
+			Params:  []apiParam{ifNoneMatch},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Product statistics", Bodies: jsonBody(ProductStatsResponse{})},
+				notModified,
+			},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/api/categories",
+			Summary:   "List product categories with their product counts",
+			Handler:   s.categoriesHandler,
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "Categories by name", Bodies: jsonBody([]store.Category{})}},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products/export.csv",
+			Summary: "Export all products as CSV",
+			Handler: s.exportCSVHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "CSV file", Bodies: []apiBody{{ContentType: "text/csv", Body: ""}}},
+			},
+
+			TimeoutGroup: timeoutStream,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products/export.ndjson",
+			Summary: "Export all products as newline-delimited JSON, streamed as they are read",
+			Handler: s.exportNDJSONHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "One product object per line", Bodies: []apiBody{{ContentType: "application/x-ndjson", Body: ""}}},
+			},
+
+			TimeoutGroup: timeoutStream,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/products/import",
+			Summary: "Add products from CSV or NDJSON in one transaction, reporting every row that fails",
+			Handler: s.importProductsHandler,
+			Params: []apiParam{
+				{Name: "dry_run", In: "query", Type: "boolean", Description: "Check every row, including for name conflicts, without committing"},
+			},
+			Request: []apiBody{
+				{ContentType: "text/csv", Body: ""},
+				{ContentType: "application/x-ndjson", Body: ""},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Dry run that would import every row", Bodies: jsonBody(ImportResult{})},
+				{Status: http.StatusCreated, Description: "Every row imported", Bodies: jsonBody(ImportResult{})},
+				errorResponse(http.StatusBadRequest, "Malformed CSV header or dry_run"),
+				errorResponse(http.StatusRequestEntityTooLarge, "Body exceeds IMPORT_MAX_BYTES"),
+				errorResponse(http.StatusUnsupportedMediaType, "Body is not CSV or NDJSON"),
+				{Status: http.StatusUnprocessableEntity, Description: "Rows failed, with their errors; nothing was imported", Bodies: jsonBody(ImportResult{})},
+			},
+
+			TimeoutGroup: timeoutFiles,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products/stream",
+			Summary: "WebSocket feed of product insert, update and delete events",
+			Handler: s.productStreamHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusSwitchingProtocols, Description: "WebSocket established; each message is a product event", Bodies: jsonBody(productEvent{})},
+				errorResponse(http.StatusServiceUnavailable, "Live feed is not available"),
+			},
+
+			TimeoutGroup: timeoutStream,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products/{id}",
+			Summary: "Get a product",
+			Handler: s.productHandler,
+			Params:  []apiParam{productID, ifNoneMatch},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Product", Bodies: jsonBody(productSchema{})},
+				notModified,
+				errorResponse(http.StatusNotFound, "Product not found"),
+			},
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/api/products/{id}",
+			Summary: "Partially update a product, if it is unchanged since the client read it",
+			Handler: s.patchProductHandler,
+			Params: []apiParam{
+				productID,
+				{Name: "If-Match", In: "header", Type: "string", Description: "ETag of the product as last read, or * to update it regardless (required)"},
+			},
+			Request: []apiBody{
+				{ContentType: jsonPatchContentType, Body: []patchOperation{}},
+				{ContentType: mergePatchContentType, Body: productSchema{}},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Updated product, with its new ETag", Bodies: jsonBody(productSchema{})},
+				errorResponse(http.StatusNotFound, "Product not found"),
+				errorResponse(http.StatusConflict, "Test operation failed or name already exists"),
+				errorResponse(http.StatusPreconditionFailed, "Product changed since the If-Match ETag was read"),
+				bodyTooLarge,
+				errorResponse(http.StatusUnsupportedMediaType, "Unsupported patch content type"),
+				errorResponse(http.StatusUnprocessableEntity, "Patch could not be applied or failed validation"),
+				errorResponse(http.StatusPreconditionRequired, "No If-Match header"),
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/products/{id}/purchase",
+			Summary: "Buy units of a product, taking them out of stock atomically",
+			Handler: s.purchaseHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{productID},
+			Request: jsonBody(PurchaseRequest{}),
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Product with its remaining stock", Bodies: jsonBody(productSchema{})},
+				errorResponse(http.StatusBadRequest, "Malformed purchase"),
+				errorResponse(http.StatusNotFound, "Product not found"),
+				errorResponse(http.StatusConflict, "Not enough in stock"),
+				bodyTooLarge,
+				errorResponse(http.StatusUnprocessableEntity, "Invalid quantity"),
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/graphql",
+			Summary: "Execute a GraphQL query or mutation over products and the viewer identity",
+			Handler: s.graphqlHandler,
+			Role:    roleViewer,
+			Request: jsonBody(graphqlRequest{}),
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "GraphQL result", Bodies: jsonBody(graphqlResponse{})},
+				errorResponse(http.StatusBadRequest, "Malformed GraphQL request"),
+				bodyTooLarge,
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/events",
+			Summary: "Server-Sent Events stream of db_status, product and heartbeat events",
+			Handler: s.eventsHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Event stream; data payloads are JSON", Bodies: []apiBody{
+					{ContentType: "text/event-stream", Body: DBStatusEvent{}},
+					{ContentType: "text/event-stream", Body: productEvent{}},
+					{ContentType: "text/event-stream", Body: HeartbeatEvent{}},
+				}},
+			},
+
+			TimeoutGroup: timeoutStream,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/admin/index-report",
+			Summary: "Explain the products workload and suggest missing indexes",
+			Handler: s.indexReportHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Index advisor report", Bodies: jsonBody(IndexReport{})},
+				errorResponse(http.StatusInternalServerError, "Statistics or plans could not be read"),
+			},
+
+			TimeoutGroup: timeoutAnalysis,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/diag/derp",
+			Summary: "DERP map subset, home region and measured latencies to nearby regions (tsnet mode)",
+			Handler: s.derpHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "DERP diagnostics", Bodies: jsonBody(DERPDiagnostics{})},
+				errorResponse(http.StatusBadGateway, "Tailscale client error"),
+				errorResponse(http.StatusServiceUnavailable, "Not running in tsnet mode"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/diag/db-path",
+			Summary: "Whether database traffic crosses the tailnet directly or through DERP, with traced recent dials (DB_TSNET)",
+			Handler: s.dbPathHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Database path report", Bodies: jsonBody(DBPathReport{})},
+				errorResponse(http.StatusServiceUnavailable, "The database is not dialed over the tailnet"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/diagnostics",
+			Summary: "Time a database round trip, a ping to a tailnet peer and a DERP netcheck, for troubleshooting (admins only)",
+			Handler: s.diagnosticsHandler,
+			Params: []apiParam{
+				{Name: "peer", In: "query", Type: "string", Description: "Peer to ping: a MagicDNS name, host name or Tailscale IP (default DIAG_PING_PEER)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Each check's outcome and timing; status is degraded if one failed", Bodies: jsonBody(DiagnosticsReport{})},
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+			},
+
+			TimeoutGroup: timeoutAnalysis,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/orders",
+			Summary: "Order products at their current prices as the calling Tailscale user",
+			Handler: s.createOrderHandler,
+			Role:    roleViewer,
+			Request: jsonBody(OrderRequest{}),
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "Order placed", Bodies: jsonBody(store.Order{})},
+				errorResponse(http.StatusBadRequest, "Malformed order"),
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				bodyTooLarge,
+				errorResponse(http.StatusUnprocessableEntity, "Invalid items or unknown products"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/orders",
+			Summary: "List the calling Tailscale user's orders, newest first",
+			Handler: s.ordersHandler,
+			Params: []apiParam{
+				{Name: "limit", In: "query", Type: "integer", Description: "Maximum orders to return (max 500, default 50)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Orders", Bodies: jsonBody([]store.Order{})},
+				errorResponse(http.StatusBadRequest, "Invalid limit"),
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/orders/{id}",
+			Summary: "Get one of the calling Tailscale user's orders",
+			Handler: s.orderHandler,
+			Params:  []apiParam{{Name: "id", In: "path", Type: "integer", Description: "Order ID"}},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Order", Bodies: jsonBody(store.Order{})},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				errorResponse(http.StatusNotFound, "Order not found"),
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/products/{id}/favorite",
+			Summary: "Star a product for the calling Tailscale user; starring it again is not an error",
+			Handler: s.addFavoriteHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{productID},
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "Product starred", Bodies: jsonBody(FavoriteStatus{})},
+				{Status: http.StatusOK, Description: "Product was already starred", Bodies: jsonBody(FavoriteStatus{})},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				errorResponse(http.StatusNotFound, "Product not found"),
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/api/products/{id}/favorite",
+			Summary: "Unstar a product for the calling Tailscale user",
+			Handler: s.removeFavoriteHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{productID},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Product is not starred", Bodies: jsonBody(FavoriteStatus{})},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/favorites",
+			Summary: "List the calling Tailscale user's starred products, most recently starred first",
+			Handler: s.favoritesHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Starred products", Bodies: jsonBody([]productSchema{})},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/products/{id}/restore",
+			Summary: "Restore a soft-deleted product",
+			Handler: s.restoreProductHandler,
+			Params:  []apiParam{productID},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Restored product, or the product unchanged if it was not deleted", Bodies: jsonBody(productSchema{})},
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+				errorResponse(http.StatusNotFound, "Product not found"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products/{id}/history",
+			Summary: "List a product's price changes, newest first, with the Tailscale login that made each",
+			Handler: s.priceHistoryHandler,
+			Params: []apiParam{
+				productID,
+				{Name: "limit", In: "query", Type: "integer", Description: "Page size (max 500, default 50)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Price changes, ending with the price the product was created with", Bodies: jsonBody([]store.PriceChange{})},
+				errorResponse(http.StatusBadRequest, "Invalid product id or limit"),
+				errorResponse(http.StatusNotFound, "Product not found"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/products/{id}/reviews",
+			Summary: "List a product's reviews, newest first",
+			Handler: s.reviewsHandler,
+			Params: []apiParam{
+				productID,
+				{Name: "limit", In: "query", Type: "integer", Description: "Maximum reviews to return (max 500, default 50)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Reviews", Bodies: jsonBody([]store.Review{})},
+				errorResponse(http.StatusBadRequest, "Invalid product id or limit"),
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/products/{id}/reviews",
+			Summary: "Review a product as the calling Tailscale user, who may review each product once",
+			Handler: s.createReviewHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{productID},
+			Request: jsonBody(ReviewRequest{}),
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "Review created", Bodies: jsonBody(store.Review{})},
+				errorResponse(http.StatusBadRequest, "Body is not a JSON review"),
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				errorResponse(http.StatusNotFound, "Product not found"),
+				errorResponse(http.StatusConflict, "Caller has already reviewed the product"),
+				bodyTooLarge,
+				errorResponse(http.StatusUnprocessableEntity, "Rating or body out of range"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/reviews/{id}",
+			Summary: "Get a review",
+			Handler: s.reviewHandler,
+			Params:  []apiParam{reviewID},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Review", Bodies: jsonBody(store.Review{})},
+				errorResponse(http.StatusBadRequest, "Invalid review id"),
+				errorResponse(http.StatusNotFound, "Review not found"),
+			},
+		},
+		{
+			Method:  http.MethodPut,
+			Path:    "/api/reviews/{id}",
+			Summary: "Replace a review's rating and body; only its author or an admin may",
+			Handler: s.updateReviewHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{reviewID},
+			Request: jsonBody(ReviewRequest{}),
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Updated review", Bodies: jsonBody(store.Review{})},
+				errorResponse(http.StatusBadRequest, "Body is not a JSON review"),
+				errorResponse(http.StatusForbidden, "Caller is not the author or an admin"),
+				errorResponse(http.StatusNotFound, "Review not found"),
+				bodyTooLarge,
+				errorResponse(http.StatusUnprocessableEntity, "Rating or body out of range"),
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/api/reviews/{id}",
+			Summary: "Delete a review; only its author or an admin may",
+			Handler: s.deleteReviewHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{reviewID},
+			Responses: []apiResponse{
+				{Status: http.StatusNoContent, Description: "Review deleted"},
+				errorResponse(http.StatusForbidden, "Caller is not the author or an admin"),
+				errorResponse(http.StatusNotFound, "Review not found"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/preferences",
+			Summary: "Get the calling Tailscale user's UI preferences, created with the defaults on first use",
+			Handler: s.preferencesHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Preferences", Bodies: jsonBody(Preferences{})},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+			},
+		},
+		{
+			Method:  http.MethodPut,
+			Path:    "/api/preferences",
+			Summary: "Replace the calling Tailscale user's UI preferences; omitted fields take their defaults",
+			Handler: s.putPreferencesHandler,
+			Role:    roleViewer,
+			Request: jsonBody(Preferences{}),
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Saved preferences", Bodies: jsonBody(Preferences{})},
+				errorResponse(http.StatusBadRequest, "Body is not a preferences object"),
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				bodyTooLarge,
+				errorResponse(http.StatusUnprocessableEntity, "Preferences failed validation"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/files",
+			Summary: "List the files the calling Tailscale user dropped, newest first",
+			Handler: s.filesHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Files", Bodies: jsonBody([]store.File{})},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				errorResponse(http.StatusServiceUnavailable, "File drop is disabled"),
+			},
+		},
+		{
+			Method:  http.MethodPut,
+			Path:    "/api/files/{name}",
+			Summary: "Drop a file, stored under the calling Tailscale user and replacing any of the same name",
+			Handler: s.putFileHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{fileNameParam},
+			Request: []apiBody{{ContentType: "application/octet-stream", Body: ""}},
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "File stored", Bodies: jsonBody(store.File{})},
+				{Status: http.StatusOK, Description: "File replaced", Bodies: jsonBody(store.File{})},
+				errorResponse(http.StatusBadRequest, "Invalid file name"),
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				errorResponse(http.StatusRequestEntityTooLarge, "File exceeds FILES_MAX_MB"),
+				errorResponse(http.StatusServiceUnavailable, "File drop is disabled"),
+			},
+
+			TimeoutGroup: timeoutFiles,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/files/{name}",
+			Summary: "Download one of the calling Tailscale user's files",
+			Handler: s.getFileHandler,
+			Params:  []apiParam{fileNameParam},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "File contents, as an attachment", Bodies: []apiBody{{ContentType: "application/octet-stream", Body: ""}}},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				errorResponse(http.StatusNotFound, "File not found"),
+				errorResponse(http.StatusServiceUnavailable, "File drop is disabled"),
+			},
+
+			TimeoutGroup: timeoutFiles,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/api/files/{name}",
+			Summary: "Delete one of the calling Tailscale user's files",
+			Handler: s.deleteFileHandler,
+			Role:    roleViewer,
+			Params:  []apiParam{fileNameParam},
+			Responses: []apiResponse{
+				{Status: http.StatusNoContent, Description: "File deleted"},
+				errorResponse(http.StatusForbidden, "Caller has no Tailscale identity"),
+				errorResponse(http.StatusNotFound, "File not found"),
+				errorResponse(http.StatusServiceUnavailable, "File drop is disabled"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/audit",
+			Summary: "List audited API calls with the Tailscale identity that made them, newest first",
+			Handler: s.auditHandler,
+			Params: []apiParam{
+				{Name: "login", In: "query", Type: "string", Description: "Only calls made by this login"},
+				{Name: "before", In: "query", Type: "integer", Description: "Only entries older than this id, for paging"},
+				{Name: "limit", In: "query", Type: "integer", Description: "Page size (max 500, default 50)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Audit entries", Bodies: jsonBody(AuditPage{})},
+				errorResponse(http.StatusBadRequest, "Invalid query parameters"),
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+				errorResponse(http.StatusServiceUnavailable, "Audit log is disabled"),
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/api/admin/products/{id}",
+			Summary: "Soft-delete a product, leaving it out of listings until it is restored",
+			Handler: s.deleteProductHandler,
+			Params:  []apiParam{productID},
+			Responses: []apiResponse{
+				{Status: http.StatusNoContent, Description: "Product deleted"},
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+				errorResponse(http.StatusNotFound, "Product not found"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/admin/access-log/export",
+			Summary: "Download recent requests, with the caller's Tailscale login, for log analysis tools",
+			Handler: s.accessLogExportHandler,
+			Params: []apiParam{
+				{Name: "format", In: "query", Type: "string", Description: "w3c (W3C extended, the default) or clf (NCSA common)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Access log file", Bodies: []apiBody{{ContentType: "text/plain", Body: ""}}},
+				errorResponse(http.StatusBadRequest, "Unknown format"),
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+				errorResponse(http.StatusServiceUnavailable, "Access log is disabled"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/users",
+			Summary: "List the Tailscale logins that have used the app, with first and last seen times and request counts",
+			Handler: s.usersHandler,
+			Params: []apiParam{
+				{Name: "limit", In: "query", Type: "integer", Description: "Maximum users to return (max 1000, default 100)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Users, most recently seen first", Bodies: jsonBody([]store.User{})},
+				errorResponse(http.StatusBadRequest, "Invalid limit"),
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+				errorResponse(http.StatusServiceUnavailable, "User tracking is disabled"),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/admin/anomalies",
+			Summary: "List anomalies flagged in the access log: new admin identities, request spikes and quiet-hours access",
+			Handler: s.anomaliesHandler,
+			Params: []apiParam{
+				{Name: "limit", In: "query", Type: "integer", Description: "Maximum alerts to return (max 500, default 50)"},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Alerts, newest first", Bodies: jsonBody([]store.Alert{})},
+				errorResponse(http.StatusBadRequest, "Invalid limit"),
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+				errorResponse(http.StatusServiceUnavailable, "Anomaly detection is disabled"),
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/admin/rotate",
+			Summary: "Re-read the file-based secrets (DB_PASSWORD_FILE, BUDGET_WEBHOOK_URL_FILE) and swap them in without a restart",
+			Handler: s.rotateSecretsHandler,
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Secrets re-read, and whether each changed", Bodies: jsonBody(rotateResponse{})},
+				errorResponse(http.StatusForbidden, "Caller is not an admin"),
+				errorResponse(http.StatusInternalServerError, "A secret could not be read; none were rotated"),
+			},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/api/admin/features",
+			Summary:   "List optional subsystems and whether they are running",
+			Handler:   s.featuresHandler,
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "Subsystem status", Bodies: jsonBody([]featureStatus{})}},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/api/admin/shaping",
+			Summary:   "List latency and bandwidth shaping rules",
+			Handler:   s.listShapingHandler,
+			Responses: []apiResponse{{Status: http.StatusOK, Description: "Active shaping rules", Bodies: jsonBody([]shapingRule{})}},
+		},
+		{
+			Method:  http.MethodPut,
+			Path:    "/api/admin/shaping",
+			Summary: "Add or replace the shaping rule for a route",
+			Handler: s.putShapingHandler,
+			Request: jsonBody(shapingRule{}),
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Rule applied", Bodies: jsonBody(shapingRule{})},
+				errorResponse(http.StatusBadRequest, "Malformed rule"),
+				bodyTooLarge,
+				errorResponse(http.StatusUnprocessableEntity, "Unknown route or invalid values"),
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/api/admin/shaping",
+			Summary: "Remove the shaping rule for a route",
+			Handler: s.deleteShapingHandler,
+			Params: []apiParam{
+				{Name: "route", In: "query", Type: "string", Description: `Route pattern, e.g. "GET /api/products"`},
+			},
+			Responses: []apiResponse{
+				{Status: http.StatusNoContent, Description: "Rule removed"},
+				errorResponse(http.StatusNotFound, "No rule for the route"),
+			},
+		},
+	}
+}
+
+// registerRoutes adds every route in the table to mux, passing each handler
+// through wrap along with its pattern and route.
+func registerRoutes(mux *http.ServeMux, routes []apiRoute, wrap func(pattern string, rt apiRoute) http.HandlerFunc) {
+	for _, rt := range routes {
+		pattern := rt.Method + " " + rt.Path
+		mux.HandleFunc(pattern, wrap(pattern, rt))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fileSecret is a secret read from a file, such as a mounted Kubernetes or
+// Docker secret, so it can be rotated by replacing the file and calling
+// /api/admin/rotate rather than restarting.
+type fileSecret struct {
+	name string // the setting that names the file, for messages
+	path string
+
+	value atomic.Pointer[string]
+
+	mu       sync.Mutex
+	onChange []func()
+}
+
+// newFileSecret reads the secret in the file at path.
+func newFileSecret(name, path string) (*fileSecret, error) {
+	s := &fileSecret{name: name, path: path}
+	v, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	s.value.Store(&v)
+	return s, nil
+}
+
+// Get returns the current value.
+func (s *fileSecret) Get() string {
+	return *s.value.Load()
+}
+
+// read reads the file without changing the current value.
+func (s *fileSecret) read() (string, error) {
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", s.name, err)
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "" {
+		return "", fmt.Errorf("%s %s is empty", s.name, s.path)
+	}
+	return v, nil
+}
+
+// notify registers fn to run after the value changes.
+func (s *fileSecret) notify(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// fetchSecret returns the secret ref refers to, fetched from
+// SecretsProvider. setting names the *_SECRET setting in errors.
+func (c DBConfig) fetchSecret(setting, ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var v string
+	var err error
+	switch c.SecretsProvider {
+	case "aws":
+		var s *awsSecrets
+		if s, err = sharedAWSSecrets(ctx); err != nil {
+			return "", err
+		}
+		v, err = s.get(ctx, ref)
+	case "vault":
+		var vc *vaultClient
+		if vc, err = sharedVault(c.Vault); err != nil {
+			return "", err
+		}
+		v, err = vc.get(ctx, ref)
+	default:
+		return "", fmt.Errorf("%s needs SECRETS_PROVIDER to be aws or vault", setting)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", setting, err)
+	}
+	return v, nil
+}
+
+// secretSet holds the secrets that /api/admin/rotate re-reads.
+type secretSet struct {
+	mu      sync.Mutex // serializes rotations
+	secrets []*fileSecret
+}
+
+func (set *secretSet) add(s *fileSecret) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.secrets = append(set.secrets, s)
+}
+
+// rotatedSecret reports one secret's rotation.
+type rotatedSecret struct {
+	Name    string `json:"name"`
+	Changed bool   `json:"changed"`
+}
+
+// rotate re-reads every secret and, only if all of them could be read,
+// swaps in the new values. A bad file leaves every secret as it was rather
+// than rotating some of a set that has to match.
+func (set *secretSet) rotate() ([]rotatedSecret, error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	values := make([]string, len(set.secrets))
+	var errs []error
+	for i, s := range set.secrets {
+		v, err := s.read()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		values[i] = v
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	results := make([]rotatedSecret, len(set.secrets))
+	for i, s := range set.secrets {
+		old := s.value.Swap(&values[i])
+		results[i] = rotatedSecret{Name: s.name, Changed: *old != values[i]}
+	}
+	for i, s := range set.secrets {
+		if !results[i].Changed {
+			continue
+		}
+		s.mu.Lock()
+		onChange := s.onChange
+		s.mu.Unlock()
+		for _, fn := range onChange {
+			fn()
+		}
+	}
+	return results, nil
+}
+
+// rotateResponse is the body of a successful rotation.
+type rotateResponse struct {
+	Secrets []rotatedSecret `json:"secrets"`
+}
+
+// rotateSecretsHandler re-reads the file-based secrets and swaps them in.
+func (s *Server) rotateSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	results, err := s.secrets.rotate()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("No secrets were rotated: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(rotateResponse{Secrets: results})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSecretFile(t *testing.T, path, value string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSecretSetRotate verifies rotation re-reads every file secret, reports
+// which changed and keeps the old value if a read fails
+func TestSecretSetRotate(t *testing.T) {
+	dir := t.TempDir()
+	pwPath, hookPath := filepath.Join(dir, "password"), filepath.Join(dir, "webhook")
+	writeSecretFile(t, pwPath, "old-password")
+	writeSecretFile(t, hookPath, "https://hooks.example.com/old")
+
+	pw, err := newFileSecret("DB_PASSWORD_FILE", pwPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := newFileSecret("BUDGET_WEBHOOK_URL_FILE", hookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := 0
+	pw.notify(func() { changes++ })
+	set := &secretSet{}
+	set.add(pw)
+	set.add(hook)
+
+	// One unreadable file rotates nothing
+	writeSecretFile(t, pwPath, "new-password")
+	writeSecretFile(t, hookPath, "")
+	if _, err := set.rotate(); err == nil || !strings.Contains(err.Error(), "BUDGET_WEBHOOK_URL_FILE") {
+		t.Fatalf("rotate with an empty file: err = %v", err)
+	}
+	if pw.Get() != "old-password" || changes != 0 {
+		t.Errorf("failed rotation changed the password to %q (%d notifications)", pw.Get(), changes)
+	}
+
+	writeSecretFile(t, hookPath, "https://hooks.example.com/old")
+	results, err := set.rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rotatedSecret{{Name: "DB_PASSWORD_FILE", Changed: true}, {Name: "BUDGET_WEBHOOK_URL_FILE"}}
+	if len(results) != len(want) || results[0] != want[0] || results[1] != want[1] {
+		t.Errorf("rotate = %+v, want %+v", results, want)
+	}
+	if pw.Get() != "new-password" || changes != 1 {
+		t.Errorf("password = %q after %d notifications, want new-password after 1", pw.Get(), changes)
+	}
+
+	c := DBConfig{DBHost: "db", DBPassword: "unused", password: pw}
+	if !strings.Contains(c.connString(), "password=new-password") {
+		t.Errorf("connString does not use the rotated password: %s", c.connString())
+	}
+}
+
+// TestRotateSecretsHandler verifies /api/admin/rotate lists the secrets it re-read
+func TestRotateSecretsHandler(t *testing.T) {
+	s := &Server{secrets: &secretSet{}}
+	w := httptest.NewRecorder()
+	s.rotateSecretsHandler(w, httptest.NewRequest(http.MethodPost, "/api/admin/rotate", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp rotateResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Secrets == nil || len(resp.Secrets) != 0 {
+		t.Errorf("no secrets: got %+v (%v), want an empty list", resp, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "password")
+	writeSecretFile(t, path, "pw")
+	pw, err := newFileSecret("DB_PASSWORD_FILE", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.secrets.add(pw)
+	os.Remove(path)
+	w = httptest.NewRecorder()
+	s.rotateSecretsHandler(w, httptest.NewRequest(http.MethodPost, "/api/admin/rotate", nil))
+	if w.Code != http.StatusInternalServerError || pw.Get() != "pw" {
+		t.Errorf("missing file: status %d, password %q", w.Code, pw.Get())
+	}
+}
+
+// TestLoadAuthKeyFile verifies TS_AUTHKEY_FILE is read and trimmed into the auth key
+func TestLoadAuthKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authkey")
+	writeSecretFile(t, path, "  tskey-auth-abc123 ")
+
+	config := ServeCmd{TailscaleAuthKeyFile: path}
+	if err := config.loadAuthKeyFile(); err != nil {
+		t.Fatal(err)
+	}
+	if config.TailscaleAuthKey != "tskey-auth-abc123" {
+		t.Errorf("auth key %q", config.TailscaleAuthKey)
+	}
+
+	config = ServeCmd{TailscaleAuthKey: "tskey-env", TailscaleAuthKeyFile: path}
+	if err := config.loadAuthKeyFile(); err == nil {
+		t.Error("TS_AUTHKEY and TS_AUTHKEY_FILE together: expected an error")
+	}
+
+	writeSecretFile(t, path, "")
+	config = ServeCmd{TailscaleAuthKeyFile: path}
+	if err := config.loadAuthKeyFile(); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("empty file: %v", err)
+	}
+	config = ServeCmd{TailscaleAuthKeyFile: filepath.Join(t.TempDir(), "missing")}
+	if err := config.loadAuthKeyFile(); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// largeDatasetSize is how many generated products the large dataset adds on
+// top of the catalog, enough to exercise pagination and the index advisor.
+const largeDatasetSize = 1000
+
+// seedEpoch is the created_at of the first fixture; later fixtures are a
+// minute apart so ordering by created_at is stable.
+var seedEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SeedCmd loads deterministic fixture data, so tests and demos start from a
+// known set of products.
+type SeedCmd struct {
+	DBConfig `embed:""`
+
+	Dataset  string `enum:"small,large" default:"small" help:"Fixture dataset to load (small, large)"`
+	Truncate bool   `help:"Remove all existing products first, with their favorites, reviews and price history"`
+}
+
+// fixtureProduct is one seeded row.
+type fixtureProduct struct {
+	Name          string
+	Description   string
+	Price         float64
+	StockQuantity int
+	Category      string
+	CreatedAt     time.Time
+}
+
+// catalogFixtures are the initial SKUs from migration 001.
+var catalogFixtures = []fixtureProduct{
+	{Name: "Business VPN", Description: "Secure remote access for distributed teams", Price: 99.00, StockQuantity: 50, Category: "Networking"},
+	{Name: "Workload Connectivity", Description: "Secure service-to-service communication", Price: 149.00, StockQuantity: 75, Category: "Infrastructure"},
+	{Name: "Edge & IoT", Description: "Connect edge devices and IoT infrastructure", Price: 199.00, StockQuantity: 30, Category: "IoT"},
+	{Name: "Securing AI", Description: "Secure AI workloads and model training", Price: 299.00, StockQuantity: 20, Category: "AI/ML"},
+	{Name: "Homelab", Description: "Personal networking for hobbyists and tinkerers", Price: 0.00, StockQuantity: 200, Category: "Personal"},
+}
+
+// seedFixtures returns the products in dataset. The output is identical on
+// every call.
+func seedFixtures(dataset string) ([]fixtureProduct, error) {
+	var products []fixtureProduct
+	products = append(products, catalogFixtures...)
+
+	switch dataset {
+	case "small":
+	case "large":
+		// Fixed seed so every run generates the same products
+		rng := rand.New(rand.NewSource(1))
+		for i := 1; i <= largeDatasetSize; i++ {
+			category := catalogFixtures[rng.Intn(len(catalogFixtures))].Category
+			products = append(products, fixtureProduct{
+				Name:          fmt.Sprintf("Fixture Product %04d", i),
+				Description:   fmt.Sprintf("Generated %s fixture #%d", category, i),
+				Price:         float64(rng.Intn(50000)) / 100,
+				StockQuantity: rng.Intn(500),
+				Category:      category,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown dataset %q", dataset)
+	}
+
+	for i := range products {
+		products[i].CreatedAt = seedEpoch.Add(time.Duration(i) * time.Minute)
+	}
+	return products, nil
+}
+
+func (c *SeedCmd) Run() error {
+	products, err := seedFixtures(c.Dataset)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(c.DBConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The product migrations create the table (and are a no-op if it is
+	// already migrated)
+	if err := runMigrations(db); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := seedProducts(ctx, db, products, c.Truncate); err != nil {
+		return err
+	}
+	log.Printf("✅ Seeded %d products (%s dataset)", len(products), c.Dataset)
+	return nil
+}
+
+// seedProducts upserts products by name in a single transaction, optionally
+// emptying the table first.
+func seedProducts(ctx context.Context, db *sql.DB, products []fixtureProduct, truncate bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// CASCADE empties the tables referencing products too
+	if truncate {
+		if _, err := tx.ExecContext(ctx, `TRUNCATE products RESTART IDENTITY CASCADE`); err != nil {
+			return fmt.Errorf("failed to truncate products: %w", err)
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO products (name, description, price, stock_quantity, category, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			price = EXCLUDED.price,
+			stock_quantity = EXCLUDED.stock_quantity,
+			category = EXCLUDED.category,
+			created_at = EXCLUDED.created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range products {
+		if _, err := stmt.ExecContext(ctx, p.Name, p.Description, p.Price, p.StockQuantity, p.Category, p.CreatedAt); err != nil {
+			return fmt.Errorf("failed to seed %q: %w", p.Name, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSeedFixtures verifies each dataset size seeds its expected products
+func TestSeedFixtures(t *testing.T) {
+	small, err := seedFixtures("small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(small) != len(catalogFixtures) {
+		t.Errorf("small dataset has %d products, want %d", len(small), len(catalogFixtures))
+	}
+
+	large, err := seedFixtures("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(catalogFixtures) + largeDatasetSize; len(large) != want {
+		t.Errorf("large dataset has %d products, want %d", len(large), want)
+	}
+
+	names := map[string]bool{}
+	for i, p := range large {
+		if names[p.Name] {
+			t.Errorf("duplicate product name %q", p.Name)
+		}
+		names[p.Name] = true
+		if i > 0 && !p.CreatedAt.After(large[i-1].CreatedAt) {
+			t.Errorf("product %d created_at %v is not after the previous one", i, p.CreatedAt)
+		}
+	}
+
+	again, err := seedFixtures("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(large, again) {
+		t.Error("large dataset is not deterministic")
+	}
+
+	if _, err := seedFixtures("huge"); err == nil {
+		t.Error("seedFixtures accepted an unknown dataset")
+	}
+}
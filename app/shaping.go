@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shapingRule slows down one route so presenters can simulate a distant
+// database or a slow link, then show the effect of caching and batching.
+type shapingRule struct {
+	Route          string `json:"route"`
+	LatencyMS      int    `json:"latency_ms"`
+	JitterMS       int    `json:"jitter_ms,omitempty"`
+	BytesPerSecond int    `json:"bytes_per_second,omitempty"`
+}
+
+// shaper holds the active shaping rules keyed by route pattern, e.g.
+// "GET /api/products".
+type shaper struct {
+	mu    sync.RWMutex
+	rules map[string]shapingRule
+}
+
+func newShaper() *shaper {
+	return &shaper{rules: map[string]shapingRule{}}
+}
+
+func (sh *shaper) get(route string) (shapingRule, bool) {
+	if sh == nil {
+		return shapingRule{}, false
+	}
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	rule, ok := sh.rules[route]
+	return rule, ok
+}
+
+func (sh *shaper) set(rule shapingRule) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.rules[rule.Route] = rule
+}
+
+func (sh *shaper) remove(route string) bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	_, ok := sh.rules[route]
+	delete(sh.rules, route)
+	return ok
+}
+
+func (sh *shaper) list() []shapingRule {
+	rules := []shapingRule{}
+	if sh == nil {
+		return rules
+	}
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	for _, rule := range sh.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Route < rules[j].Route })
+	return rules
+}
+
+// shapeRoute wraps a route handler so it honors any shaping rule configured
+// for its pattern. Rules are looked up per request, so changes made through
+// the admin API apply immediately.
+func (s *Server) shapeRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := s.shaping.get(pattern)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		delay := time.Duration(rule.LatencyMS) * time.Millisecond
+		if rule.JitterMS > 0 {
+			delay += time.Duration(s.rand.Int63n(int64(rule.JitterMS)+1)) * time.Millisecond
+		}
+		if delay > 0 {
+			select {
+			case <-s.clock.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if rule.BytesPerSecond > 0 {
+			w = &throttledWriter{ResponseWriter: w, r: r, clock: s.clock, bytesPerSecond: rule.BytesPerSecond}
+		}
+		next(w, r)
+	}
+}
+
+// throttledWriter limits response throughput by writing in small chunks and
+// pausing between them.
+type throttledWriter struct {
+	http.ResponseWriter
+	r              *http.Request
+	clock          Clock
+	bytesPerSecond int
+}
+
+// throttleSlices is how many chunks a second of bandwidth is split into, so
+// clients see a steady trickle rather than one burst per second.
+const throttleSlices = 10
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	chunk := t.bytesPerSecond / throttleSlices
+	if chunk < 1 {
+		chunk = 1
+	}
+	pause := time.Duration(float64(chunk) / float64(t.bytesPerSecond) * float64(time.Second))
+
+	written := 0
+	for written < len(p) {
+		end := written + chunk
+		if end > len(p) {
+			end = len(p)
+		}
+		n, err := t.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if f, ok := t.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		select {
+		case <-t.clock.After(pause):
+		case <-t.r.Context().Done():
+			return written, t.r.Context().Err()
+		}
+	}
+	return written, nil
+}
+
+func (t *throttledWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSockets upgrade on throttled routes. Traffic on the
+// hijacked connection is not throttled.
+func (t *throttledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.ResponseWriter does not implement http.Hijacker")
+	}
+	return hj.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (t *throttledWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// shapeableRoutes returns the route patterns that may be shaped. Admin
+// routes are excluded so a bad rule can always be removed promptly.
+func (s *Server) shapeableRoutes() map[string]bool {
+	patterns := map[string]bool{}
+	for _, rt := range s.routes() {
+		if strings.HasPrefix(rt.Path, "/api/admin/") {
+			continue
+		}
+		patterns[rt.Method+" "+rt.Path] = true
+	}
+	return patterns
+}
+
+func (r shapingRule) validate(shapeable map[string]bool) error {
+	if !shapeable[r.Route] {
+		return fmt.Errorf("route %q is not a shapeable route pattern", r.Route)
+	}
+	if r.LatencyMS < 0 || r.JitterMS < 0 || r.BytesPerSecond < 0 {
+		return errors.New("latency_ms, jitter_ms and bytes_per_second must not be negative")
+	}
+	if r.LatencyMS+r.JitterMS > 60000 {
+		return errors.New("latency_ms plus jitter_ms must be at most 60000")
+	}
+	if r.LatencyMS == 0 && r.JitterMS == 0 && r.BytesPerSecond == 0 {
+		return errors.New("rule must set latency_ms, jitter_ms or bytes_per_second")
+	}
+	return nil
+}
+
+func (s *Server) listShapingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.shaping.list())
+}
+
+func (s *Server) putShapingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var rule shapingRule
+	if !s.readJSONBody(w, r, 0, &rule, "shaping rule") {
+		return
+	}
+
+	if err := rule.validate(s.shapeableRoutes()); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	s.shaping.set(rule)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (s *Server) deleteShapingHandler(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		http.Error(w, `{"error": "route query parameter is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if !s.shaping.remove(route) {
+		http.Error(w, `{"error": "No shaping rule for that route"}`, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// TestShapingRuleValidate verifies rules must target a known, non-admin route
+func TestShapingRuleValidate(t *testing.T) {
+	shapeable := (&Server{}).shapeableRoutes()
+
+	tests := []struct {
+		name    string
+		rule    shapingRule
+		wantErr bool
+	}{
+		{"latency", shapingRule{Route: "GET /api/products", LatencyMS: 300}, false},
+		{"bandwidth", shapingRule{Route: "GET /api/products/export.csv", BytesPerSecond: 1024}, false},
+		{"unknown route", shapingRule{Route: "GET /nope", LatencyMS: 300}, true},
+		{"admin route", shapingRule{Route: "PUT /api/admin/shaping", LatencyMS: 300}, true},
+		{"negative", shapingRule{Route: "GET /api/products", LatencyMS: -1}, true},
+		{"empty", shapingRule{Route: "GET /api/products"}, true},
+		{"too slow", shapingRule{Route: "GET /api/products", LatencyMS: 60000, JitterMS: 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.validate(shapeable)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestShapeRouteDelaysResponse verifies latency is applied using the injected clock
+func TestShapeRouteDelaysResponse(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &Server{clock: clock, rand: newLockedRand(1), shaping: newShaper()}
+	s.shaping.set(shapingRule{Route: "GET /api/products", LatencyMS: 250})
+
+	handler := s.shapeRoute("GET /api/products", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(rec, httptest.NewRequest("GET", "/api/products", nil))
+		close(done)
+	}()
+
+	waitForWaiters(t, clock, 1)
+	select {
+	case <-done:
+		t.Fatalf("Handler completed before the delay elapsed")
+	default:
+	}
+
+	clock.Advance(250 * time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Handler did not complete after the delay elapsed")
+	}
+	if rec.Body.String() != "ok" {
+		t.Errorf("Expected body %q, got %q", "ok", rec.Body.String())
+	}
+}
+
+// TestShapeRouteUnshapedPassesThrough verifies routes without a rule are not delayed
+func TestShapeRouteUnshapedPassesThrough(t *testing.T) {
+	s := &Server{clock: newFakeClock(time.Now()), shaping: newShaper()}
+	handler := s.shapeRoute("GET /api/user", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/api/user", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("Expected status %d, got %d", http.StatusTeapot, rec.Code)
+	}
+}
+
+// TestShapeRouteWebSocket verifies a bandwidth rule on the product stream
+// does not break the WebSocket upgrade
+func TestShapeRouteWebSocket(t *testing.T) {
+	s := &Server{clock: systemClock{}, feed: newTestFeed(), shaping: newShaper()}
+	s.shaping.set(shapingRule{Route: "GET /api/products/stream", BytesPerSecond: 1024})
+	srv := httptest.NewServer(s.shapeRoute("GET /api/products/stream", s.productStreamHandler))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Close(websocket.StatusNormalClosure, "")
+}
+
+// waitForWaiters blocks until n timers are pending on the fake clock.
+func waitForWaiters(t *testing.T, c *fakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		pending := len(c.waiters)
+		c.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d pending timers", n)
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// snapshotEndpoints are the responses saved each run: the API contract and
+// the product data the demo workflows change.
+var snapshotEndpoints = []struct{ Name, Path string }{
+	{"openapi", "/openapi.json"},
+	{"products", "/api/products"},
+	{"products-stats", "/api/products/stats"},
+	{"categories", "/api/categories"},
+}
+
+// snapshotManifest lists the endpoints saved in a run.
+type snapshotManifest struct {
+	Run       string    `json:"run"`
+	URL       string    `json:"url"`
+	Time      time.Time `json:"time"`
+	Endpoints []string  `json:"endpoints"`
+}
+
+// snapshotResponse is a saved, canonicalized response.
+type snapshotResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// SnapshotCmd saves API responses per CI run and compares runs, making the
+// demo a lightweight API regression harness.
+type SnapshotCmd struct {
+	Save SnapshotSaveCmd `cmd:"" help:"Save canonicalized responses of key endpoints from a running server"`
+	Diff SnapshotDiffCmd `cmd:"" help:"Compare two saved runs, exiting non-zero if they differ"`
+}
+
+// SnapshotSaveCmd saves one run.
+type SnapshotSaveCmd struct {
+	URL     string        `env:"SNAPSHOT_URL" default:"http://127.0.0.1:8080" help:"Server to snapshot"`
+	Out     string        `env:"SNAPSHOT_OUT" default:"snapshots" help:"Directory, or s3://bucket/prefix, runs are saved under"`
+	Name    string        `env:"SNAPSHOT_RUN" name:"run" help:"Run name (default: the UTC time, with GITHUB_RUN_ID when set)"`
+	Ignore  []string      `env:"SNAPSHOT_IGNORE" default:"created_at,updated_at" help:"JSON fields whose values change every run, masked before saving"`
+	Timeout time.Duration `default:"30s" help:"How long each request may take"`
+}
+
+// SnapshotDiffCmd compares two runs.
+type SnapshotDiffCmd struct {
+	Old string `arg:"" help:"Earlier run: its directory or s3://bucket/prefix/run"`
+	New string `arg:"" help:"Later run, as for old"`
+}
+
+var snapshotRunName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func (c *SnapshotSaveCmd) Run() error {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	run := c.Name
+	if run == "" {
+		run = now.Format("20060102T150405Z")
+		if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+			run += "-" + id
+		}
+	}
+	if !snapshotRunName.MatchString(run) {
+		return fmt.Errorf("run name %q may only contain letters, digits, dots, dashes and underscores", run)
+	}
+
+	store, err := openSnapshotStore(ctx, strings.TrimSuffix(c.Out, "/")+"/"+run)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+	manifest := snapshotManifest{Run: run, URL: c.URL, Time: now}
+	for _, ep := range snapshotEndpoints {
+		resp, err := fetchSnapshot(ctx, client, strings.TrimSuffix(c.URL, "/")+ep.Path, c.Ignore)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", ep.Name, err)
+		}
+		b, _ := json.MarshalIndent(resp, "", "  ")
+		if err := store.put(ctx, ep.Name+".json", append(b, '\n')); err != nil {
+			return fmt.Errorf("saving snapshot %s: %w", ep.Name, err)
+		}
+		manifest.Endpoints = append(manifest.Endpoints, ep.Name)
+	}
+
+	b, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := store.put(ctx, "manifest.json", append(b, '\n')); err != nil {
+		return fmt.Errorf("saving manifest: %w", err)
+	}
+	fmt.Printf("Saved %d snapshots of %s to %s\n", len(manifest.Endpoints), c.URL, store)
+	return nil
+}
+
+// errSnapshotsDiffer is returned by snapshot diff when the runs differ.
+var errSnapshotsDiffer = errors.New("snapshots differ")
+
+func (c *SnapshotDiffCmd) Run() error {
+	ctx := context.Background()
+	changed, err := diffSnapshotRuns(ctx, os.Stdout, c.Old, c.New)
+	if err != nil {
+		return err
+	}
+	if changed > 0 {
+		return fmt.Errorf("%w: %d endpoints changed", errSnapshotsDiffer, changed)
+	}
+	fmt.Println("No differences")
+	return nil
+}
+
+// fetchSnapshot requests url and canonicalizes the response: JSON with
+// sorted keys and the ignored fields masked, so only real changes differ.
+func fetchSnapshot(ctx context.Context, client *http.Client, url string, ignore []string) (*snapshotResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := canonicalJSON(b, ignore)
+	if err != nil {
+		return nil, fmt.Errorf("%s returned %s that is not JSON: %w", url, resp.Status, err)
+	}
+	return &snapshotResponse{Status: resp.StatusCode, Body: body}, nil
+}
+
+// canonicalJSON re-encodes b with sorted keys, replacing the values of
+// fields named in ignore.
+func canonicalJSON(b []byte, ignore []string) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	masked := map[string]bool{}
+	for _, f := range ignore {
+		masked[strings.TrimSpace(f)] = true
+	}
+	var mask func(v interface{}) interface{}
+	mask = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if masked[k] {
+					v[k] = "<ignored>"
+				} else {
+					v[k] = mask(child)
+				}
+			}
+		case []interface{}:
+			for i, child := range v {
+				v[i] = mask(child)
+			}
+		}
+		return v
+	}
+
+	// Maps encode with sorted keys
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(mask(v)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// diffSnapshotRuns writes the differences between two runs to w, returning
+// how many endpoints changed.
+func diffSnapshotRuns(ctx context.Context, w io.Writer, oldLoc, newLoc string) (int, error) {
+	oldStore, err := openSnapshotStore(ctx, oldLoc)
+	if err != nil {
+		return 0, err
+	}
+	newStore, err := openSnapshotStore(ctx, newLoc)
+	if err != nil {
+		return 0, err
+	}
+	oldManifest, err := readSnapshotManifest(ctx, oldStore)
+	if err != nil {
+		return 0, err
+	}
+	newManifest, err := readSnapshotManifest(ctx, newStore)
+	if err != nil {
+		return 0, err
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, n := range append(oldManifest.Endpoints, newManifest.Endpoints...) {
+		if !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+
+	changed := 0
+	for _, name := range names {
+		oldBody, oldErr := oldStore.get(ctx, name+".json")
+		newBody, newErr := newStore.get(ctx, name+".json")
+		switch {
+		case oldErr != nil && !errors.Is(oldErr, os.ErrNotExist):
+			return changed, oldErr
+		case newErr != nil && !errors.Is(newErr, os.ErrNotExist):
+			return changed, newErr
+		case oldErr != nil:
+			fmt.Fprintf(w, "=== %s: only in %s\n", name, newManifest.Run)
+			changed++
+		case newErr != nil:
+			fmt.Fprintf(w, "=== %s: only in %s\n", name, oldManifest.Run)
+			changed++
+		case !bytes.Equal(oldBody, newBody):
+			fmt.Fprintf(w, "=== %s: %s -> %s\n", name, oldManifest.Run, newManifest.Run)
+			writeLineDiff(w, strings.Split(string(oldBody), "\n"), strings.Split(string(newBody), "\n"))
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+func readSnapshotManifest(ctx context.Context, store snapshotStore) (*snapshotManifest, error) {
+	b, err := store.get(ctx, "manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("reading %s manifest: %w", store, err)
+	}
+	var m snapshotManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("reading %s manifest: %w", store, err)
+	}
+	return &m, nil
+}
+
+// diffContext is how many unchanged lines are shown around a change.
+const diffContext = 3
+
+// writeLineDiff writes the changes from a to b, with "-" and "+" prefixes
+// and diffContext lines of context around each hunk.
+func writeLineDiff(w io.Writer, a, b []string) {
+	// Only the middle, past the common prefix and suffix, needs the
+	// quadratic longest common subsequence
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	am, bm := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	lcs := make([][]int32, len(am)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(bm)+1)
+	}
+	for i := len(am) - 1; i >= 0; i-- {
+		for j := len(bm) - 1; j >= 0; j-- {
+			if am[i] == bm[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	for _, l := range a[:pre] {
+		lines = append(lines, line{' ', l})
+	}
+	i, j := 0, 0
+	for i < len(am) || j < len(bm) {
+		switch {
+		case i < len(am) && j < len(bm) && am[i] == bm[j]:
+			lines = append(lines, line{' ', am[i]})
+			i, j = i+1, j+1
+		case i < len(am) && (j == len(bm) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', am[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', bm[j]})
+			j++
+		}
+	}
+	for _, l := range a[len(a)-suf:] {
+		lines = append(lines, line{' ', l})
+	}
+
+	show := make([]bool, len(lines))
+	for k, l := range lines {
+		if l.op == ' ' {
+			continue
+		}
+		for c := max(0, k-diffContext); c <= min(len(lines)-1, k+diffContext); c++ {
+			show[c] = true
+		}
+	}
+	last := -1
+	for k, l := range lines {
+		if !show[k] {
+			continue
+		}
+		if last >= 0 && k > last+1 {
+			fmt.Fprintln(w, "...")
+		}
+		fmt.Fprintf(w, "%c %s\n", l.op, l.text)
+		last = k
+	}
+}
+
+// snapshotStore holds the files of one run.
+type snapshotStore interface {
+	put(ctx context.Context, name string, b []byte) error
+	// get returns an error wrapping os.ErrNotExist if name was not saved.
+	get(ctx context.Context, name string) ([]byte, error)
+	String() string
+}
+
+// openSnapshotStore opens the run at loc, a directory or s3://bucket/prefix.
+func openSnapshotStore(ctx context.Context, loc string) (snapshotStore, error) {
+	if rest, ok := strings.CutPrefix(loc, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("snapshot location %q has no bucket", loc)
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS configuration: %w", err)
+		}
+		if cfg.Region == "" {
+			return nil, errors.New("S3 snapshots need AWS_REGION to be set")
+		}
+		return &s3SnapshotStore{
+			bucket: bucket,
+			prefix: strings.Trim(prefix, "/"),
+			config: cfg,
+			signer: v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true }),
+			client: &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	}
+	return dirSnapshotStore(loc), nil
+}
+
+// dirSnapshotStore keeps a run in a local directory, such as one uploaded
+// as a CI artifact.
+type dirSnapshotStore string
+
+func (d dirSnapshotStore) put(ctx context.Context, name string, b []byte) error {
+	if err := os.MkdirAll(string(d), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(d), name), b, 0o644)
+}
+
+func (d dirSnapshotStore) get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), name))
+}
+
+func (d dirSnapshotStore) String() string { return string(d) }
+
+// s3SnapshotStore keeps a run under a prefix in an S3 bucket. Requests are
+// signed directly, as the run only needs whole-object puts and gets.
+type s3SnapshotStore struct {
+	bucket, prefix string
+	config         aws.Config
+	signer         *v4.Signer
+	client         *http.Client
+}
+
+func (s *s3SnapshotStore) do(ctx context.Context, method, name string, body []byte) (*http.Response, error) {
+	key := name
+	if s.prefix != "" {
+		key = s.prefix + "/" + name
+	}
+	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.config.Region, key)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	creds, err := s.config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving AWS credentials: %w", err)
+	}
+	if err := s.signer.SignHTTP(ctx, creds, req, payloadHash, "s3", s.config.Region, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.client.Do(req)
+}
+
+func (s *s3SnapshotStore) put(ctx context.Context, name string, b []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, name, b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3 PUT %s/%s: %s", s, name, resp.Status)
+	}
+	return nil
+}
+
+func (s *s3SnapshotStore) get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("S3 GET %s/%s: %w", s, name, os.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("S3 GET %s/%s: %s", s, name, resp.Status)
+	}
+}
+
+func (s *s3SnapshotStore) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
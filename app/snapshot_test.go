@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCanonicalJSON verifies snapshots sort keys, keep number formatting and blank ignored fields
+func TestCanonicalJSON(t *testing.T) {
+	got, err := canonicalJSON([]byte(`[{"name":"Widget","created_at":"2024-01-01T00:00:00Z","price":1.50,"id":1}]`), []string{"created_at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "created_at": "<ignored>",
+    "id": 1,
+    "name": "Widget",
+    "price": 1.50
+  }
+]`
+	if string(got) != want {
+		t.Errorf("canonicalJSON =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := canonicalJSON([]byte("<html>"), nil); err == nil {
+		t.Error("canonicalJSON accepted HTML")
+	}
+}
+
+// TestWriteLineDiff verifies the diff shows changed lines with a little context
+func TestWriteLineDiff(t *testing.T) {
+	a := strings.Split("a b c d e f g h i j k l m", " ")
+	b := strings.Split("a b X d e f g h i j k m n", " ")
+
+	var out strings.Builder
+	writeLineDiff(&out, a, b)
+	want := `  a
+  b
+- c
++ X
+  d
+  e
+  f
+...
+  i
+  j
+  k
+- l
+  m
++ n
+`
+	if out.String() != want {
+		t.Errorf("writeLineDiff =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+// TestSnapshotSaveAndDiff verifies a saved snapshot matches until a response changes
+func TestSnapshotSaveAndDiff(t *testing.T) {
+	price := "9.99"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/products":
+			w.Write([]byte(`[{"id":1,"name":"Widget","price":` + price + `,"created_at":"` + r.Header.Get("X-Now") + `"}]`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	save := func(run string) {
+		t.Helper()
+		if err := (&SnapshotSaveCmd{URL: srv.URL, Out: dir, Name: run, Ignore: []string{"created_at"}}).Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("one")
+	save("two")
+	price = "12.50"
+	save("three")
+
+	ctx := context.Background()
+	if n, err := diffSnapshotRuns(ctx, &strings.Builder{}, filepath.Join(dir, "one"), filepath.Join(dir, "two")); err != nil || n != 0 {
+		t.Errorf("diff of identical runs = %d, %v; want 0, nil", n, err)
+	}
+
+	var out strings.Builder
+	n, err := diffSnapshotRuns(ctx, &out, filepath.Join(dir, "two"), filepath.Join(dir, "three"))
+	if err != nil || n != 1 {
+		t.Fatalf("diff of changed runs = %d, %v; want 1, nil", n, err)
+	}
+	if !strings.Contains(out.String(), `-       "price": 9.99`) || !strings.Contains(out.String(), `+       "price": 12.50`) {
+		t.Errorf("diff does not show the price change:\n%s", out.String())
+	}
+
+	err = (&SnapshotDiffCmd{Old: filepath.Join(dir, "one"), New: filepath.Join(dir, "three")}).Run()
+	if !errors.Is(err, errSnapshotsDiffer) {
+		t.Errorf("snapshot diff = %v, want errSnapshotsDiffer", err)
+	}
+
+	if err := (&SnapshotSaveCmd{URL: srv.URL, Out: dir, Name: "../escape"}).Run(); err == nil {
+		t.Error("snapshot save accepted a run name with a path")
+	}
+}
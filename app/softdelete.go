@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// includeDeleted parses ?include_deleted=, which lists soft-deleted
+// products too and is only for admins. It writes a 400 or 403 and returns
+// ok false if the value is invalid or the caller is not an admin.
+func (s *Server) includeDeleted(w http.ResponseWriter, r *http.Request) (include, ok bool) {
+	v := r.URL.Query().Get("include_deleted")
+	if v == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		http.Error(w, `{"error": "include_deleted must be true or false"}`, http.StatusBadRequest)
+		return false, false
+	}
+	if include {
+		if admin, reasons := s.isAdmin(r); !admin {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("Listing deleted products requires %s (%s)", s.adminRequirement(), strings.Join(reasons, "; ")))
+			return false, false
+		}
+	}
+	return include, true
+}
+
+// restoreProductHandler undeletes a soft-deleted product.
+func (s *Server) restoreProductHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	raw, err := s.store.RestoreProduct(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error": "Product not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to restore product: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(normalizeProduct(raw))
+}
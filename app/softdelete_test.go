@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestIncludeDeleted verifies only admins may list deleted products with include_deleted
+func TestIncludeDeleted(t *testing.T) {
+	s := &Server{}
+	s.setLive(&liveConfig{adminLogins: loginSet([]string{"alice@example.com"})})
+
+	for _, tc := range []struct {
+		query, login string
+		include, ok  bool
+		status       int
+	}{
+		{"", "bob@example.com", false, true, http.StatusOK},
+		{"?include_deleted=false", "bob@example.com", false, true, http.StatusOK},
+		{"?include_deleted=true", "alice@example.com", true, true, http.StatusOK},
+		{"?include_deleted=true", "bob@example.com", false, false, http.StatusForbidden},
+		{"?include_deleted=maybe", "alice@example.com", false, false, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/products"+tc.query, nil)
+		asServeUser(r, tc.login)
+		w := httptest.NewRecorder()
+		include, ok := s.includeDeleted(w, r)
+		if include != tc.include || ok != tc.ok || w.Code != tc.status {
+			t.Errorf("%s as %s: include %v, ok %v, status %d; want %v, %v, %d", tc.query, tc.login, include, ok, w.Code, tc.include, tc.ok, tc.status)
+		}
+	}
+}
+
+// TestRestoreIsAdminRoute verifies restoring products is limited to admins
+func TestRestoreIsAdminRoute(t *testing.T) {
+	if !isAdminRoute("/api/products/{id}/restore") {
+		t.Error("restoring products is open to every caller")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// validTraceparent matches a W3C Trace Context traceparent header.
+var validTraceparent = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// sqlTags are the sqlcommenter tags of the API request a query is made for.
+type sqlTags struct {
+	route       string
+	requestID   string
+	traceparent string
+}
+
+type sqlTagsKey struct{}
+
+// comment renders t as a sqlcommenter comment: keys sorted, values
+// URL-encoded, so none can close the comment early.
+func (t sqlTags) comment() string {
+	var kv []string
+	for _, tag := range [][2]string{{"request_id", t.requestID}, {"route", t.route}, {"traceparent", t.traceparent}} {
+		if tag[1] != "" {
+			kv = append(kv, tag[0]+"='"+url.PathEscape(tag[1])+"'")
+		}
+	}
+	if len(kv) == 0 {
+		return ""
+	}
+	return "/*" + strings.Join(kv, ",") + "*/"
+}
+
+// commentRoute tags the queries the route pattern makes with its request,
+// for DB_SQL_COMMENTS. The request ID is returned in X-Request-ID, and set
+// on the request so a panic reports the same one.
+func (s *Server) commentRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	if !s.sqlComments {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
+		r.Header.Set(requestIDHeader, id)
+		w.Header().Set(requestIDHeader, id)
+
+		tags := sqlTags{route: pattern, requestID: id}
+		if tp := r.Header.Get("traceparent"); validTraceparent.MatchString(tp) {
+			tags.traceparent = tp
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), sqlTagsKey{}, tags)))
+	}
+}
+
+// annotateQuery appends the comment of the request in ctx to query. Each
+// commented query is unique, so it is sent with the describe-exec mode
+// rather than filling the per-connection prepared statement cache; that
+// costs it a round trip. Queries outside a request are unchanged.
+func annotateQuery(ctx context.Context, query string, args []driver.NamedValue) (string, []driver.NamedValue) {
+	tags, ok := ctx.Value(sqlTagsKey{}).(sqlTags)
+	if !ok {
+		return query, args
+	}
+	comment := tags.comment()
+	if comment == "" {
+		return query, args
+	}
+	query = strings.TrimRight(query, " \t\n;") + " " + comment
+	return query, append([]driver.NamedValue{{Value: pgx.QueryExecModeDescribeExec}}, args...)
+}
+
+// commentConnector opens connections that annotate queries with
+// annotateQuery.
+type commentConnector struct {
+	driver.Connector
+}
+
+func (c commentConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sc, ok := conn.(*stdlib.Conn); ok {
+		return &commentConn{Conn: sc}, nil
+	}
+	return conn, nil
+}
+
+// commentConn is a pgx connection whose queries, including those in
+// transactions, are annotated.
+type commentConn struct {
+	*stdlib.Conn
+}
+
+func (c *commentConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query, args = annotateQuery(ctx, query, args)
+	return c.Conn.QueryContext(ctx, query, args)
+}
+
+func (c *commentConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, args = annotateQuery(ctx, query, args)
+	return c.Conn.ExecContext(ctx, query, args)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TestSQLTagsComment verifies tags become an escaped sqlcommenter comment
+func TestSQLTagsComment(t *testing.T) {
+	tags := sqlTags{route: "GET /api/products/{id}", requestID: "abc-1", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	want := `/*request_id='abc-1',route='GET%20%2Fapi%2Fproducts%2F%7Bid%7D',traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/`
+	if got := tags.comment(); got != want {
+		t.Errorf("comment = %s, want %s", got, want)
+	}
+	if got := (sqlTags{route: "x'*/; DROP"}).comment(); got != `/*route='x%27%2A%2F%3B%20DROP'*/` {
+		t.Errorf("unescaped comment %s", got)
+	}
+	if got := (sqlTags{}).comment(); got != "" {
+		t.Errorf("empty tags comment %q", got)
+	}
+}
+
+// TestCommentRoute verifies requests carry their route and request ID for
+// query comments when enabled
+func TestCommentRoute(t *testing.T) {
+	var got sqlTags
+	next := func(w http.ResponseWriter, r *http.Request) {
+		got, _ = r.Context().Value(sqlTagsKey{}).(sqlTags)
+	}
+
+	w := httptest.NewRecorder()
+	(&Server{}).commentRoute("GET /api/products", next)(w, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	if got != (sqlTags{}) || w.Header().Get(requestIDHeader) != "" {
+		t.Errorf("disabled: tags %+v, request ID %q", got, w.Header().Get(requestIDHeader))
+	}
+
+	s := &Server{sqlComments: true}
+	r := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	r.Header.Set(requestIDHeader, "req-7")
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w = httptest.NewRecorder()
+	s.commentRoute("GET /api/products", next)(w, r)
+	if got.route != "GET /api/products" || got.requestID != "req-7" || got.traceparent == "" || w.Header().Get(requestIDHeader) != "req-7" {
+		t.Errorf("tags %+v, request ID %q", got, w.Header().Get(requestIDHeader))
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	r.Header.Set("traceparent", "not a traceparent")
+	w = httptest.NewRecorder()
+	s.commentRoute("GET /api/products", next)(w, r)
+	if got.requestID == "" || got.requestID != w.Header().Get(requestIDHeader) || got.requestID != r.Header.Get(requestIDHeader) || got.traceparent != "" {
+		t.Errorf("generated ID: tags %+v, response %q", got, w.Header().Get(requestIDHeader))
+	}
+}
+
+// TestAnnotateQuery verifies tagged queries get the comment appended, before any trailing semicolon
+func TestAnnotateQuery(t *testing.T) {
+	args := []driver.NamedValue{{Ordinal: 1, Value: int64(3)}}
+	if q, a := annotateQuery(context.Background(), "SELECT 1", args); q != "SELECT 1" || len(a) != 1 {
+		t.Errorf("untagged query rewritten: %q %v", q, a)
+	}
+
+	ctx := context.WithValue(context.Background(), sqlTagsKey{}, sqlTags{route: "DELETE /api/products/{id}", requestID: "r1"})
+	q, a := annotateQuery(ctx, "DELETE FROM products WHERE id = $1;\n", args)
+	if want := `DELETE FROM products WHERE id = $1 /*request_id='r1',route='DELETE%20%2Fapi%2Fproducts%2F%7Bid%7D'*/`; q != want {
+		t.Errorf("query = %q, want %q", q, want)
+	}
+	if len(a) != 2 || a[0].Value != pgx.QueryExecModeDescribeExec || a[1].Value != int64(3) {
+		t.Errorf("args = %v", a)
+	}
+	if name := queryName(q); name != "delete_products" {
+		t.Errorf("annotated query is named %q", name)
+	}
+}
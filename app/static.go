@@ -0,0 +1,23 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticFiles returns the UI assets: those in dir if it is set, so they can
+// be edited live during development, or the copies embedded in the binary.
+func staticFiles(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	sub, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		panic(err) // the directory is embedded at build time
+	}
+	return sub
+}
@@ -0,0 +1,133 @@
+// Escape text for interpolation into HTML; audit entries carry
+// caller-controlled paths
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text == null ? '' : String(text);
+    return div.innerHTML;
+}
+
+async function errorFrom(response) {
+    try {
+        const data = await response.json();
+        return data.error || response.statusText;
+    } catch {
+        return response.statusText;
+    }
+}
+
+function showError(div, message) {
+    div.innerHTML = `<div class="error-message"><strong>Error:</strong> ${escapeHtml(message)}</div>`;
+    div.classList.remove('loading');
+}
+
+// Fetch and display products, each with a delete button
+async function fetchAdminProducts() {
+    const div = document.getElementById('admin-products');
+    try {
+        const response = await fetch('/api/products');
+        if (!response.ok) {
+            showError(div, await errorFrom(response));
+            return;
+        }
+        const products = await response.json();
+        if (!products || products.length === 0) {
+            div.innerHTML = '<div class="no-data">No products found</div>';
+        } else {
+            div.innerHTML = `
+                <table class="admin-table">
+                    <thead><tr><th>ID</th><th>Name</th><th>Category</th><th>Price</th><th></th></tr></thead>
+                    <tbody>
+                        ${products.map(p => `
+                            <tr>
+                                <td>${escapeHtml(p.id)}</td>
+                                <td>${escapeHtml(p.name)}</td>
+                                <td>${escapeHtml(p.category || '')}</td>
+                                <td>$${parseFloat(p.price || 0).toFixed(2)}</td>
+                                <td><button class="admin-button admin-danger" data-id="${escapeHtml(p.id)}" data-name="${escapeHtml(p.name)}">Delete</button></td>
+                            </tr>
+                        `).join('')}
+                    </tbody>
+                </table>
+            `;
+            div.querySelectorAll('button[data-id]').forEach(button => {
+                button.addEventListener('click', () => deleteProduct(button.dataset.id, button.dataset.name));
+            });
+        }
+        div.classList.remove('loading');
+    } catch (error) {
+        showError(div, `Failed to load products. ${error.message}`);
+    }
+}
+
+async function deleteProduct(id, name) {
+    if (!confirm(`Delete ${name}?`)) {
+        return;
+    }
+    const response = await fetch(`/api/admin/products/${encodeURIComponent(id)}`, { method: 'DELETE' });
+    if (!response.ok) {
+        alert(`Failed to delete ${name}: ${await errorFrom(response)}`);
+        return;
+    }
+    fetchAdminProducts();
+    resetAudit();
+}
+
+let auditBefore = null;
+
+function resetAudit() {
+    auditBefore = null;
+    document.getElementById('admin-audit').innerHTML = '';
+    fetchAudit();
+}
+
+// Fetch a page of the audit log, appending it to what is shown
+async function fetchAudit() {
+    const div = document.getElementById('admin-audit');
+    const more = document.getElementById('audit-more');
+    try {
+        const response = await fetch(auditBefore ? `/api/audit?before=${auditBefore}` : '/api/audit');
+        if (!response.ok) {
+            showError(div, await errorFrom(response));
+            more.style.display = 'none';
+            return;
+        }
+        const page = await response.json();
+        const rows = page.entries.map(e => `
+            <tr>
+                <td>${escapeHtml(new Date(e.time).toLocaleString())}</td>
+                <td>${escapeHtml(e.login || e.node || '-')}</td>
+                <td>${escapeHtml(e.method)} ${escapeHtml(e.path)}</td>
+                <td>${escapeHtml(e.status)}</td>
+            </tr>
+        `).join('');
+
+        let tbody = div.querySelector('tbody');
+        if (!tbody) {
+            if (page.entries.length === 0) {
+                div.innerHTML = '<div class="no-data">No audited calls yet</div>';
+            } else {
+                div.innerHTML = `
+                    <table class="admin-table">
+                        <thead><tr><th>Time</th><th>Who</th><th>Request</th><th>Status</th></tr></thead>
+                        <tbody></tbody>
+                    </table>
+                `;
+                tbody = div.querySelector('tbody');
+            }
+        }
+        if (tbody) {
+            tbody.insertAdjacentHTML('beforeend', rows);
+        }
+        div.classList.remove('loading');
+
+        auditBefore = page.next_before || null;
+        more.style.display = auditBefore ? '' : 'none';
+    } catch (error) {
+        showError(div, `Failed to load the audit log. ${error.message}`);
+    }
+}
+
+document.getElementById('audit-more').addEventListener('click', fetchAudit);
+
+fetchAdminProducts();
+fetchAudit();
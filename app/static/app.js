@@ -3,35 +3,8 @@ async function fetchUserInfo() {
     try {
         const response = await fetch('/api/user');
         const data = await response.json();
-        
-        const userInfoDiv = document.getElementById('user-info');
-        
-        if (data.connected) {
-            userInfoDiv.innerHTML = `
-                <div class="user-profile">
-                    <div class="user-avatar">${data.first_initial || '?'}</div>
-                    <div class="user-details">
-                        <h3>${data.display_name || data.login_name || 'Unknown User'}</h3>
-                        <p>${data.login_name || 'No login information'}</p>
-                        <span class="badge badge-connected">✓ Connected via Tailscale</span>
-                    </div>
-                </div>
-            `;
-        } else {
-            userInfoDiv.innerHTML = `
-                <div class="user-profile">
-                    <div class="user-avatar">?</div>
-                    <div class="user-details">
-                        <h3>Not Connected</h3>
-                        <p>Connect via Tailscale to see your information</p>
-                        <span class="badge badge-disconnected">✗ Not Connected</span>
-                        ${data.error ? `<p class="error-message" style="margin-top: 10px;">${data.error}</p>` : ''}
-                    </div>
-                </div>
-            `;
-        }
-        
-        userInfoDiv.classList.remove('loading');
+        renderUserInfo(data);
+        return data;
     } catch (error) {
         console.error('Error fetching user info:', error);
         document.getElementById('user-info').innerHTML = `
@@ -43,10 +16,108 @@ async function fetchUserInfo() {
     }
 }
 
+// Display user information; the server renders the same markup into the page
+function renderUserInfo(data) {
+    const userInfoDiv = document.getElementById('user-info');
+    
+    if (data.guest) {
+        userInfoDiv.innerHTML = `
+            <div class="user-profile">
+                <div class="user-avatar">?</div>
+                <div class="user-details">
+                    <h3>Guest</h3>
+                    <p>Visiting from the public internet</p>
+                    <span class="badge badge-disconnected">Read-only access</span>
+                </div>
+            </div>
+        `;
+    } else if (data.connected) {
+        userInfoDiv.innerHTML = `
+            <div class="user-profile">
+                <div class="user-avatar"><img src="/api/user/picture" alt="${data.first_initial || '?'}"></div>
+                <div class="user-details">
+                    <h3>${data.display_name || data.login_name || 'Unknown User'}</h3>
+                    <p>${data.login_name || 'No login information'}</p>
+                    ${data.tailnet ? `<p class="user-tailnet">Tailnet: ${data.tailnet}</p>` : ''}
+                    <span class="badge badge-connected">✓ Connected via Tailscale</span>
+                </div>
+            </div>
+        `;
+    } else {
+        userInfoDiv.innerHTML = `
+            <div class="user-profile">
+                <div class="user-avatar">?</div>
+                <div class="user-details">
+                    <h3>Not Connected</h3>
+                    <p>Connect via Tailscale to see your information</p>
+                    <span class="badge badge-disconnected">✗ Not Connected</span>
+                    ${data.error ? `<p class="error-message" style="margin-top: 10px;">${data.error}</p>` : ''}
+                </div>
+            </div>
+        `;
+    }
+    
+    userInfoDiv.classList.remove('loading');
+}
+
+// IDs of the caller's starred products; null hides the star buttons, for
+// guests and callers without a Tailscale identity
+let favorites = null;
+
+// Load the caller's favorites
+async function fetchFavorites() {
+    try {
+        const response = await fetch('/api/favorites');
+        favorites = response.ok ? new Set((await response.json()).map(p => p.id)) : null;
+    } catch (error) {
+        console.error('Error fetching favorites:', error);
+        favorites = null;
+    }
+}
+
+// Star or unstar a product, updating its button in place
+async function toggleFavorite(button) {
+    const id = Number(button.dataset.productId);
+    const starred = favorites.has(id);
+    button.disabled = true;
+    try {
+        const response = await fetch(`/api/products/${id}/favorite`, { method: starred ? 'DELETE' : 'POST' });
+        if (!response.ok) {
+            throw new Error((await response.json()).error || response.statusText);
+        }
+        if (starred) {
+            favorites.delete(id);
+        } else {
+            favorites.add(id);
+        }
+        renderFavoriteButton(button, !starred);
+    } catch (error) {
+        console.error('Error updating favorite:', error);
+    } finally {
+        button.disabled = false;
+    }
+}
+
+function favoriteButton(id) {
+    if (favorites === null) {
+        return '';
+    }
+    const starred = favorites.has(id);
+    return `<button class="favorite-button${starred ? ' favorited' : ''}" data-product-id="${id}" aria-pressed="${starred}" title="${starred ? 'Remove from favorites' : 'Add to favorites'}">${starred ? '★' : '☆'}</button>`;
+}
+
+function renderFavoriteButton(button, starred) {
+    button.classList.toggle('favorited', starred);
+    button.setAttribute('aria-pressed', starred);
+    button.title = starred ? 'Remove from favorites' : 'Add to favorites';
+    button.textContent = starred ? '★' : '☆';
+}
+
 // Fetch and display products
 async function fetchProducts() {
     try {
-        const response = await fetch('/api/products');
+        const category = document.getElementById('category-filter').value;
+        const response = await fetch(category ? `/api/products?category=${encodeURIComponent(category)}` : '/api/products');
         const data = await response.json();
         
         const productsDiv = document.getElementById('products-info');
@@ -85,6 +156,7 @@ async function fetchProducts() {
                         <div class="product-header">
                             <h3>${product.name || 'Unnamed Product'}</h3>
                             ${categoryBadge}
+                            ${favoriteButton(product.id)}
                         </div>
                         <p>${product.description || 'No description available'}</p>
                         <div class="product-footer">
@@ -122,12 +194,84 @@ async function fetchProducts() {
     }
 }
 
+// Fill the category filter, keeping the current selection
+async function fetchCategories() {
+    try {
+        const response = await fetch('/api/categories');
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+
+        const select = document.getElementById('category-filter');
+        const selected = select.value;
+        select.innerHTML = '<option value="">All categories</option>' + data.map(c =>
+            `<option value="${c.name}">${c.name} (${c.product_count})</option>`
+        ).join('');
+        select.value = data.some(c => c.name === selected) ? selected : '';
+    } catch (error) {
+        console.error('Error fetching categories:', error);
+    }
+}
+
+// Fetch and display the catalog summary
+async function fetchStats() {
+    try {
+        const response = await fetch('/api/products/stats');
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+
+        const statsDiv = document.getElementById('stats-info');
+        const money = (value) => value === null ? '—' : `$${value.toFixed(2)}`;
+
+        const categoryBadges = data.categories.map(c =>
+            `<span class="category-badge">${c.category || 'Uncategorized'}: ${c.count}</span>`
+        ).join(' ');
+
+        statsDiv.innerHTML = `
+            <div class="health-status">
+                <div class="health-item">
+                    <h3>Products</h3>
+                    <div class="health-value">${data.count}</div>
+                </div>
+                <div class="health-item">
+                    <h3>Price Range</h3>
+                    <div class="health-value">${money(data.min_price)} – ${money(data.max_price)}</div>
+                </div>
+                <div class="health-item">
+                    <h3>Average Price</h3>
+                    <div class="health-value">${money(data.avg_price)}</div>
+                </div>
+                <div class="health-item">
+                    <h3>Newest</h3>
+                    <div class="health-value">${data.newest ? data.newest.name : '—'}</div>
+                </div>
+            </div>
+            ${categoryBadges ? `<div class="stats-categories">${categoryBadges}</div>` : ''}
+        `;
+
+        statsDiv.classList.remove('loading');
+    } catch (error) {
+        console.error('Error fetching stats:', error);
+        document.getElementById('stats-info').innerHTML = `
+            <div class="error-message">
+                <strong>Error:</strong> Failed to load catalog summary. ${error.message}
+            </div>
+        `;
+        document.getElementById('stats-info').classList.remove('loading');
+    }
+}
+
 // Fetch and display health status
 async function fetchHealth() {
     try {
         const response = await fetch('/health');
         const data = await response.json();
         
+        document.getElementById('read-only-banner').style.display = data.read_only ? 'block' : 'none';
+
         const healthDiv = document.getElementById('health-info');
         
         const getStatusClass = (status) => {
@@ -171,16 +315,75 @@ async function fetchHealth() {
     }
 }
 
+// Subscribe to the live product feed and refresh the list on every change
+function subscribeProductFeed() {
+    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    const socket = new WebSocket(`${protocol}//${window.location.host}/api/products/stream`);
+
+    socket.addEventListener('message', () => {
+        fetchProducts();
+        fetchStats();
+        fetchCategories();
+    });
+
+    // Reconnect after a pause if the feed drops (server restart, network blip)
+    socket.addEventListener('close', () => {
+        setTimeout(subscribeProductFeed, 5000);
+    });
+}
+
+// Refresh the health panel as soon as the database status changes.
+// EventSource reconnects on its own if the stream drops.
+function subscribeEvents() {
+    const events = new EventSource('/api/events');
+    events.addEventListener('db_status', () => {
+        fetchHealth();
+    });
+}
+
+// Public Funnel visitors only get the product list
+function enterGuestMode() {
+    document.getElementById('guest-banner').style.display = 'block';
+    document.querySelector('.health-card').style.display = 'none';
+
+    setInterval(() => {
+        fetchProducts();
+        fetchStats();
+        fetchCategories();
+    }, 30000);
+}
+
 // Initialize the app
-document.addEventListener('DOMContentLoaded', () => {
-    fetchUserInfo();
+document.addEventListener('DOMContentLoaded', async () => {
+    document.getElementById('category-filter').addEventListener('change', fetchProducts);
+    document.getElementById('products-info').addEventListener('click', (event) => {
+        const button = event.target.closest('.favorite-button');
+        if (button) {
+            toggleFavorite(button);
+        }
+    });
     fetchProducts();
+    fetchStats();
+    fetchCategories();
+    const user = window.initialUser || await fetchUserInfo();
+    if (user && user.guest) {
+        enterGuestMode();
+        return;
+    }
+
+    if (user && user.connected) {
+        fetchFavorites().then(fetchProducts);
+    }
     fetchHealth();
+    subscribeProductFeed();
+    subscribeEvents();
     
     // Refresh data every 30 seconds
     setInterval(() => {
         fetchUserInfo();
         fetchProducts();
+        fetchStats();
+        fetchCategories();
         fetchHealth();
     }, 30000);
 });
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStaticFilesEmbedded verifies the UI files are embedded in the binary
+func TestStaticFilesEmbedded(t *testing.T) {
+	for _, name := range []string{"index.html", "admin.html", "app.js", "admin.js", "style.css"} {
+		if _, err := fs.Stat(staticFiles(""), name); err != nil {
+			t.Errorf("%s is not embedded: %v", name, err)
+		}
+	}
+}
+
+// TestStaticDirOverride verifies STATIC_DIR is served instead of the embedded files
+func TestStaticDirOverride(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>live edit</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{static: staticFiles(dir)}
+	h := s.handler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "live edit") {
+		t.Errorf("GET / = %d %q, want the index.html from the static dir", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /static/app.js = %d, want 404 as the static dir has no app.js", w.Code)
+	}
+}
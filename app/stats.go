@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// productStatsTTL is how long computed product statistics are reused.
+const productStatsTTL = 30 * time.Second
+
+// ProductStatsResponse is the /api/products/stats body.
+type ProductStatsResponse struct {
+	store.ProductStats
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// productStats returns recent product statistics, computing them if the
+// cached ones are stale or were invalidated by a write.
+func (s *Server) productStats(ctx context.Context) (*ProductStatsResponse, error) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	if s.stats != nil && s.clock.Now().Sub(s.stats.ComputedAt) < productStatsTTL {
+		return s.stats, nil
+	}
+
+	stats, err := s.store.ProductStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.stats = &ProductStatsResponse{ProductStats: *stats, ComputedAt: s.clock.Now()}
+	return s.stats, nil
+}
+
+// invalidateProductStats drops cached statistics after a product write.
+func (s *Server) invalidateProductStats() {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.stats = nil
+}
+
+// productStatsHandler serves aggregate product statistics for the UI's
+// summary card. They are computed at most every productStatsTTL, and the
+// ETag leaves out ComputedAt, so dashboards polling with If-None-Match get
+// a 304 until the statistics change.
+func (s *Server) productStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	stats, err := s.productStats(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query database: %v", err))
+		return
+	}
+	data, err := json.Marshal(stats.ProductStats)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	body, err := json.Marshal(stats)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeWithETag(w, r, append(body, '\n'), bodyETag(data))
+}
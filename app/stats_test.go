@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestProductStatsCache verifies cached statistics are reused until they
+// expire or a write invalidates them. The server has no database, so a
+// cache miss would panic.
+func TestProductStatsCache(t *testing.T) {
+	clock := newFakeClock(time.Unix(0, 0))
+	cached := &ProductStatsResponse{ComputedAt: clock.Now()}
+	s := &Server{clock: clock, stats: cached}
+
+	clock.Advance(productStatsTTL - time.Second)
+	got, err := s.productStats(context.Background())
+	if err != nil || got != cached {
+		t.Fatalf("productStats = %v, %v; want the cached statistics", got, err)
+	}
+
+	s.invalidateProductStats()
+	if s.stats != nil {
+		t.Error("statistics still cached after invalidation")
+	}
+}
+
+// TestProductStatsHandlerNotModified verifies polling with the ETag of
+// unchanged statistics gets a 304, even once they are recomputed.
+func TestProductStatsHandlerNotModified(t *testing.T) {
+	clock := newFakeClock(time.Unix(0, 0))
+	s := &Server{clock: clock, stats: &ProductStatsResponse{ComputedAt: clock.Now()}}
+
+	w := httptest.NewRecorder()
+	s.productStatsHandler(w, httptest.NewRequest(http.MethodGet, "/api/products/stats", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d, ETag %q", w.Code, etag)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/products/stats", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	s.productStatsHandler(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status with matching If-None-Match = %d, want 304", w.Code)
+	}
+
+	clock.Advance(productStatsTTL)
+	s.stats = &ProductStatsResponse{ComputedAt: clock.Now()}
+	w = httptest.NewRecorder()
+	s.productStatsHandler(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status after recomputing = %d, want 304", w.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// statusMaxAge is how long monitors and caches may reuse /status.json.
+	statusMaxAge = 10 * time.Second
+
+	// statusRate and statusBurst limit /status.json requests per client.
+	statusRate  = 1
+	statusBurst = 10
+)
+
+// PublicStatus is the /status.json body. It deliberately carries nothing
+// beyond overall health, as it is served to the public internet.
+type PublicStatus struct {
+	Status    string     `json:"status"` // "ok", "degraded" or "unknown"
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// healthSnapshot is the result of the last /health check.
+type healthSnapshot struct {
+	database string
+	at       time.Time
+}
+
+// recordHealth keeps the result of a health check for /status.json.
+func (s *Server) recordHealth(h HealthResponse) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.lastHealth = &healthSnapshot{database: h.Database, at: s.clock.Now()}
+}
+
+// publicStatus summarizes the newest of the last health check and the last
+// database monitor ping, without touching the database itself.
+func (s *Server) publicStatus() PublicStatus {
+	var snap healthSnapshot
+	s.healthMu.Lock()
+	if s.lastHealth != nil {
+		snap = *s.lastHealth
+	}
+	s.healthMu.Unlock()
+
+	if s.dbMonitor != nil {
+		ev := s.dbMonitor.status()
+		if t, err := time.Parse(time.RFC3339, ev.Time); err == nil && t.After(snap.at) {
+			snap = healthSnapshot{database: ev.Database, at: t}
+		}
+	}
+
+	if snap.at.IsZero() {
+		return PublicStatus{Status: "unknown"}
+	}
+	status := PublicStatus{Status: "ok", CheckedAt: &snap.at}
+	if snap.database != "connected" {
+		status.Status = "degraded"
+	}
+	return status
+}
+
+// statusHandler serves /status.json for external uptime monitors. Healthy
+// responses are cacheable and support If-Modified-Since; a degraded service
+// answers 503 so monitors need not parse the body.
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	status := s.publicStatus()
+	body, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to encode status"}`, http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status == "degraded" {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(statusMaxAge.Seconds())))
+	var modtime time.Time
+	if status.CheckedAt != nil {
+		modtime = *status.CheckedAt
+	}
+	http.ServeContent(w, r, "", modtime, bytes.NewReader(body))
+}
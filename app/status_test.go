@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStatusHandler verifies /status.json reports the last health check and
+// answers If-Modified-Since
+func TestStatusHandler(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	s := &Server{clock: clock}
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/status.json", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		s.statusHandler(w, r)
+		return w
+	}
+
+	// Before any health check the status is unknown
+	var got PublicStatus
+	if err := json.Unmarshal(get(nil).Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "unknown" || got.CheckedAt != nil {
+		t.Errorf("status before any check = %+v", got)
+	}
+
+	s.recordHealth(HealthResponse{Status: "ok", Database: "connected"})
+	w := get(nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "ok" || got.CheckedAt == nil || !got.CheckedAt.Equal(clock.Now()) {
+		t.Errorf("status = %+v", got)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=10" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+
+	lastModified := w.Header().Get("Last-Modified")
+	if w := get(http.Header{"If-Modified-Since": {lastModified}}); w.Code != http.StatusNotModified {
+		t.Errorf("conditional request = %d, want 304", w.Code)
+	}
+
+	clock.Advance(time.Minute)
+	s.recordHealth(HealthResponse{Status: "ok", Database: "disconnected"})
+	w = get(http.Header{"If-Modified-Since": {lastModified}})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("degraded status = %d, want 503", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "degraded" {
+		t.Errorf("status = %q, want degraded", got.Status)
+	}
+}
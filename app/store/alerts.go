@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Alert is an anomaly flagged in the access log.
+type Alert struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Subject string    `json:"subject,omitempty"`
+	Detail  string    `json:"detail"`
+}
+
+// RecordAlert stores a. Its ID is ignored.
+func (s *Store) RecordAlert(ctx context.Context, a Alert) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO alerts (created_at, kind, subject, detail)
+		VALUES ($1, $2, NULLIF($3, ''), $4)`,
+		a.Time, a.Kind, a.Subject, a.Detail)
+	return err
+}
+
+// Alerts returns up to limit alerts, newest first.
+func (s *Store) Alerts(ctx context.Context, limit int) ([]Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, created_at, kind, coalesce(subject, ''), detail
+		FROM alerts
+		ORDER BY id DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.Time, &a.Kind, &a.Subject, &a.Detail); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
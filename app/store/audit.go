@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one recorded API call.
+type AuditEntry struct {
+	ID      int64           `json:"id"`
+	Time    time.Time       `json:"time"`
+	Login   string          `json:"login,omitempty"`
+	Node    string          `json:"node,omitempty"`
+	Method  string          `json:"method"`
+	Route   string          `json:"route"`
+	Path    string          `json:"path"`
+	Status  int             `json:"status"`
+	Summary json.RawMessage `json:"summary,omitempty"`
+}
+
+// AuditFilter selects audit entries, newest first.
+type AuditFilter struct {
+	Login  string // only entries by this login, if set
+	Before int64  // only entries with a lower ID, if set
+	Limit  int
+}
+
+// RecordAudit appends e to the audit log. Its ID is ignored.
+func (s *Store) RecordAudit(ctx context.Context, e AuditEntry) error {
+	var summary interface{}
+	if len(e.Summary) > 0 {
+		summary = string(e.Summary)
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit_log (created_at, login, node, method, route, path, status, summary)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, $8)`,
+		e.Time, e.Login, e.Node, e.Method, e.Route, e.Path, e.Status, summary)
+	return err
+}
+
+// AuditLog returns the audit entries matching f.
+func (s *Store) AuditLog(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, created_at, coalesce(login, ''), coalesce(node, ''), method, route, path, status, summary
+		FROM audit_log
+		WHERE ($1::text = '' OR login = $1) AND ($2::bigint = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3`, f.Login, f.Before, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var (
+			e       AuditEntry
+			summary sql.NullString
+		)
+		if err := rows.Scan(&e.ID, &e.Time, &e.Login, &e.Node, &e.Method, &e.Route, &e.Path, &e.Status, &summary); err != nil {
+			return nil, err
+		}
+		if summary.Valid {
+			e.Summary = json.RawMessage(summary.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
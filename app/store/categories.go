@@ -0,0 +1,42 @@
+package store
+
+import "context"
+
+// Category is a product category and how many products are in it.
+type Category struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	ProductCount int64  `json:"product_count"`
+}
+
+// Categories returns every category by name with its count of products
+// that are not deleted, preferring the replica.
+func (s *Store) Categories(ctx context.Context) ([]Category, error) {
+	categories := []Category{}
+	err := s.Read(ctx, func(q Queryer) error {
+		rows, err := q.QueryContext(ctx, `
+			SELECT c.id, c.name, count(p.id)
+			FROM categories c
+			LEFT JOIN products p ON p.category_id = c.id AND p.deleted_at IS NULL
+			GROUP BY c.id
+			ORDER BY c.name`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		categories = categories[:0]
+		for rows.Next() {
+			var c Category
+			if err := rows.Scan(&c.ID, &c.Name, &c.ProductCount); err != nil {
+				return err
+			}
+			categories = append(categories, c)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
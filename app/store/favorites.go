@@ -0,0 +1,45 @@
+package store
+
+import "context"
+
+// AddFavorite stars product id for login, reporting whether it was not
+// already starred. It returns ErrNotFound if there is no such product or it
+// is deleted.
+func (s *Store) AddFavorite(ctx context.Context, login string, id int64) (bool, error) {
+	var exists, added bool
+	err := s.db.QueryRowContext(ctx, `
+		WITH product AS (
+			SELECT id FROM products WHERE id = $2 AND deleted_at IS NULL
+		), added AS (
+			INSERT INTO favorites (login, product_id)
+			SELECT $1, id FROM product
+			ON CONFLICT (login, product_id) DO NOTHING
+			RETURNING 1
+		)
+		SELECT EXISTS (SELECT 1 FROM product), EXISTS (SELECT 1 FROM added)`,
+		login, id).Scan(&exists, &added)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, ErrNotFound
+	}
+	return added, nil
+}
+
+// RemoveFavorite unstars product id for login. Removing a favorite that
+// does not exist is not an error.
+func (s *Store) RemoveFavorite(ctx context.Context, login string, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM favorites WHERE login = $1 AND product_id = $2`, login, id)
+	return err
+}
+
+// Favorites returns the products login has starred, most recently starred
+// first. Deleted products are left out until they are restored.
+func (s *Store) Favorites(ctx context.Context, login string) ([]Row, error) {
+	return QueryAll(ctx, s.db, `
+		SELECT p.* FROM favorites f
+		JOIN products p ON p.id = f.product_id
+		WHERE f.login = $1 AND p.deleted_at IS NULL
+		ORDER BY f.created_at DESC, p.id`, login)
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// File is a file a user dropped. Its contents are kept in blob storage
+// under StorageKey.
+type File struct {
+	ID          int64     `json:"id"`
+	Login       string    `json:"-"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	StorageKey  string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const fileColumns = `id, login, name, content_type, size, sha256, storage_key, created_at`
+
+func scanFile(row interface{ Scan(...interface{}) error }) (*File, error) {
+	var f File
+	err := row.Scan(&f.ID, &f.Login, &f.Name, &f.ContentType, &f.Size, &f.SHA256, &f.StorageKey, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// PutFile records f, replacing any file of the same login and name, and
+// returns the stored file and the storage key of the one it replaced ("" if
+// none) so its contents can be removed.
+func (s *Store) PutFile(ctx context.Context, f File) (*File, string, error) {
+	var (
+		stored   *File
+		replaced string
+	)
+	err := s.InTx(ctx, func(tx *Tx) error {
+		for {
+			// Inserting first claims the name, so a concurrent upload of the
+			// same name waits for this one and then replaces it below; a
+			// SELECT ... FOR UPDATE finds no row to lock while neither exists
+			var err error
+			stored, err = scanFile(tx.QueryRowContext(ctx, `
+				INSERT INTO files (login, name, content_type, size, sha256, storage_key)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (login, name) DO NOTHING
+				RETURNING `+fileColumns,
+				f.Login, f.Name, f.ContentType, f.Size, f.SHA256, f.StorageKey))
+			if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+
+			err = tx.QueryRowContext(ctx, `SELECT storage_key FROM files WHERE login = $1 AND name = $2 FOR UPDATE`, f.Login, f.Name).Scan(&replaced)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Deleted since the insert conflicted
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			stored, err = scanFile(tx.QueryRowContext(ctx, `
+				UPDATE files SET
+					content_type = $3,
+					size = $4,
+					sha256 = $5,
+					storage_key = $6,
+					created_at = CURRENT_TIMESTAMP
+				WHERE login = $1 AND name = $2
+				RETURNING `+fileColumns,
+				f.Login, f.Name, f.ContentType, f.Size, f.SHA256, f.StorageKey))
+			return err
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return stored, replaced, nil
+}
+
+// Files returns login's files, newest first.
+func (s *Store) Files(ctx context.Context, login string) ([]File, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+fileColumns+` FROM files WHERE login = $1 ORDER BY created_at DESC, id DESC`, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []File{}
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *f)
+	}
+	return files, rows.Err()
+}
+
+// File returns login's file called name, or ErrNotFound.
+func (s *Store) File(ctx context.Context, login, name string) (*File, error) {
+	return scanFile(s.db.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE login = $1 AND name = $2`, login, name))
+}
+
+// DeleteFile removes login's file called name and returns it, or
+// ErrNotFound.
+func (s *Store) DeleteFile(ctx context.Context, login, name string) (*File, error) {
+	return scanFile(s.db.QueryRowContext(ctx, `DELETE FROM files WHERE login = $1 AND name = $2 RETURNING `+fileColumns, login, name))
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+)
+
+// Notification is a NOTIFY payload.
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+// Listener receives notifications on a channel over a dedicated native pgx
+// connection, since database/sql connections cannot LISTEN. If the
+// connection drops it reconnects with backoff and sends a nil Notification,
+// because notifications may have been missed in between.
+type Listener struct {
+	// Notify delivers notifications until the listener is closed.
+	Notify <-chan *Notification
+
+	config  func() (*pgx.ConnConfig, error)
+	channel string
+	logf    func(format string, args ...interface{})
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Listen connects with the configuration from config and starts listening
+// on channel. config is called again for every reconnect, so rotated
+// credentials are picked up. logf receives connection errors.
+func Listen(ctx context.Context, config func() (*pgx.ConnConfig, error), channel string, logf func(format string, args ...interface{})) (*Listener, error) {
+	l := &Listener{config: config, channel: channel, logf: logf, done: make(chan struct{})}
+
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	notify := make(chan *Notification)
+	l.Notify = notify
+	runCtx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.run(runCtx, conn, notify)
+	return l, nil
+}
+
+func (l *Listener) connect(ctx context.Context) (*pgx.Conn, error) {
+	cfg, err := l.config()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (l *Listener) run(ctx context.Context, conn *pgx.Conn, notify chan<- *Notification) {
+	defer close(l.done)
+	defer close(notify)
+
+	delay := listenerMinReconnect
+	for {
+		if conn == nil {
+			var err error
+			if conn, err = l.connect(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				l.logf("reconnect failed: %v; retrying in %s", err, delay)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				delay = min(delay*2, listenerMaxReconnect)
+				continue
+			}
+			delay = listenerMinReconnect
+			if !l.send(ctx, notify, nil) {
+				conn.Close(context.Background())
+				return
+			}
+		}
+
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			conn.Close(context.Background())
+			conn = nil
+			if ctx.Err() != nil {
+				return
+			}
+			l.logf("connection lost: %v", err)
+			continue
+		}
+		if !l.send(ctx, notify, &Notification{Channel: n.Channel, Payload: n.Payload}) {
+			conn.Close(context.Background())
+			return
+		}
+	}
+}
+
+func (l *Listener) send(ctx context.Context, notify chan<- *Notification, n *Notification) bool {
+	select {
+	case notify <- n:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Close disconnects and closes Notify.
+func (l *Listener) Close() error {
+	l.cancel()
+	<-l.done
+	return nil
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Order is an order with its items. Prices are decimal strings, as
+// products' are.
+type Order struct {
+	ID        int64       `json:"id"`
+	Login     string      `json:"login"`
+	Status    string      `json:"status"`
+	Total     string      `json:"total"`
+	CreatedAt time.Time   `json:"created_at"`
+	Items     []OrderItem `json:"items"`
+}
+
+// OrderItem is one product line of an order, priced when it was placed.
+type OrderItem struct {
+	ProductID   int64  `json:"product_id"`
+	ProductName string `json:"product_name"`
+	UnitPrice   string `json:"unit_price"`
+	Quantity    int    `json:"quantity"`
+}
+
+// OrderLine requests quantity of a product.
+type OrderLine struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+// CreateOrder places an order for login at current product prices. Lines
+// for the same product are combined. If any product does not exist or is
+// deleted the order is not created and ErrNotFound is returned.
+func (s *Store) CreateOrder(ctx context.Context, login string, lines []OrderLine) (*Order, error) {
+	quantities := map[int64]int{}
+	for _, l := range lines {
+		quantities[l.ProductID] += l.Quantity
+	}
+	ids := make([]int64, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	qty := make([]int64, len(ids))
+	for i, id := range ids {
+		qty[i] = int64(quantities[id])
+	}
+
+	var order *Order
+	err := s.InTx(ctx, func(tx *Tx) error {
+		var id int64
+		if err := tx.QueryRowContext(ctx, `INSERT INTO orders (login) VALUES ($1) RETURNING id`, login).Scan(&id); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO order_items (order_id, product_id, product_name, unit_price, quantity)
+			SELECT $1, p.id, p.name, p.price, l.quantity
+			FROM unnest($2::bigint[], $3::bigint[]) AS l(product_id, quantity)
+			JOIN products p ON p.id = l.product_id AND p.deleted_at IS NULL
+			ORDER BY p.id`, id, ids, qty)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n != int64(len(ids)) {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE orders SET total = (SELECT sum(unit_price * quantity) FROM order_items WHERE order_id = $1)
+			WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		orders, err := queryOrders(ctx, tx, `o.id = $1`, id)
+		if err != nil {
+			return err
+		}
+		order = &orders[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Orders returns up to limit of login's orders, newest first.
+func (s *Store) Orders(ctx context.Context, login string, limit int) ([]Order, error) {
+	return queryOrders(ctx, s.db, `o.login = $1 ORDER BY o.id DESC LIMIT $2`, login, limit)
+}
+
+// Order returns login's order id, or ErrNotFound if login has no such
+// order.
+func (s *Store) Order(ctx context.Context, login string, id int64) (*Order, error) {
+	orders, err := queryOrders(ctx, s.db, `o.login = $1 AND o.id = $2`, login, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrNotFound
+	}
+	return &orders[0], nil
+}
+
+// queryOrders loads the orders matching where, each with its items.
+func queryOrders(ctx context.Context, q Queryer, where string, args ...interface{}) ([]Order, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT o.id, o.login, o.status, o.total::text, o.created_at,
+		       coalesce((
+		           SELECT json_agg(json_build_object(
+		               'product_id', i.product_id,
+		               'product_name', i.product_name,
+		               'unit_price', i.unit_price::text,
+		               'quantity', i.quantity) ORDER BY i.id)
+		           FROM order_items i WHERE i.order_id = o.id
+		       ), '[]')
+		FROM orders o
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		var (
+			o     Order
+			items []byte
+		)
+		if err := rows.Scan(&o.ID, &o.Login, &o.Status, &o.Total, &o.CreatedAt, &items); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(items, &o.Items); err != nil {
+			return nil, fmt.Errorf("decoding items of order %d: %w", o.ID, err)
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Preferences returns the preferences document stored for login, storing
+// defaults first if there is none yet.
+func (s *Store) Preferences(ctx context.Context, login string, defaults json.RawMessage) (json.RawMessage, error) {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO preferences (login, data) VALUES ($1, $2)
+		ON CONFLICT (login) DO NOTHING`, login, []byte(defaults)); err != nil {
+		return nil, err
+	}
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM preferences WHERE login = $1`, login).Scan(&data)
+	return data, err
+}
+
+// SetPreferences replaces the preferences document stored for login.
+func (s *Store) SetPreferences(ctx context.Context, login string, data json.RawMessage) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO preferences (login, data) VALUES ($1, $2)
+		ON CONFLICT (login) DO UPDATE SET data = EXCLUDED.data, updated_at = CURRENT_TIMESTAMP`,
+		login, []byte(data))
+	return err
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// PriceChange is one entry of a product's price history. OldPrice is nil
+// for the price a product was created with.
+type PriceChange struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	OldPrice  *float64  `json:"old_price"`
+	Price     float64   `json:"price"`
+	ChangedBy string    `json:"changed_by,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type actorKey struct{}
+
+// WithActor returns ctx naming login as who makes the writes of the
+// transactions InTx starts with it. The login is kept in the transaction's
+// app.changed_by setting, which the price history trigger records.
+func WithActor(ctx context.Context, login string) context.Context {
+	return context.WithValue(ctx, actorKey{}, login)
+}
+
+// Actor returns the login WithActor put in ctx, if any.
+func Actor(ctx context.Context) (string, bool) {
+	login, ok := ctx.Value(actorKey{}).(string)
+	return login, ok
+}
+
+// PriceHistory returns up to limit price changes of product id, newest
+// first, or ErrNotFound if there is no such product. Every product has at
+// least the entry for the price it was created with.
+func (s *Store) PriceHistory(ctx context.Context, productID int64, limit int) ([]PriceChange, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, product_id, old_price::float8, new_price::float8, changed_by, changed_at
+		FROM price_history
+		WHERE product_id = $1
+		ORDER BY changed_at DESC, id DESC
+		LIMIT $2`, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []PriceChange{}
+	for rows.Next() {
+		var c PriceChange
+		if err := rows.Scan(&c.ID, &c.ProductID, &c.OldPrice, &c.Price, &c.ChangedBy, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(changes) == 0 {
+		if _, err := s.Product(ctx, productID); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// replicaRetryAfter is how long reads go to the primary after the replica
+// failed, before it is tried again.
+const replicaRetryAfter = 30 * time.Second
+
+// SetReplica sends reads made with Read to replica. While it is unreachable
+// they fall back to the primary.
+func (s *Store) SetReplica(replica *sql.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replica = replica
+	s.replicaDownUntil = time.Time{}
+}
+
+// Replica returns the replica pool and whether reads are currently sent to
+// it. The pool is nil if no replica is configured.
+func (s *Store) Replica() (*sql.DB, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replica, s.replica != nil && !s.now().Before(s.replicaDownUntil)
+}
+
+// Read runs the read-only fn against the replica, or against the primary if
+// there is no replica, it recently failed, or it cannot be reached now. fn
+// may therefore be called twice and must not have side effects before its
+// first query succeeds.
+func (s *Store) Read(ctx context.Context, fn func(q Queryer) error) error {
+	replica, ok := s.Replica()
+	if !ok {
+		return fn(s.db)
+	}
+
+	err := fn(replica)
+	if err == nil || ctx.Err() != nil || !IsUnavailable(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	s.replicaDownUntil = s.now().Add(replicaRetryAfter)
+	s.mu.Unlock()
+	if s.logf != nil {
+		s.logf("read replica unavailable, using the primary for %s: %v", replicaRetryAfter, err)
+	}
+	return fn(s.db)
+}
+
+// IsUnavailable reports whether err means the server could not be reached
+// or is not accepting queries, rather than that the query itself failed.
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exceptions; 57P covers shutdowns and
+		// "the database system is starting up"
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TestReadFallsBackToPrimary verifies reads use the primary while the replica is unavailable
+func TestReadFallsBackToPrimary(t *testing.T) {
+	// The pools never connect; Read only hands them to fn
+	primary, _ := sql.Open(DriverName, "host=primary.invalid")
+	replica, _ := sql.Open(DriverName, "host=replica.invalid")
+	defer primary.Close()
+	defer replica.Close()
+
+	now := time.Unix(0, 0)
+	s := New(primary)
+	s.now = func() time.Time { return now }
+	s.SetReplica(replica)
+
+	var used []Queryer
+	read := func(replicaErr error) error {
+		used = nil
+		return s.Read(context.Background(), func(q Queryer) error {
+			used = append(used, q)
+			if q == Queryer(replica) {
+				return replicaErr
+			}
+			return nil
+		})
+	}
+
+	if err := read(nil); err != nil || len(used) != 1 || used[0] != Queryer(replica) {
+		t.Fatalf("healthy replica: err %v, used %v", err, used)
+	}
+
+	// A query error is the caller's problem, not a reason to fail over
+	undefined := &pgconn.PgError{Code: pgerrcode.UndefinedTable}
+	if err := read(undefined); err != undefined || len(used) != 1 {
+		t.Fatalf("query error: err %v, used %d pools", err, len(used))
+	}
+
+	if err := read(fmt.Errorf("dial: %w", errors.New("connection refused"))); err != nil || len(used) != 2 || used[1] != Queryer(primary) {
+		t.Fatalf("unreachable replica: err %v, used %v", err, used)
+	}
+	if _, ok := s.Replica(); ok {
+		t.Error("replica still in use after failing")
+	}
+	if read(nil); used[0] != Queryer(primary) {
+		t.Error("read went to the replica during its back-off")
+	}
+
+	now = now.Add(replicaRetryAfter)
+	if read(nil); used[0] != Queryer(replica) {
+		t.Error("replica not retried after its back-off")
+	}
+}
+
+// TestIsUnavailable verifies only connection failures count as the server being unavailable
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("dial tcp: connection refused"), true},
+		{&pgconn.PgError{Code: pgerrcode.CannotConnectNow}, true},
+		{&pgconn.PgError{Code: pgerrcode.ConnectionFailure}, true},
+		{&pgconn.PgError{Code: pgerrcode.QueryCanceled}, false},
+		{&pgconn.PgError{Code: pgerrcode.UndefinedColumn}, false},
+		{ErrNotFound, false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := IsUnavailable(tt.err); got != tt.want {
+			t.Errorf("IsUnavailable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Review is a Tailscale user's review of a product.
+type Review struct {
+	ID          int64     `json:"id"`
+	ProductID   int64     `json:"product_id"`
+	Login       string    `json:"login"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Rating      int       `json:"rating"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const reviewColumns = `id, product_id, login, display_name, rating, body, created_at, updated_at`
+
+func scanReview(row interface{ Scan(...interface{}) error }) (*Review, error) {
+	var r Review
+	err := row.Scan(&r.ID, &r.ProductID, &r.Login, &r.DisplayName, &r.Rating, &r.Body, &r.CreatedAt, &r.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateReview stores r, ignoring its ID and times. It returns ErrNotFound
+// if the product does not exist or is deleted and ErrConflict if the author
+// has already reviewed it.
+func (s *Store) CreateReview(ctx context.Context, r Review) (*Review, error) {
+	review, err := scanReview(s.db.QueryRowContext(ctx, `
+		INSERT INTO reviews (product_id, login, display_name, rating, body)
+		SELECT id, $2::text, $3::text, $4::smallint, $5::text FROM products WHERE id = $1 AND `+NotDeleted+`
+		RETURNING `+reviewColumns,
+		r.ProductID, r.Login, r.DisplayName, r.Rating, r.Body))
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation:
+		return nil, ErrNotFound
+	case IsUniqueViolation(err):
+		return nil, ErrConflict
+	}
+	return review, err
+}
+
+// liveProductReview is a reviews WHERE condition leaving out reviews of
+// soft-deleted products.
+const liveProductReview = `product_id IN (SELECT id FROM products WHERE ` + NotDeleted + `)`
+
+// Review returns review id, or ErrNotFound if there is none or its product
+// is deleted.
+func (s *Store) Review(ctx context.Context, id int64) (*Review, error) {
+	return scanReview(s.db.QueryRowContext(ctx, `SELECT `+reviewColumns+` FROM reviews WHERE id = $1 AND `+liveProductReview, id))
+}
+
+// Reviews returns up to limit reviews of product id, newest first, or none
+// if it is deleted.
+func (s *Store) Reviews(ctx context.Context, productID int64, limit int) ([]Review, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+reviewColumns+`
+		FROM reviews
+		WHERE product_id = $1 AND `+liveProductReview+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []Review{}
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, *r)
+	}
+	return reviews, rows.Err()
+}
+
+// UpdateReview replaces the rating and body of review id.
+func (s *Store) UpdateReview(ctx context.Context, id int64, rating int, body string) (*Review, error) {
+	return scanReview(s.db.QueryRowContext(ctx, `
+		UPDATE reviews SET rating = $2, body = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+reviewColumns, id, rating, body))
+}
+
+// DeleteReview deletes review id, returning ErrNotFound if there is none.
+func (s *Store) DeleteReview(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM reviews WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
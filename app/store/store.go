@@ -0,0 +1,465 @@
+// Package store is the data-access layer for the demo's Postgres database.
+// It uses pgx through database/sql, so prepared statements are cached per
+// connection and server errors arrive as *pgconn.PgError.
+//
+// Products are read with SELECT * and returned as column maps: the demo
+// workflows add and drop product columns with migrations the app is not
+// compiled against.
+//
+// Reads that may lag slightly behind writes, such as product listings, go
+// through Store.Read, which prefers the read replica when one is set.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" driver
+)
+
+// DriverName is the database/sql driver to open connections with.
+const DriverName = "pgx"
+
+var (
+	// ErrNotFound is returned when a query expected to match a row did not.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when a write violates a unique constraint.
+	ErrConflict = errors.New("conflicts with an existing row")
+)
+
+// Row is one result row keyed by column name, holding raw driver values.
+type Row = map[string]interface{}
+
+// Queryer is satisfied by *sql.DB, *sql.Tx and *sql.Conn.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Store wraps the connection pool and an optional read replica.
+type Store struct {
+	db *sql.DB
+
+	// logf, if set, receives replica fallback messages
+	logf func(format string, args ...interface{})
+	now  func() time.Time
+
+	mu               sync.Mutex
+	replica          *sql.DB
+	replicaDownUntil time.Time
+}
+
+func New(db *sql.DB) *Store {
+	return &Store{db: db, now: time.Now}
+}
+
+// SetLogf sets where replica fallback messages are logged.
+func (s *Store) SetLogf(logf func(format string, args ...interface{})) {
+	s.logf = logf
+}
+
+// DB returns the underlying pool.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// NotDeleted is a products WHERE condition leaving out soft-deleted
+// products.
+const NotDeleted = "deleted_at IS NULL"
+
+// Product returns the product with id, unless it is deleted. It always
+// reads the primary so a product reads back as it was just written.
+func (s *Store) Product(ctx context.Context, id int64) (Row, error) {
+	return QueryOne(ctx, s.db, `SELECT * FROM products WHERE id = $1 AND `+NotDeleted, id)
+}
+
+// RecentProducts returns up to limit products, newest first, preferring the
+// replica. If category is set, only products in the category of that name
+// are returned. Deleted products are left out unless withDeleted is set.
+func (s *Store) RecentProducts(ctx context.Context, limit int, category string, withDeleted bool) ([]Row, error) {
+	query, args := recentProductsQuery(limit, category, withDeleted)
+	var rows []Row
+	err := s.Read(ctx, func(q Queryer) (err error) {
+		rows, err = QueryAll(ctx, q, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// RecentProductRows starts the RecentProducts query and returns its rows,
+// for callers that write each product out as it is scanned. The caller
+// closes the rows. Only starting the query can fall back to the primary.
+func (s *Store) RecentProductRows(ctx context.Context, limit int, category string, withDeleted bool) (*sql.Rows, error) {
+	query, args := recentProductsQuery(limit, category, withDeleted)
+	var rows *sql.Rows
+	err := s.Read(ctx, func(q Queryer) (err error) {
+		rows, err = q.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// recentProductsQuery builds the RecentProducts query; limit is $1.
+func recentProductsQuery(limit int, category string, withDeleted bool) (string, []interface{}) {
+	var where []string
+	args := []interface{}{limit}
+	if category != "" {
+		args = append(args, category)
+		where = append(where, CategoryFilter(len(args)))
+	}
+	if !withDeleted {
+		where = append(where, NotDeleted)
+	}
+	query := `SELECT * FROM products`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	return query + ` ORDER BY created_at DESC LIMIT $1`, args
+}
+
+// CategoryFilter returns a products WHERE condition matching the category
+// whose name is query parameter $n.
+func CategoryFilter(n int) string {
+	return fmt.Sprintf("category_id = (SELECT id FROM categories WHERE name = $%d)", n)
+}
+
+// ProductColumns returns the columns of the products table in table order,
+// preferring the replica. Migrations add and drop columns while the app
+// runs, so this reads the catalog rather than a list compiled in.
+func (s *Store) ProductColumns(ctx context.Context) ([]string, error) {
+	var columns []string
+	err := s.Read(ctx, func(q Queryer) error {
+		rows, err := q.QueryContext(ctx, `
+			SELECT column_name FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'products'
+			ORDER BY ordinal_position`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		columns = columns[:0]
+		for rows.Next() {
+			var col string
+			if err := rows.Scan(&col); err != nil {
+				return err
+			}
+			columns = append(columns, col)
+		}
+		return rows.Err()
+	})
+	return columns, err
+}
+
+// ProductStats summarizes the products table.
+type ProductStats struct {
+	Count      int64           `json:"count"`
+	MinPrice   *float64        `json:"min_price"`
+	MaxPrice   *float64        `json:"max_price"`
+	AvgPrice   *float64        `json:"avg_price"`
+	Newest     *NewestProduct  `json:"newest"`
+	Categories []CategoryCount `json:"categories"`
+}
+
+// NewestProduct identifies the most recently created product.
+type NewestProduct struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CategoryCount is the number of products in a category. Category is nil
+// for uncategorized products.
+type CategoryCount struct {
+	Category *string `json:"category"`
+	Count    int64   `json:"count"`
+}
+
+// productStatsQuery computes every statistic over the products that are
+// not deleted in one round trip, largest categories first.
+const productStatsQuery = `
+SELECT agg.count, agg.min_price, agg.max_price, agg.avg_price,
+       newest.id, newest.name, newest.created_at, cats.categories
+FROM (
+    SELECT count(*) AS count, min(price)::float8 AS min_price,
+           max(price)::float8 AS max_price, avg(price)::float8 AS avg_price
+    FROM products WHERE deleted_at IS NULL
+) agg
+LEFT JOIN LATERAL (
+    SELECT id, name, created_at FROM products WHERE deleted_at IS NULL ORDER BY created_at DESC, id DESC LIMIT 1
+) newest ON true
+CROSS JOIN LATERAL (
+    SELECT coalesce(json_agg(json_build_object('category', category, 'count', n) ORDER BY n DESC, category), '[]') AS categories
+    FROM (SELECT category, count(*) AS n FROM products WHERE deleted_at IS NULL GROUP BY category) g
+) cats`
+
+// ProductStats returns aggregate statistics over all products, preferring
+// the replica.
+func (s *Store) ProductStats(ctx context.Context) (*ProductStats, error) {
+	var (
+		stats      ProductStats
+		newestID   sql.NullInt64
+		newestName sql.NullString
+		newestAt   sql.NullTime
+		categories []byte
+	)
+	err := s.Read(ctx, func(q Queryer) error {
+		return retryCachedPlan(func() error {
+			return q.QueryRowContext(ctx, productStatsQuery).Scan(
+				&stats.Count, &stats.MinPrice, &stats.MaxPrice, &stats.AvgPrice,
+				&newestID, &newestName, &newestAt, &categories)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if newestID.Valid {
+		stats.Newest = &NewestProduct{ID: newestID.Int64, Name: newestName.String, CreatedAt: newestAt.Time}
+	}
+	if err := json.Unmarshal(categories, &stats.Categories); err != nil {
+		return nil, fmt.Errorf("decoding category counts: %w", err)
+	}
+	return &stats, nil
+}
+
+// Tx is a transaction with the product queries that need one.
+type Tx struct {
+	*sql.Tx
+}
+
+// InTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise. The transaction's writes are attributed to the login
+// WithActor put in ctx, if any.
+func (s *Store) InTx(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if login, ok := Actor(ctx); ok {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('app.changed_by', $1, true)`, login); err != nil {
+			return fmt.Errorf("failed to name the transaction's actor: %w", err)
+		}
+	}
+
+	if err := fn(&Tx{tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// LockProduct returns the product with id, unless it is deleted, locking
+// its row until the transaction ends.
+func (tx *Tx) LockProduct(ctx context.Context, id int64) (Row, error) {
+	return QueryOne(ctx, tx, `SELECT * FROM products WHERE id = $1 AND `+NotDeleted+` FOR UPDATE`, id)
+}
+
+// UpdateProduct sets the given columns on product id and returns the
+// updated row. A duplicate name is reported as ErrConflict.
+func (tx *Tx) UpdateProduct(ctx context.Context, id int64, changes map[string]interface{}) (Row, error) {
+	columns := make([]string, 0, len(changes))
+	for col := range changes {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	assignments := make([]string, len(columns))
+	args := []interface{}{id}
+	for i, col := range columns {
+		assignments[i] = fmt.Sprintf("%s = $%d", pgx.Identifier{col}.Sanitize(), i+2)
+		args = append(args, changes[col])
+	}
+
+	query := fmt.Sprintf(`UPDATE products SET %s WHERE id = $1 RETURNING *`, strings.Join(assignments, ", "))
+	row, err := QueryOne(ctx, tx, query, args...)
+	if IsUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	return row, err
+}
+
+// InsertProducts inserts rows of values for columns into products in one
+// statement, skipping rows whose name is already taken. It returns the
+// names of the rows it inserted, so the caller can tell which were skipped.
+// columns must include name.
+func (tx *Tx) InsertProducts(ctx context.Context, columns []string, rows [][]interface{}) (map[string]bool, error) {
+	if len(rows) == 0 {
+		return map[string]bool{}, nil
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+	}
+
+	values := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		params := make([]string, len(row))
+		for j, v := range row {
+			args = append(args, v)
+			params[j] = fmt.Sprintf("$%d", len(args))
+		}
+		values[i] = "(" + strings.Join(params, ", ") + ")"
+	}
+
+	query := fmt.Sprintf(`INSERT INTO products (%s) VALUES %s ON CONFLICT (name) DO NOTHING RETURNING name`,
+		strings.Join(quoted, ", "), strings.Join(values, ", "))
+	inserted := make(map[string]bool, len(rows))
+	err := Each(ctx, tx, query, args, func(_ []string, row Row) error {
+		name, _ := row["name"].(string)
+		inserted[name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// DeleteProduct soft-deletes product id, returning ErrNotFound if there is
+// none or it is already deleted.
+func (s *Store) DeleteProduct(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE products SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND `+NotDeleted, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RestoreProduct undeletes product id and returns it. Restoring a product
+// that is not deleted returns it unchanged; ErrNotFound means there is no
+// such product.
+func (s *Store) RestoreProduct(ctx context.Context, id int64) (Row, error) {
+	row, err := QueryOne(ctx, s.db, `UPDATE products SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING *`, id)
+	if errors.Is(err, ErrNotFound) {
+		return QueryOne(ctx, s.db, `SELECT * FROM products WHERE id = $1`, id)
+	}
+	return row, err
+}
+
+// QueryOne runs a query expected to return at most one row, returning
+// ErrNotFound when nothing matched.
+func QueryOne(ctx context.Context, q Queryer, query string, args ...interface{}) (Row, error) {
+	rows, err := QueryAll(ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return rows[0], nil
+}
+
+// QueryAll runs a query and returns every row.
+func QueryAll(ctx context.Context, q Queryer, query string, args ...interface{}) ([]Row, error) {
+	var result []Row
+	err := retryCachedPlan(func() error {
+		result = nil
+		return Each(ctx, q, query, args, func(columns []string, row Row) error {
+			result = append(result, row)
+			return nil
+		})
+	})
+	return result, err
+}
+
+// errStop ends an Each iteration early without an error.
+var errStop = errors.New("stop")
+
+// Stop can be returned from an Each callback to stop iterating.
+func Stop() error { return errStop }
+
+// Each runs a query and calls fn for each row as it is read, so large
+// results can be streamed. The row map is not reused between calls.
+func Each(ctx context.Context, q Queryer, query string, args []interface{}, fn func(columns []string, row Row) error) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		row, err := ScanRow(rows, columns)
+		if err != nil {
+			return err
+		}
+		if err := fn(columns, row); errors.Is(err, errStop) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// ScanRow scans the current row into a map keyed by column name.
+func ScanRow(rows *sql.Rows, columns []string) (Row, error) {
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, err
+	}
+
+	row := make(Row, len(columns))
+	for i, col := range columns {
+		row[col] = values[i]
+	}
+	return row, nil
+}
+
+// IsUniqueViolation reports whether err is a unique constraint violation.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation
+}
+
+// isCachedPlanError reports whether err means a cached prepared statement
+// no longer matches the schema, e.g. after a migration added a column to a
+// SELECT * query. pgx drops the statement from that connection's cache on
+// error, so retrying is safe.
+func isCachedPlanError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.FeatureNotSupported &&
+		strings.Contains(pgErr.Message, "cached plan must not change result type")
+}
+
+// retryCachedPlan runs fn, once more if it failed on a stale cached plan.
+func retryCachedPlan(fn func() error) error {
+	err := fn()
+	if isCachedPlanError(err) {
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TestIsUniqueViolation verifies wrapped unique violations are detected and other errors are not
+func TestIsUniqueViolation(t *testing.T) {
+	err := fmt.Errorf("update: %w", &pgconn.PgError{Code: pgerrcode.UniqueViolation})
+	if !IsUniqueViolation(err) {
+		t.Error("wrapped unique violation not detected")
+	}
+	if IsUniqueViolation(&pgconn.PgError{Code: pgerrcode.ForeignKeyViolation}) || IsUniqueViolation(errors.New("boom")) {
+		t.Error("other errors reported as unique violations")
+	}
+}
+
+// TestRetryCachedPlan verifies a stale cached plan is retried exactly once
+// and other errors are not retried
+func TestRetryCachedPlan(t *testing.T) {
+	stale := &pgconn.PgError{Code: pgerrcode.FeatureNotSupported, Message: "cached plan must not change result type"}
+
+	calls := 0
+	err := retryCachedPlan(func() error {
+		calls++
+		if calls == 1 {
+			return stale
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Expected success on the second call, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	boom := errors.New("boom")
+	if err := retryCachedPlan(func() error { calls++; return boom }); err != boom || calls != 1 {
+		t.Errorf("Expected one failed call, got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// User is a Tailscale login that has used the app.
+type User struct {
+	Login        string    `json:"login"`
+	DisplayName  string    `json:"display_name,omitempty"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	RequestCount int64     `json:"request_count"`
+}
+
+// RecordUserVisits adds each user's requests, FirstSeen to LastSeen, to
+// their row, creating it on first sight. An empty DisplayName keeps the
+// stored one.
+func (s *Store) RecordUserVisits(ctx context.Context, visits []User) error {
+	return s.InTx(ctx, func(tx *Tx) error {
+		for _, v := range visits {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO users (login, display_name, first_seen, last_seen, request_count)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (login) DO UPDATE SET
+					display_name = coalesce(NULLIF(EXCLUDED.display_name, ''), users.display_name),
+					first_seen = LEAST(users.first_seen, EXCLUDED.first_seen),
+					last_seen = GREATEST(users.last_seen, EXCLUDED.last_seen),
+					request_count = users.request_count + EXCLUDED.request_count`,
+				v.Login, v.DisplayName, v.FirstSeen, v.LastSeen, v.RequestCount); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Users returns up to limit users, most recently seen first.
+func (s *Store) Users(ctx context.Context, limit int) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT login, display_name, first_seen, last_seen, request_count
+		FROM users
+		ORDER BY last_seen DESC, login
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Login, &u.DisplayName, &u.FirstSeen, &u.LastSeen, &u.RequestCount); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
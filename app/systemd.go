@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotifier sends sd_notify(3) state changes to systemd, so the demo can
+// run as a Type=notify unit. A nil notifier does nothing, for runs outside
+// systemd.
+type sdNotifier struct {
+	socket string
+}
+
+// newSDNotifier returns a notifier for $NOTIFY_SOCKET, or nil if systemd did
+// not set one.
+func newSDNotifier() *sdNotifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	return &sdNotifier{socket: socket}
+}
+
+// notify sends state, such as READY=1. Abstract sockets (@name) are
+// handled by net.
+func (n *sdNotifier) notify(state string) error {
+	if n == nil {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: n.socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("connecting to NOTIFY_SOCKET: %w", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// ready tells systemd startup is done, once the servers are listening.
+func (n *sdNotifier) ready() {
+	if err := n.notify("READY=1\nSTATUS=Serving"); err != nil {
+		log.Printf("Warning: failed to notify systemd: %v", err)
+	}
+}
+
+// stopping tells systemd shutdown has begun.
+func (n *sdNotifier) stopping() {
+	if err := n.notify("STOPPING=1"); err != nil {
+		log.Printf("Warning: failed to notify systemd: %v", err)
+	}
+}
+
+// watchdogInterval returns how often to ping the systemd watchdog: half of
+// WatchdogSec=, as sd_watchdog_enabled(3) recommends. It is 0 when the unit
+// has no watchdog or it is meant for another process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// runWatchdog pings the systemd watchdog every interval while the database
+// answers, until ctx is done. If the database stays down systemd restarts
+// the unit, per its Restart= setting.
+func (s *Server) runWatchdog(ctx context.Context, n *sdNotifier, interval time.Duration) {
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := s.db.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Skipping systemd watchdog ping, database is down: %v", err)
+		} else if err := n.notify("WATCHDOG=1"); err != nil {
+			log.Printf("Warning: failed to ping systemd watchdog: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(interval):
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSDNotifier verifies notifications are sent to NOTIFY_SOCKET, and are no-ops without it
+func TestSDNotifier(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if n := newSDNotifier(); n != nil {
+		t.Fatal("notifier without NOTIFY_SOCKET")
+	}
+	var none *sdNotifier
+	if err := none.notify("READY=1"); err != nil {
+		t.Errorf("nil notifier: %v", err)
+	}
+
+	// Unix socket paths are short; t.TempDir can be too long
+	dir, err := os.MkdirTemp("", "sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	n := newSDNotifier()
+	n.ready()
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	k, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:k]); got != "READY=1\nSTATUS=Serving" {
+		t.Errorf("sent %q", got)
+	}
+}
+
+// TestWatchdogInterval verifies the watchdog pings at half WATCHDOG_USEC,
+// only when meant for this process
+func TestWatchdogInterval(t *testing.T) {
+	for _, tc := range []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"junk", "", 0},
+		{"30000000", "", 15 * time.Second},
+		{"30000000", strconv.Itoa(os.Getpid()), 15 * time.Second},
+		{"30000000", "1", 0},
+	} {
+		t.Setenv("WATCHDOG_USEC", tc.usec)
+		t.Setenv("WATCHDOG_PID", tc.pid)
+		if got := watchdogInterval(); got != tc.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: interval %s, want %s", tc.usec, tc.pid, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// templateCache parses pages from the static files as html/template,
+// keeping each until its file changes. Embedded files never change, and
+// --static-dir edits show up on the next request.
+type templateCache struct {
+	fsys fs.FS
+
+	mu    sync.Mutex
+	pages map[string]cachedTemplate
+}
+
+type cachedTemplate struct {
+	tmpl    *template.Template
+	modTime time.Time
+	size    int64
+}
+
+func newTemplateCache(fsys fs.FS) *templateCache {
+	return &templateCache{fsys: fsys, pages: map[string]cachedTemplate{}}
+}
+
+// get returns the parsed template for the page name.
+func (c *templateCache) get(name string) (*template.Template, error) {
+	info, err := fs.Stat(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.pages[name]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.tmpl, nil
+	}
+
+	tmpl, err := template.ParseFS(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	c.pages[name] = cachedTemplate{tmpl: tmpl, modTime: info.ModTime(), size: info.Size()}
+	return tmpl, nil
+}
+
+// indexPage is the data index.html is rendered with.
+type indexPage struct {
+	User UserInfo
+}
+
+// indexHandler renders index.html with the caller's identity, so the page
+// shows who they are without waiting on /api/user.
+func (s *Server) indexHandler(pages *templateCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := pages.get("index.html")
+		if err != nil {
+			log.Printf("Failed to load index.html: %v", err)
+			http.Error(w, "Failed to load page", http.StatusInternalServerError)
+			return
+		}
+
+		// Render fully first so a template error is not a half-sent page
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, indexPage{User: s.userInfo(r)}); err != nil {
+			log.Printf("Failed to render index.html: %v", err)
+			http.Error(w, "Failed to render page", http.StatusInternalServerError)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		// The page is personalized
+		h.Set("Cache-Control", "private, no-cache")
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIndexRendersIdentity verifies the index page shows the caller's identity, escaped
+func TestIndexRendersIdentity(t *testing.T) {
+	h := (&Server{}).handler()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	asServeUser(r, "alice@example.com")
+	r.Header.Set("Tailscale-User-Name", "alice <script>")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET / = %d: %s", w.Code, body)
+	}
+	for _, want := range []string{
+		`<img src="/api/user/picture" alt="A">`,
+		`<h3>alice &lt;script&gt;</h3>`,
+		`"login_name":"alice@example.com"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page is missing %s", want)
+		}
+	}
+	if strings.Contains(body, "<script>\"") || strings.Contains(body, "alice <script>") {
+		t.Error("display name is not escaped")
+	}
+	if got := w.Header().Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("Cache-Control = %q, want private, no-cache", got)
+	}
+}
+
+// TestTemplateCacheReloads verifies templates in STATIC_DIR are parsed again when they change
+func TestTemplateCacheReloads(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.html")
+	write := func(content string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render := func(c *templateCache) string {
+		t.Helper()
+		tmpl, err := c.get("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, indexPage{User: UserInfo{LoginName: "bob@example.com"}}); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	c := newTemplateCache(os.DirFS(dir))
+	mod := time.Now().Add(-time.Hour)
+	write("one {{.User.LoginName}}", mod)
+	if got := render(c); got != "one bob@example.com" {
+		t.Errorf("render = %q", got)
+	}
+	first, _ := c.get("index.html")
+	if again, _ := c.get("index.html"); again != first {
+		t.Error("unchanged template was parsed again")
+	}
+
+	write("two {{.User.LoginName}}", mod.Add(time.Minute))
+	if got := render(c); got != "two bob@example.com" {
+		t.Errorf("render after edit = %q, want the edited template", got)
+	}
+}
+
+// TestFirstInitial verifies the avatar initial is the first letter, uppercased
+func TestFirstInitial(t *testing.T) {
+	for name, want := range map[string]string{"alice": "A", "émile": "É", "": ""} {
+		if got := firstInitial(name); got != want {
+			t.Errorf("firstInitial(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
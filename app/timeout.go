@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Route timeout groups. Routes are in timeoutAPI unless they set
+// apiRoute.TimeoutGroup.
+const (
+	timeoutAPI      = "api"
+	timeoutHealth   = "health"   // health and readiness checks, which probe each dependency in turn
+	timeoutAnalysis = "analysis" // EXPLAIN-based reports
+	timeoutFiles    = "files"    // file uploads and downloads
+	timeoutStream   = "stream"   // long-lived responses: WebSockets, SSE, the CSV export
+)
+
+// defaultRouteTimeouts bounds each group's requests. ROUTE_TIMEOUTS
+// overrides them; 0 means no limit.
+var defaultRouteTimeouts = map[string]time.Duration{
+	timeoutAPI:      5 * time.Second,
+	timeoutHealth:   10 * time.Second,
+	timeoutAnalysis: 10 * time.Second,
+	timeoutFiles:    time.Minute,
+	timeoutStream:   0,
+}
+
+// parseRouteTimeouts applies GROUP=DURATION entries to the defaults.
+func parseRouteTimeouts(entries []string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration, len(defaultRouteTimeouts))
+	for group, d := range defaultRouteTimeouts {
+		timeouts[group] = d
+	}
+	for _, entry := range entries {
+		group, value, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if _, known := defaultRouteTimeouts[group]; !ok || !known {
+			return nil, fmt.Errorf("route timeout %q: want GROUP=DURATION with GROUP one of api, health, analysis, files, stream", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("route timeout %q: invalid duration", entry)
+		}
+		timeouts[group] = d
+	}
+	return timeouts, nil
+}
+
+// routeTimeout returns how long requests to rt may take.
+func (s *Server) routeTimeout(rt apiRoute) time.Duration {
+	group := rt.TimeoutGroup
+	if group == "" {
+		group = timeoutAPI
+	}
+	if s.routeTimeouts != nil {
+		return s.routeTimeouts[group]
+	}
+	return defaultRouteTimeouts[group]
+}
+
+// timeoutRoute gives the handler a context that expires after the route's
+// timeout. A handler that only writes once the deadline has passed, which
+// is usually an error about it, has its response replaced with a 504.
+func (s *Server) timeoutRoute(pattern string, rt apiRoute, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout := s.routeTimeout(rt)
+		if timeout <= 0 {
+			next(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{
+			ResponseWriter: w,
+			ctx:            ctx,
+			detail:         fmt.Sprintf("%s did not finish within %s", pattern, timeout),
+		}
+		next(tw, r.WithContext(ctx))
+		if !tw.wrote && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			writeProblem(w, http.StatusGatewayTimeout, tw.detail)
+		}
+	}
+}
+
+// timeoutWriter passes the response through unless the deadline has
+// passed when the handler starts writing it.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	detail string
+
+	wrote    bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.wrote {
+		return
+	}
+	tw.wrote = true
+	if errors.Is(tw.ctx.Err(), context.DeadlineExceeded) {
+		tw.timedOut = true
+		writeProblem(tw.ResponseWriter, http.StatusGatewayTimeout, tw.detail)
+		return
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.ResponseWriter.Write(p)
+}
+
+func (tw *timeoutWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok && !tw.timedOut {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSockets upgrade on routes with a timeout; websocket.Accept
+// asserts http.Hijacker rather than following Unwrap.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.ResponseWriter does not implement http.Hijacker")
+	}
+	tw.wrote = true
+	return hj.Hijack()
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// problem is an RFC 9457 problem details body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// RequestID identifies the request in the server log
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeProblem writes an application/problem+json response, dropping any
+// headers the handler set for the response it meant to send.
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	sendProblem(w, problem{Status: status, Detail: detail})
+}
+
+// sendProblem writes p as writeProblem does, filling in its type and title.
+func sendProblem(w http.ResponseWriter, p problem) {
+	h := w.Header()
+	for _, name := range []string{"Content-Length", "Content-Encoding", "Content-Disposition", "ETag", "Last-Modified", "Cache-Control"} {
+		h.Del(name)
+	}
+	h.Set("Content-Type", "application/problem+json")
+	p.Type, p.Title = "about:blank", http.StatusText(p.Status)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// TestParseRouteTimeouts verifies ROUTE_TIMEOUTS overrides the defaults by
+// group without changing them
+func TestParseRouteTimeouts(t *testing.T) {
+	timeouts, err := parseRouteTimeouts([]string{"api=2s", " files = 5m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeouts[timeoutAPI] != 2*time.Second || timeouts[timeoutFiles] != 5*time.Minute || timeouts[timeoutHealth] != 10*time.Second {
+		t.Errorf("timeouts = %v", timeouts)
+	}
+	if defaultRouteTimeouts[timeoutAPI] != 5*time.Second {
+		t.Error("parsing changed the defaults")
+	}
+	for _, bad := range []string{"api", "db=2s", "api=soon", "api=-1s"} {
+		if _, err := parseRouteTimeouts([]string{bad}); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+// TestTimeoutRoute verifies requests over their group's timeout get a 504
+// without the handler's headers
+func TestTimeoutRoute(t *testing.T) {
+	s := &Server{routeTimeouts: map[string]time.Duration{timeoutAPI: 20 * time.Millisecond, timeoutStream: 0}}
+
+	// A handler that gives up when its context expires
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `W/"stale"`)
+		select {
+		case <-r.Context().Done():
+			writeJSONError(w, http.StatusInternalServerError, "Failed to query database: "+r.Context().Err().Error())
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.timeoutRoute("GET /api/products", apiRoute{}, slow)(w, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	if w.Code != http.StatusGatewayTimeout || w.Header().Get("Content-Type") != "application/problem+json" || w.Header().Get("ETag") != "" {
+		t.Fatalf("status %d, headers %v", w.Code, w.Header())
+	}
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != http.StatusGatewayTimeout || p.Title != "Gateway Timeout" || !strings.Contains(p.Detail, "GET /api/products did not finish within 20ms") {
+		t.Errorf("problem = %+v", p)
+	}
+
+	// A handler that returns without writing also gets a 504
+	w = httptest.NewRecorder()
+	s.timeoutRoute("GET /api/products", apiRoute{}, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})(w, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("silent handler: status %d", w.Code)
+	}
+
+	// Fast handlers and routes without a timeout are untouched
+	fast := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok && r.URL.Path != "/api/events" {
+			t.Errorf("%s: no deadline", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}
+	w = httptest.NewRecorder()
+	s.timeoutRoute("GET /api/products", apiRoute{}, fast)(w, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("fast handler: status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.timeoutRoute("GET /api/events", apiRoute{TimeoutGroup: timeoutStream}, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("stream route got a deadline")
+		}
+		fast(w, r)
+	})(w, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("stream: status %d", w.Code)
+	}
+}
+
+// TestTimeoutRouteWebSocket verifies the product stream still upgrades when
+// the stream group has a timeout
+func TestTimeoutRouteWebSocket(t *testing.T) {
+	s := &Server{feed: newTestFeed(), routeTimeouts: map[string]time.Duration{timeoutStream: time.Minute}}
+	srv := httptest.NewServer(s.timeoutRoute("GET /api/products/stream", apiRoute{TimeoutGroup: timeoutStream}, s.productStreamHandler))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig serves HTTPS directly in regular mode, rather than only behind
+// `tailscale serve` or a load balancer. tsnet mode has no use for it: the
+// tailnet already encrypts traffic and Tailscale issues its certificates.
+type TLSConfig struct {
+	TLSCert string `name:"tls-cert" env:"TLS_CERT" type:"existingfile" help:"Serve HTTPS with this PEM certificate (chain) in regular mode; needs --tls-key"`
+	TLSKey  string `name:"tls-key" env:"TLS_KEY" type:"existingfile" help:"PEM private key for --tls-cert"`
+
+	AutocertDomains []string `name:"tls-autocert-domains" env:"TLS_AUTOCERT_DOMAINS" help:"Get certificates for these domains from Let's Encrypt instead of --tls-cert; the domains must reach PORT (or :443)"`
+	AutocertCache   string   `name:"tls-autocert-cache" env:"TLS_AUTOCERT_CACHE" default:"autocert-cache" help:"Directory for the certificates Let's Encrypt issues"`
+	AutocertEmail   string   `name:"tls-autocert-email" env:"TLS_AUTOCERT_EMAIL" help:"Contact address for the Let's Encrypt account"`
+
+	ClientCA string `name:"tls-client-ca" env:"TLS_CLIENT_CA" type:"existingfile" help:"Require clients to present a certificate signed by a CA in this PEM bundle (mutual TLS)"`
+
+	HTTPRedirectPort string `name:"http-redirect-port" env:"HTTP_REDIRECT_PORT" help:"With TLS, also listen for plain HTTP on this port and redirect it to HTTPS (e.g. 80)"`
+}
+
+// enabled reports whether HTTPS is configured.
+func (c TLSConfig) enabled() bool {
+	return c.TLSCert != "" || c.TLSKey != "" || len(c.AutocertDomains) > 0
+}
+
+// validate checks the settings are complete and do not conflict.
+func (c TLSConfig) validate(tsnetMode bool) error {
+	if !c.enabled() {
+		switch {
+		case c.HTTPRedirectPort != "":
+			return errors.New("HTTP_REDIRECT_PORT needs TLS_CERT or TLS_AUTOCERT_DOMAINS")
+		case c.ClientCA != "":
+			return errors.New("TLS_CLIENT_CA needs TLS_CERT or TLS_AUTOCERT_DOMAINS")
+		}
+		return nil
+	}
+	switch {
+	case tsnetMode:
+		return errors.New("TLS_CERT and TLS_AUTOCERT_DOMAINS are for regular mode; in tsnet mode traffic is on the tailnet")
+	case (c.TLSCert == "") != (c.TLSKey == ""):
+		return errors.New("TLS_CERT and TLS_KEY must be set together")
+	case c.TLSCert != "" && len(c.AutocertDomains) > 0:
+		return errors.New("set TLS_CERT or TLS_AUTOCERT_DOMAINS, not both")
+	}
+	return nil
+}
+
+// serverConfig returns the TLS configuration for the listener, and the
+// handler for the plain HTTP redirect listener, which also answers ACME
+// HTTP-01 challenges with autocert.
+func (c TLSConfig) serverConfig(httpsPort string) (*tls.Config, http.Handler, error) {
+	redirect := httpsRedirect(httpsPort)
+
+	var cfg *tls.Config
+	if len(c.AutocertDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.AutocertDomains...),
+			Cache:      autocert.DirCache(c.AutocertCache),
+			Email:      c.AutocertEmail,
+		}
+		// Includes the acme-tls/1 protocol for TLS-ALPN-01 challenges
+		cfg = m.TLSConfig()
+		redirect = m.HTTPHandler(redirect)
+	} else {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg = &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}
+	}
+
+	// TLS 1.2 only with forward-secret AEAD suites; TLS 1.3 suites are not
+	// configurable and all fine
+	cfg.MinVersion = tls.VersionTLS12
+	cfg.CurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256}
+	cfg.CipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	}
+
+	if c.ClientCA != "" {
+		pool, err := loadCertPool(c.ClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if len(c.AutocertDomains) > 0 {
+			// The ACME server's TLS-ALPN-01 challenge brings no certificate
+			challenge := cfg.Clone()
+			challenge.ClientAuth = tls.NoClientCert
+			cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+					return challenge, nil
+				}
+				return nil, nil
+			}
+		}
+	}
+	return cfg, redirect, nil
+}
+
+// loadCertPool reads the PEM certificates in path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return pool, nil
+}
+
+// httpsRedirect permanently redirects requests to the same URL over HTTPS
+// on httpsPort, with a 308 so clients keep the method and body.
+func httpsRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host += ":" + httpsPort
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for localhost and its key
+// to dir.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// TestTLSConfigValidate verifies conflicting or incomplete TLS settings are rejected
+func TestTLSConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  TLSConfig
+		tsnet   bool
+		wantErr bool
+	}{
+		{"off", TLSConfig{}, false, false},
+		{"cert", TLSConfig{TLSCert: "c", TLSKey: "k", HTTPRedirectPort: "80"}, false, false},
+		{"autocert", TLSConfig{AutocertDomains: []string{"demo.example.com"}}, false, false},
+		{"cert without key", TLSConfig{TLSCert: "c"}, false, true},
+		{"cert and autocert", TLSConfig{TLSCert: "c", TLSKey: "k", AutocertDomains: []string{"demo.example.com"}}, false, true},
+		{"redirect without TLS", TLSConfig{HTTPRedirectPort: "80"}, false, true},
+		{"client CA without TLS", TLSConfig{ClientCA: "ca"}, false, true},
+		{"tsnet", TLSConfig{TLSCert: "c", TLSKey: "k"}, true, true},
+	} {
+		if err := tc.config.validate(tc.tsnet); (err != nil) != tc.wantErr {
+			t.Errorf("%s: validate = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+// TestTLSServe verifies a certificate and key serve HTTPS with TLS 1.2 or later
+func TestTLSServe(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+	cfg, _, err := TLSConfig{TLSCert: certFile, TLSKey: keyFile}.serverConfig("8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", cfg.MinVersion)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11}
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("TLS 1.1 handshake succeeded")
+	}
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// TestTLSClientAuth verifies CLIENT_CA requires clients to present a certificate it signed
+func TestTLSClientAuth(t *testing.T) {
+	// The self-signed certificate serves as CA, server and client
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+	cfg, _, err := TLSConfig{TLSCert: certFile, TLSKey: keyFile, ClientCA: certFile}.serverConfig("8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("request without a client certificate succeeded")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{cert}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "localhost" {
+		t.Errorf("client certificate CN = %q", body)
+	}
+
+	if _, _, err := (TLSConfig{TLSCert: certFile, TLSKey: keyFile, ClientCA: keyFile}).serverConfig("8443"); err == nil {
+		t.Error("a client CA file without certificates should fail")
+	}
+}
+
+// TestHTTPSRedirect verifies plain HTTP is redirected to the same URL over HTTPS on the TLS port
+func TestHTTPSRedirect(t *testing.T) {
+	for _, tc := range []struct {
+		port, host, want string
+	}{
+		{"443", "demo.example.com", "https://demo.example.com/api/products?limit=5"},
+		{"8443", "demo.example.com:8080", "https://demo.example.com:8443/api/products?limit=5"},
+		{"443", "[::1]:80", "https://[::1]/api/products?limit=5"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/products?limit=5", nil)
+		r.Host = tc.host
+		w := httptest.NewRecorder()
+		httpsRedirect(tc.port).ServeHTTP(w, r)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tc.want {
+			t.Errorf("%s on %s: %d %q, want %q", tc.host, tc.port, w.Code, w.Header().Get("Location"), tc.want)
+		}
+	}
+}
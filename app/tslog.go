@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"tailscale.com/types/logger"
+)
+
+// tsnetImportant matches the tsnet log lines that are shown at TS_VERBOSE=0:
+// the node needing a sign-in, its state changes and health problems.
+var tsnetImportant = []string{
+	"To start this tsnet server",
+	"Switching ipn state",
+	"): error: ",
+}
+
+// tsnetLogf returns the Logf for the tsnet node, logging to logf with a
+// "tsnet: " prefix. tsnet logs every netmap, magicsock and control event,
+// so by default (verbosity 0) only the important lines are kept; 1 keeps
+// every regular line and 2 also tsnet's [v1] and [v2] debug lines.
+func tsnetLogf(verbosity int, logf logger.Logf) logger.Logf {
+	logf = logger.WithPrefix(logf, "tsnet: ")
+	return func(format string, args ...any) {
+		if verbosity >= 2 {
+			logf(format, args...)
+			return
+		}
+		if strings.HasPrefix(format, "[v1] ") || strings.HasPrefix(format, "[v2] ") {
+			return
+		}
+		if verbosity == 1 {
+			logf(format, args...)
+			return
+		}
+		msg := fmt.Sprintf(format, args...)
+		for _, s := range tsnetImportant {
+			if strings.Contains(msg, s) {
+				logf("%s", msg)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestTsnetLogf verifies TS_VERBOSE decides which tsnet log lines are
+// shown, keeping the login URL and state changes
+func TestTsnetLogf(t *testing.T) {
+	lines := []struct{ format, arg string }{
+		{"To start this tsnet server, restart with TS_AUTHKEY set, or go to: %s", "https://login.tailscale.com/a/1"},
+		{"Switching ipn state %v -> Running", "Starting"},
+		{"health(%q): error: not in map poll", "overall"},
+		{"magicsock: endpoints changed: %s", "1.2.3.4:41641"},
+		{"[v1] netmap: %s", "self"},
+		{"[v2] wg: %s", "handshake"},
+	}
+
+	for verbosity, want := range map[int][]string{
+		0: {
+			"tsnet: To start this tsnet server, restart with TS_AUTHKEY set, or go to: https://login.tailscale.com/a/1",
+			"tsnet: Switching ipn state Starting -> Running",
+			`tsnet: health("overall"): error: not in map poll`,
+		},
+		1: {
+			"tsnet: To start this tsnet server, restart with TS_AUTHKEY set, or go to: https://login.tailscale.com/a/1",
+			"tsnet: Switching ipn state Starting -> Running",
+			`tsnet: health("overall"): error: not in map poll`,
+			"tsnet: magicsock: endpoints changed: 1.2.3.4:41641",
+		},
+	} {
+		var got []string
+		logf := tsnetLogf(verbosity, func(format string, args ...any) {
+			got = append(got, fmt.Sprintf(format, args...))
+		})
+		for _, l := range lines {
+			logf(l.format, l.arg)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("verbosity %d:\n%q\nwant\n%q", verbosity, got, want)
+		}
+	}
+
+	var n int
+	logf := tsnetLogf(2, func(string, ...any) { n++ })
+	for _, l := range lines {
+		logf(l.format, l.arg)
+	}
+	if n != len(lines) {
+		t.Errorf("verbosity 2 logged %d of %d lines", n, len(lines))
+	}
+}
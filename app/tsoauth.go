@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuthConfig mints the tsnet auth key at startup from a Tailscale OAuth
+// client, so CI runs need no long-lived key. The client needs the
+// auth_keys scope, and the tags must be ones it owns.
+type OAuthConfig struct {
+	ClientID     string        `env:"TS_OAUTH_CLIENT_ID" help:"Tailscale OAuth client ID; mints a short-lived auth key for tsnet mode instead of TS_AUTHKEY"`
+	ClientSecret string        `env:"TS_OAUTH_CLIENT_SECRET" help:"Secret of the Tailscale OAuth client"`
+	Tags         []string      `env:"TS_OAUTH_TAGS" placeholder:"tag:ci" help:"Tags for the node; keys minted by an OAuth client must have at least one"`
+	Ephemeral    bool          `env:"TS_OAUTH_EPHEMERAL" default:"true" negatable:"" help:"Register the node as ephemeral, so it is removed soon after going offline"`
+	KeyExpiry    time.Duration `env:"TS_OAUTH_KEY_EXPIRY" default:"10m" help:"How long the minted auth key stays valid for registration"`
+	APIURL       string        `name:"api-url" env:"TS_API_URL" default:"https://api.tailscale.com" help:"Tailscale API base URL"`
+}
+
+// enabled reports whether an OAuth client is configured.
+func (c OAuthConfig) enabled() bool {
+	return c.ClientID != "" || c.ClientSecret != ""
+}
+
+// validate checks the settings are complete and do not conflict with an
+// auth key.
+func (c OAuthConfig) validate(tsnetMode bool, authKey string) error {
+	if !c.enabled() {
+		return nil
+	}
+	switch {
+	case c.ClientID == "" || c.ClientSecret == "":
+		return errors.New("TS_OAUTH_CLIENT_ID and TS_OAUTH_CLIENT_SECRET must be set together")
+	case !tsnetMode:
+		return errors.New("TS_OAUTH_CLIENT_ID is for tsnet mode (TSNET=true)")
+	case authKey != "":
+		return errors.New("set TS_AUTHKEY or TS_OAUTH_CLIENT_ID, not both")
+	case len(c.Tags) == 0:
+		return errors.New("TS_OAUTH_TAGS is required: keys minted by an OAuth client must be tagged")
+	}
+	for _, tag := range c.Tags {
+		if !strings.HasPrefix(tag, "tag:") || len(tag) == len("tag:") {
+			return fmt.Errorf("TS_OAUTH_TAGS: %q is not a tag such as tag:ci", tag)
+		}
+	}
+	return nil
+}
+
+// token exchanges the client credentials for an API access token.
+func (c OAuthConfig) token(ctx context.Context, client *http.Client) (string, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.APIURL, "/")+"/api/v2/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := doTailscaleAPI(client, req, &token); err != nil {
+		return "", fmt.Errorf("getting an OAuth token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// mintAuthKey exchanges the client credentials for an API token and
+// creates a single-use, preauthorized auth key with it.
+func (c OAuthConfig) mintAuthKey(ctx context.Context, client *http.Client) (string, error) {
+	token, err := c.token(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	var keyRequest struct {
+		Capabilities struct {
+			Devices struct {
+				Create struct {
+					Reusable      bool     `json:"reusable"`
+					Ephemeral     bool     `json:"ephemeral"`
+					Preauthorized bool     `json:"preauthorized"`
+					Tags          []string `json:"tags"`
+				} `json:"create"`
+			} `json:"devices"`
+		} `json:"capabilities"`
+		ExpirySeconds int64  `json:"expirySeconds"`
+		Description   string `json:"description"`
+	}
+	create := &keyRequest.Capabilities.Devices.Create
+	create.Ephemeral = c.Ephemeral
+	create.Preauthorized = true
+	create.Tags = c.Tags
+	keyRequest.ExpirySeconds = int64(c.KeyExpiry / time.Second)
+	keyRequest.Description = "tailscale-demo startup"
+	body, _ := json.Marshal(keyRequest)
+
+	var key struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.APIURL, "/")+"/api/v2/tailnet/-/keys", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := doTailscaleAPI(client, req, &key); err != nil {
+		return "", fmt.Errorf("creating an auth key: %w", err)
+	}
+	if key.Key == "" {
+		return "", errors.New("creating an auth key: response has no key")
+	}
+	log.Printf("Minted auth key %s for %s (ephemeral %v, expires in %s)", key.ID, strings.Join(c.Tags, ","), c.Ephemeral, c.KeyExpiry)
+	return key.Key, nil
+}
+
+// doTailscaleAPI sends req and decodes the JSON response into v, turning
+// error statuses into errors with the API's message.
+func doTailscaleAPI(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
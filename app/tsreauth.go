@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn"
+)
+
+// tsnetLoginClient is the part of the LocalClient re-authentication uses.
+type tsnetLoginClient interface {
+	Start(ctx context.Context, opts ipn.Options) error
+	StartLoginInteractive(ctx context.Context) error
+}
+
+// tsnetAuth follows the running node's login state from the IPN bus and
+// logs it back in with a fresh auth key when it needs a login, such as
+// after its node key expires. Until then WhoIs cannot identify callers,
+// so requests needing an identity get a 503 and /health reports why.
+type tsnetAuth struct {
+	client  tsnetLoginClient
+	authKey func(ctx context.Context) (string, error)
+	clock   Clock
+	rand    *lockedRand
+
+	// wake is signalled when the node needs a login
+	wake chan struct{}
+
+	mu     sync.Mutex
+	status TailscaleAuthStatus
+}
+
+// TailscaleAuthStatus is the node's login state in /health.
+type TailscaleAuthStatus struct {
+	State      string     `json:"state"`                 // the IPN state, e.g. Running or NeedsLogin
+	KeyExpiry  *time.Time `json:"key_expiry,omitempty"`  // when the node key expires; unset if it never does
+	Reauths    int        `json:"reauths,omitempty"`     // re-authentication attempts since startup
+	LastReauth *time.Time `json:"last_reauth,omitempty"` // the last attempt
+	Error      string     `json:"error,omitempty"`       // why the last attempt, or control, failed
+}
+
+func newTsnetAuth(client tsnetLoginClient, authKey func(ctx context.Context) (string, error), clock Clock, rand *lockedRand) *tsnetAuth {
+	return &tsnetAuth{
+		client:  client,
+		authKey: authKey,
+		clock:   clock,
+		rand:    rand,
+		wake:    make(chan struct{}, 1),
+		status:  TailscaleAuthStatus{State: ipn.Running.String()},
+	}
+}
+
+// reauthKey returns the key to log the node back in with: a newly minted
+// one with an OAuth client, since each is single-use and short-lived, and
+// otherwise TS_AUTHKEY, which must be reusable to work a second time.
+func (config ServeCmd) reauthKey(ctx context.Context) (string, error) {
+	if config.OAuth.enabled() {
+		return config.OAuth.mintAuthKey(ctx, http.DefaultClient)
+	}
+	if config.TailscaleAuthKey == "" {
+		return "", errors.New("no auth key is configured")
+	}
+	return config.TailscaleAuthKey, nil
+}
+
+// observe records the state in an IPN bus notification.
+func (a *tsnetAuth) observe(n ipn.Notify) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n.State != nil {
+		if *n.State == ipn.Running && a.status.State != ipn.Running.String() {
+			log.Printf("Tailscale node is running again")
+			a.status.Error = ""
+		}
+		a.status.State = n.State.String()
+	}
+	if n.NetMap != nil {
+		a.status.KeyExpiry = nil
+		if exp := n.NetMap.Expiry; !exp.IsZero() {
+			a.status.KeyExpiry = &exp
+		}
+	}
+	if n.ErrMessage != nil {
+		a.status.Error = *n.ErrMessage
+	}
+	if a.status.State == ipn.NeedsLogin.String() {
+		select {
+		case a.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Status returns a copy of the login state.
+func (a *tsnetAuth) Status() TailscaleAuthStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.status
+}
+
+// err returns why callers cannot be identified, or nil while the node is
+// running.
+func (a *tsnetAuth) err() error {
+	if a == nil {
+		return nil
+	}
+	st := a.Status()
+	switch st.State {
+	case ipn.Running.String(), ipn.Starting.String():
+		return nil
+	case ipn.NeedsLogin.String():
+		return errors.New("the Tailscale node is logged out (its node key may have expired) and is re-authenticating")
+	case ipn.NeedsMachineAuth.String():
+		return errors.New("the Tailscale node is waiting to be approved by a tailnet admin")
+	}
+	return fmt.Errorf("the Tailscale node is %s", st.State)
+}
+
+// run re-authenticates whenever the node needs a login, retrying with
+// backoff while it still does, until ctx is done.
+func (a *tsnetAuth) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.wake:
+		}
+		b := newBackoff(5*time.Second, 5*time.Minute, a.rand)
+		for a.Status().State == ipn.NeedsLogin.String() {
+			a.reauth(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.clock.After(b.Next()):
+			}
+		}
+	}
+}
+
+// reauth makes one attempt to log the node in, as tsnet does at startup.
+func (a *tsnetAuth) reauth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	now := a.clock.Now()
+	a.mu.Lock()
+	a.status.Reauths++
+	a.status.LastReauth = &now
+	a.mu.Unlock()
+	log.Printf("Tailscale node needs a login; re-authenticating")
+
+	err := func() error {
+		key, err := a.authKey(ctx)
+		if err != nil {
+			return fmt.Errorf("getting an auth key: %w", err)
+		}
+		if err := a.client.Start(ctx, ipn.Options{AuthKey: key}); err != nil {
+			return fmt.Errorf("restarting the backend: %w", err)
+		}
+		return a.client.StartLoginInteractive(ctx)
+	}()
+	if err != nil {
+		log.Printf("Warning: Tailscale re-authentication failed: %v", err)
+		a.mu.Lock()
+		a.status.Error = err.Error()
+		a.mu.Unlock()
+	}
+}
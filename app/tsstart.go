@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"tailscale.com/tsnet"
+)
+
+// tsnetAttemptTimeout bounds a single attempt to bring the node up, so a
+// hung control connection is retried rather than waited on forever.
+const tsnetAttemptTimeout = time.Minute
+
+// tsnetStarter brings the tsnet node up, retrying with backoff when
+// starting or authenticating fails. A tsnet.Server cannot be started
+// again after a failure, so each attempt uses a fresh one.
+type tsnetStarter struct {
+	create func() (*tsnet.Server, error)
+	up     func(ctx context.Context, ts *tsnet.Server) error
+	clock  Clock
+	rand   *lockedRand
+
+	mu       sync.Mutex
+	ts       *tsnet.Server
+	attempts int
+}
+
+func newTsnetStarter(config ServeCmd) *tsnetStarter {
+	return &tsnetStarter{
+		create: func() (*tsnet.Server, error) { return newTsnetServer(config) },
+		up: func(ctx context.Context, ts *tsnet.Server) error {
+			_, err := ts.Up(ctx)
+			return err
+		},
+		clock: systemClock{},
+		rand:  newLockedRand(time.Now().UnixNano()),
+	}
+}
+
+// start returns the running node, bringing it up first if needed and
+// retrying for up to timeout. Configuration errors are not retried.
+func (t *tsnetStarter) start(ctx context.Context, timeout time.Duration) (*tsnet.Server, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ts != nil {
+		return t.ts, nil
+	}
+
+	var configErr error
+	began := t.clock.Now()
+	attempt := func(ctx context.Context) error {
+		ts, err := t.create()
+		if err != nil {
+			configErr = err
+			return nil
+		}
+		t.attempts++
+
+		ctx, cancel := context.WithTimeout(ctx, tsnetAttemptTimeout)
+		defer cancel()
+		if err := t.up(ctx, ts); err != nil {
+			ts.Close()
+			return err
+		}
+		t.ts = ts
+		return nil
+	}
+	err := retry(ctx, t.clock, newBackoff(time.Second, 30*time.Second, t.rand), timeout, attempt,
+		func(attempt int, err error, wait time.Duration) {
+			log.Printf("Tailscale node not up (attempt %d): %v; retrying in %s", attempt, err, wait.Round(time.Millisecond))
+		})
+	switch {
+	case configErr != nil:
+		return nil, fmt.Errorf("failed to set up tsnet: %w", configErr)
+	case err != nil:
+		return nil, fmt.Errorf("tailscale node not up after %d attempt(s) in %s: %w", t.attempts, t.clock.Now().Sub(began).Round(time.Second), err)
+	}
+	log.Printf("Tailscale node up after %d attempt(s) in %s", t.attempts, t.clock.Now().Sub(began).Round(time.Millisecond))
+	return t.ts, nil
+}
+
+// Close shuts the node down if it was started.
+func (t *tsnetStarter) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ts != nil {
+		t.ts.Close()
+		t.ts = nil
+	}
+}
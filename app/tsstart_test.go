@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/tsnet"
+)
+
+// TestTsnetStarterRetries verifies a failed node is replaced by a fresh one
+// on each attempt and the running node is reused afterwards
+func TestTsnetStarterRetries(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var created []*tsnet.Server
+	st := &tsnetStarter{
+		create: func() (*tsnet.Server, error) {
+			ts := &tsnet.Server{}
+			created = append(created, ts)
+			return ts, nil
+		},
+		up: func(ctx context.Context, ts *tsnet.Server) error {
+			if len(created) < 3 {
+				return errors.New("tsnet.Up: backend: control unreachable")
+			}
+			return nil
+		},
+		clock: clock,
+		rand:  newLockedRand(1),
+	}
+
+	done := make(chan error, 1)
+	var ts *tsnet.Server
+	go func() {
+		var err error
+		ts, err = st.start(context.Background(), time.Minute)
+		done <- err
+	}()
+	for i := 0; i < 2; i++ {
+		waitForWaiters(t, clock, 1)
+		clock.Advance(30 * time.Second)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if len(created) != 3 || ts != created[2] || st.attempts != 3 {
+		t.Fatalf("Expected the third of 3 nodes after 3 attempts, got %d nodes and %d attempts", len(created), st.attempts)
+	}
+
+	again, err := st.start(context.Background(), 0)
+	if err != nil || again != ts || len(created) != 3 {
+		t.Errorf("Running node not reused: %v", err)
+	}
+}
+
+// TestTsnetStarterConfigError verifies configuration errors fail at once
+func TestTsnetStarterConfigError(t *testing.T) {
+	st := &tsnetStarter{
+		create: func() (*tsnet.Server, error) { return nil, errors.New("bad passphrase file") },
+		clock:  newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		rand:   newLockedRand(1),
+	}
+	if _, err := st.start(context.Background(), time.Hour); err == nil || !strings.Contains(err.Error(), "bad passphrase file") {
+		t.Errorf("Expected the configuration error, got %v", err)
+	}
+}
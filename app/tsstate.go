@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store"
+	"tailscale.com/types/logger"
+)
+
+// encryptedStateMagic prefixes values written by encryptedStateStore. Values
+// without it are plaintext state from before encryption was enabled.
+var encryptedStateMagic = []byte("tsdemo-enc1:")
+
+const (
+	stateSaltSize = 16
+
+	// scrypt parameters recommended for interactive use (2017)
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// encryptedStateStore wraps an ipn.StateStore and encrypts every value with
+// AES-256-GCM under a key derived from a passphrase, since the tsnet state
+// holds the node's private keys. Plaintext values are still readable, so
+// enabling encryption on an existing node re-encrypts its state as tsnet
+// rewrites it.
+//
+// Each value is stored as magic || salt || nonce || ciphertext, with the
+// state key as additional data so values cannot be swapped between keys.
+type encryptedStateStore struct {
+	inner      ipn.StateStore
+	passphrase []byte
+
+	// salt is used for every value this process writes, so the expensive
+	// key derivation happens once.
+	salt []byte
+
+	mu   sync.Mutex
+	keys map[string]cipher.AEAD // by salt
+}
+
+func newEncryptedStateStore(inner ipn.StateStore, passphrase string) (*encryptedStateStore, error) {
+	if passphrase == "" {
+		return nil, errors.New("state passphrase must not be empty")
+	}
+
+	salt := make([]byte, stateSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	s := &encryptedStateStore{
+		inner:      inner,
+		passphrase: []byte(passphrase),
+		salt:       salt,
+		keys:       map[string]cipher.AEAD{},
+	}
+	// Derive the write key up front so a bad configuration fails at startup
+	if _, err := s.aead(salt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *encryptedStateStore) aead(salt []byte) (cipher.AEAD, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.keys[string(salt)]; ok {
+		return a, nil
+	}
+
+	key, err := scrypt.Key(s.passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	a, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s.keys[string(salt)] = a
+	return a, nil
+}
+
+func (s *encryptedStateStore) ReadState(id ipn.StateKey) ([]byte, error) {
+	bs, err := s.inner.ReadState(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(bs, encryptedStateMagic) {
+		return bs, nil
+	}
+	bs = bs[len(encryptedStateMagic):]
+
+	if len(bs) < stateSaltSize {
+		return nil, fmt.Errorf("encrypted state %q is truncated", id)
+	}
+	salt, bs := bs[:stateSaltSize], bs[stateSaltSize:]
+
+	a, err := s.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) < a.NonceSize() {
+		return nil, fmt.Errorf("encrypted state %q is truncated", id)
+	}
+	nonce, ciphertext := bs[:a.NonceSize()], bs[a.NonceSize():]
+
+	plaintext, err := a.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt state %q (wrong passphrase?): %w", id, err)
+	}
+	return plaintext, nil
+}
+
+func (s *encryptedStateStore) WriteState(id ipn.StateKey, bs []byte) error {
+	a, err := s.aead(s.salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	out := make([]byte, 0, len(encryptedStateMagic)+len(s.salt)+len(nonce)+len(bs)+a.Overhead())
+	out = append(out, encryptedStateMagic...)
+	out = append(out, s.salt...)
+	out = append(out, nonce...)
+	out = a.Seal(out, nonce, bs, []byte(id))
+
+	return s.inner.WriteState(id, out)
+}
+
+// tsnetStateStore opens the state store configured by TS_STATE, encrypted
+// when a passphrase is configured. It returns nil to let tsnet use its
+// default file store. TS_STATE accepts a file path or any store URI tailscale
+// supports, such as arn:aws:ssm:... or kube:<secret>.
+func tsnetStateStore(config ServeCmd, logf logger.Logf) (ipn.StateStore, error) {
+	passphrase := config.TailscaleStatePassphrase
+	if config.TailscaleStatePassphraseFile != "" {
+		b, err := os.ReadFile(config.TailscaleStatePassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state passphrase file: %w", err)
+		}
+		passphrase = strings.TrimSpace(string(b))
+	}
+
+	if config.TailscaleState == "" && passphrase == "" {
+		return nil, nil
+	}
+
+	path := config.TailscaleState
+	if path == "" {
+		// Same location tsnet uses by default
+		dir, err := tsnetDefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "tailscaled.state")
+	}
+
+	st, err := store.New(logf, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tsnet state store: %w", err)
+	}
+
+	if passphrase == "" {
+		return st, nil
+	}
+	logf("tsnet state is encrypted at rest")
+	return newEncryptedStateStore(st, passphrase)
+}
+
+// tsnetDefaultDir mirrors tsnet's default state directory when Dir is unset.
+func tsnetDefaultDir() (string, error) {
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	prog := strings.TrimSuffix(strings.ToLower(filepath.Base(exe)), ".exe")
+	dir := filepath.Join(confDir, "tsnet-"+prog)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
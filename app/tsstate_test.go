@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+)
+
+// TestEncryptedStateStore verifies state is encrypted at rest and read back with the passphrase
+func TestEncryptedStateStore(t *testing.T) {
+	inner := new(mem.Store)
+	s, err := newEncryptedStateStore(inner, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := ipn.StateKey("_machinekey")
+	secret := []byte("privkey:0123456789abcdef")
+	if err := s.WriteState(key, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := inner.ReadState(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, secret) || !bytes.HasPrefix(raw, encryptedStateMagic) {
+		t.Fatalf("stored value is not encrypted: %q", raw)
+	}
+
+	got, err := s.ReadState(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Errorf("ReadState = %q, want %q", got, secret)
+	}
+
+	// A new process (new write salt) with the same passphrase can read it
+	s2, err := newEncryptedStateStore(inner, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s2.ReadState(key); err != nil || !bytes.Equal(got, secret) {
+		t.Errorf("ReadState from new store = %q, %v", got, err)
+	}
+
+	wrong, err := newEncryptedStateStore(inner, "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.ReadState(key); err == nil {
+		t.Error("ReadState with wrong passphrase succeeded")
+	}
+
+	// Ciphertext is bound to its key
+	if err := inner.WriteState("other", raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadState("other"); err == nil {
+		t.Error("ReadState of value moved to another key succeeded")
+	}
+}
+
+// TestEncryptedStateStorePlaintext verifies state written before encryption
+// was enabled is still read
+func TestEncryptedStateStorePlaintext(t *testing.T) {
+	inner := new(mem.Store)
+	if err := inner.WriteState("_profiles", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newEncryptedStateStore(inner, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.ReadState("_profiles")
+	if err != nil || string(got) != `{}` {
+		t.Fatalf("ReadState of plaintext = %q, %v", got, err)
+	}
+
+	if _, err := s.ReadState("missing"); err != ipn.ErrStateNotExist {
+		t.Errorf("ReadState of missing key error = %v, want ErrStateNotExist", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+
+	"tailscale.com/ipn/ipnstate"
+)
+
+// tailnetURLs returns the node's MagicDNS name in st, the URL the app is
+// served on over the tailnet at port, and with funnel its public URL.
+// Without a MagicDNS name the tailnet URL uses the node's Tailscale IP.
+func tailnetURLs(st *ipnstate.Status, port string, funnel bool) (dnsName, url, funnelURL string) {
+	if st == nil || st.Self == nil {
+		return "", "", ""
+	}
+	dnsName = strings.TrimSuffix(st.Self.DNSName, ".")
+	host := dnsName
+	if host == "" {
+		if len(st.Self.TailscaleIPs) == 0 {
+			return "", "", ""
+		}
+		host = st.Self.TailscaleIPs[0].String()
+	}
+	url = "http://" + host
+	if port != "" && port != "80" {
+		url = "http://" + net.JoinHostPort(host, port)
+	}
+	// Funnel serves TLS on :443 with the node's certificate
+	if funnel && dnsName != "" {
+		funnelURL = "https://" + dnsName
+	}
+	return dnsName, url, funnelURL
+}
+
+// servedTailnetPort returns the port served on the tailnet, or "" before
+// tsnet is listening.
+func (s *Server) servedTailnetPort() string {
+	if p := s.tailnetPort.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// logTailnetURLs logs where the app can be reached once the node is up, so
+// demo scripts and people can find it without the admin console.
+func (s *Server) logTailnetURLs(ctx context.Context) {
+	st, err := s.client.StatusWithoutPeers(ctx)
+	if err != nil {
+		log.Printf("Warning: cannot look up the node's MagicDNS name: %v", err)
+		return
+	}
+	dnsName, url, funnelURL := tailnetURLs(st, s.servedTailnetPort(), s.funnel)
+	if dnsName == "" {
+		log.Printf("The node has no MagicDNS name; serving on the tailnet at %s", url)
+	} else {
+		log.Printf("Serving on the tailnet at %s (MagicDNS name %s)", url, dnsName)
+	}
+	if funnelURL != "" {
+		log.Printf("Serving publicly over Funnel at %s", funnelURL)
+	}
+}
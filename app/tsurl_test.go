@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/ipn/ipnstate"
+)
+
+// TestTailnetURLs verifies the tailnet and Funnel URLs use the MagicDNS
+// name, falling back to the Tailscale IP
+func TestTailnetURLs(t *testing.T) {
+	self := &ipnstate.PeerStatus{DNSName: "demo.tailnet-1234.ts.net.", TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.9")}}
+	for _, tc := range []struct {
+		name             string
+		self             *ipnstate.PeerStatus
+		port             string
+		funnel           bool
+		dns, url, pubURL string
+	}{
+		{"default port", self, "80", false, "demo.tailnet-1234.ts.net", "http://demo.tailnet-1234.ts.net", ""},
+		{"other port", self, "8080", false, "demo.tailnet-1234.ts.net", "http://demo.tailnet-1234.ts.net:8080", ""},
+		{"funnel", self, "80", true, "demo.tailnet-1234.ts.net", "http://demo.tailnet-1234.ts.net", "https://demo.tailnet-1234.ts.net"},
+		{"no MagicDNS name", &ipnstate.PeerStatus{TailscaleIPs: self.TailscaleIPs}, "8080", true, "", "http://100.64.0.9:8080", ""},
+		{"not up", nil, "8080", true, "", "", ""},
+	} {
+		dns, url, pubURL := tailnetURLs(&ipnstate.Status{Self: tc.self}, tc.port, tc.funnel)
+		if dns != tc.dns || url != tc.url || pubURL != tc.pubURL {
+			t.Errorf("%s: got %q %q %q, want %q %q %q", tc.name, dns, url, pubURL, tc.dns, tc.url, tc.pubURL)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+const (
+	// userFlushInterval is how often seen users are written to the
+	// database. Requests in between are counted in memory, so a busy user
+	// costs one upsert per interval rather than one per request.
+	userFlushInterval = 10 * time.Second
+
+	usersPageDefault = 100
+	usersPageMax     = 1000
+)
+
+// userTracker records which Tailscale logins use the app, when, and how
+// often, in the users table.
+type userTracker struct {
+	store *store.Store
+	clock Clock
+
+	mu      sync.Mutex
+	pending map[string]*store.User
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newUserTracker(st *store.Store, clock Clock) *userTracker {
+	t := &userTracker{
+		store:   st,
+		clock:   clock,
+		pending: map[string]*store.User{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// seen counts a request by login.
+func (t *userTracker) seen(login, displayName string) {
+	now := t.clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.pending[login]
+	if !ok {
+		u = &store.User{Login: login, FirstSeen: now}
+		t.pending[login] = u
+	}
+	if displayName != "" {
+		u.DisplayName = displayName
+	}
+	u.LastSeen = now
+	u.RequestCount++
+}
+
+func (t *userTracker) run() {
+	defer close(t.done)
+	for {
+		select {
+		case <-t.clock.After(userFlushInterval):
+			t.flush()
+		case <-t.stop:
+			t.flush()
+			return
+		}
+	}
+}
+
+// flush writes the pending visits. If that fails they are kept and merged
+// with later ones, so a database outage delays the counts but does not
+// lose them.
+func (t *userTracker) flush() {
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	visits := make([]store.User, 0, len(t.pending))
+	for _, u := range t.pending {
+		visits = append(visits, *u)
+	}
+	t.pending = map[string]*store.User{}
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.store.RecordUserVisits(ctx, visits); err != nil {
+		log.Printf("Failed to record %d users: %v", len(visits), err)
+		t.requeue(visits)
+	}
+}
+
+// requeue merges visits that could not be written back into pending.
+func (t *userTracker) requeue(visits []store.User) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, v := range visits {
+		u, ok := t.pending[v.Login]
+		if !ok {
+			v := v
+			t.pending[v.Login] = &v
+			continue
+		}
+		u.FirstSeen = v.FirstSeen
+		if u.DisplayName == "" {
+			u.DisplayName = v.DisplayName
+		}
+		u.RequestCount += v.RequestCount
+	}
+}
+
+// Close writes any pending visits and stops the tracker.
+func (t *userTracker) Close() {
+	close(t.stop)
+	<-t.done
+}
+
+// trackUsers counts every request made with a Tailscale identity, as
+// tailscaleWhois resolves it; logins in headers a peer sent are not seen.
+func (s *Server) trackUsers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t := s.users; t != nil {
+			if who, err := s.tailscaleWhois(r.Context(), r); err == nil && who.LoginName != "" {
+				t.seen(who.LoginName, who.DisplayName)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// usersHandler lists the users seen, most recent first.
+func (s *Server) usersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.users == nil {
+		http.Error(w, `{"error": "User tracking is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := usersPageDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > usersPageMax {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", usersPageMax))
+			return
+		}
+		limit = n
+	}
+
+	ctx := r.Context()
+
+	users, err := s.store.Users(ctx, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query users: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(users)
+}
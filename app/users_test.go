@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jaxxstorm/tailscale-actions-demo/store"
+)
+
+// TestUserTrackerCountsRequests verifies only identified callers are
+// counted, and a failed flush is merged into later visits
+func TestUserTrackerCountsRequests(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	tr := &userTracker{clock: clock, pending: map[string]*store.User{}}
+	s := &Server{users: tr}
+	h := s.trackUsers(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(login, name string) {
+		r := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+		if login != "" {
+			asServeUser(r, login)
+			r.Header.Set("Tailscale-User-Name", name)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	first := clock.Now()
+	request("alice@example.com", "Alice")
+	clock.Advance(time.Second)
+	request("alice@example.com", "")
+	request("", "")
+	h.ServeHTTP(httptest.NewRecorder(), asSpoofedUser(httptest.NewRequest(http.MethodGet, "/api/products", nil), "mallory@example.com"))
+
+	if len(tr.pending) != 1 {
+		t.Fatalf("pending = %v, want only alice", tr.pending)
+	}
+	got := *tr.pending["alice@example.com"]
+	want := store.User{Login: "alice@example.com", DisplayName: "Alice", FirstSeen: first, LastSeen: clock.Now(), RequestCount: 2}
+	if got != want {
+		t.Errorf("pending alice = %+v, want %+v", got, want)
+	}
+
+	// A failed flush is merged into visits made since
+	tr.pending = map[string]*store.User{}
+	clock.Advance(time.Second)
+	request("alice@example.com", "")
+	tr.requeue([]store.User{got})
+	merged := *tr.pending["alice@example.com"]
+	want = store.User{Login: "alice@example.com", DisplayName: "Alice", FirstSeen: first, LastSeen: clock.Now(), RequestCount: 3}
+	if merged != want {
+		t.Errorf("requeued alice = %+v, want %+v", merged, want)
+	}
+}
+
+// TestUsersHandlerErrors verifies /api/users answers 503 when disabled and 400 for a bad limit
+func TestUsersHandlerErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Server{}).usersHandler(w, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("disabled: status %d, want 503", w.Code)
+	}
+
+	s := &Server{users: &userTracker{}}
+	for _, limit := range []string{"0", "1001", "x"} {
+		w := httptest.NewRecorder()
+		s.usersHandler(w, httptest.NewRequest(http.MethodGet, "/api/users?limit="+limit, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: status %d, want 400", limit, w.Code)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// VaultConfig configures SECRETS_PROVIDER=vault. The token should outlive
+// the process: a periodic token, or one kept fresh by a Vault Agent.
+type VaultConfig struct {
+	Addr      string `env:"VAULT_ADDR" default:"https://127.0.0.1:8200" help:"Vault server address"`
+	Token     string `env:"VAULT_TOKEN" help:"Vault token; its policy needs read on the secrets and database credentials used"`
+	Namespace string `env:"VAULT_NAMESPACE" help:"Vault Enterprise namespace"`
+	DBCreds   string `name:"db-creds" env:"VAULT_DB_CREDS" placeholder:"PATH" help:"Use dynamic database credentials from this Vault path (e.g. database/creds/demo) instead of DB_USER and DB_PASSWORD; the lease is renewed, and new credentials issued before it runs out"`
+}
+
+var (
+	vaultOnce   sync.Once
+	vaultShared *vaultClient
+	vaultErr    error
+)
+
+// sharedVault returns the process's vaultClient, so that every DBConfig
+// copy reading the same secret fetches it once.
+func sharedVault(c VaultConfig) (*vaultClient, error) {
+	vaultOnce.Do(func() {
+		if c.Token == "" {
+			vaultErr = errors.New("SECRETS_PROVIDER=vault needs VAULT_TOKEN")
+			return
+		}
+		vaultShared = newVaultClient(c)
+	})
+	return vaultShared, vaultErr
+}
+
+// vaultClient reads from Vault's HTTP API, caching static secrets. Like
+// the AWS provider it makes the few calls it needs itself rather than
+// pulling in the Vault SDK.
+type vaultClient struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newVaultClient(c VaultConfig) *vaultClient {
+	return &vaultClient{
+		addr:      strings.TrimSuffix(c.Addr, "/"),
+		token:     c.Token,
+		namespace: c.Namespace,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		cache:     map[string]string{},
+	}
+}
+
+// vaultSecret is Vault's response to a read or lease renewal.
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+// get resolves ref, a secret path such as secret/data/demo (KV version 2)
+// or kv/demo (version 1). A #KEY suffix picks that field; it may be left
+// off when the secret has a single field.
+func (v *vaultClient) get(ctx context.Context, ref string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.cache[ref]; ok {
+		return s, nil
+	}
+
+	path, key, _ := strings.Cut(ref, "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", fmt.Errorf("%q must be a Vault secret path such as secret/data/demo#password", ref)
+	}
+	var secret vaultSecret
+	if err := v.do(ctx, http.MethodGet, path, nil, &secret); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	fields := secret.Data
+	if inner, ok := fields["data"].(map[string]interface{}); ok && fields["metadata"] != nil {
+		// KV version 2 nests the secret under data
+		fields = inner
+	}
+	if key == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("%s has %d fields; pick one with #KEY", path, len(fields))
+		}
+		for k := range fields {
+			key = k
+		}
+	}
+	f, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%s has no %q field", path, key)
+	}
+	s := fmt.Sprint(f)
+	if s == "" {
+		return "", fmt.Errorf("%s is empty", ref)
+	}
+	v.cache[ref] = s
+	return s, nil
+}
+
+// do sends a request to /v1/path and decodes the response into out, which
+// may be nil, explaining Vault's errors.
+func (v *vaultClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, _ := json.Marshal(in)
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+"/v1/"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 == 2 {
+		if out == nil || len(b) == 0 {
+			return nil
+		}
+		return json.Unmarshal(b, out)
+	}
+
+	var apiErr struct {
+		Errors []string `json:"errors"`
+	}
+	json.Unmarshal(b, &apiErr)
+	msg := strings.Join(apiErr.Errors, "; ")
+	switch resp.StatusCode {
+	case http.StatusForbidden:
+		capability := "read"
+		if method != http.MethodGet {
+			capability = "update"
+		}
+		return fmt.Errorf("permission denied: the token's policy needs %s on %s (or the token has expired)", capability, path)
+	case http.StatusNotFound:
+		return errors.New("not found in Vault")
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(string(b))
+	}
+	return fmt.Errorf("%s: %s", resp.Status, msg)
+}
+
+// dbLogin is a database username and password.
+type dbLogin struct {
+	User     string
+	Password string
+}
+
+// vaultDBCreds are dynamic database credentials from a Vault database
+// secrets engine role. A background loop renews their lease and, once the
+// role's max TTL stops it being extended, issues new credentials; the
+// superseded lease is left to expire, so connections still using it are
+// not cut off early.
+type vaultDBCreds struct {
+	vault *vaultClient
+	path  string
+	clock Clock
+
+	login atomic.Pointer[dbLogin]
+
+	// firstTTL is the first lease's duration
+	firstTTL time.Duration
+
+	// lease state, owned by the renewal loop once it starts
+	leaseID   string
+	ttl       time.Duration // the lease duration when issued
+	remaining time.Duration
+	renewable bool
+
+	mu       sync.Mutex
+	onChange []func()
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newVaultDBCreds issues credentials from path and starts renewing them.
+func newVaultDBCreds(ctx context.Context, vault *vaultClient, path string, clock Clock) (*vaultDBCreds, error) {
+	c := &vaultDBCreds{
+		vault: vault,
+		path:  strings.Trim(path, "/"),
+		clock: clock,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if err := c.issue(ctx); err != nil {
+		return nil, err
+	}
+	c.firstTTL = c.ttl
+	if c.ttl == 0 {
+		// A lease without a duration never expires
+		close(c.done)
+		return c, nil
+	}
+	go c.renewLoop(c.remaining * 2 / 3)
+	return c, nil
+}
+
+// Get returns the current credentials.
+func (c *vaultDBCreds) Get() dbLogin {
+	return *c.login.Load()
+}
+
+// TTL returns the duration of the first lease.
+func (c *vaultDBCreds) TTL() time.Duration {
+	return c.firstTTL
+}
+
+// notify registers fn to run after new credentials are issued.
+func (c *vaultDBCreds) notify(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = append(c.onChange, fn)
+}
+
+// issue reads new credentials and swaps them in.
+func (c *vaultDBCreds) issue(ctx context.Context) error {
+	var secret vaultSecret
+	if err := c.vault.do(ctx, http.MethodGet, c.path, nil, &secret); err != nil {
+		return fmt.Errorf("VAULT_DB_CREDS %s: %w", c.path, err)
+	}
+	user, _ := secret.Data["username"].(string)
+	password, _ := secret.Data["password"].(string)
+	if user == "" || password == "" {
+		return fmt.Errorf("VAULT_DB_CREDS %s: response has no username and password; is it a database secrets engine creds path?", c.path)
+	}
+
+	old := c.login.Swap(&dbLogin{User: user, Password: password})
+	c.leaseID = secret.LeaseID
+	c.ttl = time.Duration(secret.LeaseDuration) * time.Second
+	c.remaining = c.ttl
+	c.renewable = secret.Renewable
+	log.Printf("Vault issued database user %s (lease %s, %s)", user, c.leaseID, c.ttl)
+
+	if old != nil {
+		c.mu.Lock()
+		onChange := c.onChange
+		c.mu.Unlock()
+		for _, fn := range onChange {
+			fn()
+		}
+	}
+	return nil
+}
+
+// refresh renews the lease, or issues new credentials if it cannot be
+// renewed for at least a third of its original duration, and returns how
+// long to wait before the next refresh.
+func (c *vaultDBCreds) refresh(ctx context.Context) time.Duration {
+	if c.renewable {
+		var secret vaultSecret
+		err := c.vault.do(ctx, http.MethodPut, "sys/leases/renew", map[string]interface{}{
+			"lease_id":  c.leaseID,
+			"increment": int64(c.ttl / time.Second),
+		}, &secret)
+		if err != nil {
+			log.Printf("Renewing Vault lease %s: %v", c.leaseID, err)
+		} else if d := time.Duration(secret.LeaseDuration) * time.Second; d >= c.ttl/3 {
+			c.remaining = d
+			return d * 2 / 3
+		}
+	}
+
+	if err := c.issue(ctx); err != nil {
+		// Keep the current credentials until they run out
+		log.Printf("Warning: %v", err)
+		return 10 * time.Second
+	}
+	return c.remaining * 2 / 3
+}
+
+// renewLoop refreshes the credentials after wait, and then at two thirds
+// of each lease, until close is called.
+func (c *vaultDBCreds) renewLoop(wait time.Duration) {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-c.clock.After(wait):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		wait = c.refresh(ctx)
+		cancel()
+	}
+}
+
+// close stops renewing and revokes the current lease, so the database user
+// is dropped as soon as the server exits rather than when the lease runs
+// out.
+func (c *vaultDBCreds) close() {
+	close(c.stop)
+	<-c.done
+	if c.leaseID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.vault.do(ctx, http.MethodPut, "sys/leases/revoke", map[string]string{"lease_id": c.leaseID}, nil); err != nil {
+		log.Printf("Revoking Vault lease %s: %v", c.leaseID, err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault serves KV secrets, dynamic database credentials and lease
+// renewal. Leases renew for the full hour until maxTTL has been used.
+type fakeVault struct {
+	mu      sync.Mutex
+	issued  int
+	renewed int
+	revoked []string
+	maxTTL  int64
+	used    int64
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("X-Vault-Token") != "s.demo" || r.Header.Get("X-Vault-Namespace") != "team" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+	var in map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&in)
+	enc := json.NewEncoder(w)
+	switch r.Method + " " + r.URL.Path {
+	case "GET /v1/secret/data/demo":
+		enc.Encode(map[string]interface{}{"data": map[string]interface{}{
+			"data":     map[string]string{"password": "hunter2", "authkey": "tskey-auth-vault"},
+			"metadata": map[string]int{"version": 3},
+		}})
+	case "GET /v1/kv/single":
+		enc.Encode(map[string]interface{}{"data": map[string]string{"value": "only"}})
+	case "GET /v1/database/creds/demo":
+		f.issued++
+		f.used = 3600
+		enc.Encode(map[string]interface{}{
+			"lease_id":       "database/creds/demo/" + string(rune('a'+f.issued-1)),
+			"lease_duration": 3600,
+			"renewable":      true,
+			"data":           map[string]string{"username": "v-demo-" + string(rune('a'+f.issued-1)), "password": "pw"},
+		})
+	case "PUT /v1/sys/leases/renew":
+		f.renewed++
+		d := min(3600, f.maxTTL-f.used)
+		f.used += d
+		enc.Encode(map[string]interface{}{"lease_id": in["lease_id"], "lease_duration": d, "renewable": true})
+	case "PUT /v1/sys/leases/revoke":
+		f.revoked = append(f.revoked, in["lease_id"].(string))
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /v1/secret/data/denied":
+		w.WriteHeader(http.StatusForbidden)
+		enc.Encode(map[string][]string{"errors": {"1 error occurred:\n\t* permission denied\n\n"}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		enc.Encode(map[string][]string{"errors": {}})
+	}
+}
+
+// TestVaultGet verifies secrets are read from KV v1 and v2 paths, by key where one is given
+func TestVaultGet(t *testing.T) {
+	api := httptest.NewServer(&fakeVault{})
+	defer api.Close()
+	v := newVaultClient(VaultConfig{Addr: api.URL + "/", Token: "s.demo", Namespace: "team"})
+	ctx := context.Background()
+
+	for ref, want := range map[string]string{
+		"secret/data/demo#password": "hunter2",
+		"secret/data/demo#authkey":  "tskey-auth-vault",
+		"kv/single":                 "only",
+	} {
+		if got, err := v.get(ctx, ref); err != nil || got != want {
+			t.Errorf("%s = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+
+	for ref, want := range map[string]string{
+		"secret/data/demo":       "secret/data/demo has 2 fields; pick one with #KEY",
+		"secret/data/demo#token": `secret/data/demo has no "token" field`,
+		"secret/data/denied#x":   "secret/data/denied: permission denied: the token's policy needs read on secret/data/denied",
+		"secret/data/missing#x":  "secret/data/missing: not found in Vault",
+		"#password":              "must be a Vault secret path",
+	} {
+		if _, err := v.get(ctx, ref); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", ref, err, want)
+		}
+	}
+}
+
+// TestVaultDBCreds verifies dynamic database credentials are renewed, and
+// issued again once the lease reaches its max TTL
+func TestVaultDBCreds(t *testing.T) {
+	vault := &fakeVault{maxTTL: 3 * 3600}
+	api := httptest.NewServer(vault)
+	defer api.Close()
+	v := newVaultClient(VaultConfig{Addr: api.URL, Token: "s.demo", Namespace: "team"})
+	ctx := context.Background()
+
+	creds, err := newVaultDBCreds(ctx, v, "/database/creds/demo", newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := creds.Get(); got.User != "v-demo-a" || got.Password != "pw" || creds.TTL() != time.Hour {
+		t.Fatalf("issued %+v for %s", got, creds.TTL())
+	}
+	changed := 0
+	creds.notify(func() { changed++ })
+
+	// The 3h max TTL allows two full renewals; the third refresh finds it
+	// used up and issues new credentials
+	for i, want := range []struct {
+		user string
+		wait time.Duration
+	}{
+		{"v-demo-a", 40 * time.Minute},
+		{"v-demo-a", 40 * time.Minute},
+		{"v-demo-b", 40 * time.Minute},
+	} {
+		wait := creds.refresh(ctx)
+		if got := creds.Get().User; got != want.user || wait != want.wait {
+			t.Errorf("refresh %d: user %s, next in %s; want %s, %s", i, got, wait, want.user, want.wait)
+		}
+	}
+	if vault.renewed != 3 || vault.issued != 2 || changed != 1 {
+		t.Errorf("renewed %d, issued %d, notified %d; want 3, 2, 1", vault.renewed, vault.issued, changed)
+	}
+
+	creds.close()
+	if len(vault.revoked) != 1 || vault.revoked[0] != "database/creds/demo/b" {
+		t.Errorf("revoked %v, want only the current lease", vault.revoked)
+	}
+}
+
+// TestLoadVaultCreds verifies VAULT_DB_CREDS needs the vault provider and
+// excludes the other password settings
+func TestLoadVaultCreds(t *testing.T) {
+	for _, tc := range []struct {
+		c    DBConfig
+		want string
+	}{
+		{DBConfig{Vault: VaultConfig{DBCreds: "database/creds/demo"}}, "VAULT_DB_CREDS needs SECRETS_PROVIDER=vault"},
+		{DBConfig{SecretsProvider: "vault", DBPasswordSecret: "secret/data/demo#password", Vault: VaultConfig{DBCreds: "database/creds/demo"}}, "set one of DB_PASSWORD_FILE, DB_PASSWORD_SECRET and VAULT_DB_CREDS"},
+	} {
+		if err := tc.c.loadVaultCreds(); err == nil || err.Error() != tc.want {
+			t.Errorf("loadVaultCreds() = %v, want %q", err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...
+// -X main.buildTime=...". Without them commit and buildTime come from the
+// VCS stamp Go adds when building inside a git checkout.
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+// BuildInfo identifies the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Tailscale string `json:"tailscale,omitempty"` // tailscale.com module version
+}
+
+// readBuildInfo combines the ldflags with the module's embedded build info.
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == "tailscale.com" {
+			info.Tailscale = dep.Version
+			if dep.Replace != nil {
+				info.Tailscale = dep.Replace.Version
+			}
+		}
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true" && commit == ""
+		}
+	}
+	return info
+}
+
+// VersionCmd prints the build version.
+type VersionCmd struct {
+	JSON bool `help:"Print the build info as JSON"`
+}
+
+func (c *VersionCmd) Run() error {
+	info := readBuildInfo()
+	if c.JSON {
+		return json.NewEncoder(os.Stdout).Encode(info)
+	}
+
+	fmt.Printf("tailscale-demo %s (%s)\n", info.Version, info.GoVersion)
+	if info.Commit != "" {
+		dirty := ""
+		if info.Modified {
+			dirty = " (modified)"
+		}
+		fmt.Printf("commit:    %s%s\n", info.Commit, dirty)
+	}
+	if info.BuildTime != "" {
+		fmt.Printf("built:     %s\n", info.BuildTime)
+	}
+	if info.Tailscale != "" {
+		fmt.Printf("tailscale: %s\n", info.Tailscale)
+	}
+	return nil
+}
+
+// versionHandler reports which build is running.
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readBuildInfo())
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+// TestVersionHandler verifies /version reports the commit and build time the binary was built with
+func TestVersionHandler(t *testing.T) {
+	defer func(c, b string) { commit, buildTime = c, b }(commit, buildTime)
+	commit, buildTime = "abc123", "2026-01-02T03:04:05Z"
+
+	w := httptest.NewRecorder()
+	(&Server{}).versionHandler(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var info BuildInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != version || info.Commit != "abc123" || info.BuildTime != "2026-01-02T03:04:05Z" || info.Modified {
+		t.Errorf("ldflags not reported: %+v", info)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("go_version = %q, want %q", info.GoVersion, runtime.Version())
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// dependency is one --wait-for entry: a named startup gate and how long to
+// wait for it.
+type dependency struct {
+	Name    string
+	Timeout time.Duration
+}
+
+// gateFunc blocks until a dependency is ready or timeout elapses.
+type gateFunc func(ctx context.Context, timeout time.Duration) error
+
+// knownDependencies are the names accepted by --wait-for.
+var knownDependencies = []string{"db", "tailscale", "redis"}
+
+// parseWaitFor parses --wait-for entries of the form name or name:timeout,
+// keeping their order. Entries without a timeout use def.
+func parseWaitFor(specs []string, def time.Duration) ([]dependency, error) {
+	var deps []dependency
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, timeoutStr, hasTimeout := strings.Cut(spec, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		known := false
+		for _, k := range knownDependencies {
+			known = known || k == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown --wait-for dependency %q (want one of %s)", name, strings.Join(knownDependencies, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("--wait-for lists %q more than once", name)
+		}
+		seen[name] = true
+
+		timeout := def
+		if hasTimeout {
+			d, err := time.ParseDuration(strings.TrimSpace(timeoutStr))
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid --wait-for timeout %q for %s", timeoutStr, name)
+			}
+			timeout = d
+		}
+		deps = append(deps, dependency{Name: name, Timeout: timeout})
+	}
+	return deps, nil
+}
+
+// hasDependency reports whether deps includes name.
+func hasDependency(deps []dependency, name string) bool {
+	for _, d := range deps {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForDependencies runs the gates for deps in order, stopping at the
+// first one that is not ready in time.
+func waitForDependencies(ctx context.Context, deps []dependency, gates map[string]gateFunc) error {
+	for i, d := range deps {
+		gate, ok := gates[d.Name]
+		if !ok {
+			return fmt.Errorf("%s is not available in this configuration", d.Name)
+		}
+
+		log.Printf("Waiting for %s (%d/%d, timeout %s)...", d.Name, i+1, len(deps), d.Timeout)
+		start := time.Now()
+		if err := gate(ctx, d.Timeout); err != nil {
+			return fmt.Errorf("%s not ready after %s: %w", d.Name, time.Since(start).Round(time.Millisecond), err)
+		}
+		log.Printf("%s is ready (%s)", d.Name, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// tcpGate waits until addr accepts TCP connections.
+func tcpGate(addr string) gateFunc {
+	return func(ctx context.Context, timeout time.Duration) error {
+		dial := func(ctx context.Context) error {
+			var d net.Dialer
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			c, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			return c.Close()
+		}
+		return retry(ctx, systemClock{}, newBackoff(500*time.Millisecond, 10*time.Second, newLockedRand(time.Now().UnixNano())), timeout, dial, nil)
+	}
+}
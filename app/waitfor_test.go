@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseWaitFor verifies WAIT_FOR names dependencies with optional timeouts
+func TestParseWaitFor(t *testing.T) {
+	got, err := parseWaitFor([]string{"tailscale:2m", " DB ", "redis:5s"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []dependency{
+		{Name: "tailscale", Timeout: 2 * time.Minute},
+		{Name: "db", Timeout: time.Minute},
+		{Name: "redis", Timeout: 5 * time.Second},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseWaitFor = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range [][]string{{"kafka"}, {"db", "db:5s"}, {"db:soon"}, {"db:-1s"}} {
+		if _, err := parseWaitFor(bad, time.Minute); err == nil {
+			t.Errorf("parseWaitFor(%q) succeeded", bad)
+		}
+	}
+}
+
+// TestWaitForDependenciesOrder verifies gates run in the listed order and
+// the first failure stops startup
+func TestWaitForDependenciesOrder(t *testing.T) {
+	var ran []string
+	gate := func(name string, err error) gateFunc {
+		return func(ctx context.Context, timeout time.Duration) error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+	gates := map[string]gateFunc{
+		"db":        gate("db", errors.New("connection refused")),
+		"tailscale": gate("tailscale", nil),
+		"redis":     gate("redis", nil),
+	}
+
+	deps := []dependency{{Name: "tailscale"}, {Name: "db"}, {Name: "redis"}}
+	err := waitForDependencies(context.Background(), deps, gates)
+	if err == nil || !strings.Contains(err.Error(), "db not ready") {
+		t.Errorf("Expected db failure, got %v", err)
+	}
+	if want := []string{"tailscale", "db"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("Gates ran %v, want %v", ran, want)
+	}
+
+	if err := waitForDependencies(context.Background(), []dependency{{Name: "redis"}}, map[string]gateFunc{}); err == nil {
+		t.Error("Expected an error for a dependency without a gate")
+	}
+}
+
+// TestTCPGate verifies the TCP gate waits until the address accepts connections
+func TestTCPGate(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	if err := tcpGate(addr)(context.Background(), time.Second); err != nil {
+		t.Errorf("Expected %s to be ready, got %v", addr, err)
+	}
+
+	ln.Close()
+	if err := tcpGate(addr)(context.Background(), 0); err == nil {
+		t.Errorf("Expected closed %s to fail", addr)
+	}
+}
@@ -0,0 +1,45 @@
+"""Smoke tests for the generated Python client against a running server.
+
+Run with `make clients-test API_URL=...`.
+"""
+
+import os
+import unittest
+from http import HTTPStatus
+
+from tailscale_demo_api_client import Client
+from tailscale_demo_api_client.api.default import (
+    get_api_categories,
+    get_api_products,
+    get_api_products_stats,
+    get_health,
+)
+
+API_URL = os.environ.get("API_URL", "http://localhost:8080")
+
+
+class SmokeTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.client = Client(base_url=API_URL, timeout=10.0)
+
+    def test_health(self):
+        resp = get_health.sync_detailed(client=self.client)
+        self.assertEqual(resp.status_code, HTTPStatus.OK, resp.content)
+
+    def test_products(self):
+        resp = get_api_products.sync_detailed(client=self.client)
+        self.assertEqual(resp.status_code, HTTPStatus.OK, resp.content)
+        self.assertIsInstance(resp.parsed, list)
+
+    def test_stats(self):
+        resp = get_api_products_stats.sync_detailed(client=self.client)
+        self.assertEqual(resp.status_code, HTTPStatus.OK, resp.content)
+
+    def test_categories(self):
+        resp = get_api_categories.sync_detailed(client=self.client)
+        self.assertEqual(resp.status_code, HTTPStatus.OK, resp.content)
+
+
+if __name__ == "__main__":
+    unittest.main()
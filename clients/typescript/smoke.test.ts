@@ -0,0 +1,34 @@
+// Smoke tests for the generated TypeScript client against a running
+// server. Run with `make clients-test API_URL=...`.
+import assert from "node:assert/strict";
+import test from "node:test";
+
+import createClient from "openapi-fetch";
+import type { paths } from "./src/schema";
+
+const client = createClient<paths>({
+  baseUrl: process.env.API_URL ?? "http://localhost:8080",
+});
+
+test("health", async () => {
+  const { data, response } = await client.GET("/health");
+  assert.equal(response.status, 200);
+  assert.ok(data);
+});
+
+test("products", async () => {
+  const { data, response } = await client.GET("/api/products");
+  assert.equal(response.status, 200);
+  assert.ok(Array.isArray(data));
+});
+
+test("stats", async () => {
+  const { response } = await client.GET("/api/products/stats");
+  assert.equal(response.status, 200);
+});
+
+test("categories", async () => {
+  const { data, response } = await client.GET("/api/categories");
+  assert.equal(response.status, 200);
+  assert.ok(Array.isArray(data));
+});
@@ -5,7 +5,8 @@ set -euo pipefail
 # This script:
 # 1. Gets database credentials from AWS Secrets Manager
 # 2. Sets environment variables for tests
-# 3. Runs Go integration tests
+# 3. Seeds fixture data (SEED_DATASET, default small)
+# 4. Runs Go integration tests
 
 cd "$(dirname "$0")/.."
 
@@ -51,12 +52,17 @@ else
     echo "✅ Using TEST_API_URL: $TEST_API_URL"
 fi
 
+cd app
+
+echo ""
+echo "🌱 Seeding fixture data (${SEED_DATASET:-small})..."
+go run . seed --dataset="${SEED_DATASET:-small}"
+
 echo ""
 echo "🧪 Running integration tests..."
 echo ""
 
 # Run tests from app directory
-cd app
 go test -v -count=1 ./...
 
 echo ""